@@ -0,0 +1,190 @@
+package advertiser
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"github.com/cenkalti/backoff/v3"
+	"github.com/fichain/go-file/internal/logger"
+)
+
+// Status of the advertiser.
+type Status int
+
+const (
+	// NotAdvertised means that the torrent is not listed as a provider in the DHT.
+	// Either it has never been advertised successfully or the last record has expired.
+	NotAdvertised Status = iota
+	// Advertising is in progress and there is no valid record yet.
+	Advertising
+	// Advertised means that the provider record is valid. It is refreshed before the TTL runs out.
+	Advertised
+)
+
+func (s Status) String() string {
+	m := map[Status]string{
+		NotAdvertised: "Not Advertised",
+		Advertising:   "Advertising",
+		Advertised:    "Advertised",
+	}
+	return m[s]
+}
+
+// AdvertiseFunc publishes the provider record and returns how long the record is valid.
+type AdvertiseFunc func(ctx context.Context) (time.Duration, error)
+
+// Advertiser advertises the torrent in the DHT periodically.
+type Advertiser struct {
+	advertiseFunc AdvertiseFunc
+	advertising   bool
+	lastError     error
+	lastAdvertise time.Time
+	nextAdvertise time.Time
+	expiresAt     time.Time
+	backoff       backoff.BackOff
+	log           logger.Logger
+	statsCommandC chan statsRequest
+	ttlC          chan time.Duration
+	errC          chan error
+	closeC        chan struct{}
+	doneC         chan struct{}
+}
+
+// New returns a new Advertiser.
+func New(f AdvertiseFunc, minBackoff, maxBackoff time.Duration, l logger.Logger) *Advertiser {
+	return &Advertiser{
+		advertiseFunc: f,
+		log:           l,
+		statsCommandC: make(chan statsRequest),
+		ttlC:          make(chan time.Duration),
+		errC:          make(chan error),
+		closeC:        make(chan struct{}),
+		doneC:         make(chan struct{}),
+		backoff: &backoff.ExponentialBackOff{
+			InitialInterval:     minBackoff,
+			RandomizationFactor: 0.5,
+			Multiplier:          2,
+			MaxInterval:         maxBackoff,
+			MaxElapsedTime:      0, // never stop
+			Clock:               backoff.SystemClock,
+		},
+	}
+}
+
+// Close the advertiser. The record is not refreshed anymore after this call.
+func (a *Advertiser) Close() {
+	close(a.closeC)
+	<-a.doneC
+}
+
+type statsRequest struct {
+	Response chan Stats
+}
+
+// Stats about the advertiser.
+func (a *Advertiser) Stats() Stats {
+	var stats Stats
+	req := statsRequest{Response: make(chan Stats, 1)}
+	select {
+	case a.statsCommandC <- req:
+	case <-a.closeC:
+		return stats
+	}
+	select {
+	case stats = <-req.Response:
+	case <-a.closeC:
+	}
+	return stats
+}
+
+// Run the advertiser goroutine. Invoke with go statement.
+func (a *Advertiser) Run() {
+	defer close(a.doneC)
+	a.backoff.Reset()
+
+	timer := time.NewTimer(math.MaxInt64)
+	defer timer.Stop()
+
+	resetTimer := func(interval time.Duration) {
+		timer.Reset(interval)
+		a.nextAdvertise = time.Now().Add(interval)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	a.doAdvertise(ctx)
+	for {
+		select {
+		case <-timer.C:
+			if a.advertising {
+				break
+			}
+			a.doAdvertise(ctx)
+		case ttl := <-a.ttlC:
+			a.advertising = false
+			a.lastError = nil
+			a.expiresAt = a.lastAdvertise.Add(ttl)
+			a.backoff.Reset()
+			// Refresh the record before it expires.
+			resetTimer(ttl - ttl/8)
+		case err := <-a.errC:
+			a.advertising = false
+			a.lastError = err
+			a.log.Debugln("advertise error:", err)
+			resetTimer(a.backoff.NextBackOff())
+		case req := <-a.statsCommandC:
+			req.Response <- a.stats()
+		case <-a.closeC:
+			return
+		}
+	}
+}
+
+func (a *Advertiser) doAdvertise(ctx context.Context) {
+	a.advertising = true
+	a.lastAdvertise = time.Now()
+	go func() {
+		ttl, err := a.advertiseFunc(ctx)
+		if err != nil {
+			select {
+			case a.errC <- err:
+			case <-a.closeC:
+			}
+			return
+		}
+		select {
+		case a.ttlC <- ttl:
+		case <-a.closeC:
+		}
+	}()
+}
+
+// Stats about the advertiser.
+type Stats struct {
+	Status        Status
+	Error         error
+	LastAdvertise time.Time
+	NextAdvertise time.Time
+	// Time when the last published record expires.
+	ExpiresAt time.Time
+}
+
+func (a *Advertiser) stats() Stats {
+	s := Stats{
+		Error:         a.lastError,
+		LastAdvertise: a.lastAdvertise,
+		NextAdvertise: a.nextAdvertise,
+		ExpiresAt:     a.expiresAt,
+	}
+	switch {
+	case time.Now().Before(a.expiresAt):
+		s.Status = Advertised
+	case a.advertising:
+		s.Status = Advertising
+	default:
+		s.Status = NotAdvertised
+	}
+	return s
+}
@@ -0,0 +1,77 @@
+package advertiser
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/fichain/go-file/internal/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAdvertiserRefresh(t *testing.T) {
+	var calls int32
+	f := func(ctx context.Context) (time.Duration, error) {
+		atomic.AddInt32(&calls, 1)
+		return 100 * time.Millisecond, nil
+	}
+	a := New(f, 10*time.Millisecond, 10*time.Millisecond, logger.New("test"))
+	go a.Run()
+
+	time.Sleep(50 * time.Millisecond)
+	s := a.Stats()
+	assert.Equal(t, Advertised, s.Status)
+	assert.True(t, s.ExpiresAt.After(s.LastAdvertise))
+
+	// The record must be refreshed before it expires.
+	time.Sleep(300 * time.Millisecond)
+	assert.Equal(t, Advertised, a.Stats().Status)
+	assert.True(t, atomic.LoadInt32(&calls) >= 3)
+
+	a.Close()
+	n := atomic.LoadInt32(&calls)
+	time.Sleep(200 * time.Millisecond)
+	assert.Equal(t, n, atomic.LoadInt32(&calls))
+	assert.Equal(t, NotAdvertised, a.Stats().Status)
+}
+
+func TestAdvertiserBackoff(t *testing.T) {
+	errAdvertise := errors.New("failed to find any peer in table")
+	var calls int32
+	f := func(ctx context.Context) (time.Duration, error) {
+		if atomic.AddInt32(&calls, 1) <= 3 {
+			return 0, errAdvertise
+		}
+		return time.Hour, nil
+	}
+	a := New(f, 10*time.Millisecond, 20*time.Millisecond, logger.New("test"))
+	go a.Run()
+	defer a.Close()
+
+	time.Sleep(5 * time.Millisecond)
+	s := a.Stats()
+	assert.Equal(t, NotAdvertised, s.Status)
+	assert.Equal(t, errAdvertise, s.Error)
+
+	time.Sleep(200 * time.Millisecond)
+	s = a.Stats()
+	assert.Equal(t, Advertised, s.Status)
+	assert.NoError(t, s.Error)
+	assert.Equal(t, int32(4), atomic.LoadInt32(&calls))
+}
+
+func TestAdvertiserCloseCancelsAdvertise(t *testing.T) {
+	started := make(chan struct{})
+	f := func(ctx context.Context) (time.Duration, error) {
+		close(started)
+		<-ctx.Done()
+		return 0, ctx.Err()
+	}
+	a := New(f, time.Second, time.Second, logger.New("test"))
+	go a.Run()
+	<-started
+	assert.Equal(t, Advertising, a.Stats().Status)
+	a.Close()
+}
@@ -0,0 +1,132 @@
+package announcer
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/fichain/go-file/internal/logger"
+	"github.com/libp2p/go-libp2p-core/peer"
+)
+
+// FindPeersFunc starts a query for the peers of the torrent.
+// Found peers are sent to the returned channel and the channel is closed when the query finishes.
+type FindPeersFunc func(ctx context.Context) (<-chan peer.AddrInfo, error)
+
+// DHTAnnouncer queries the DHT periodically to find peers of the torrent.
+// Results are streamed to the peers channel as they arrive.
+type DHTAnnouncer struct {
+	lastAnnounce time.Time
+	peersNeeded  int
+	mPeersNeeded sync.Mutex
+	peersNeededC chan struct{}
+	closeC       chan struct{}
+	doneC        chan struct{}
+}
+
+// NewDHTAnnouncer returns a new DHTAnnouncer.
+func NewDHTAnnouncer(peersNeeded int) *DHTAnnouncer {
+	return &DHTAnnouncer{
+		peersNeeded:  peersNeeded,
+		peersNeededC: make(chan struct{}, 1),
+		closeC:       make(chan struct{}),
+		doneC:        make(chan struct{}),
+	}
+}
+
+// Close the announcer. Running query is cancelled.
+func (a *DHTAnnouncer) Close() {
+	close(a.closeC)
+	<-a.doneC
+}
+
+// NeedMorePeers sets the number of peers that the torrent needs.
+// The more peers are needed, the more frequent the DHT is queried.
+// It never blocks, so it is safe to call from the torrent loop.
+func (a *DHTAnnouncer) NeedMorePeers(n int) {
+	a.mPeersNeeded.Lock()
+	a.peersNeeded = n
+	a.mPeersNeeded.Unlock()
+	select {
+	case a.peersNeededC <- struct{}{}:
+	default:
+	}
+}
+
+// Run the announcer. Invoke with go statement.
+// The query interval is minInterval when maxPeers or more peers are needed, interval when no peers are needed
+// and scaled linearly between them. A single query runs at most queryTimeout.
+func (a *DHTAnnouncer) Run(findPeers FindPeersFunc, peersC chan []peer.AddrInfo, interval, minInterval, queryTimeout time.Duration, maxPeers int, l logger.Logger) {
+	defer close(a.doneC)
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	resetTimer := func() {
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(time.Until(a.lastAnnounce.Add(a.nextInterval(interval, minInterval, maxPeers))))
+	}
+
+	var (
+		resultC <-chan peer.AddrInfo
+		cancel  context.CancelFunc = func() {}
+	)
+	defer func() { cancel() }()
+
+	for {
+		select {
+		case <-timer.C:
+			if resultC != nil {
+				break
+			}
+			ctx, cancelQuery := context.WithTimeout(context.Background(), queryTimeout)
+			cancel = cancelQuery
+			a.lastAnnounce = time.Now()
+			var err error
+			resultC, err = findPeers(ctx)
+			if err != nil {
+				l.Errorln("cannot find peers in dht:", err)
+				cancel()
+				resultC = nil
+				resetTimer()
+			}
+		case addr, ok := <-resultC:
+			if !ok {
+				cancel()
+				resultC = nil
+				resetTimer()
+				break
+			}
+			select {
+			case peersC <- []peer.AddrInfo{addr}:
+			case <-a.closeC:
+				return
+			}
+		case <-a.peersNeededC:
+			if resultC != nil {
+				break
+			}
+			resetTimer()
+		case <-a.closeC:
+			return
+		}
+	}
+}
+
+func (a *DHTAnnouncer) nextInterval(interval, minInterval time.Duration, maxPeers int) time.Duration {
+	a.mPeersNeeded.Lock()
+	n := a.peersNeeded
+	a.mPeersNeeded.Unlock()
+	if n <= 0 || maxPeers <= 0 {
+		return interval
+	}
+	if n >= maxPeers {
+		return minInterval
+	}
+	return interval - (interval-minInterval)*time.Duration(n)/time.Duration(maxPeers)
+}
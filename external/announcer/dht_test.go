@@ -0,0 +1,88 @@
+package announcer
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/fichain/go-file/internal/logger"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDHTAnnouncerStreamsResults(t *testing.T) {
+	ctxC := make(chan context.Context, 1)
+	findPeers := func(ctx context.Context) (<-chan peer.AddrInfo, error) {
+		ctxC <- ctx
+		ch := make(chan peer.AddrInfo)
+		go func() {
+			defer close(ch)
+			for _, id := range []peer.ID{"a", "b"} {
+				select {
+				case ch <- peer.AddrInfo{ID: id}:
+				case <-ctx.Done():
+					return
+				}
+			}
+			// Query continues until it is cancelled.
+			<-ctx.Done()
+		}()
+		return ch, nil
+	}
+	peersC := make(chan []peer.AddrInfo)
+	a := NewDHTAnnouncer(10)
+	go a.Run(findPeers, peersC, time.Hour, time.Hour, time.Hour, 10, logger.New("test"))
+
+	// Results arrive while the query is still running.
+	assert.Equal(t, peer.ID("a"), (<-peersC)[0].ID)
+	assert.Equal(t, peer.ID("b"), (<-peersC)[0].ID)
+
+	// Closing the announcer cancels the query.
+	ctx := <-ctxC
+	a.Close()
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("query is not cancelled")
+	}
+}
+
+func TestDHTAnnouncerInterval(t *testing.T) {
+	a := NewDHTAnnouncer(0)
+	assert.Equal(t, time.Hour, a.nextInterval(time.Hour, time.Minute, 50))
+	a.NeedMorePeers(50)
+	assert.Equal(t, time.Minute, a.nextInterval(time.Hour, time.Minute, 50))
+	a.NeedMorePeers(100)
+	assert.Equal(t, time.Minute, a.nextInterval(time.Hour, time.Minute, 50))
+	a.NeedMorePeers(25)
+	assert.Equal(t, 30*time.Minute+30*time.Second, a.nextInterval(time.Hour, time.Minute, 50))
+}
+
+func TestDHTAnnouncerRepeatsQuery(t *testing.T) {
+	queries := make(chan struct{}, 10)
+	findPeers := func(ctx context.Context) (<-chan peer.AddrInfo, error) {
+		queries <- struct{}{}
+		ch := make(chan peer.AddrInfo)
+		close(ch)
+		return ch, nil
+	}
+	a := NewDHTAnnouncer(0)
+	go a.Run(findPeers, make(chan []peer.AddrInfo), time.Hour, 10*time.Millisecond, time.Hour, 10, logger.New("test"))
+	defer a.Close()
+	<-queries
+
+	// No peers are needed, next query is an hour later.
+	select {
+	case <-queries:
+		t.Fatal("unexpected query")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// Needing peers makes the next query happen sooner.
+	a.NeedMorePeers(10)
+	select {
+	case <-queries:
+	case <-time.After(time.Second):
+		t.Fatal("query is not repeated")
+	}
+}
@@ -0,0 +1,80 @@
+package dialer
+
+import (
+	"time"
+
+	"github.com/cenkalti/backoff/v3"
+	"github.com/libp2p/go-libp2p-core/peer"
+)
+
+// Backoff keeps track of failed dials and tells when a peer can be dialed again.
+// Wait duration grows exponentially for each consecutive failure of the same peer.
+type Backoff struct {
+	minInterval time.Duration
+	maxInterval time.Duration
+	peers       map[peer.ID]*peerBackoff
+}
+
+type peerBackoff struct {
+	backoff backoff.BackOff
+	retryAt time.Time
+}
+
+// NewBackoff returns a new Backoff.
+func NewBackoff(minInterval, maxInterval time.Duration) *Backoff {
+	return &Backoff{
+		minInterval: minInterval,
+		maxInterval: maxInterval,
+		peers:       make(map[peer.ID]*peerBackoff),
+	}
+}
+
+// Allowed returns true if the peer can be dialed at time now.
+func (b *Backoff) Allowed(id peer.ID, now time.Time) bool {
+	pb, ok := b.peers[id]
+	if !ok {
+		return true
+	}
+	// Forget the failures if the peer has not been tried for a long time.
+	if now.After(pb.retryAt.Add(b.maxInterval)) {
+		delete(b.peers, id)
+		return true
+	}
+	return !now.Before(pb.retryAt)
+}
+
+// Failed records a failed dial and returns the time of the next allowed dial.
+func (b *Backoff) Failed(id peer.ID, now time.Time) time.Time {
+	pb, ok := b.peers[id]
+	if !ok {
+		pb = &peerBackoff{
+			backoff: &backoff.ExponentialBackOff{
+				InitialInterval:     b.minInterval,
+				RandomizationFactor: 0.5,
+				Multiplier:          2,
+				MaxInterval:         b.maxInterval,
+				MaxElapsedTime:      0, // never stop
+				Clock:               backoff.SystemClock,
+			},
+		}
+		pb.backoff.Reset()
+		b.peers[id] = pb
+	}
+	pb.retryAt = now.Add(pb.backoff.NextBackOff())
+	return pb.retryAt
+}
+
+// Succeeded resets the failures of the peer.
+func (b *Backoff) Succeeded(id peer.ID) {
+	delete(b.peers, id)
+}
+
+// Len returns the number of peers in backoff state.
+func (b *Backoff) Len() int {
+	return len(b.peers)
+}
+
+// Reset forgets all failures.
+func (b *Backoff) Reset() {
+	b.peers = make(map[peer.ID]*peerBackoff)
+}
@@ -0,0 +1,132 @@
+package dialer
+
+import (
+	"context"
+	"time"
+
+	"github.com/fichain/go-file/external/p2p"
+	"github.com/fichain/go-file/external/peersource"
+	"github.com/fichain/go-file/internal/logger"
+	"github.com/libp2p/go-libp2p-core/host"
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/peerstore"
+	"github.com/libp2p/go-libp2p-core/protocol"
+)
+
+// Dialer connects to a peer, opens a transfer stream and requests the torrent with the handshake.
+type Dialer struct {
+	Addr   *peer.AddrInfo
+	Source peersource.Source
+	Stream network.Stream
+	Error  error
+
+	closeC chan struct{}
+	doneC  chan struct{}
+}
+
+// New returns a new Dialer for a peer address.
+func New(addr *peer.AddrInfo, source peersource.Source) *Dialer {
+	return &Dialer{
+		Addr:   addr,
+		Source: source,
+		closeC: make(chan struct{}),
+		doneC:  make(chan struct{}),
+	}
+}
+
+// Close the dialer. Dial in progress is cancelled.
+func (d *Dialer) Close() {
+	close(d.closeC)
+	<-d.doneC
+}
+
+// Run the dialer. Invoke with go statement.
+// The connection must be established in dialTimeout.
+// The stream must be opened and accepted by the peer in handshakeTimeout.
+// protos are offered to the peer in order, the first one supported by the peer is used.
+func (d *Dialer) Run(h host.Host, protos []protocol.ID, infoHash [20]byte, dialTimeout, handshakeTimeout time.Duration, resultC chan *Dialer) {
+	defer close(d.doneC)
+	log := logger.New("peer -> " + d.Addr.ID.Pretty())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-d.closeC:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	d.Stream, d.Error = d.dial(ctx, h, protos, infoHash, dialTimeout, handshakeTimeout)
+	if d.Error != nil {
+		log.Debugln("cannot dial peer:", d.Error)
+	}
+
+	select {
+	case resultC <- d:
+	case <-d.closeC:
+		if d.Stream != nil {
+			d.Stream.Reset()
+		}
+	}
+}
+
+func (d *Dialer) dial(ctx context.Context, h host.Host, protos []protocol.ID, infoHash [20]byte, dialTimeout, handshakeTimeout time.Duration) (network.Stream, error) {
+	// Addresses must be in the peerstore, otherwise the host cannot open a stream to the peer.
+	h.Peerstore().AddAddrs(d.Addr.ID, d.Addr.Addrs, peerstore.TempAddrTTL)
+
+	dctx, cancel := context.WithTimeout(ctx, dialTimeout)
+	err := h.Connect(dctx, *d.Addr)
+	cancel()
+	if err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(handshakeTimeout)
+	sctx, cancel := context.WithDeadline(ctx, deadline)
+	defer cancel()
+	stream, err := h.NewStream(sctx, d.Addr.ID, protos...)
+	if err != nil {
+		return nil, err
+	}
+	err = handshake(sctx, stream, infoHash, deadline)
+	if err != nil {
+		stream.Reset()
+		return nil, err
+	}
+	return stream, nil
+}
+
+func handshake(ctx context.Context, stream network.Stream, infoHash [20]byte, deadline time.Time) error {
+	// Closing the dialer must interrupt a blocked handshake.
+	stop := make(chan struct{})
+	stopped := make(chan struct{})
+	defer func() {
+		close(stop)
+		<-stopped
+	}()
+	go func() {
+		defer close(stopped)
+		select {
+		case <-ctx.Done():
+			stream.SetDeadline(time.Now())
+		case <-stop:
+		}
+	}()
+
+	err := stream.SetDeadline(deadline)
+	if err != nil {
+		return err
+	}
+	err = p2p.WriteTransferHandshake(stream, infoHash)
+	if err != nil {
+		return err
+	}
+	err = p2p.ReadTransferResponse(stream)
+	if err != nil {
+		return err
+	}
+	return stream.SetDeadline(time.Time{})
+}
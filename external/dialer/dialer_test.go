@@ -0,0 +1,133 @@
+package dialer
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/fichain/go-file/external/p2p"
+	"github.com/fichain/go-file/external/peersource"
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p-core/host"
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/protocol"
+	"github.com/stretchr/testify/assert"
+)
+
+const testProtocol = "/filechain/test/1.0.0"
+
+func newTestHost(t *testing.T) host.Host {
+	h, err := libp2p.New(context.Background(), libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h
+}
+
+func TestDialer(t *testing.T) {
+	a := newTestHost(t)
+	defer a.Close()
+	b := newTestHost(t)
+	defer b.Close()
+	testInfoHash := [20]byte{1}
+	b.SetStreamHandler(testProtocol, func(s network.Stream) {
+		defer s.Close()
+		ih, err := p2p.ReadTransferHandshake(s)
+		if err != nil {
+			return
+		}
+		if ih != testInfoHash {
+			_ = p2p.WriteTransferResponse(s, "unknown torrent")
+			return
+		}
+		_ = p2p.WriteTransferResponse(s, "")
+	})
+
+	// Addresses are not in the peerstore of a, dialer must add them.
+	resultC := make(chan *Dialer, 1)
+	d := New(&peer.AddrInfo{ID: b.ID(), Addrs: b.Addrs()}, peersource.DHT)
+	go d.Run(a, []protocol.ID{testProtocol}, testInfoHash, time.Second, time.Second, resultC)
+	res := <-resultC
+	if !assert.NoError(t, res.Error) {
+		return
+	}
+	assert.Equal(t, b.ID(), res.Stream.Conn().RemotePeer())
+	assert.Equal(t, peersource.DHT, res.Source)
+	res.Stream.Close()
+
+	// Peer does not have the torrent.
+	d = New(&peer.AddrInfo{ID: b.ID(), Addrs: b.Addrs()}, peersource.DHT)
+	go d.Run(a, []protocol.ID{testProtocol}, [20]byte{2}, time.Second, time.Second, resultC)
+	res = <-resultC
+	if assert.IsType(t, &p2p.TransferRejectedError{}, res.Error) {
+		assert.Equal(t, "unknown torrent", res.Error.(*p2p.TransferRejectedError).Reason)
+	}
+	assert.Nil(t, res.Stream)
+
+	// Stream cannot be opened for a protocol that is not handled by the peer.
+	d = New(&peer.AddrInfo{ID: b.ID(), Addrs: b.Addrs()}, peersource.DHT)
+	go d.Run(a, []protocol.ID{"/filechain/unknown/1.0.0"}, testInfoHash, time.Second, time.Second, resultC)
+	res = <-resultC
+	assert.Error(t, res.Error)
+	assert.Nil(t, res.Stream)
+}
+
+func TestDialerTimeout(t *testing.T) {
+	a := newTestHost(t)
+	defer a.Close()
+	b := newTestHost(t)
+	addrs := b.Addrs()
+	id := b.ID()
+	b.Close()
+
+	resultC := make(chan *Dialer, 1)
+	d := New(&peer.AddrInfo{ID: id, Addrs: addrs}, peersource.DHT)
+	start := time.Now()
+	go d.Run(a, []protocol.ID{testProtocol}, [20]byte{}, 100*time.Millisecond, time.Second, resultC)
+	res := <-resultC
+	assert.Error(t, res.Error)
+	assert.True(t, time.Since(start) < time.Second)
+}
+
+func TestDialerClose(t *testing.T) {
+	a := newTestHost(t)
+	defer a.Close()
+	b := newTestHost(t)
+	defer b.Close()
+
+	// Nobody reads the result, Close must not block.
+	d := New(&peer.AddrInfo{ID: b.ID(), Addrs: b.Addrs()}, peersource.DHT)
+	go d.Run(a, []protocol.ID{testProtocol}, [20]byte{}, time.Second, time.Second, make(chan *Dialer))
+	d.Close()
+}
+
+func TestBackoff(t *testing.T) {
+	b := NewBackoff(time.Second, time.Minute)
+	now := time.Now()
+	id := peer.ID("a")
+	assert.True(t, b.Allowed(id, now))
+
+	retryAt := b.Failed(id, now)
+	assert.True(t, retryAt.After(now))
+	assert.False(t, b.Allowed(id, now))
+	assert.True(t, b.Allowed(id, retryAt))
+	assert.True(t, b.Allowed(peer.ID("b"), now))
+
+	// Consecutive failures wait longer.
+	var prev time.Duration
+	for i := 0; i < 5; i++ {
+		prev = b.Failed(id, now).Sub(now)
+	}
+	assert.True(t, prev > 3*time.Second, prev)
+	assert.True(t, prev <= time.Minute+time.Minute/2, prev)
+
+	b.Succeeded(id)
+	assert.True(t, b.Allowed(id, now))
+	assert.Equal(t, 0, b.Len())
+
+	// Failures are forgotten after a long time.
+	retryAt = b.Failed(id, now)
+	assert.True(t, b.Allowed(id, retryAt.Add(2*time.Minute)))
+	assert.Equal(t, 0, b.Len())
+}
@@ -0,0 +1,134 @@
+package p2p
+
+import (
+	"context"
+	"time"
+
+	leveldb "github.com/ipfs/go-ds-leveldb"
+	connmgr "github.com/libp2p/go-libp2p-connmgr"
+	"github.com/libp2p/go-libp2p-core/host"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/pnet"
+	"github.com/libp2p/go-libp2p-core/protocol"
+	dht "github.com/libp2p/go-libp2p-kad-dht"
+)
+
+// BootstrapNodeConfig contains the settings of a bootstrap node.
+type BootstrapNodeConfig struct {
+	// File that contains the private key of the node. Generated on first run if missing.
+	KeyFile string
+	// Multiaddrs to listen on.
+	ListenAddrs []string
+	// Directory of the datastore that keeps DHT records across restarts.
+	DatastorePath string
+	// Private network key. See LoadPrivateNetworkKey.
+	PrivateNetworkKey string
+	// Other bootstrap nodes to connect on start.
+	BootstrapPeers []string
+	// Prefix of the DHT protocols. Must be the same with sessions. DefaultDHTProtocolPrefix is used if empty.
+	DHTProtocolPrefix string
+	// Connection manager limits.
+	ConnLowWater    int
+	ConnHighWater   int
+	ConnGracePeriod time.Duration
+}
+
+// BootstrapNode is a DHT server that helps sessions to find each other.
+type BootstrapNode struct {
+	Host      host.Host
+	DHT       *dht.IpfsDHT
+	datastore *leveldb.Datastore
+	startedAt time.Time
+}
+
+// BootstrapNodeStats contains statistics about a BootstrapNode.
+type BootstrapNodeStats struct {
+	ID                peer.ID
+	Addrs             []string
+	RoutingTablePeers int
+	ConnectedPeers    int
+	Uptime            time.Duration
+}
+
+// NewBootstrapNode starts a bootstrap node. It must be closed after use.
+func NewBootstrapNode(cfg BootstrapNodeConfig) (n *BootstrapNode, err error) {
+	priv, err := LoadOrCreateKey(cfg.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	var psk pnet.PSK
+	if cfg.PrivateNetworkKey != "" {
+		psk, err = LoadPrivateNetworkKey(cfg.PrivateNetworkKey)
+		if err != nil {
+			return nil, err
+		}
+	}
+	ds, err := leveldb.NewDatastore(cfg.DatastorePath, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			ds.Close()
+		}
+	}()
+	cm := connmgr.NewConnManager(cfg.ConnLowWater, cfg.ConnHighWater, cfg.ConnGracePeriod)
+	h, err := NewHost(cfg.ListenAddrs, priv, psk, cm, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			h.Close()
+		}
+	}()
+	d, err := NewDHT(context.Background(), h, protocol.ID(cfg.DHTProtocolPrefix), dht.ModeServer, dht.Datastore(ds))
+	if err != nil {
+		return nil, err
+	}
+	bpeers, err := ParseBootstrapPeers(cfg.BootstrapPeers)
+	if err != nil {
+		return nil, err
+	}
+	for _, pi := range bpeers {
+		cm.Protect(pi.ID, BootstrapProtectTag)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		err2 := h.Connect(ctx, pi)
+		cancel()
+		if err2 != nil {
+			logger.Warn(ConnectError(h, err2))
+		}
+	}
+	return &BootstrapNode{
+		Host:      h,
+		DHT:       d,
+		datastore: ds,
+		startedAt: time.Now(),
+	}, nil
+}
+
+// Stats returns statistics about the node.
+func (n *BootstrapNode) Stats() BootstrapNodeStats {
+	s := BootstrapNodeStats{
+		ID:                n.Host.ID(),
+		RoutingTablePeers: n.DHT.RoutingTable().Size(),
+		ConnectedPeers:    len(n.Host.Network().Peers()),
+		Uptime:            time.Since(n.startedAt),
+	}
+	for _, addr := range n.Host.Addrs() {
+		s.Addrs = append(s.Addrs, addr.String()+"/p2p/"+n.Host.ID().Pretty())
+	}
+	return s
+}
+
+// Close the node. DHT records are kept in the datastore.
+func (n *BootstrapNode) Close() error {
+	err := n.DHT.Close()
+	if err2 := n.Host.Close(); err == nil {
+		err = err2
+	}
+	if err2 := n.datastore.Close(); err == nil {
+		err = err2
+	}
+	return err
+}
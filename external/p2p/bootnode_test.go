@@ -0,0 +1,129 @@
+package p2p
+
+import (
+	"context"
+	"crypto/rand"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	connmgr "github.com/libp2p/go-libp2p-connmgr"
+	"github.com/libp2p/go-libp2p-core/crypto"
+	"github.com/libp2p/go-libp2p-core/host"
+	"github.com/libp2p/go-libp2p-core/peer"
+	discovery "github.com/libp2p/go-libp2p-discovery"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestBootstrapNode(t *testing.T, dir string) *BootstrapNode {
+	n, err := NewBootstrapNode(BootstrapNodeConfig{
+		KeyFile:         filepath.Join(dir, "identity.key"),
+		ListenAddrs:     []string{"/ip4/127.0.0.1/tcp/0"},
+		DatastorePath:   filepath.Join(dir, "datastore"),
+		ConnLowWater:    100,
+		ConnHighWater:   400,
+		ConnGracePeriod: time.Minute,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestBootstrapNodeKey(t *testing.T) {
+	dir, err := ioutil.TempDir("", "filechain-boot-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	n := newTestBootstrapNode(t, dir)
+	id := n.Host.ID()
+	assert.NoError(t, n.Close())
+	assert.FileExists(t, filepath.Join(dir, "identity.key"))
+
+	// The same key is used after restart.
+	n = newTestBootstrapNode(t, dir)
+	defer n.Close()
+	assert.Equal(t, id, n.Host.ID())
+}
+
+func TestBootstrapNodeDiscovery(t *testing.T) {
+	dir, err := ioutil.TempDir("", "filechain-boot-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	n := newTestBootstrapNode(t, dir)
+	defer n.Close()
+	boot := n.Stats().Addrs[0]
+
+	newSessionHost := func() host.Host {
+		priv, _, err := crypto.GenerateKeyPairWithReader(crypto.Ed25519, 0, rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		h, err := NewRoutedHost(0, []string{boot}, priv, nil, connmgr.NewConnManager(100, 400, time.Minute), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		peers, err := ParseBootstrapPeers([]string{boot})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ConnectBootstrapPeers(context.Background(), h, peers)
+		return h
+	}
+	a := newSessionHost()
+	defer a.Close()
+	b := newSessionHost()
+	defer b.Close()
+	da, _, err := NewRoutedDiscovery(a, "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, _, err := NewRoutedDiscovery(b, "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	// Wait until the bootstrap node is added to the routing table of the session.
+	for {
+		_, err = Advertise(ctx, da, "test-torrent")
+		if err == nil {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			t.Fatal(err)
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+	assert.Equal(t, 2, n.Stats().ConnectedPeers)
+
+	// The routing table of b may still be empty, retry until the provider is found.
+	for !findPeer(ctx, t, db, a.ID()) {
+		select {
+		case <-ctx.Done():
+			t.Fatal("provider is not found")
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+}
+
+func findPeer(ctx context.Context, t *testing.T, d *discovery.RoutingDiscovery, id peer.ID) bool {
+	peers, err := FindPeers(ctx, d, "test-torrent", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for pi := range peers {
+		if pi.ID == id {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,250 @@
+package p2p
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/cenkalti/backoff/v3"
+	"github.com/libp2p/go-libp2p-core/host"
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/peer"
+	dht "github.com/libp2p/go-libp2p-kad-dht"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// ParseBootstrapPeers parses multiaddrs of bootstrap peers. Each address must contain the peer ID.
+// Addresses of the same peer are merged.
+func ParseBootstrapPeers(addrs []string) ([]peer.AddrInfo, error) {
+	maddrs := make([]ma.Multiaddr, 0, len(addrs))
+	for _, s := range addrs {
+		maddr, err := ma.NewMultiaddr(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid bootstrap peer %q: %s", s, err)
+		}
+		maddrs = append(maddrs, maddr)
+	}
+	return peer.AddrInfosFromP2pAddrs(maddrs...)
+}
+
+// ConnectBootstrapPeers dials all bootstrap peers in parallel and returns the number of connected peers.
+func ConnectBootstrapPeers(ctx context.Context, h host.Host, peers []peer.AddrInfo) int {
+	var wg sync.WaitGroup
+	var m sync.Mutex
+	var connected int
+	for _, pi := range peers {
+		wg.Add(1)
+		go func(pi peer.AddrInfo) {
+			defer wg.Done()
+			if err := h.Connect(ctx, pi); err != nil {
+				logger.Warn(ConnectError(h, err))
+				return
+			}
+			logger.Info("Connection established with bootstrap node:", pi.String())
+			m.Lock()
+			connected++
+			m.Unlock()
+		}(pi)
+	}
+	wg.Wait()
+	return connected
+}
+
+// BootstrapStats contains information about the connectivity of the node to the network.
+type BootstrapStats struct {
+	// Number of configured bootstrap peers.
+	BootstrapPeers int
+	// Number of bootstrap peers that we are connected to.
+	ConnectedBootstrapPeers int
+	// Number of peers in the DHT routing table.
+	RoutingTablePeers int
+	// True if the routing table has at least the minimum number of peers
+	// and at least one bootstrap peer is connected.
+	Healthy bool
+	// Error of the last bootstrap attempt.
+	Error error
+	// Start time of the last and the next bootstrap attempt.
+	LastBootstrap time.Time
+	NextBootstrap time.Time
+}
+
+// Bootstrapper keeps the node connected to the network.
+// It checks the connectivity periodically and when a connection is closed.
+// If the routing table has less than the minimum number of peers, or not connected to any bootstrap peer,
+// bootstrap peers are dialed again and routing table is refreshed. Failed attempts are retried with backoff.
+type Bootstrapper struct {
+	host          host.Host
+	dht           *dht.IpfsDHT
+	peers         []peer.AddrInfo
+	minPeers      int
+	checkInterval time.Duration
+	dialTimeout   time.Duration
+	backoff       backoff.BackOff
+
+	stats  BootstrapStats
+	mStats sync.RWMutex
+
+	checkC chan struct{}
+	closeC chan struct{}
+	doneC  chan struct{}
+}
+
+// NewBootstrapper returns a new Bootstrapper.
+func NewBootstrapper(h host.Host, d *dht.IpfsDHT, peers []peer.AddrInfo, minPeers int, checkInterval, dialTimeout, minBackoff, maxBackoff time.Duration) *Bootstrapper {
+	return &Bootstrapper{
+		host:          h,
+		dht:           d,
+		peers:         peers,
+		minPeers:      minPeers,
+		checkInterval: checkInterval,
+		dialTimeout:   dialTimeout,
+		backoff: &backoff.ExponentialBackOff{
+			InitialInterval:     minBackoff,
+			RandomizationFactor: 0.5,
+			Multiplier:          2,
+			MaxInterval:         maxBackoff,
+			MaxElapsedTime:      0, // never stop
+			Clock:               backoff.SystemClock,
+		},
+		stats:  BootstrapStats{BootstrapPeers: len(peers)},
+		checkC: make(chan struct{}, 1),
+		closeC: make(chan struct{}),
+		doneC:  make(chan struct{}),
+	}
+}
+
+// Close the bootstrapper.
+func (b *Bootstrapper) Close() {
+	close(b.closeC)
+	<-b.doneC
+}
+
+// Stats returns the bootstrap health.
+func (b *Bootstrapper) Stats() BootstrapStats {
+	b.mStats.RLock()
+	s := b.stats
+	b.mStats.RUnlock()
+	s.ConnectedBootstrapPeers = b.connectedBootstrapPeers()
+	s.RoutingTablePeers = b.dht.RoutingTable().Size()
+	s.Healthy = s.RoutingTablePeers >= b.minPeers && (len(b.peers) == 0 || s.ConnectedBootstrapPeers > 0)
+	return s
+}
+
+// Run the bootstrapper. Invoke with go statement.
+func (b *Bootstrapper) Run() {
+	defer close(b.doneC)
+	b.backoff.Reset()
+
+	notifiee := &network.NotifyBundle{
+		DisconnectedF: func(network.Network, network.Conn) {
+			select {
+			case b.checkC <- struct{}{}:
+			default:
+			}
+		},
+	}
+	b.host.Network().Notify(notifiee)
+	defer b.host.Network().StopNotify(notifiee)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-b.closeC:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-timer.C:
+			d := b.check(ctx)
+			timer.Reset(d)
+			b.mStats.Lock()
+			b.stats.NextBootstrap = time.Now().Add(d)
+			b.mStats.Unlock()
+		case <-b.checkC:
+			// A connection is closed. Bootstrap immediately if the node has lost connectivity.
+			if b.healthy() {
+				break
+			}
+			if !timer.Stop() {
+				<-timer.C
+			}
+			timer.Reset(0)
+		case <-b.closeC:
+			return
+		}
+	}
+}
+
+func (b *Bootstrapper) healthy() bool {
+	if b.dht.RoutingTable().Size() < b.minPeers {
+		return false
+	}
+	return len(b.peers) == 0 || b.connectedBootstrapPeers() > 0
+}
+
+// check bootstraps if needed and returns the duration until the next check.
+func (b *Bootstrapper) check(ctx context.Context) time.Duration {
+	if b.healthy() {
+		b.mStats.Lock()
+		b.stats.Error = nil
+		b.mStats.Unlock()
+		b.backoff.Reset()
+		return b.checkInterval
+	}
+	b.mStats.Lock()
+	b.stats.LastBootstrap = time.Now()
+	b.mStats.Unlock()
+	err := b.bootstrap(ctx)
+	b.mStats.Lock()
+	b.stats.Error = err
+	b.mStats.Unlock()
+	if err != nil {
+		logger.Warn("bootstrap error: ", err)
+		return b.backoff.NextBackOff()
+	}
+	b.backoff.Reset()
+	return b.checkInterval
+}
+
+func (b *Bootstrapper) bootstrap(ctx context.Context) error {
+	if len(b.peers) > 0 {
+		dctx, cancel := context.WithTimeout(ctx, b.dialTimeout)
+		n := ConnectBootstrapPeers(dctx, b.host, b.peers)
+		cancel()
+		if n == 0 {
+			return fmt.Errorf("cannot connect to any of %d bootstrap peers", len(b.peers))
+		}
+	}
+	// Peers are added to the routing table after they are identified,
+	// so refreshing may fail right after connecting to bootstrap peers.
+	var refreshErr error
+	select {
+	case refreshErr = <-b.dht.ForceRefresh():
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	if n := b.dht.RoutingTable().Size(); n < b.minPeers {
+		if refreshErr != nil {
+			return refreshErr
+		}
+		return fmt.Errorf("routing table has %d peers, less than %d", n, b.minPeers)
+	}
+	return nil
+}
+
+func (b *Bootstrapper) connectedBootstrapPeers() int {
+	var n int
+	for _, pi := range b.peers {
+		if b.host.Network().Connectedness(pi.ID) == network.Connected {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,161 @@
+package p2p
+
+import (
+	"context"
+	"crypto/rand"
+	"testing"
+	"time"
+
+	connmgr "github.com/libp2p/go-libp2p-connmgr"
+	"github.com/libp2p/go-libp2p-core/crypto"
+	"github.com/libp2p/go-libp2p-core/host"
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/peer"
+	dht "github.com/libp2p/go-libp2p-kad-dht"
+	"github.com/stretchr/testify/assert"
+)
+
+func p2pAddr(h host.Host) string {
+	return loopbackAddrs(h)[0].String() + "/p2p/" + h.ID().Pretty()
+}
+
+func TestParseBootstrapPeers(t *testing.T) {
+	a := newTestHost(t, nil)
+	defer a.Close()
+	b := newTestHost(t, nil)
+	defer b.Close()
+
+	peers, err := ParseBootstrapPeers([]string{p2pAddr(a), p2pAddr(b), "/ip4/127.0.0.1/tcp/1/p2p/" + a.ID().Pretty()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	addrs := make(map[peer.ID]int)
+	for _, pi := range peers {
+		addrs[pi.ID] = len(pi.Addrs)
+	}
+	assert.Equal(t, map[peer.ID]int{a.ID(): 2, b.ID(): 1}, addrs)
+
+	_, err = ParseBootstrapPeers([]string{"foo"})
+	assert.Error(t, err)
+	_, err = ParseBootstrapPeers([]string{loopbackAddrs(a)[0].String()})
+	assert.Error(t, err)
+}
+
+func TestConnectBootstrapPeers(t *testing.T) {
+	b := newTestHost(t, nil)
+	defer b.Close()
+	c := newTestHost(t, nil)
+	defer c.Close()
+	a := newTestHost(t, nil)
+	defer a.Close()
+
+	peers, err := ParseBootstrapPeers([]string{p2pAddr(b), p2pAddr(c)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := ConnectBootstrapPeers(context.Background(), a, peers)
+	assert.Equal(t, 2, n)
+	assert.Equal(t, network.Connected, a.Network().Connectedness(b.ID()))
+	assert.Equal(t, network.Connected, a.Network().Connectedness(c.ID()))
+}
+
+func TestBootstrapperReconnects(t *testing.T) {
+	priv, _, err := crypto.GenerateKeyPairWithReader(crypto.Ed25519, 0, rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newBootstrapHost := func(listenAddr string) (host.Host, *dht.IpfsDHT) {
+		h, err := NewHost([]string{listenAddr}, priv, nil, connmgr.NewConnManager(100, 400, time.Minute), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		d, err := NewDHT(context.Background(), h, "", dht.ModeServer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return h, d
+	}
+	b, db := newBootstrapHost("/ip4/127.0.0.1/tcp/0")
+	listenAddr := b.Addrs()[0].String()
+	peers, err := ParseBootstrapPeers([]string{listenAddr + "/p2p/" + b.ID().Pretty()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a := newTestHost(t, nil)
+	defer a.Close()
+	da, err := NewDHT(context.Background(), a, "", dht.ModeServer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer da.Close()
+
+	bs := NewBootstrapper(a, da, peers, 1, time.Hour, time.Second, 10*time.Millisecond, 100*time.Millisecond)
+	go bs.Run()
+	defer bs.Close()
+
+	waitFor := func(f func(s BootstrapStats) bool) {
+		deadline := time.Now().Add(10 * time.Second)
+		for !f(bs.Stats()) {
+			if time.Now().After(deadline) {
+				t.Fatalf("timeout: %+v", bs.Stats())
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	healthy := func(s BootstrapStats) bool { return s.Healthy && s.Error == nil }
+	waitFor(healthy)
+	s := bs.Stats()
+	assert.Equal(t, 1, s.BootstrapPeers)
+	assert.Equal(t, 1, s.ConnectedBootstrapPeers)
+	assert.Equal(t, 1, s.RoutingTablePeers)
+	assert.False(t, s.LastBootstrap.IsZero())
+
+	// Bootstrap node goes down. Bootstrap is retried without waiting for the check interval.
+	db.Close()
+	b.Close()
+	waitFor(func(s BootstrapStats) bool { return s.Error != nil })
+	assert.False(t, bs.Stats().Healthy, "%+v", bs.Stats())
+
+	// Bootstrap node comes back at the same address.
+	b, db = newBootstrapHost(listenAddr)
+	defer b.Close()
+	defer db.Close()
+	waitFor(healthy)
+	assert.Equal(t, 1, bs.Stats().ConnectedBootstrapPeers)
+}
+
+func TestBootstrapperBackoff(t *testing.T) {
+	b := newTestHost(t, nil)
+	peers, err := ParseBootstrapPeers([]string{p2pAddr(b)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.Close()
+
+	a := newTestHost(t, nil)
+	defer a.Close()
+	da, err := NewDHT(context.Background(), a, "", dht.ModeServer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer da.Close()
+
+	bs := NewBootstrapper(a, da, peers, 1, time.Hour, time.Second, time.Minute, time.Minute)
+	go bs.Run()
+	defer bs.Close()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for bs.Stats().Error == nil {
+		if time.Now().After(deadline) {
+			t.Fatal("bootstrap did not fail")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	s := bs.Stats()
+	assert.False(t, s.Healthy)
+	assert.Equal(t, 0, s.ConnectedBootstrapPeers)
+	// Next attempt is scheduled with backoff, not at the check interval.
+	assert.True(t, time.Until(s.NextBootstrap) < 2*time.Minute)
+	assert.True(t, time.Until(s.NextBootstrap) > 10*time.Second)
+}
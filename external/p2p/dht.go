@@ -7,44 +7,57 @@ import (
 
 	coreDiscovery "github.com/libp2p/go-libp2p-core/discovery"
 	"github.com/libp2p/go-libp2p-core/host"
+	"github.com/libp2p/go-libp2p-core/protocol"
 	discovery "github.com/libp2p/go-libp2p-discovery"
 	dht "github.com/libp2p/go-libp2p-kad-dht"
 )
 
+// DefaultDHTProtocolPrefix is the prefix of the DHT protocols used by default. It is the prefix of the public IPFS DHT.
+// Sessions and bootstrap nodes must use the same prefix to be in the same DHT.
+const DefaultDHTProtocolPrefix protocol.ID = dht.DefaultPrefix
+
+// NewDHT creates a DHT on the host with the settings shared by sessions and bootstrap nodes.
+// DefaultDHTProtocolPrefix is used if prefix is empty. Additional options are applied after the shared ones.
+func NewDHT(ctx context.Context, h host.Host, prefix protocol.ID, mode dht.ModeOpt, opts ...dht.Option) (*dht.IpfsDHT, error) {
+	if prefix == "" {
+		prefix = DefaultDHTProtocolPrefix
+	}
+	opts = append([]dht.Option{dht.ProtocolPrefix(prefix), dht.Mode(mode)}, opts...)
+	return dht.New(ctx, h, opts...)
+}
+
 //todo mode server
-func NewRoutedDiscovery(h host.Host) (*discovery.RoutingDiscovery, error) {
+// NewRoutedDiscovery creates a DHT on the host and returns the discovery service on top of it.
+// Nodes of a private network cannot reach the public nodes needed to detect reachability,
+// so they always run the DHT in server mode.
+func NewRoutedDiscovery(h host.Host, prefix protocol.ID, privateNetwork bool) (*discovery.RoutingDiscovery, *dht.IpfsDHT, error) {
 	ctx := context.Background()
-	dht, err := dht.New(ctx, h, dht.Mode(dht.ModeAuto))
+	mode := dht.ModeAuto
+	if privateNetwork {
+		mode = dht.ModeServer
+	}
+	d, err := NewDHT(ctx, h, prefix, mode)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	//dht.FindProvidersAsync()
-	routingDiscovery := discovery.NewRoutingDiscovery(dht)
+	routingDiscovery := discovery.NewRoutingDiscovery(d)
 
-	dht.RefreshRoutingTable()
+	d.RefreshRoutingTable()
 
-	return routingDiscovery, nil
+	return routingDiscovery, d, nil
 }
 
-//todo is thread safe?
-func FindProviders(discovery *discovery.RoutingDiscovery, id string, limit int) ([]peer.AddrInfo, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second * 60)
-	defer cancel()
-
-	peerAddrC, err := discovery.FindPeers(ctx, id, coreDiscovery.Limit(limit))
-	if err != nil {
-		return nil, err
-	}
-
-	var addrs []peer.AddrInfo
-	for p := range peerAddrC {
-		addrs = append(addrs, p)
-	}
-	return addrs, err
+// FindPeers starts a query for the providers of the torrent with id.
+// Providers are sent to the returned channel as they are found.
+// The channel is closed when the query finishes or ctx is done.
+func FindPeers(ctx context.Context, discovery *discovery.RoutingDiscovery, id string, limit int) (<-chan peer.AddrInfo, error) {
+	return discovery.FindPeers(ctx, id, coreDiscovery.Limit(limit))
 }
 
-func Advertise(discovery *discovery.RoutingDiscovery, id string) error {
-	_, err := discovery.Advertise(context.Background(), id)
-	return err
+// Advertise announces that the host provides the torrent with id.
+// It returns the duration after which the advertisement must be repeated.
+func Advertise(ctx context.Context, discovery *discovery.RoutingDiscovery, id string) (time.Duration, error) {
+	return discovery.Advertise(ctx, id)
 }
\ No newline at end of file
@@ -0,0 +1,138 @@
+package p2p
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/fichain/go-file/internal/blocklist"
+	"github.com/libp2p/go-libp2p-core/control"
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/peer"
+	ma "github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr/net"
+)
+
+// Gater decides which connections are allowed to be opened by the host.
+// Connections are rejected if the remote IP is in the blocklist or the remote peer ID is not allowed.
+type Gater struct {
+	blocklist     *blocklist.Blocklist
+	blockIncoming bool
+	blockOutgoing bool
+	allowed       map[peer.ID]struct{}
+	denied        map[peer.ID]struct{}
+	blocked       int64
+
+	// The swarm calls InterceptAddrDial for the accepted connections too.
+	// Remote addresses of the accepted connections are kept here to skip the outgoing checks for them.
+	accepted  map[string]int
+	mAccepted sync.Mutex
+}
+
+// NewGater returns a new Gater.
+// IP addresses are checked against bl in the directions enabled by blockIncoming and blockOutgoing.
+// If allowed is not empty, only the peers in allowed can connect. Peers in denied can never connect.
+func NewGater(bl *blocklist.Blocklist, blockIncoming, blockOutgoing bool, allowed, denied []peer.ID) *Gater {
+	g := &Gater{
+		blocklist:     bl,
+		blockIncoming: blockIncoming,
+		blockOutgoing: blockOutgoing,
+		allowed:       make(map[peer.ID]struct{}, len(allowed)),
+		denied:        make(map[peer.ID]struct{}, len(denied)),
+		accepted:      make(map[string]int),
+	}
+	for _, id := range allowed {
+		g.allowed[id] = struct{}{}
+	}
+	for _, id := range denied {
+		g.denied[id] = struct{}{}
+	}
+	return g
+}
+
+// Blocked returns the number of connections rejected by the gater.
+func (g *Gater) Blocked() int64 {
+	return atomic.LoadInt64(&g.blocked)
+}
+
+// InterceptPeerDial checks the peer ID before dialing a peer.
+func (g *Gater) InterceptPeerDial(p peer.ID) bool {
+	return g.check(g.peerAllowed(p))
+}
+
+// InterceptAddrDial checks the address before dialing a peer.
+func (g *Gater) InterceptAddrDial(p peer.ID, addr ma.Multiaddr) bool {
+	if g.takeAccepted(addr) {
+		return true
+	}
+	return g.check(g.peerAllowed(p) && (!g.blockOutgoing || !g.ipBlocked(addr)))
+}
+
+// InterceptAccept checks the remote address of an incoming connection.
+// Peer ID is not known before the security handshake.
+func (g *Gater) InterceptAccept(addrs network.ConnMultiaddrs) bool {
+	return g.check(!g.blockIncoming || !g.ipBlocked(addrs.RemoteMultiaddr()))
+}
+
+// InterceptSecured checks the peer ID after the security handshake.
+func (g *Gater) InterceptSecured(dir network.Direction, p peer.ID, addrs network.ConnMultiaddrs) bool {
+	if !g.check(g.peerAllowed(p)) {
+		return false
+	}
+	if dir == network.DirInbound {
+		g.mAccepted.Lock()
+		g.accepted[addrs.RemoteMultiaddr().String()]++
+		g.mAccepted.Unlock()
+	}
+	return true
+}
+
+// InterceptUpgraded allows all connections that passed the previous checks.
+func (g *Gater) InterceptUpgraded(network.Conn) (bool, control.DisconnectReason) {
+	return true, 0
+}
+
+func (g *Gater) takeAccepted(addr ma.Multiaddr) bool {
+	g.mAccepted.Lock()
+	defer g.mAccepted.Unlock()
+	key := addr.String()
+	n, ok := g.accepted[key]
+	if !ok {
+		return false
+	}
+	if n <= 1 {
+		delete(g.accepted, key)
+	} else {
+		g.accepted[key] = n - 1
+	}
+	return true
+}
+
+func (g *Gater) check(allow bool) bool {
+	if !allow {
+		atomic.AddInt64(&g.blocked, 1)
+	}
+	return allow
+}
+
+func (g *Gater) peerAllowed(p peer.ID) bool {
+	if _, ok := g.denied[p]; ok {
+		return false
+	}
+	if len(g.allowed) == 0 {
+		return true
+	}
+	_, ok := g.allowed[p]
+	return ok
+}
+
+func (g *Gater) ipBlocked(addr ma.Multiaddr) bool {
+	if g.blocklist == nil {
+		return false
+	}
+	ip, err := manet.ToIP(addr)
+	if err != nil {
+		// Not an IP address, e.g. a relay or DNS address.
+		return false
+	}
+	return g.blocklist.Blocked(ip)
+}
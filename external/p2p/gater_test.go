@@ -0,0 +1,85 @@
+package p2p
+
+import (
+	"crypto/rand"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fichain/go-file/internal/blocklist"
+	connmgr "github.com/libp2p/go-libp2p-connmgr"
+	"github.com/libp2p/go-libp2p-core/crypto"
+	"github.com/libp2p/go-libp2p-core/host"
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/stretchr/testify/assert"
+)
+
+func newGatedTestHost(t *testing.T, g *Gater) host.Host {
+	priv, _, err := crypto.GenerateKeyPairWithReader(crypto.Ed25519, 0, rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := NewRoutedHost(0, nil, priv, nil, connmgr.NewConnManager(100, 400, time.Minute), g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.SetStreamHandler(testProtocol, func(s network.Stream) {
+		defer s.Close()
+		_, _ = io.Copy(s, s)
+	})
+	return h
+}
+
+func TestGaterPeerLists(t *testing.T) {
+	b := newTestHost(t, nil)
+	defer b.Close()
+	c := newTestHost(t, nil)
+	defer c.Close()
+
+	// a denies b.
+	g := NewGater(nil, true, true, nil, []peer.ID{b.ID()})
+	a := newGatedTestHost(t, g)
+	defer a.Close()
+	assert.Error(t, ping(a, b))
+	assert.Error(t, ping(b, a))
+	assert.NoError(t, ping(a, c))
+	assert.NoError(t, ping(c, a))
+	assert.True(t, g.Blocked() >= 2)
+
+	// d allows only c.
+	g = NewGater(nil, true, true, []peer.ID{c.ID()}, nil)
+	d := newGatedTestHost(t, g)
+	defer d.Close()
+	assert.NoError(t, ping(d, c))
+	assert.NoError(t, ping(c, d))
+	assert.Error(t, ping(d, b))
+	assert.Error(t, ping(b, d))
+}
+
+func TestGaterBlocklist(t *testing.T) {
+	bl := blocklist.New()
+	_, err := bl.Reload(strings.NewReader("127.0.0.0/8\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := newTestHost(t, nil)
+	defer b.Close()
+
+	// Incoming connections are blocked, outgoing are not.
+	g := NewGater(bl, true, false, nil, nil)
+	a := newGatedTestHost(t, g)
+	defer a.Close()
+	assert.Error(t, ping(b, a))
+	assert.NoError(t, ping(a, b))
+	assert.Equal(t, int64(1), g.Blocked())
+
+	// Outgoing connections are blocked, incoming are not.
+	g = NewGater(bl, false, true, nil, nil)
+	c := newGatedTestHost(t, g)
+	defer c.Close()
+	assert.Error(t, ping(c, b))
+	assert.NoError(t, ping(b, c))
+	assert.True(t, g.Blocked() > 0)
+}
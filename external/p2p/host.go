@@ -3,45 +3,53 @@ package p2p
 import (
 	"context"
 	"fmt"
-	"log"
-	"sync"
-	"time"
 
 	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p-core/connmgr"
 	"github.com/libp2p/go-libp2p-core/crypto"
 	"github.com/libp2p/go-libp2p-core/host"
-	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/pnet"
 
 	logging "github.com/ipfs/go-log"
-	connmgr "github.com/libp2p/go-libp2p-connmgr"
 	noise "github.com/libp2p/go-libp2p-noise"
 	libp2ptls "github.com/libp2p/go-libp2p-tls"
-
-	ma "github.com/multiformats/go-multiaddr"
 )
 
 var logger = logging.Logger("p2p")
 
-func convertPeers(peers []string) []peer.AddrInfo {
-	pinfos := make([]peer.AddrInfo, len(peers))
-	for i, addr := range peers {
-		maddr := ma.StringCast(addr)
-		p, err := peer.AddrInfoFromP2pAddr(maddr)
-		if err != nil {
-			log.Fatalln(err)
-		}
-		pinfos[i] = *p
+// BootstrapProtectTag is used to protect connections of bootstrap nodes from the connection manager.
+const BootstrapProtectTag = "filechain/bootstrap"
+
+// NewRoutedHost creates a libp2p host for a session. It does not dial the bootstrap peers,
+// Bootstrapper connects to them in background so a node that is offline does not block.
+// If psk is not nil, the host only communicates with peers that have the same pre-shared key.
+// Connections to bootstrap peers are protected in the connection manager cm.
+// If gater is not nil, it is consulted before opening or accepting a connection.
+func NewRoutedHost(listenPort int, bootstrapPeers []string, priv crypto.PrivKey, psk pnet.PSK, cm connmgr.ConnManager, gater connmgr.ConnectionGater) (host.Host, error) {
+	bpeers, err := ParseBootstrapPeers(bootstrapPeers)
+	if err != nil {
+		return nil, err
 	}
-	return pinfos
-}
 
-func NewRoutedHost(listenPort int, bootstrapPeers []string, priv crypto.PrivKey) (host.Host, error) {
-	bpeers := convertPeers(bootstrapPeers)
+	basicHost, err := NewHost([]string{fmt.Sprintf("/ip4/0.0.0.0/tcp/%d", listenPort)}, priv, psk, cm, gater)
+	if err != nil {
+		return nil, err
+	}
 
-	ctx := context.Background()
+	for _, pi := range bpeers {
+		cm.Protect(pi.ID, BootstrapProtectTag)
+	}
+
+	logger.Infof("Hello World, my hosts ID is %s/%s\n", basicHost.Addrs()[0].String(), basicHost.ID())
+	return basicHost, nil
+}
 
+// NewHost creates a libp2p host with the transports and security protocols used by all filechain nodes.
+// If psk is not nil, the host only communicates with peers that have the same pre-shared key.
+// If gater is not nil, it is consulted before opening or accepting a connection.
+func NewHost(listenAddrs []string, priv crypto.PrivKey, psk pnet.PSK, cm connmgr.ConnManager, gater connmgr.ConnectionGater) (host.Host, error) {
 	opts := []libp2p.Option{
-		libp2p.ListenAddrStrings(fmt.Sprintf("/ip4/0.0.0.0/tcp/%d", listenPort)),
+		libp2p.ListenAddrStrings(listenAddrs...),
 		libp2p.Identity(priv),
 		libp2p.DefaultTransports,
 		libp2p.DefaultMuxers,
@@ -50,32 +58,24 @@ func NewRoutedHost(listenPort int, bootstrapPeers []string, priv crypto.PrivKey)
 		libp2p.NATPortMap(),
 		//libp2p.EnableAutoRelay(),
 		libp2p.EnableNATService(),
-		libp2p.ConnectionManager(connmgr.NewConnManager(
-			100,         // Lowwater
-			400,         // HighWater,
-			time.Minute, // GracePeriod
-		)),
+		libp2p.ConnectionManager(cm),
+	}
+	if psk != nil {
+		opts = append(opts, libp2p.PrivateNetwork(psk))
 	}
-	basicHost, err := libp2p.New(ctx, opts...)
+	if gater != nil {
+		opts = append(opts, libp2p.ConnectionGater(gater))
+	}
+	h, err := libp2p.New(context.Background(), opts...)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
-	logger.Debug("")
-
-	var wg sync.WaitGroup
-	for _, peerAddr := range bpeers {
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			if err := basicHost.Connect(ctx, peerAddr); err != nil {
-				logger.Warn(err)
-			} else {
-				logger.Info("Connection established with bootstrap node:", peerAddr.String())
-			}
-		}()
+	if psk != nil {
+		err = h.Peerstore().Put(h.ID(), privateNetworkKey, true)
+		if err != nil {
+			h.Close()
+			return nil, err
+		}
 	}
-	wg.Wait()
-
-	logger.Infof("Hello World, my hosts ID is %s/%s\n", basicHost.Addrs()[0].String(), basicHost.ID())
-	return basicHost, nil
-}
\ No newline at end of file
+	return h, nil
+}
@@ -0,0 +1,43 @@
+package p2p
+
+import (
+	"context"
+	"crypto/rand"
+	"testing"
+	"time"
+
+	connmgr "github.com/libp2p/go-libp2p-connmgr"
+	"github.com/libp2p/go-libp2p-core/crypto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBootstrapPeersProtected(t *testing.T) {
+	b := newTestHost(t, nil)
+	defer b.Close()
+
+	priv, _, err := crypto.GenerateKeyPairWithReader(crypto.Ed25519, 0, rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cm := connmgr.NewConnManager(0, 0, 0)
+	bootstrapPeers := []string{loopbackAddrs(b)[0].String() + "/p2p/" + b.ID().Pretty()}
+	a, err := NewRoutedHost(0, bootstrapPeers, priv, nil, cm, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	// Bootstrap peers are dialed by Bootstrapper, not while creating the host.
+	assert.Empty(t, a.Network().ConnsToPeer(b.ID()))
+	peers, err := ParseBootstrapPeers(bootstrapPeers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 1, ConnectBootstrapPeers(context.Background(), a, peers))
+	assert.Len(t, a.Network().ConnsToPeer(b.ID()), 1)
+	assert.True(t, cm.IsProtected(b.ID(), BootstrapProtectTag))
+
+	// Trimming must keep the bootstrap connection even if it is over the limits.
+	time.Sleep(10 * time.Millisecond)
+	cm.TrimOpenConns(context.Background())
+	assert.Len(t, a.Network().ConnsToPeer(b.ID()), 1)
+}
@@ -0,0 +1,39 @@
+package p2p
+
+import (
+	"crypto/rand"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/libp2p/go-libp2p-core/crypto"
+)
+
+// LoadOrCreateKey reads the private key of a node from the file at path.
+// If the file does not exist, a new Ed25519 key is generated and saved to path.
+func LoadOrCreateKey(path string) (crypto.PrivKey, error) {
+	b, err := ioutil.ReadFile(path)
+	if err == nil {
+		return crypto.UnmarshalPrivateKey(b)
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+	priv, _, err := crypto.GenerateKeyPairWithReader(crypto.Ed25519, 0, rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	b, err = crypto.MarshalPrivateKey(priv)
+	if err != nil {
+		return nil, err
+	}
+	err = os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return nil, err
+	}
+	err = ioutil.WriteFile(path, b, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return priv, nil
+}
@@ -0,0 +1,64 @@
+package p2p
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/libp2p/go-libp2p-core/host"
+	"github.com/libp2p/go-libp2p-core/pnet"
+)
+
+// pskHeader is the first line of a key in libp2p swarm key format.
+const pskHeader = "/key/swarm/psk/1.0.0/"
+
+// ErrPrivateNetwork is returned when a connection cannot be established because
+// the remote peer does not use the same private network key.
+var ErrPrivateNetwork = errors.New("peer is not a member of the same private network (pre-shared key mismatch)")
+
+// LoadPrivateNetworkKey returns the pre-shared key of a private network.
+// v can be the path of a swarm key file or the contents of the key file itself.
+func LoadPrivateNetworkKey(v string) (pnet.PSK, error) {
+	b := []byte(v)
+	if !strings.HasPrefix(strings.TrimSpace(v), pskHeader) {
+		var err error
+		b, err = ioutil.ReadFile(v)
+		if err != nil {
+			return nil, err
+		}
+	}
+	psk, err := pnet.DecodeV1PSK(bytes.NewReader(bytes.TrimSpace(b)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid private network key: %s", err)
+	}
+	return psk, nil
+}
+
+// privateNetworkKey is the peerstore key that marks the own peer of a host using a private network.
+const privateNetworkKey = "filechain/private-network"
+
+// IsPrivateNetwork returns true if the host is created with a pre-shared key.
+func IsPrivateNetwork(h host.Host) bool {
+	v, err := h.Peerstore().Get(h.ID(), privateNetworkKey)
+	return err == nil && v == true
+}
+
+// ConnectError converts an error caused by a private network key mismatch into ErrPrivateNetwork.
+// Other errors, and all errors of hosts without a pre-shared key, are returned unchanged.
+//
+// A private network connection starts with a nonce instead of the security protocol negotiation.
+// When only one of the peers has the key, or the keys differ, the negotiation fails on both sides.
+// All nodes support the same security protocols, so for a host with a key a failed negotiation means a key mismatch.
+// A host without a key cannot tell a private network from other negotiation failures.
+func ConnectError(h host.Host, err error) error {
+	if err == nil || !IsPrivateNetwork(h) {
+		return err
+	}
+	s := err.Error()
+	if !strings.Contains(s, "privnet:") && !strings.Contains(s, "failed to negotiate security protocol") {
+		return err
+	}
+	return fmt.Errorf("%w: %s", ErrPrivateNetwork, s)
+}
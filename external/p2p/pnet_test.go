@@ -0,0 +1,189 @@
+package p2p
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	connmgr "github.com/libp2p/go-libp2p-connmgr"
+	"github.com/libp2p/go-libp2p-core/crypto"
+	"github.com/libp2p/go-libp2p-core/host"
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/pnet"
+	"github.com/libp2p/go-libp2p-core/transport"
+	ma "github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr/net"
+	"github.com/stretchr/testify/assert"
+)
+
+const testProtocol = "/filechain/test/1.0.0"
+
+func newTestKey(t *testing.T) string {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pskHeader + "\n/base16/\n" + hex.EncodeToString(b) + "\n"
+}
+
+func newTestHost(t *testing.T, psk pnet.PSK) host.Host {
+	priv, _, err := crypto.GenerateKeyPairWithReader(crypto.Ed25519, 0, rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := NewRoutedHost(0, nil, priv, psk, connmgr.NewConnManager(100, 400, time.Minute), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.SetStreamHandler(testProtocol, func(s network.Stream) {
+		defer s.Close()
+		_, _ = io.Copy(s, s)
+	})
+	return h
+}
+
+func loopbackAddrs(h host.Host) []ma.Multiaddr {
+	var addrs []ma.Multiaddr
+	for _, addr := range h.Addrs() {
+		if manet.IsIPLoopback(addr) {
+			addrs = append(addrs, addr)
+		}
+	}
+	return addrs
+}
+
+func ping(a, b host.Host) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	err := a.Connect(ctx, peer.AddrInfo{ID: b.ID(), Addrs: loopbackAddrs(b)})
+	if err != nil {
+		return ConnectError(a, err)
+	}
+	s, err := a.NewStream(ctx, b.ID(), testProtocol)
+	if err != nil {
+		return ConnectError(a, err)
+	}
+	defer s.Close()
+	_, err = s.Write([]byte("ping"))
+	if err != nil {
+		return err
+	}
+	buf := make([]byte, 4)
+	_, err = io.ReadFull(s, buf)
+	if err != nil {
+		return err
+	}
+	if string(buf) != "ping" {
+		return errors.New("unexpected response: " + string(buf))
+	}
+	return nil
+}
+
+func TestLoadPrivateNetworkKey(t *testing.T) {
+	key := newTestKey(t)
+	psk, err := LoadPrivateNetworkKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, psk, 32)
+
+	dir, err := ioutil.TempDir("", "filechain-pnet-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	p := filepath.Join(dir, "swarm.key")
+	err = ioutil.WriteFile(p, []byte(key), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	psk2, err := LoadPrivateNetworkKey(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, psk, psk2)
+
+	_, err = LoadPrivateNetworkKey(pskHeader + "\n/base16/\nzz")
+	assert.Error(t, err)
+	_, err = LoadPrivateNetworkKey(filepath.Join(dir, "missing.key"))
+	assert.Error(t, err)
+}
+
+func TestPrivateNetwork(t *testing.T) {
+	// Depending on the bytes read, the handshake of mismatching keys may hang until the listener gives up.
+	// A shorter accept timeout turns the hang into a failed negotiation well before ping times out.
+	defer func(d time.Duration) { transport.AcceptTimeout = d }(transport.AcceptTimeout)
+	transport.AcceptTimeout = 2 * time.Second
+
+	psk, err := LoadPrivateNetworkKey(newTestKey(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := newTestHost(t, psk)
+	defer a.Close()
+	b := newTestHost(t, psk)
+	defer b.Close()
+	c := newTestHost(t, nil)
+	defer c.Close()
+	assert.True(t, IsPrivateNetwork(a))
+	assert.False(t, IsPrivateNetwork(c))
+
+	// Members of the private network can exchange data.
+	assert.NoError(t, ping(a, b))
+
+	// Nodes without the key cannot connect to the members.
+	// They cannot tell a private network from other failures, so the error is not converted.
+	err = ping(c, a)
+	if assert.Error(t, err) {
+		assert.False(t, errors.Is(err, ErrPrivateNetwork), "unexpected error: %v", err)
+	}
+
+	// Members cannot connect to the nodes without the key.
+	assertPrivateNetworkError(t, ping(a, c))
+
+	// A node with a different key is not a member either.
+	psk2, err := LoadPrivateNetworkKey(newTestKey(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := newTestHost(t, psk2)
+	defer d.Close()
+	assertPrivateNetworkError(t, ping(d, a))
+}
+
+func TestConnectError(t *testing.T) {
+	psk, err := LoadPrivateNetworkKey(newTestKey(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := newTestHost(t, psk)
+	defer a.Close()
+	c := newTestHost(t, nil)
+	defer c.Close()
+
+	negotiation := errors.New("failed to negotiate security protocol: EOF")
+	assert.True(t, errors.Is(ConnectError(a, negotiation), ErrPrivateNetwork))
+	assert.Equal(t, negotiation, ConnectError(c, negotiation))
+	other := errors.New("connection refused")
+	assert.Equal(t, other, ConnectError(a, other))
+	assert.Nil(t, ConnectError(a, nil))
+}
+
+// assertPrivateNetworkError checks that the connection has failed because of the key mismatch.
+// A handshake that hangs until ping times out is a failure too.
+func assertPrivateNetworkError(t *testing.T, err error) {
+	t.Helper()
+	if !assert.Error(t, err) {
+		return
+	}
+	assert.True(t, errors.Is(err, ErrPrivateNetwork), "unexpected error: %v", err)
+}
@@ -1,11 +1,91 @@
 package p2p
 
-import "github.com/libp2p/go-libp2p-core/protocol"
-
-const (
-	FileTransferProtocol = "/filchain/transfer/1.0.0"
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
 )
 
-func GenerateFileTransferProtocol(infohash string) protocol.ID {
-	return protocol.ID(FileTransferProtocol + "/" + infohash)
-}
\ No newline at end of file
+// FileTransferProtocolPrefix is the prefix of the libp2p protocol of the streams that transfer torrent data.
+// The protocol ID ends with the semantic version of the protocol. See TransferProtocolID.
+// A single handler serves all torrents of a session. The first message of the dialing side
+// names the torrent with its info hash. The listening side replies with an empty message if
+// the stream is accepted, or with the reason of rejection. Then peer protocol messages follow.
+const FileTransferProtocolPrefix = "/filchain/transfer/"
+
+// maxTransferHandshakeMessage is the maximum length of a message exchanged in the transfer handshake.
+const maxTransferHandshakeMessage = 1024
+
+var errInvalidInfoHash = errors.New("invalid info hash in transfer handshake")
+
+// TransferRejectedError is returned by ReadTransferResponse if the remote peer has rejected the stream.
+type TransferRejectedError struct {
+	Reason string
+}
+
+func (e *TransferRejectedError) Error() string {
+	return "stream rejected by peer: " + e.Reason
+}
+
+// WriteTransferHandshake writes the first message of a transfer stream that names the torrent.
+func WriteTransferHandshake(w io.Writer, infoHash [20]byte) error {
+	return writeTransferMessage(w, infoHash[:])
+}
+
+// ReadTransferHandshake reads the info hash of the torrent that the remote peer wants to transfer.
+func ReadTransferHandshake(r io.Reader) (infoHash [20]byte, err error) {
+	b, err := readTransferMessage(r)
+	if err != nil {
+		return
+	}
+	if len(b) != len(infoHash) {
+		err = errInvalidInfoHash
+		return
+	}
+	copy(infoHash[:], b)
+	return
+}
+
+// WriteTransferResponse accepts the stream if reason is empty, otherwise rejects it with reason.
+func WriteTransferResponse(w io.Writer, reason string) error {
+	if len(reason) > maxTransferHandshakeMessage {
+		reason = reason[:maxTransferHandshakeMessage]
+	}
+	return writeTransferMessage(w, []byte(reason))
+}
+
+// ReadTransferResponse returns nil if the remote peer has accepted the stream.
+// If the stream is rejected, the error is a *TransferRejectedError.
+func ReadTransferResponse(r io.Reader) error {
+	b, err := readTransferMessage(r)
+	if err != nil {
+		return err
+	}
+	if len(b) > 0 {
+		return &TransferRejectedError{Reason: string(b)}
+	}
+	return nil
+}
+
+func writeTransferMessage(w io.Writer, b []byte) error {
+	buf := make([]byte, 2+len(b))
+	binary.BigEndian.PutUint16(buf, uint16(len(b)))
+	copy(buf[2:], b)
+	_, err := w.Write(buf)
+	return err
+}
+
+func readTransferMessage(r io.Reader) ([]byte, error) {
+	var l uint16
+	err := binary.Read(r, binary.BigEndian, &l)
+	if err != nil {
+		return nil, err
+	}
+	if l > maxTransferHandshakeMessage {
+		return nil, fmt.Errorf("transfer handshake message too long: %d", l)
+	}
+	b := make([]byte, l)
+	_, err = io.ReadFull(r, b)
+	return b, err
+}
@@ -0,0 +1,38 @@
+package p2p
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransferHandshake(t *testing.T) {
+	var buf bytes.Buffer
+	ih := [20]byte{1, 2, 3}
+	assert.NoError(t, WriteTransferHandshake(&buf, ih))
+	ih2, err := ReadTransferHandshake(&buf)
+	assert.NoError(t, err)
+	assert.Equal(t, ih, ih2)
+
+	assert.NoError(t, WriteTransferResponse(&buf, ""))
+	assert.NoError(t, ReadTransferResponse(&buf))
+
+	assert.NoError(t, WriteTransferResponse(&buf, "unknown torrent"))
+	err = ReadTransferResponse(&buf)
+	assert.Equal(t, &TransferRejectedError{Reason: "unknown torrent"}, err)
+
+	// Long reasons are truncated.
+	assert.NoError(t, WriteTransferResponse(&buf, strings.Repeat("a", 2000)))
+	err = ReadTransferResponse(&buf)
+	assert.Len(t, err.(*TransferRejectedError).Reason, maxTransferHandshakeMessage)
+
+	// Info hash must be 20 bytes.
+	assert.NoError(t, writeTransferMessage(&buf, []byte("short")))
+	_, err = ReadTransferHandshake(&buf)
+	assert.Equal(t, errInvalidInfoHash, err)
+
+	_, err = ReadTransferHandshake(bytes.NewReader([]byte{0xff, 0xff}))
+	assert.Error(t, err)
+}
@@ -0,0 +1,145 @@
+package p2p
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/coreos/go-semver/semver"
+	"github.com/libp2p/go-libp2p-core/helpers"
+	"github.com/libp2p/go-libp2p-core/host"
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/protocol"
+)
+
+// Features of the transfer protocol. Peers learn the features of each other from the extension handshake.
+const (
+	// FeatureFast is the Fast Extension (BEP 6).
+	FeatureFast = "fast"
+	// FeatureMetadata is the extension for downloading metadata from peers (BEP 9).
+	FeatureMetadata = "metadata"
+	// FeaturePEX is the peer exchange extension.
+	FeaturePEX = "pex"
+	// FeatureChoke means that both sides start in choked state and wait for an unchoke message
+	// before requesting pieces, as in BitTorrent.
+	// With older peers, both sides start unchoked, but they can still be choked later.
+	FeatureChoke = "choke"
+)
+
+// transferProtocolVersions are the versions of the transfer protocol, oldest first.
+// A version introduces new features. It is always possible to speak an older version with the same major.
+var transferProtocolVersions = []struct {
+	version  string
+	features []string
+}{
+	{"1.0.0", []string{FeatureFast, FeatureMetadata}},
+	{"1.1.0", []string{FeaturePEX}},
+	{"1.2.0", []string{FeatureChoke}},
+}
+
+// TransferProtocolVersion is the newest version of the transfer protocol.
+var TransferProtocolVersion = transferProtocolVersions[len(transferProtocolVersions)-1].version
+
+// TransferProtocolID returns the libp2p protocol ID of the transfer protocol version.
+func TransferProtocolID(version string) protocol.ID {
+	return protocol.ID(FileTransferProtocolPrefix + version)
+}
+
+// TransferProtocolVersionOf returns the version in the protocol ID of a transfer stream.
+func TransferProtocolVersionOf(id protocol.ID) string {
+	return strings.TrimPrefix(string(id), FileTransferProtocolPrefix)
+}
+
+// TransferProtocolVersions returns the known versions up to maxVersion, newest first.
+// Dialers offer the versions in this order so the newest version supported by both sides is selected.
+// If the remote peer is older, the stream falls back to an older version, down to the oldest common version.
+func TransferProtocolVersions(maxVersion string) ([]string, error) {
+	max, err := semver.NewVersion(maxVersion)
+	if err != nil {
+		return nil, fmt.Errorf("invalid transfer protocol version %q: %s", maxVersion, err)
+	}
+	var ret []string
+	for _, v := range transferProtocolVersions {
+		if semver.New(v.version).LessThan(*max) || v.version == max.String() {
+			ret = append(ret, v.version)
+		}
+	}
+	if len(ret) == 0 || ret[len(ret)-1] != max.String() {
+		return nil, fmt.Errorf("unknown transfer protocol version: %s", maxVersion)
+	}
+	sort.Slice(ret, func(i, j int) bool { return semver.New(ret[j]).LessThan(*semver.New(ret[i])) })
+	return ret, nil
+}
+
+// TransferProtocolIDs returns the protocol IDs of TransferProtocolVersions.
+func TransferProtocolIDs(maxVersion string) ([]protocol.ID, error) {
+	versions, err := TransferProtocolVersions(maxVersion)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]protocol.ID, len(versions))
+	for i, v := range versions {
+		ids[i] = TransferProtocolID(v)
+	}
+	return ids, nil
+}
+
+// TransferProtocolFeatures returns the features available in the transfer protocol version.
+func TransferProtocolFeatures(version string) []string {
+	v, err := semver.NewVersion(version)
+	if err != nil {
+		return nil
+	}
+	var ret []string
+	for _, pv := range transferProtocolVersions {
+		w := semver.New(pv.version)
+		if w.Major == v.Major && !v.LessThan(*w) {
+			ret = append(ret, pv.features...)
+		}
+	}
+	return ret
+}
+
+// SetTransferHandler sets the handler of the transfer protocol for all versions up to maxVersion.
+// The newest version of each major is registered with a semver matcher,
+// so streams of older minor versions are also handled.
+func SetTransferHandler(h host.Host, maxVersion string, handler network.StreamHandler) error {
+	ids, err := transferHandlerIDs(maxVersion)
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		match, err := helpers.MultistreamSemverMatcher(id)
+		if err != nil {
+			return err
+		}
+		h.SetStreamHandlerMatch(id, match, handler)
+	}
+	return nil
+}
+
+// RemoveTransferHandler removes the handlers set by SetTransferHandler.
+func RemoveTransferHandler(h host.Host, maxVersion string) {
+	ids, _ := transferHandlerIDs(maxVersion)
+	for _, id := range ids {
+		h.RemoveStreamHandler(id)
+	}
+}
+
+// transferHandlerIDs returns the protocol ID of the newest version of each major up to maxVersion.
+func transferHandlerIDs(maxVersion string) ([]protocol.ID, error) {
+	versions, err := TransferProtocolVersions(maxVersion)
+	if err != nil {
+		return nil, err
+	}
+	var ret []protocol.ID
+	var lastMajor int64 = -1
+	for _, v := range versions {
+		major := semver.New(v).Major
+		if major != lastMajor {
+			ret = append(ret, TransferProtocolID(v))
+			lastMajor = major
+		}
+	}
+	return ret, nil
+}
@@ -0,0 +1,81 @@
+package p2p
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/protocol"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransferProtocolVersions(t *testing.T) {
+	versions, err := TransferProtocolVersions("1.1.0")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"1.1.0", "1.0.0"}, versions)
+
+	ids, err := TransferProtocolIDs("1.0.0")
+	assert.NoError(t, err)
+	assert.Equal(t, []protocol.ID{"/filchain/transfer/1.0.0"}, ids)
+
+	_, err = TransferProtocolVersions("1.0")
+	assert.Error(t, err)
+	_, err = TransferProtocolVersions("1.5.0")
+	assert.Error(t, err)
+
+	assert.Equal(t, []string{FeatureFast, FeatureMetadata}, TransferProtocolFeatures("1.0.0"))
+	assert.Equal(t, []string{FeatureFast, FeatureMetadata, FeaturePEX}, TransferProtocolFeatures("1.1.0"))
+	assert.Equal(t, []string{FeatureFast, FeatureMetadata, FeaturePEX, FeatureChoke}, TransferProtocolFeatures("1.2.0"))
+	assert.Equal(t, "1.1.0", TransferProtocolVersionOf("/filchain/transfer/1.1.0"))
+}
+
+func TestTransferProtocolNegotiation(t *testing.T) {
+	negotiate := func(listenerVersion, dialerVersion string) string {
+		a := newTestHost(t, nil)
+		defer a.Close()
+		b := newTestHost(t, nil)
+		defer b.Close()
+
+		protoC := make(chan protocol.ID, 1)
+		err := SetTransferHandler(a, listenerVersion, func(s network.Stream) {
+			protoC <- s.Protocol()
+			s.Close()
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids, err := TransferProtocolIDs(dialerVersion)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		err = b.Connect(ctx, peer.AddrInfo{ID: a.ID(), Addrs: loopbackAddrs(a)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		s, err := b.NewStream(ctx, a.ID(), ids...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer s.Close()
+		// Write something, otherwise the protocol negotiation is not completed on the listener side.
+		_, err = s.Write([]byte{0})
+		if err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case p := <-protoC:
+			assert.Equal(t, s.Protocol(), p)
+		case <-ctx.Done():
+			t.Fatal("stream is not handled")
+		}
+		return TransferProtocolVersionOf(s.Protocol())
+	}
+	assert.Equal(t, "1.1.0", negotiate("1.1.0", "1.1.0"))
+	assert.Equal(t, "1.0.0", negotiate("1.0.0", "1.1.0"))
+	assert.Equal(t, "1.0.0", negotiate("1.1.0", "1.0.0"))
+	assert.Equal(t, "1.0.0", negotiate("1.0.0", "1.0.0"))
+}
@@ -3,30 +3,40 @@ package peer
 import (
 	p2pPeer "github.com/libp2p/go-libp2p-core/peer"
 	"math"
+	"net"
 	"time"
 
 	"github.com/fichain/go-file/internal/bitfield"
 	"github.com/fichain/go-file/internal/logger"
 	"github.com/fichain/go-file/internal/mse"
 	"github.com/fichain/go-file/internal/pieceset"
-	"github.com/juju/ratelimit"
+	"github.com/fichain/go-file/internal/speedlimit"
+	"github.com/fichain/go-file/internal/stringutil"
 	"github.com/libp2p/go-libp2p-core/host"
 	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr/net"
 	"github.com/rcrowley/go-metrics"
 
+	"github.com/fichain/go-file/external/p2p"
 	"github.com/fichain/go-file/external/peerconn"
 	"github.com/fichain/go-file/external/peerconn/peerreader"
 	"github.com/fichain/go-file/external/peerconn/peerwriter"
 	"github.com/fichain/go-file/external/peerprotocol"
 	"github.com/fichain/go-file/external/peersource"
+	"github.com/fichain/go-file/external/pexlist"
 )
 
-// Peer of a Torrent. Wraps a BitTorrent connection.
+// BitTorrentProtocol is the ProtocolVersion of classic BitTorrent peers.
+const BitTorrentProtocol = "bittorrent"
+
+// Peer of a Torrent. Wraps a libp2p stream or a BitTorrent TCP connection.
 type Peer struct {
 	*peerconn.Conn
 
-	Host host.Host
-	Stream network.Stream
+	// Host and P2pID are set only for libp2p peers.
+	Host   host.Host
+	Stream peerconn.Stream
 
 	ConnectedAt time.Time
 
@@ -36,8 +46,20 @@ type Peer struct {
 	ReceivedAllowedFast pieceset.PieceSet
 	SentAllowedFast     pieceset.PieceSet
 
-	ID                string
-	P2pID 	          p2pPeer.ID
+	// ID is the libp2p peer ID or the address of a BitTorrent peer.
+	ID    string
+	P2pID p2pPeer.ID
+
+	// TCPAddr and PeerID are set only for classic BitTorrent peers.
+	TCPAddr *net.TCPAddr
+	PeerID  [20]byte
+
+	// Version of the transfer protocol negotiated with the peer.
+	ProtocolVersion string
+	// Features that can be used with the peer. Initially all features of ProtocolVersion
+	// (or the ones in the reserved bytes of the BitTorrent handshake),
+	// then limited to the features that the peer announces in the extension handshake.
+	Features map[string]struct{}
 
 	ExtensionsEnabled bool
 	FastEnabled       bool
@@ -56,6 +78,10 @@ type Peer struct {
 
 	Downloading bool
 
+	// Limit the speed of this peer only. Rates are zero (no limit) until they are set.
+	DownloadLimit *speedlimit.Bucket
+	UploadLimit   *speedlimit.Bucket
+
 	downloadSpeed metrics.Meter
 	uploadSpeed   metrics.Meter
 
@@ -64,7 +90,10 @@ type Peer struct {
 
 	ExtensionHandshake *peerprotocol.ExtensionHandshakeMessage
 
-	//PEX *pex
+	PEX *pex
+
+	// Time of the last PEX message received from the peer.
+	lastPEXReceived time.Time
 
 	snubTimeout time.Duration
 	snubTimer   *time.Timer
@@ -85,53 +114,109 @@ type PieceMessage struct {
 	Piece peerreader.Piece
 }
 
-// New wraps the net.Conn and returns a new Peer.
-func New(host host.Host, s network.Stream, source peersource.Source, id [20]byte, pieceReadTimeout, snubTimeout time.Duration, maxRequestsIn int, br, bw *ratelimit.Bucket) *Peer {
-	//bf, _ := bitfield.NewBytes(extensions[:], 64)
-	//fastEnabled := bf.Test(61)
-	//extensionsEnabled := bf.Test(43)
-	//dhtEnabled := bf.Test(63)
+// New wraps the libp2p stream and returns a new Peer.
+func New(host host.Host, s network.Stream, source peersource.Source, id [20]byte, pieceReadTimeout, snubTimeout time.Duration, maxRequestsIn int, br, bw speedlimit.Buckets) *Peer {
+	version := p2p.TransferProtocolVersionOf(s.Protocol())
+	features := make(map[string]struct{})
+	for _, f := range p2p.TransferProtocolFeatures(version) {
+		features[f] = struct{}{}
+	}
+	p := newPeer(s, s.Conn().RemotePeer().String(), source, features, pieceReadTimeout, snubTimeout, maxRequestsIn, br, bw)
+	p.Host = host
+	p.P2pID = s.Conn().RemotePeer()
+	p.ProtocolVersion = version
+	p.ExtensionsEnabled = true
+	p.DHTEnabled = true
+	_, choke := features[p2p.FeatureChoke]
+	p.ClientChoking = choke
+	p.PeerChoking = choke
+	return p
+}
 
-	//pi.Addrs
+// NewBitTorrent wraps the TCP connection of a classic BitTorrent peer that has completed the BitTorrent handshake.
+// Features are derived from the reserved bytes in the handshake.
+// The BitTorrent protocol starts in choked state on both sides.
+func NewBitTorrent(conn net.Conn, source peersource.Source, peerID [20]byte, extensions [8]byte, cipher mse.CryptoMethod, pieceReadTimeout, snubTimeout time.Duration, maxRequestsIn int, br, bw speedlimit.Buckets) *Peer {
+	bf, _ := bitfield.NewBytes(extensions[:], 64)
+	features := make(map[string]struct{})
+	if bf.Test(61) {
+		features[p2p.FeatureFast] = struct{}{}
+	}
+	extensionsEnabled := bf.Test(43)
+	if extensionsEnabled {
+		features[p2p.FeatureMetadata] = struct{}{}
+	}
+	addr := conn.RemoteAddr().(*net.TCPAddr)
+	p := newPeer(conn, addr.String(), source, features, pieceReadTimeout, snubTimeout, maxRequestsIn, br, bw)
+	p.TCPAddr = addr
+	p.PeerID = peerID
+	p.ProtocolVersion = BitTorrentProtocol
+	p.ExtensionsEnabled = extensionsEnabled
+	p.DHTEnabled = bf.Test(63)
+	p.EncryptionCipher = cipher
+	p.ClientChoking = true
+	p.PeerChoking = true
+	return p
+}
+
+func newPeer(s peerconn.Stream, id string, source peersource.Source, features map[string]struct{}, pieceReadTimeout, snubTimeout time.Duration, maxRequestsIn int, br, bw speedlimit.Buckets) *Peer {
 	t := time.NewTimer(math.MaxInt64)
 	t.Stop()
-	//ctx := context.Background()
-	//s, err := host.NewStream(ctx, pi.ID, "/filechain/file/1.0")
-	//if err != nil {
-	//	return nil
-	//}
-
+	_, fastEnabled := features[p2p.FeatureFast]
+	downloadLimit, uploadLimit := speedlimit.New(0), speedlimit.New(0)
+	// Do not modify the backing arrays of shared buckets.
+	br = append(br[:len(br):len(br)], downloadLimit)
+	bw = append(bw[:len(bw):len(bw)], uploadLimit)
 	return &Peer{
-		Host:              host,
-		Stream: 	       s,
-		P2pID:             s.Conn().RemotePeer(),
-		Conn:              peerconn.New(s, newPeerLogger(source, s), pieceReadTimeout, maxRequestsIn, true, br, bw),
-		Source:            source,
-		ConnectedAt:       time.Now(),
-		ID:                s.Conn().RemotePeer().String(),
-		ClientChoking:     false,
-		PeerChoking:       false,
-		ExtensionsEnabled: true,
-		FastEnabled:       true,
-		DHTEnabled:        true,
-		snubTimeout:       snubTimeout,
-		snubTimer:         t,
-		closeC:            make(chan struct{}),
-		doneC:             make(chan struct{}),
-		downloadSpeed:     metrics.NewMeter(),
-		uploadSpeed:       metrics.NewMeter(),
+		Stream:        s,
+		Conn:          peerconn.New(s, newPeerLogger(source, id), pieceReadTimeout, maxRequestsIn, fastEnabled, br, bw),
+		DownloadLimit: downloadLimit,
+		UploadLimit:   uploadLimit,
+		Source:        source,
+		ConnectedAt:   time.Now(),
+		ID:            id,
+		Features:      features,
+		FastEnabled:   fastEnabled,
+		snubTimeout:   snubTimeout,
+		snubTimer:     t,
+		closeC:        make(chan struct{}),
+		doneC:         make(chan struct{}),
+		downloadSpeed: metrics.NewMeter(),
+		uploadSpeed:   metrics.NewMeter(),
 	}
 }
 
-func newPeerLogger(src peersource.Source, stream network.Stream) logger.Logger {
+func newPeerLogger(src peersource.Source, id string) logger.Logger {
 	if src == peersource.Incoming {
-		return logger.New("peer <- " + stream.ID())
+		return logger.New("peer <- " + id)
+	}
+	return logger.New("peer -> " + id)
+}
+
+// String returns the libp2p peer ID or the address of a BitTorrent peer.
+func (p *Peer) String() string {
+	return p.ID
+}
+
+// RemoteAddr returns the address of the connection.
+func (p *Peer) RemoteAddr() multiaddr.Multiaddr {
+	if s, ok := p.Stream.(network.Stream); ok {
+		return s.Conn().RemoteMultiaddr()
 	}
-	return logger.New("peer -> " + stream.ID())
+	addr, _ := manet.FromNetAddr(p.TCPAddr)
+	return addr
+}
+
+// IsBitTorrent returns true if the peer is a classic BitTorrent peer connected over TCP.
+func (p *Peer) IsBitTorrent() bool {
+	return p.TCPAddr != nil
 }
 
 // Close the peer connection.
 func (p *Peer) Close() {
+	if p.PEX != nil {
+		p.PEX.close()
+	}
 	p.snubTimer.Stop()
 	close(p.closeC)
 	p.Stream.Close()
@@ -190,12 +275,23 @@ func (p *Peer) Run(messages chan Message, pieces chan interface{}, snubbed, disc
 }
 
 // StartPEX starts the PEX goroutine for sending PEX messages to the Peer periodically.
-//func (p *Peer) StartPEX(initialPeers map[*Peer]struct{}, recentlySeen *pexlist.RecentlySeen) {
-//	if p.PEX == nil {
-//		p.PEX = newPEX(p.Conn, p.ExtensionHandshake.M[peerprotocol.ExtensionKeyPEX], initialPeers, recentlySeen)
-//		go p.PEX.run()
-//	}
-//}
+func (p *Peer) StartPEX(initialPeers []p2pPeer.AddrInfo, recentlySeen *pexlist.RecentlySeen) {
+	if p.PEX == nil {
+		p.PEX = newPEX(p.Conn, p.ExtensionHandshake.M[peerprotocol.ExtensionKeyPEX], initialPeers, recentlySeen)
+		go p.PEX.run()
+	}
+}
+
+// PEXReceived is called when a PEX message is received from the Peer.
+// Returns false if the Peer sends PEX messages more often than allowed by BEP 11.
+func (p *Peer) PEXReceived(now time.Time) bool {
+	// Allow some jitter in the timers of the remote peer.
+	if !p.lastPEXReceived.IsZero() && now.Sub(p.lastPEXReceived) < pexInterval/2 {
+		return false
+	}
+	p.lastPEXReceived = now
+	return true
+}
 
 // ResetSnubTimer is called when some data received from the Peer.
 func (p *Peer) ResetSnubTimer() {
@@ -277,6 +373,30 @@ func (p *Peer) CancelPiece(index, begin, length uint32) {
 	p.SendMessage(msg)
 }
 
+// HasFeature returns true if the feature of the transfer protocol can be used with the peer.
+func (p *Peer) HasFeature(name string) bool {
+	_, ok := p.Features[name]
+	return ok
+}
+
+// SetFeatures limits the features to the ones announced by the peer.
+// Peers that do not announce features are assumed to support all features of the negotiated version.
+// Fast extension is disabled if the peer does not announce it.
+func (p *Peer) SetFeatures(announced []string) {
+	if announced == nil {
+		return
+	}
+	m := make(map[string]struct{}, len(announced))
+	for _, f := range announced {
+		if _, ok := p.Features[f]; ok {
+			m[f] = struct{}{}
+		}
+	}
+	p.Features = m
+	p.FastEnabled = p.HasFeature(p2p.FeatureFast)
+	p.Conn.SetFastEnabled(p.FastEnabled)
+}
+
 // EnabledFast returns true if the remote Peer supports Fast extension.
 func (p *Peer) EnabledFast() bool {
 	return p.FastEnabled
@@ -285,10 +405,12 @@ func (p *Peer) EnabledFast() bool {
 // Client returns the name of the client.
 // Returns client string in extension handshake. If extension handshake is not done, returns asciified version of the peer ID.
 func (p *Peer) Client() string {
-	//if p.ExtensionHandshake != nil && p.ExtensionHandshake.V != "" {
-	//	return stringutil.Printable(p.ExtensionHandshake.V)
-	//}
-	//return stringutil.Asciify(clientID(string(p.ID[:])))
+	if p.ExtensionHandshake != nil && p.ExtensionHandshake.V != "" {
+		return stringutil.Printable(p.ExtensionHandshake.V)
+	}
+	if p.IsBitTorrent() {
+		return stringutil.Asciify(clientID(string(p.PeerID[:])))
+	}
 	return p.ID
 }
 
@@ -0,0 +1,102 @@
+package peer
+
+import (
+	"time"
+
+	"github.com/fichain/go-file/external/peerconn"
+	"github.com/fichain/go-file/external/peerprotocol"
+	"github.com/fichain/go-file/external/pexlist"
+	p2pPeer "github.com/libp2p/go-libp2p-core/peer"
+)
+
+// BEP 11: Peer exchange messages are sent at most once per minute.
+const pexInterval = time.Minute
+
+type pex struct {
+	conn  *peerconn.Conn
+	extID uint8
+
+	// Contains added and dropped peers.
+	pexList *pexlist.PEXList
+
+	pexAddPeerC  chan p2pPeer.AddrInfo
+	pexDropPeerC chan p2pPeer.AddrInfo
+
+	closeC chan struct{}
+	doneC  chan struct{}
+}
+
+func newPEX(conn *peerconn.Conn, extID uint8, initialPeers []p2pPeer.AddrInfo, recentlySeen *pexlist.RecentlySeen) *pex {
+	pl := pexlist.NewWithRecentlySeen(recentlySeen.Peers())
+	for _, pi := range initialPeers {
+		pl.Add(pi)
+	}
+	return &pex{
+		conn:         conn,
+		extID:        extID,
+		pexList:      pl,
+		pexAddPeerC:  make(chan p2pPeer.AddrInfo),
+		pexDropPeerC: make(chan p2pPeer.AddrInfo),
+		closeC:       make(chan struct{}),
+		doneC:        make(chan struct{}),
+	}
+}
+
+func (p *pex) close() {
+	close(p.closeC)
+	<-p.doneC
+}
+
+func (p *pex) run() {
+	defer close(p.doneC)
+
+	p.pexFlushPeers()
+
+	ticker := time.NewTicker(pexInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case pi := <-p.pexAddPeerC:
+			p.pexList.Add(pi)
+		case pi := <-p.pexDropPeerC:
+			p.pexList.Drop(pi)
+		case <-ticker.C:
+			p.pexFlushPeers()
+		case <-p.closeC:
+			return
+		}
+	}
+}
+
+// Add the peer to the next PEX message.
+func (p *pex) Add(pi p2pPeer.AddrInfo) {
+	select {
+	case p.pexAddPeerC <- pi:
+	case <-p.doneC:
+	}
+}
+
+// Drop the peer in the next PEX message.
+func (p *pex) Drop(pi p2pPeer.AddrInfo) {
+	select {
+	case p.pexDropPeerC <- pi:
+	case <-p.doneC:
+	}
+}
+
+func (p *pex) pexFlushPeers() {
+	added, dropped := p.pexList.Flush()
+	if len(added) == 0 && len(dropped) == 0 {
+		return
+	}
+	extPEXMsg := peerprotocol.ExtensionPEXMessage{
+		Added:   added,
+		Dropped: dropped,
+	}
+	msg := peerprotocol.ExtensionMessage{
+		ExtendedMessageID: p.extID,
+		Payload:           extPEXMsg,
+	}
+	p.conn.SendMessage(msg)
+}
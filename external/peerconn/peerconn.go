@@ -1,21 +1,28 @@
 package peerconn
 
 import (
-	"github.com/libp2p/go-libp2p-core/network"
 	"io"
 	"time"
 
 	"github.com/fichain/go-file/internal/logger"
-	"github.com/juju/ratelimit"
+	"github.com/fichain/go-file/internal/speedlimit"
 
 	"github.com/fichain/go-file/external/peerconn/peerreader"
 	"github.com/fichain/go-file/external/peerconn/peerwriter"
 	"github.com/fichain/go-file/external/peerprotocol"
 )
 
+// Stream is the connection that peer protocol messages are exchanged on.
+// It is either a libp2p stream or a TCP connection to a BitTorrent peer.
+type Stream interface {
+	io.ReadWriteCloser
+	SetReadDeadline(t time.Time) error
+	SetWriteDeadline(t time.Time) error
+}
+
 // Conn is a peer connection that provides a channel for receiving messages and methods for sending messages.
 type Conn struct {
-	stream     network.Stream
+	stream   Stream
 	reader   *peerreader.PeerReader
 	writer   *peerwriter.PeerWriter
 	messages chan interface{}
@@ -25,7 +32,7 @@ type Conn struct {
 }
 
 // New returns a new PeerConn by wrapping a net.Conn.
-func New(s network.Stream, l logger.Logger, pieceTimeout time.Duration, maxRequestsIn int, fastEnabled bool, br, bw *ratelimit.Bucket) *Conn {
+func New(s Stream, l logger.Logger, pieceTimeout time.Duration, maxRequestsIn int, fastEnabled bool, br, bw speedlimit.Buckets) *Conn {
 	return &Conn{
 		stream:     s,
 		reader:   peerreader.New(s, l, pieceTimeout, br),
@@ -47,11 +54,6 @@ func New(s network.Stream, l logger.Logger, pieceTimeout time.Duration, maxReque
 //	return p.conn.RemoteAddr().(*net.TCPAddr).IP.String()
 //}
 
-// String returns the remote address as string.
-func (p *Conn) String() string {
-	return p.stream.ID()
-}
-
 // Close stops receiving and sending messages and closes underlying net.Conn.
 func (p *Conn) Close() {
 	close(p.closeC)
@@ -69,6 +71,11 @@ func (p *Conn) Messages() <-chan interface{} {
 	return p.messages
 }
 
+// SetFastEnabled sets whether the peer supports Fast extension.
+func (p *Conn) SetFastEnabled(enabled bool) {
+	p.writer.SetFastEnabled(enabled)
+}
+
 // SendMessage queues a message for sending. Does not block.
 func (p *Conn) SendMessage(msg peerprotocol.Message) {
 	//p.log.Debugf("send message: %v\n", msg)
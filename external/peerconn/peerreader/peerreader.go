@@ -13,8 +13,7 @@ import (
 	"github.com/fichain/go-file/internal/bufferpool"
 	"github.com/fichain/go-file/internal/logger"
 	"github.com/fichain/go-file/internal/piece"
-	"github.com/juju/ratelimit"
-	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/fichain/go-file/internal/speedlimit"
 
 	"github.com/fichain/go-file/external/peerprotocol"
 )
@@ -30,26 +29,32 @@ const (
 
 var blockPool = bufferpool.New(piece.BlockSize)
 
+// Stream is the part of a peer connection that messages are read from.
+type Stream interface {
+	io.Reader
+	SetReadDeadline(t time.Time) error
+}
+
 // PeerReader is used for reading and parsing messages from a net.Conn.
 type PeerReader struct {
-	stream		 network.Stream
+	stream       Stream
 	r            io.Reader
 	log          logger.Logger
 	pieceTimeout time.Duration
-	bucket       *ratelimit.Bucket
+	buckets      speedlimit.Buckets
 	messages     chan interface{}
 	stopC        chan struct{}
 	doneC        chan struct{}
 }
 
 // New returns a new PeerReader by wrapping a net.Conn.
-func New(s network.Stream, l logger.Logger, pieceTimeout time.Duration, b *ratelimit.Bucket) *PeerReader {
+func New(s Stream, l logger.Logger, pieceTimeout time.Duration, b speedlimit.Buckets) *PeerReader {
 	return &PeerReader{
 		stream:         s,
 		r:            bufio.NewReaderSize(s, readBufferSize),
 		log:          l,
 		pieceTimeout: pieceTimeout,
-		bucket:       b,
+		buckets:      b,
 		messages:     make(chan interface{}),
 		stopC:        make(chan struct{}),
 		doneC:        make(chan struct{}),
@@ -273,8 +278,7 @@ func (p *PeerReader) readPiece(length uint32) (buf bufferpool.Buffer, err error)
 
 	var n, m int
 	for {
-		if p.bucket != nil {
-			d := p.bucket.Take(int64(length))
+		if d := p.buckets.Take(int64(length)); d > 0 {
 			select {
 			case <-time.After(d):
 			case <-p.stopC:
@@ -6,11 +6,11 @@ import (
 	"encoding/binary"
 	"io"
 	"net"
+	"sync/atomic"
 	"time"
 
 	"github.com/fichain/go-file/internal/logger"
-	"github.com/juju/ratelimit"
-	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/fichain/go-file/internal/speedlimit"
 
 	"github.com/fichain/go-file/external/peerconn/peerreader"
 	"github.com/fichain/go-file/external/peerprotocol"
@@ -18,41 +18,57 @@ import (
 
 const keepAlivePeriod = 2 * time.Minute
 
+// Stream is the part of a peer connection that messages are written to.
+type Stream interface {
+	io.WriteCloser
+	SetWriteDeadline(t time.Time) error
+}
+
 // PeerWriter is responsible for writing BitTorrent protocol messages to the peer connection.
 type PeerWriter struct {
-	stream                network.Stream
+	stream                Stream
 	queueC                chan peerprotocol.Message
 	cancelC               chan peerprotocol.CancelMessage
 	writeQueue            *list.List
 	maxQueuedRequests     int
-	fastEnabled           bool
+	fastEnabled           int32 // accessed atomically
 	currentQueuedRequests int
 	writeC                chan peerprotocol.Message
 	messages              chan interface{}
 	servedRequests        map[peerprotocol.RequestMessage]struct{}
-	bucket                *ratelimit.Bucket
+	buckets               speedlimit.Buckets
 	log                   logger.Logger
 	stopC                 chan struct{}
 	doneC                 chan struct{}
 }
 
 // New returns a new PeerWriter by wrapping a net.Conn.
-func New(stream network.Stream, l logger.Logger, maxQueuedRequests int, fastEnabled bool, b *ratelimit.Bucket) *PeerWriter {
-	return &PeerWriter{
+func New(stream Stream, l logger.Logger, maxQueuedRequests int, fastEnabled bool, b speedlimit.Buckets) *PeerWriter {
+	w := &PeerWriter{
 		stream:              stream,
 		queueC:            make(chan peerprotocol.Message),
 		cancelC:           make(chan peerprotocol.CancelMessage),
 		writeQueue:        list.New(),
 		maxQueuedRequests: maxQueuedRequests,
-		fastEnabled:       fastEnabled,
 		writeC:            make(chan peerprotocol.Message),
 		messages:          make(chan interface{}),
 		servedRequests:    make(map[peerprotocol.RequestMessage]struct{}),
-		bucket:            b,
+		buckets:           b,
 		log:               l,
 		stopC:             make(chan struct{}),
 		doneC:             make(chan struct{}),
 	}
+	w.SetFastEnabled(fastEnabled)
+	return w
+}
+
+// SetFastEnabled sets whether the peer supports Fast extension. Safe to call while the writer is running.
+func (p *PeerWriter) SetFastEnabled(enabled bool) {
+	var v int32
+	if enabled {
+		v = 1
+	}
+	atomic.StoreInt32(&p.fastEnabled, v)
 }
 
 // Messages returns a channel. Various events from the writer are sent to this channel.
@@ -137,7 +153,7 @@ func (p *PeerWriter) queueMessage(msg peerprotocol.Message) {
 	case Piece:
 		// Reject request if peer queued to many requests
 		if p.currentQueuedRequests >= p.maxQueuedRequests {
-			if p.fastEnabled {
+			if atomic.LoadInt32(&p.fastEnabled) == 1 {
 				msg = peerprotocol.RejectMessage{RequestMessage: msg2.RequestMessage}
 				break
 			} else {
@@ -150,11 +166,16 @@ func (p *PeerWriter) queueMessage(msg peerprotocol.Message) {
 	p.writeQueue.PushBack(msg)
 }
 
+// cancelQueuedPieceMessages removes the queued pieces when the peer is choked.
+// If the peer supports fast extension, requests must be rejected explicitly (BEP 6).
 func (p *PeerWriter) cancelQueuedPieceMessages() {
 	var next *list.Element
 	for e := p.writeQueue.Front(); e != nil; e = next {
 		next = e.Next()
-		if _, ok := e.Value.(Piece); ok {
+		if pi, ok := e.Value.(Piece); ok {
+			if atomic.LoadInt32(&p.fastEnabled) == 1 {
+				p.writeQueue.InsertBefore(peerprotocol.RejectMessage{RequestMessage: pi.RequestMessage}, e)
+			}
 			p.writeQueue.Remove(e)
 			p.currentQueuedRequests--
 		}
@@ -235,12 +256,13 @@ func (p *PeerWriter) messageWriter() {
 			// Put message ID
 			buf.Bytes()[4] = uint8(msg.ID())
 
-			if _, ok := msg.(Piece); ok && p.bucket != nil {
-				d := p.bucket.Take(int64(buf.Len()))
-				select {
-				case <-time.After(d):
-				case <-p.stopC:
-					return
+			if _, ok := msg.(Piece); ok {
+				if d := p.buckets.Take(int64(buf.Len())); d > 0 {
+					select {
+					case <-time.After(d):
+					case <-p.stopC:
+						return
+					}
 				}
 			}
 
@@ -4,7 +4,7 @@ import (
 	"bytes"
 	"testing"
 
-	"github.com/fichain/go-file/internal/peerprotocol"
+	"github.com/fichain/go-file/external/peerprotocol"
 )
 
 func BenchmarkRead(b *testing.B) {
@@ -23,7 +23,8 @@ const (
 	// ExtensionKeyMetadata is the key for the metadata extension.
 	ExtensionKeyMetadata = "ut_metadata"
 	// ExtensionKeyPEX is the key for the PEX extension.
-	ExtensionKeyPEX = "ut_pex"
+	// Peers are exchanged with libp2p peer IDs and multiaddrs, so the messages are not compatible with "ut_pex" of BEP 11.
+	ExtensionKeyPEX = "fc_pex"
 )
 
 const (
@@ -113,10 +114,12 @@ type ExtensionHandshakeMessage struct {
 	YourIP       string           `bencode:"yourip,omitempty"`
 	MetadataSize int              `bencode:"metadata_size,omitempty"`
 	RequestQueue int              `bencode:"reqq"`
+	// Features of the transfer protocol that the sender supports.
+	Features []string `bencode:"features,omitempty"`
 }
 
 // NewExtensionHandshake returns a new ExtensionHandshakeMessage by filling the struct with given values.
-func NewExtensionHandshake(metadataSize uint32, version string, yourip net.IP, requestQueueLength int) ExtensionHandshakeMessage {
+func NewExtensionHandshake(metadataSize uint32, version string, yourip net.IP, requestQueueLength int, features []string) ExtensionHandshakeMessage {
 	return ExtensionHandshakeMessage{
 		M: map[string]uint8{
 			ExtensionKeyMetadata: ExtensionIDMetadata,
@@ -126,6 +129,7 @@ func NewExtensionHandshake(metadataSize uint32, version string, yourip net.IP, r
 		YourIP:       string(truncateIP(yourip)),
 		MetadataSize: int(metadataSize),
 		RequestQueue: requestQueueLength,
+		Features:     features,
 	}
 }
 
@@ -139,8 +143,16 @@ type ExtensionMetadataMessage struct {
 
 // ExtensionPEXMessage is the message for the PEX extension.
 type ExtensionPEXMessage struct {
-	Added   string `bencode:"added"`
-	Dropped string `bencode:"dropped"`
+	Added   []PEXPeer `bencode:"added"`
+	Dropped []PEXPeer `bencode:"dropped"`
+}
+
+// PEXPeer is a peer in a PEX message.
+type PEXPeer struct {
+	// ID is the binary form of the libp2p peer ID.
+	ID string `bencode:"id"`
+	// Addrs are the binary forms of the multiaddrs that the peer can be dialed.
+	Addrs []string `bencode:"addrs,omitempty"`
 }
 
 func truncateIP(ip net.IP) net.IP {
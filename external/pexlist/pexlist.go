@@ -1,85 +1,126 @@
 package pexlist
 
 import (
-	"net"
-	"strings"
+	"fmt"
 
-	"github.com/fichain/go-file/internal/tracker"
+	"github.com/fichain/go-file/external/peerprotocol"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/multiformats/go-multiaddr"
 )
 
 const (
 	// BEP 11: Except for the initial PEX message the combined amount of added v4/v6 contacts should not exceed 50 entries.
 	// The same applies to dropped entries.
 	maxPeers = 50
+
+	// MaxAddrs is the maximum number of multiaddrs sent and accepted for a single peer.
+	MaxAddrs = 8
 )
 
 // PEXList contains the list of peer address for sending them to a peer at certain interval.
 // List contains 2 separate lists for added and dropped addresses.
 type PEXList struct {
-	added   map[tracker.CompactPeer]struct{}
-	dropped map[tracker.CompactPeer]struct{}
+	added   map[peer.ID]peerprotocol.PEXPeer
+	dropped map[peer.ID]peerprotocol.PEXPeer
 	flushed bool
 }
 
 // New returns a new empty PEXList.
 func New() *PEXList {
 	return &PEXList{
-		added:   make(map[tracker.CompactPeer]struct{}),
-		dropped: make(map[tracker.CompactPeer]struct{}),
+		added:   make(map[peer.ID]peerprotocol.PEXPeer),
+		dropped: make(map[peer.ID]peerprotocol.PEXPeer),
 	}
 }
 
 // NewWithRecentlySeen returns a new PEXList with given peers added to the dropped part.
-func NewWithRecentlySeen(rs []tracker.CompactPeer) *PEXList {
+func NewWithRecentlySeen(rs []peer.AddrInfo) *PEXList {
 	l := New()
-	for _, cp := range rs {
-		l.dropped[cp] = struct{}{}
+	for _, pi := range rs {
+		l.dropped[pi.ID] = NewPEXPeer(pi)
 	}
 	return l
 }
 
-// Add adds the address to the added part and removes from dropped part.
-func (l *PEXList) Add(addr *net.TCPAddr) {
-	p := tracker.NewCompactPeer(addr)
-	l.added[p] = struct{}{}
-	delete(l.dropped, p)
+// Add adds the peer to the added part and removes from dropped part.
+func (l *PEXList) Add(pi peer.AddrInfo) {
+	l.added[pi.ID] = NewPEXPeer(pi)
+	delete(l.dropped, pi.ID)
 }
 
-// Drop adds the address to the dropped part and removes from added part.
-func (l *PEXList) Drop(addr *net.TCPAddr) {
-	peer := tracker.NewCompactPeer(addr)
-	l.dropped[peer] = struct{}{}
-	delete(l.added, peer)
+// Drop adds the peer to the dropped part and removes from added part.
+func (l *PEXList) Drop(pi peer.AddrInfo) {
+	l.dropped[pi.ID] = NewPEXPeer(pi)
+	delete(l.added, pi.ID)
 }
 
 // Flush returns added and dropped parts and empty the list.
-func (l *PEXList) Flush() (added, dropped string) {
+func (l *PEXList) Flush() (added, dropped []peerprotocol.PEXPeer) {
 	added = l.flush(l.added, l.flushed)
 	dropped = l.flush(l.dropped, l.flushed)
 	l.flushed = true
 	return
 }
 
-func (l *PEXList) flush(m map[tracker.CompactPeer]struct{}, limit bool) string {
+func (l *PEXList) flush(m map[peer.ID]peerprotocol.PEXPeer, limit bool) []peerprotocol.PEXPeer {
 	count := len(m)
 	if limit && count > maxPeers {
 		count = maxPeers
 	}
 
-	var s strings.Builder
-	s.Grow(count * 6)
-	for p := range m {
+	peers := make([]peerprotocol.PEXPeer, 0, count)
+	for id, p := range m {
 		if count == 0 {
 			break
 		}
 		count--
 
-		b, err := p.MarshalBinary()
+		peers = append(peers, p)
+		delete(m, id)
+	}
+	return peers
+}
+
+// NewPEXPeer converts the peer to its form in PEX messages. At most MaxAddrs addresses are kept.
+func NewPEXPeer(pi peer.AddrInfo) peerprotocol.PEXPeer {
+	addrs := pi.Addrs
+	if len(addrs) > MaxAddrs {
+		addrs = addrs[:MaxAddrs]
+	}
+	p := peerprotocol.PEXPeer{
+		ID:    string(pi.ID),
+		Addrs: make([]string, 0, len(addrs)),
+	}
+	for _, addr := range addrs {
+		p.Addrs = append(p.Addrs, string(addr.Bytes()))
+	}
+	return p
+}
+
+// DecodePeers converts the peers received in a PEX message to dialable addresses.
+// Peers without addresses are skipped.
+func DecodePeers(peers []peerprotocol.PEXPeer) ([]peer.AddrInfo, error) {
+	ret := make([]peer.AddrInfo, 0, len(peers))
+	for _, p := range peers {
+		id, err := peer.IDFromBytes([]byte(p.ID))
 		if err != nil {
-			panic(err)
+			return nil, fmt.Errorf("invalid peer id in pex message: %s", err)
+		}
+		if len(p.Addrs) > MaxAddrs {
+			return nil, fmt.Errorf("too many addresses in pex message for peer %s: %d", id.Pretty(), len(p.Addrs))
+		}
+		pi := peer.AddrInfo{ID: id}
+		for _, b := range p.Addrs {
+			addr, err := multiaddr.NewMultiaddrBytes([]byte(b))
+			if err != nil {
+				return nil, fmt.Errorf("invalid address in pex message for peer %s: %s", id.Pretty(), err)
+			}
+			pi.Addrs = append(pi.Addrs, addr)
+		}
+		if len(pi.Addrs) == 0 {
+			continue
 		}
-		s.Write(b)
-		delete(m, p)
+		ret = append(ret, pi)
 	}
-	return s.String()
+	return ret, nil
 }
@@ -0,0 +1,58 @@
+package pexlist
+
+import (
+	"testing"
+
+	"github.com/fichain/go-file/external/peerprotocol"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/multiformats/go-multiaddr"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPEXListFlush(t *testing.T) {
+	var recent RecentlySeen
+	seen := newAddrInfo(t)
+	recent.Add(seen)
+	l := NewWithRecentlySeen(recent.Peers())
+
+	a := newAddrInfo(t)
+	l.Add(a)
+	l.Drop(a)
+	l.Add(seen)
+	added, dropped := l.Flush()
+	assert.Equal(t, []peerprotocol.PEXPeer{NewPEXPeer(seen)}, added)
+	assert.Equal(t, []peerprotocol.PEXPeer{NewPEXPeer(a)}, dropped)
+
+	added, dropped = l.Flush()
+	assert.Empty(t, added)
+	assert.Empty(t, dropped)
+
+	// Only the initial message may contain more than 50 peers.
+	for i := 0; i < 60; i++ {
+		l.Add(newAddrInfo(t))
+	}
+	added, _ = l.Flush()
+	assert.Len(t, added, 50)
+	added, _ = l.Flush()
+	assert.Len(t, added, 10)
+}
+
+func TestDecodePeers(t *testing.T) {
+	a := newAddrInfo(t)
+	a.Addrs = append(a.Addrs, multiaddr.StringCast("/ip6/::1/tcp/2"))
+	noAddrs := peer.AddrInfo{ID: newAddrInfo(t).ID}
+	peers, err := DecodePeers([]peerprotocol.PEXPeer{NewPEXPeer(a), NewPEXPeer(noAddrs)})
+	assert.NoError(t, err)
+	assert.Equal(t, []peer.AddrInfo{a}, peers)
+
+	_, err = DecodePeers([]peerprotocol.PEXPeer{{ID: "foo"}})
+	assert.Error(t, err)
+	_, err = DecodePeers([]peerprotocol.PEXPeer{{ID: string(a.ID), Addrs: []string{"foo"}}})
+	assert.Error(t, err)
+	many := NewPEXPeer(a)
+	for len(many.Addrs) <= MaxAddrs {
+		many.Addrs = append(many.Addrs, many.Addrs[0])
+	}
+	_, err = DecodePeers([]peerprotocol.PEXPeer{many})
+	assert.Error(t, err)
+}
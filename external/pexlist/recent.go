@@ -1,9 +1,7 @@
 package pexlist
 
 import (
-	"net"
-
-	"github.com/fichain/go-file/internal/tracker"
+	"github.com/libp2p/go-libp2p-core/peer"
 )
 
 // MaxLength is the maximum number of items to keep in the RecentlySeen list.
@@ -11,29 +9,28 @@ const MaxLength = 25
 
 // RecentlySeen is a peer address list that keeps the last `MaxLength` items.
 type RecentlySeen struct {
-	peers  []tracker.CompactPeer
+	peers  []peer.AddrInfo
 	offset int
 	length int
 }
 
 // Add a new address to the list.
-func (l *RecentlySeen) Add(addr *net.TCPAddr) {
-	cp := tracker.NewCompactPeer(addr)
-	if l.has(cp) {
+func (l *RecentlySeen) Add(pi peer.AddrInfo) {
+	if l.has(pi.ID) {
 		return
 	}
 	if l.length >= MaxLength {
-		l.peers[l.offset] = cp
+		l.peers[l.offset] = pi
 	} else {
-		l.peers = append(l.peers, cp)
+		l.peers = append(l.peers, pi)
 		l.length++
 	}
 	l.offset = (l.offset + 1) % MaxLength
 }
 
-func (l *RecentlySeen) has(cp tracker.CompactPeer) bool {
+func (l *RecentlySeen) has(id peer.ID) bool {
 	for _, p := range l.peers {
-		if p == cp {
+		if p.ID == id {
 			return true
 		}
 	}
@@ -41,7 +38,7 @@ func (l *RecentlySeen) has(cp tracker.CompactPeer) bool {
 }
 
 // Peers returns the addresses in the list.
-func (l *RecentlySeen) Peers() []tracker.CompactPeer {
+func (l *RecentlySeen) Peers() []peer.AddrInfo {
 	return l.peers
 }
 
@@ -1,28 +1,33 @@
 package pexlist
 
 import (
-	"net"
-	"strconv"
 	"testing"
 
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/test"
+	"github.com/multiformats/go-multiaddr"
 	"github.com/stretchr/testify/assert"
 )
 
 func TestRecentlySeen(t *testing.T) {
 	var l RecentlySeen
 	assert.Equal(t, 0, l.Len())
-	l.Add(newAddr("1.1.1.1"))
+	a := newAddrInfo(t)
+	l.Add(a)
 	assert.Equal(t, 1, l.Len())
-	l.Add(newAddr("1.1.1.1"))
+	l.Add(a)
 	assert.Equal(t, 1, l.Len())
 	for i := 0; i < 24; i++ {
-		l.Add(newAddr("2.2.2." + strconv.Itoa(i)))
+		l.Add(newAddrInfo(t))
 	}
 	assert.Equal(t, 25, l.Len())
-	l.Add(newAddr("3.3.3.3"))
+	l.Add(newAddrInfo(t))
 	assert.Equal(t, 25, l.Len())
 }
 
-func newAddr(ip string) *net.TCPAddr {
-	return &net.TCPAddr{IP: net.ParseIP(ip), Port: 1}
+func newAddrInfo(t *testing.T) peer.AddrInfo {
+	return peer.AddrInfo{
+		ID:    test.RandPeerIDFatal(t),
+		Addrs: []multiaddr.Multiaddr{multiaddr.StringCast("/ip4/1.1.1.1/tcp/1")},
+	}
 }
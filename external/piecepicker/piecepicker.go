@@ -16,6 +16,7 @@ import (
 These are the things to consider when selecting a piece for downloading:
 
   * Piece is done (hash checked and written to disk)
+  * Piece is skipped (belongs only to files that are not wanted)
   * Piece is writing
   * Peer has the piece
   * Peer is choking us
@@ -24,6 +25,7 @@ These are the things to consider when selecting a piece for downloading:
   * Piece is reserved for downloading by a webseed source
   * Is endgame mode activated (all pieces are requested)
   * Are there stalled peers (snubbed or choked in the middle of download)
+  * Piece has failed the hash check (downloaded from a single peer, preferably not a previous sender)
 
 Do not forget to re-check these when making changes.
 
@@ -50,6 +52,15 @@ type myPiece struct {
 
 	// Downloading from webseed source or marked to be downloaded later.
 	RequestedWebseed *webseedsource.WebseedSource
+
+	// Pieces with higher priority are picked first.
+	Priority int
+	// Skipped pieces are not picked at all.
+	Skipped bool
+
+	// Peers that have sent the piece with data that failed the hash check.
+	// Such a piece is downloaded again from a single peer at a time, so the sender of the corrupt data is known.
+	HashFailed peerset.PeerSet
 }
 
 // RunningDownloads returns the number of pieces that are being downloaded actively.
@@ -63,14 +74,34 @@ func (p *myPiece) StalledDownloads() int {
 	return p.Snubbed.Len() + p.Choked.Len()
 }
 
+// AvailableFrom returns true if the piece that has failed the hash check can be downloaded from the peer.
+// The peers that have sent corrupt data are used only if no other peer has the piece.
+func (p *myPiece) AvailableFrom(pe *peer.Peer) bool {
+	if p.HashFailed.Len() == 0 {
+		return true
+	}
+	if p.Requested.Len() > 0 || p.RequestedWebseed != nil {
+		return false
+	}
+	if !p.HashFailed.Has(pe) {
+		return true
+	}
+	for _, pe2 := range p.Having.Peers {
+		if !p.HashFailed.Has(pe2) {
+			return false
+		}
+	}
+	return true
+}
+
 // AvailableForWebseed returns true if the piece can be downloaded from a webseed source.
 // If the piece is already requested from a peer, it does not become eligible for downloading from webseed until entering the endgame mode.
 func (p *myPiece) AvailableForWebseed(duplicate bool) bool {
-	if p.Done || p.Writing || p.RequestedWebseed != nil {
+	if p.Done || p.Writing || p.Skipped || p.RequestedWebseed != nil {
 		return false
 	}
-	if !duplicate {
-		return p.RequestedWebseed != nil
+	if !duplicate || p.HashFailed.Len() > 0 {
+		return p.Requested.Len() == 0
 	}
 	return true
 }
@@ -96,6 +127,18 @@ func New(pieces []piece.Piece, maxDuplicateDownload int, webseedSources []*webse
 	}
 }
 
+// SetPriority sets the priority of the piece at index. Pieces with higher priority are picked before others.
+// Skipped pieces are not picked until they are unskipped.
+func (p *PiecePicker) SetPriority(i uint32, priority int, skip bool) {
+	mp := &p.pieces[i]
+	mp.Priority = priority
+	if mp.Skipped != skip {
+		mp.Skipped = skip
+		// There may be unrequested pieces again.
+		p.endgame = false
+	}
+}
+
 // CloseWebseedDownloader closes the download from a webseed source.
 func (p *PiecePicker) CloseWebseedDownloader(src *webseedsource.WebseedSource) {
 	src.DownloadSpeed.Stop()
@@ -165,6 +208,11 @@ func (p *PiecePicker) HandleSnubbed(pe *peer.Peer, i uint32) {
 	p.pieces[i].Snubbed.Add(pe)
 }
 
+// HandleUnsnubbed must be called when a snubbed peer starts sending blocks of the piece again.
+func (p *PiecePicker) HandleUnsnubbed(pe *peer.Peer, i uint32) {
+	p.pieces[i].Snubbed.Remove(pe)
+}
+
 // HandleChoke must be called to set choke status of the remote peer.
 func (p *PiecePicker) HandleChoke(pe *peer.Peer, i uint32) {
 	p.pieces[i].Snubbed.Remove(pe)
@@ -182,11 +230,17 @@ func (p *PiecePicker) HandleCancelDownload(pe *peer.Peer, i uint32) {
 	p.pieces[i].Snubbed.Remove(pe)
 }
 
+// HandleHashFailed must be called when the piece downloaded from the peer has failed the hash check.
+func (p *PiecePicker) HandleHashFailed(pe *peer.Peer, i uint32) {
+	p.pieces[i].HashFailed.Add(pe)
+}
+
 // HandleDisconnect must be called to remove the peer from internal indexes.
 func (p *PiecePicker) HandleDisconnect(pe *peer.Peer) {
 	for i := range p.pieces {
 		p.HandleCancelDownload(pe, uint32(i))
 		p.removeHavingPeer(i, pe)
+		p.pieces[i].HashFailed.Remove(pe)
 	}
 }
 
@@ -220,20 +274,6 @@ func (p *PiecePicker) findPiece(pe *peer.Peer) (mp *myPiece, allowedFast bool) {
 	if pe.Downloading {
 		return nil, false
 	}
-	//if p.downloadingWebseed() {
-	//	if pe.PeerChoking {
-	//		return nil, false
-	//	}
-	//	mp = p.pickLastPieceOfSmallestGap(pe)
-	//	if mp != nil {
-	//		return mp, pe.ReceivedAllowedFast.Has(mp.Piece)
-	//	}
-	//	mp = p.peerStealsFromWebseed(pe)
-	//	if mp != nil {
-	//		return mp, pe.ReceivedAllowedFast.Has(mp.Piece)
-	//	}
-	//	return nil, false
-	//}
 	// Pick allowed fast piece
 	pi := p.pickAllowedFast(pe)
 	if pi != nil {
@@ -252,6 +292,11 @@ func (p *PiecePicker) findPiece(pe *peer.Peer) (mp *myPiece, allowedFast bool) {
 	if pi != nil {
 		return pi, false
 	}
+	// Take a piece from the end of a webseed download
+	pi = p.peerStealsFromWebseed(pe)
+	if pi != nil {
+		return pi, false
+	}
 	// Check if endgame mode is activated
 	if p.endgame {
 		return p.pickEndgame(pe), false
@@ -263,10 +308,10 @@ func (p *PiecePicker) findPiece(pe *peer.Peer) (mp *myPiece, allowedFast bool) {
 func (p *PiecePicker) pickAllowedFast(pe *peer.Peer) *myPiece {
 	for _, pi := range pe.ReceivedAllowedFast.Pieces {
 		mp := &p.pieces[pi.Index]
-		if mp.Done || mp.Writing {
+		if mp.Done || mp.Writing || mp.Skipped || mp.RequestedWebseed != nil {
 			continue
 		}
-		if mp.Requested.Len() == 0 && mp.Having.Has(pe) {
+		if mp.Requested.Len() == 0 && mp.Having.Has(pe) && mp.AvailableFrom(pe) {
 			return mp
 		}
 	}
@@ -274,18 +319,27 @@ func (p *PiecePicker) pickAllowedFast(pe *peer.Peer) *myPiece {
 }
 
 func (p *PiecePicker) pickRarest(pe *peer.Peer) *myPiece {
-	// Sort by rarity
+	// Sort by priority, then by rarity
 	sort.Slice(p.piecesByAvailability, func(i, j int) bool {
-		return len(p.piecesByAvailability[i].Having.Peers) < len(p.piecesByAvailability[j].Having.Peers)
+		pi, pj := p.piecesByAvailability[i], p.piecesByAvailability[j]
+		if pi.Priority != pj.Priority {
+			return pi.Priority > pj.Priority
+		}
+		return len(pi.Having.Peers) < len(pj.Having.Peers)
 	})
 	var picked *myPiece
 	var hasUnrequested bool
 	// Select unrequested piece
 	for _, mp := range p.piecesByAvailability {
-		if mp.Done || mp.Writing {
+		if mp.Done || mp.Writing || mp.Skipped {
+			continue
+		}
+		if mp.RequestedWebseed != nil {
+			// Not in endgame yet, peers can take it from the end of the webseed download.
+			hasUnrequested = true
 			continue
 		}
-		if mp.Requested.Len() == 0 && mp.Having.Has(pe) {
+		if mp.Requested.Len() == 0 && mp.Having.Has(pe) && mp.AvailableFrom(pe) {
 			picked = mp
 			break
 		}
@@ -306,10 +360,10 @@ func (p *PiecePicker) pickEndgame(pe *peer.Peer) *myPiece {
 	})
 	// Select unrequested piece
 	for _, mp := range p.piecesByAvailability {
-		if mp.Done || mp.Writing {
+		if mp.Done || mp.Writing || mp.Skipped {
 			continue
 		}
-		if mp.Requested.Len() < p.maxDuplicateDownload && mp.Having.Has(pe) {
+		if mp.RunningDownloads() < p.maxDuplicateDownload && mp.Having.Has(pe) && mp.AvailableFrom(pe) {
 			return mp
 		}
 	}
@@ -323,13 +377,13 @@ func (p *PiecePicker) pickStalled(pe *peer.Peer) *myPiece {
 	})
 	// Select unrequested piece
 	for _, mp := range p.piecesByStalled {
-		if mp.Done || mp.Writing {
+		if mp.Done || mp.Writing || mp.Skipped {
 			continue
 		}
-		if mp.RunningDownloads() > 0 {
+		if mp.RunningDownloads() > 0 || mp.RequestedWebseed != nil {
 			continue
 		}
-		if mp.Requested.Len() < p.maxDuplicateDownload && mp.Having.Has(pe) {
+		if mp.Requested.Len() < p.maxDuplicateDownload && mp.Having.Has(pe) && mp.AvailableFrom(pe) {
 			return mp
 		}
 	}
@@ -1,10 +1,11 @@
 package piecepicker
 
 import (
+	"strconv"
 	"testing"
 
+	"github.com/fichain/go-file/external/peer"
 	"github.com/fichain/go-file/internal/bitfield"
-	"github.com/fichain/go-file/internal/peer"
 	"github.com/fichain/go-file/internal/piece"
 	"github.com/stretchr/testify/assert"
 )
@@ -69,13 +70,104 @@ func TestPiecePicker(t *testing.T) {
 	assert.True(t, pp.endgame)
 }
 
+func TestPiecePickerSnubbed(t *testing.T) {
+	pieces := []piece.Piece{newPiece(0)}
+	peers := make([]*peer.Peer, numPeers)
+	for i := range peers {
+		peers[i] = newPeer(i)
+	}
+	pp := New(pieces, 1, nil)
+	for _, pe := range peers {
+		pp.HandleHave(pe, 0)
+	}
+
+	assert.Equal(t, &pieces[0], pp.pickFor(peers[0]))
+	assert.Nil(t, pp.pickFor(peers[1]))
+	assert.True(t, pp.endgame)
+
+	// Snubbed peer does not count as a running download.
+	pp.HandleSnubbed(peers[0], 0)
+	assert.Equal(t, 0, pp.pieces[0].RunningDownloads())
+	assert.Equal(t, &pieces[0], pp.pickFor(peers[1]))
+	assert.Nil(t, pp.pickFor(peers[2]))
+
+	pp.HandleUnsnubbed(peers[0], 0)
+	assert.Equal(t, 2, pp.pieces[0].RunningDownloads())
+	assert.Equal(t, 0, pp.pieces[0].StalledDownloads())
+}
+
+func TestPiecePickerPriorities(t *testing.T) {
+	pieces := make([]piece.Piece, 4)
+	for i := range pieces {
+		pieces[i] = newPiece(i)
+	}
+	peers := make([]*peer.Peer, 4)
+	for i := range peers {
+		peers[i] = newPeer(i)
+	}
+	pp := New(pieces, 1, nil)
+	pp.SetPriority(0, 0, true)
+	pp.SetPriority(2, 1, false)
+	pp.SetPriority(3, -1, false)
+	for _, pe := range peers {
+		for i := range pieces {
+			pp.HandleHave(pe, uint32(i))
+		}
+	}
+	// Piece #3 is rarer but has lower priority.
+	pp.HandleDisconnect(peers[3])
+	pp.HandleHave(peers[3], 1)
+	pp.HandleHave(peers[3], 2)
+
+	assert.Equal(t, &pieces[2], pp.pickFor(peers[0]))
+	assert.Equal(t, &pieces[1], pp.pickFor(peers[1]))
+	assert.Equal(t, &pieces[3], pp.pickFor(peers[2]))
+	assert.Nil(t, pp.pickFor(peers[3]))
+	assert.True(t, pp.endgame)
+
+	// Unskipped piece is picked after leaving endgame.
+	pp.SetPriority(0, 0, false)
+	assert.False(t, pp.endgame)
+	peers = append(peers, newPeer(4))
+	pp.HandleHave(peers[4], 0)
+	assert.Equal(t, &pieces[0], pp.pickFor(peers[4]))
+}
+
+func TestPiecePickerHashFailed(t *testing.T) {
+	pieces := []piece.Piece{newPiece(0)}
+	peers := make([]*peer.Peer, numPeers)
+	for i := range peers {
+		peers[i] = newPeer(i)
+	}
+	pp := New(pieces, 2, nil)
+	pp.HandleHave(peers[0], 0)
+	pp.HandleHave(peers[1], 0)
+
+	assert.Equal(t, &pieces[0], pp.pickFor(peers[0]))
+	pp.HandleCancelDownload(peers[0], 0)
+	pp.HandleHashFailed(peers[0], 0)
+
+	// The sender of the corrupt piece is not used while another peer has the piece.
+	assert.Nil(t, pp.pickFor(peers[0]))
+	assert.Equal(t, &pieces[0], pp.pickFor(peers[1]))
+	// No duplicate downloads for the piece, even in endgame.
+	pp.HandleHave(peers[2], 0)
+	assert.Nil(t, pp.pickFor(peers[2]))
+	assert.True(t, pp.endgame)
+
+	// The sender is used again if it is the only peer having the piece.
+	pp.HandleDisconnect(peers[1])
+	pp.HandleDisconnect(peers[2])
+	assert.Equal(t, &pieces[0], pp.pickFor(peers[0]))
+}
+
 func newPiece(i int) piece.Piece {
 	return piece.Piece{Index: uint32(i)}
 }
 
 func newPeer(i int) *peer.Peer {
 	return &peer.Peer{
-		ID:       [20]byte{byte(i)},
+		ID:       strconv.Itoa(i),
 		Bitfield: bitfield.New(numPieces),
 	}
 }
@@ -0,0 +1,103 @@
+package piecepicker
+
+import (
+	"github.com/fichain/go-file/external/peer"
+	"github.com/fichain/go-file/internal/webseedsource"
+)
+
+// WebseedDownloadSpec contains the range of pieces to download from a webseed source.
+type WebseedDownloadSpec struct {
+	Source *webseedsource.WebseedSource
+	Begin  uint32 // piece index
+	End    uint32 // piece index, exclusive
+}
+
+// PickWebseed reserves the next range of pieces for downloading from the webseed source.
+// It returns nil if there is nothing left to download from the source.
+func (p *PiecePicker) PickWebseed(src *webseedsource.WebseedSource) *WebseedDownloadSpec {
+	begin, end := p.findWebseedRange(false)
+	if begin == end {
+		begin, end = p.splitWebseedDownload()
+	}
+	if begin == end {
+		// Race with the peers that are downloading remaining pieces.
+		begin, end = p.findWebseedRange(true)
+	}
+	if begin == end {
+		return nil
+	}
+	for i := begin; i < end; i++ {
+		p.pieces[i].RequestedWebseed = src
+	}
+	return &WebseedDownloadSpec{
+		Source: src,
+		Begin:  begin,
+		End:    end,
+	}
+}
+
+// findWebseedRange returns the longest run of consecutive pieces that are available for webseed downloads.
+func (p *PiecePicker) findWebseedRange(duplicate bool) (begin, end uint32) {
+	var gapBegin uint32
+	var inGap bool
+	for i := range p.pieces {
+		ok := p.pieces[i].AvailableForWebseed(duplicate)
+		switch {
+		case ok && !inGap:
+			gapBegin = uint32(i)
+			inGap = true
+		case !ok && inGap:
+			if uint32(i)-gapBegin > end-begin {
+				begin, end = gapBegin, uint32(i)
+			}
+			inGap = false
+		}
+	}
+	if inGap && uint32(len(p.pieces))-gapBegin > end-begin {
+		begin, end = gapBegin, uint32(len(p.pieces))
+	}
+	return
+}
+
+// splitWebseedDownload takes the second half of the longest webseed download, so another source can work on it.
+func (p *PiecePicker) splitWebseedDownload() (begin, end uint32) {
+	var longest *webseedsource.WebseedSource
+	for _, src := range p.webseedSources {
+		if src.Remaining() < 2 {
+			continue
+		}
+		if longest == nil || src.Remaining() > longest.Remaining() {
+			longest = src
+		}
+	}
+	if longest == nil {
+		return
+	}
+	end = longest.Downloader.End
+	begin = end - longest.Remaining()/2
+	p.WebseedStopAt(longest, begin)
+	return
+}
+
+// peerStealsFromWebseed takes the last piece of a webseed download that the peer has.
+// Peers and webseed sources work from the opposite ends of the range, so they do not download the same pieces.
+func (p *PiecePicker) peerStealsFromWebseed(pe *peer.Peer) *myPiece {
+	var longest *webseedsource.WebseedSource
+	for _, src := range p.webseedSources {
+		if src.Remaining() == 0 {
+			continue
+		}
+		if !p.pieces[src.Downloader.End-1].Having.Has(pe) {
+			continue
+		}
+		if longest == nil || src.Remaining() > longest.Remaining() {
+			longest = src
+		}
+	}
+	if longest == nil {
+		return nil
+	}
+	i := longest.Downloader.End - 1
+	p.WebseedStopAt(longest, i)
+	return &p.pieces[i]
+}
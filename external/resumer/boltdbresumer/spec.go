@@ -10,6 +10,8 @@ import (
 type Spec struct {
 	InfoHash          []byte
 	Name              string
+	Trackers          [][]string
+	URLList           []string
 	FixedPeers        []string
 	Info              []byte
 	Bitfield          []byte
@@ -20,11 +22,32 @@ type Spec struct {
 	SeededFor         time.Duration
 	Started           bool
 	StopAfterDownload bool
+	// Speed limits of the torrent in KB/s. Zero means no limit.
+	SpeedLimitDownload int64
+	SpeedLimitUpload   int64
+	// Share of the torrent from session bandwidth and write cache. See filechain.Priority.
+	Priority int
+	// Seeding goals of the torrent. nil means the defaults in the session config are used.
+	SeedGoals *SeedGoals
+	// Created is true for torrents made from local files with Session.CreateFile. Their data is never deleted by the session.
+	Created bool
+	// Position of the torrent in the session queue. Lower positions are started first.
+	QueuePosition int
+	// Priorities of the files in the torrent. See filechain.FilePriority. Empty means all files have normal priority.
+	FilePriorities []int
 
 	//add
 	DataDir 		  string
 }
 
+// SeedGoals are the limits that end seeding of a torrent. See filechain.SeedGoals.
+type SeedGoals struct {
+	Ratio    float64
+	SeedTime time.Duration
+	IdleTime time.Duration
+	Action   int
+}
+
 type jsonSpec struct {
 	Port              int
 	Name              string
@@ -38,6 +61,13 @@ type jsonSpec struct {
 	Started           bool
 	StopAfterDownload bool
 
+	SpeedLimitDownload int64
+	SpeedLimitUpload   int64
+	Priority           int
+	SeedGoals          *SeedGoals
+	QueuePosition      int
+	FilePriorities     []int
+
 	// JSON safe types
 	InfoHash  string
 	Info      string
@@ -49,6 +79,8 @@ type jsonSpec struct {
 func (s Spec) MarshalJSON() ([]byte, error) {
 	j := jsonSpec{
 		Name:              s.Name,
+		Trackers:          s.Trackers,
+		URLList:           s.URLList,
 		FixedPeers:        s.FixedPeers,
 		AddedAt:           s.AddedAt,
 		BytesDownloaded:   s.BytesDownloaded,
@@ -57,6 +89,13 @@ func (s Spec) MarshalJSON() ([]byte, error) {
 		Started:           s.Started,
 		StopAfterDownload: s.StopAfterDownload,
 
+		SpeedLimitDownload: s.SpeedLimitDownload,
+		SpeedLimitUpload:   s.SpeedLimitUpload,
+		Priority:           s.Priority,
+		SeedGoals:          s.SeedGoals,
+		QueuePosition:      s.QueuePosition,
+		FilePriorities:     s.FilePriorities,
+
 		InfoHash:  base64.StdEncoding.EncodeToString(s.InfoHash),
 		Info:      base64.StdEncoding.EncodeToString(s.Info),
 		Bitfield:  base64.StdEncoding.EncodeToString(s.Bitfield),
@@ -86,6 +125,8 @@ func (s *Spec) UnmarshalJSON(b []byte) error {
 	}
 	s.SeededFor = time.Duration(j.SeededFor)
 	s.Name = j.Name
+	s.Trackers = j.Trackers
+	s.URLList = j.URLList
 	s.FixedPeers = j.FixedPeers
 	s.AddedAt = j.AddedAt
 	s.BytesDownloaded = j.BytesDownloaded
@@ -93,5 +134,11 @@ func (s *Spec) UnmarshalJSON(b []byte) error {
 	s.BytesWasted = j.BytesWasted
 	s.Started = j.Started
 	s.StopAfterDownload = j.StopAfterDownload
+	s.SpeedLimitDownload = j.SpeedLimitDownload
+	s.SpeedLimitUpload = j.SpeedLimitUpload
+	s.Priority = j.Priority
+	s.SeedGoals = j.SeedGoals
+	s.QueuePosition = j.QueuePosition
+	s.FilePriorities = j.FilePriorities
 	return nil
 }
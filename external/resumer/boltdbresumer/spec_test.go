@@ -2,13 +2,24 @@ package boltdbresumer
 
 import (
 	"bytes"
+	"reflect"
 	"testing"
+	"time"
 )
 
 func TestMarshalUnmarshalSpec(t *testing.T) {
 	s := Spec{
-		Info: []byte{1, 2, 3},
-		Name: "foo",
+		Info:     []byte{1, 2, 3},
+		Name:     "foo",
+		Trackers: [][]string{{"http://tracker.example.com/announce"}},
+		URLList:  []string{"http://origin.example.com/files/"},
+
+		SpeedLimitDownload: 100,
+		SpeedLimitUpload:   50,
+		Priority:           1,
+		SeedGoals:          &SeedGoals{Ratio: 1.5, SeedTime: time.Hour, Action: 2},
+		QueuePosition:      7,
+		FilePriorities:     []int{-2, 0, 1},
 	}
 	b, err := s.MarshalJSON()
 	if err != nil {
@@ -25,4 +36,25 @@ func TestMarshalUnmarshalSpec(t *testing.T) {
 	if s.Name != s2.Name {
 		t.FailNow()
 	}
+	if !reflect.DeepEqual(s.Trackers, s2.Trackers) {
+		t.FailNow()
+	}
+	if !reflect.DeepEqual(s.URLList, s2.URLList) {
+		t.FailNow()
+	}
+	if s.SpeedLimitDownload != s2.SpeedLimitDownload || s.SpeedLimitUpload != s2.SpeedLimitUpload {
+		t.FailNow()
+	}
+	if s.Priority != s2.Priority {
+		t.FailNow()
+	}
+	if !reflect.DeepEqual(s.SeedGoals, s2.SeedGoals) {
+		t.FailNow()
+	}
+	if s.QueuePosition != s2.QueuePosition {
+		t.FailNow()
+	}
+	if !reflect.DeepEqual(s.FilePriorities, s2.FilePriorities) {
+		t.FailNow()
+	}
 }
@@ -15,6 +15,8 @@ import (
 var Keys = struct {
 	InfoHash        []byte
 	Name            []byte
+	Trackers        []byte
+	URLList         []byte
 	FixedPeers      []byte
 	Dest            []byte
 	Info            []byte
@@ -26,6 +28,14 @@ var Keys = struct {
 	SeededFor       []byte
 	Started         []byte
 
+	SpeedLimitDownload []byte
+	SpeedLimitUpload   []byte
+	Priority           []byte
+	SeedGoals          []byte
+	Created            []byte
+	QueuePosition      []byte
+	FilePriorities     []byte
+
 	//add
 	DataDir 		[]byte
 
@@ -35,6 +45,8 @@ var Keys = struct {
 }{
 	InfoHash:        []byte("info_hash"),
 	Name:            []byte("name"),
+	Trackers:        []byte("trackers"),
+	URLList:         []byte("url_list"),
 	FixedPeers:      []byte("fixed_peers"),
 	Dest:            []byte("dest"),
 	Info:            []byte("info"),
@@ -46,6 +58,14 @@ var Keys = struct {
 	SeededFor:       []byte("seeded_for"),
 	Started:         []byte("started"),
 
+	SpeedLimitDownload: []byte("speed_limit_download"),
+	SpeedLimitUpload:   []byte("speed_limit_upload"),
+	Priority:           []byte("priority"),
+	SeedGoals:          []byte("seed_goals"),
+	Created:            []byte("created"),
+	QueuePosition:      []byte("queue_position"),
+	FilePriorities:     []byte("file_priorities"),
+
 	//add
 	DataDir: 		 []byte("data_dir"),
 
@@ -83,10 +103,29 @@ func NewTorrentResumer(db *bbolt.DB, bucket []byte, user []byte) (*TorrentResume
 
 // Write the torrent spec for torrent with `torrentID`.
 func (r *TorrentResumer) Write(torrentID string, spec *Spec) error {
+	trackers, err := json.Marshal(spec.Trackers)
+	if err != nil {
+		return err
+	}
+	urlList, err := json.Marshal(spec.URLList)
+	if err != nil {
+		return err
+	}
 	fixedPeers, err := json.Marshal(spec.FixedPeers)
 	if err != nil {
 		return err
 	}
+	var seedGoals []byte
+	if spec.SeedGoals != nil {
+		seedGoals, err = json.Marshal(spec.SeedGoals)
+		if err != nil {
+			return err
+		}
+	}
+	filePriorities, err := json.Marshal(spec.FilePriorities)
+	if err != nil {
+		return err
+	}
 	return r.db.Update(func(tx *bbolt.Tx) error {
 		b, err := tx.Bucket(r.user).Bucket(r.bucket).CreateBucketIfNotExists([]byte(torrentID))
 		if err != nil {
@@ -94,6 +133,8 @@ func (r *TorrentResumer) Write(torrentID string, spec *Spec) error {
 		}
 		_ = b.Put(Keys.InfoHash, spec.InfoHash)
 		_ = b.Put(Keys.Name, []byte(spec.Name))
+		_ = b.Put(Keys.Trackers, trackers)
+		_ = b.Put(Keys.URLList, urlList)
 		_ = b.Put(Keys.FixedPeers, fixedPeers)
 		_ = b.Put(Keys.Info, spec.Info)
 		_ = b.Put(Keys.Bitfield, spec.Bitfield)
@@ -103,6 +144,19 @@ func (r *TorrentResumer) Write(torrentID string, spec *Spec) error {
 		_ = b.Put(Keys.BytesWasted, []byte(strconv.FormatInt(spec.BytesWasted, 10)))
 		_ = b.Put(Keys.SeededFor, []byte(spec.SeededFor.String()))
 		_ = b.Put(Keys.Started, []byte(strconv.FormatBool(spec.Started)))
+		_ = b.Put(Keys.SpeedLimitDownload, []byte(strconv.FormatInt(spec.SpeedLimitDownload, 10)))
+		_ = b.Put(Keys.SpeedLimitUpload, []byte(strconv.FormatInt(spec.SpeedLimitUpload, 10)))
+		_ = b.Put(Keys.Priority, []byte(strconv.Itoa(spec.Priority)))
+		if seedGoals != nil {
+			_ = b.Put(Keys.SeedGoals, seedGoals)
+		}
+		if spec.Created {
+			_ = b.Put(Keys.Created, []byte(strconv.FormatBool(spec.Created)))
+		}
+		_ = b.Put(Keys.QueuePosition, []byte(strconv.Itoa(spec.QueuePosition)))
+		if len(spec.FilePriorities) > 0 {
+			_ = b.Put(Keys.FilePriorities, filePriorities)
+		}
 		_ = b.Put(Keys.DataDir, []byte(spec.DataDir))
 		return nil
 	})
@@ -119,6 +173,21 @@ func (r *TorrentResumer) WriteInfo(torrentID string, value []byte) error {
 	})
 }
 
+// WriteTrackers writes only the trackers of a torrent.
+func (r *TorrentResumer) WriteTrackers(torrentID string, value [][]string) error {
+	trackers, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return r.db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(r.user).Bucket(r.bucket).Bucket([]byte(torrentID))
+		if b == nil {
+			return nil
+		}
+		return b.Put(Keys.Trackers, trackers)
+	})
+}
+
 // WriteBitfield writes only bitfield of a torrent.
 func (r *TorrentResumer) WriteBitfield(torrentID string, value []byte) error {
 	return r.db.Update(func(tx *bbolt.Tx) error {
@@ -141,6 +210,104 @@ func (r *TorrentResumer) WriteStarted(torrentID string, value bool) error {
 	})
 }
 
+// WriteSpeedLimits writes the download and upload speed limits of a torrent.
+func (r *TorrentResumer) WriteSpeedLimits(torrentID string, download, upload int64) error {
+	return r.db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(r.user).Bucket(r.bucket).Bucket([]byte(torrentID))
+		if b == nil {
+			return nil
+		}
+		err := b.Put(Keys.SpeedLimitDownload, []byte(strconv.FormatInt(download, 10)))
+		if err != nil {
+			return err
+		}
+		return b.Put(Keys.SpeedLimitUpload, []byte(strconv.FormatInt(upload, 10)))
+	})
+}
+
+// WritePriority writes the priority of a torrent.
+func (r *TorrentResumer) WritePriority(torrentID string, priority int) error {
+	return r.db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(r.user).Bucket(r.bucket).Bucket([]byte(torrentID))
+		if b == nil {
+			return nil
+		}
+		return b.Put(Keys.Priority, []byte(strconv.Itoa(priority)))
+	})
+}
+
+// WriteQueuePositions writes the queue positions of torrents in a single transaction.
+func (r *TorrentResumer) WriteQueuePositions(positions map[string]int) error {
+	return r.db.Update(func(tx *bbolt.Tx) error {
+		for id, pos := range positions {
+			b := tx.Bucket(r.user).Bucket(r.bucket).Bucket([]byte(id))
+			if b == nil {
+				continue
+			}
+			err := b.Put(Keys.QueuePosition, []byte(strconv.Itoa(pos)))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// WriteFilePriorities writes the priorities of the files in a torrent. Empty value deletes the priorities.
+func (r *TorrentResumer) WriteFilePriorities(torrentID string, priorities []int) error {
+	var value []byte
+	if len(priorities) > 0 {
+		var err error
+		value, err = json.Marshal(priorities)
+		if err != nil {
+			return err
+		}
+	}
+	return r.db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(r.user).Bucket(r.bucket).Bucket([]byte(torrentID))
+		if b == nil {
+			return nil
+		}
+		if value == nil {
+			return b.Delete(Keys.FilePriorities)
+		}
+		return b.Put(Keys.FilePriorities, value)
+	})
+}
+
+// WriteSeedGoals writes the seeding goals of a torrent. nil value deletes the goals of the torrent.
+func (r *TorrentResumer) WriteSeedGoals(torrentID string, value *SeedGoals) error {
+	var goals []byte
+	if value != nil {
+		var err error
+		goals, err = json.Marshal(value)
+		if err != nil {
+			return err
+		}
+	}
+	return r.db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(r.user).Bucket(r.bucket).Bucket([]byte(torrentID))
+		if b == nil {
+			return nil
+		}
+		if goals == nil {
+			return b.Delete(Keys.SeedGoals)
+		}
+		return b.Put(Keys.SeedGoals, goals)
+	})
+}
+
+// Delete removes the resume data of a torrent.
+func (r *TorrentResumer) Delete(torrentID string) error {
+	return r.db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(r.user).Bucket(r.bucket)
+		if b.Bucket([]byte(torrentID)) == nil {
+			return nil
+		}
+		return b.DeleteBucket([]byte(torrentID))
+	})
+}
+
 func (r *TorrentResumer) Read(torrentID string) (spec *Spec, err error) {
 	defer debug.SetPanicOnFault(debug.SetPanicOnFault(true))
 	defer func() {
@@ -170,6 +337,22 @@ func (r *TorrentResumer) Read(torrentID string) (spec *Spec, err error) {
 			spec.Name = string(value)
 		}
 
+		value = b.Get(Keys.Trackers)
+		if value != nil {
+			err = json.Unmarshal(value, &spec.Trackers)
+			if err != nil {
+				return err
+			}
+		}
+
+		value = b.Get(Keys.URLList)
+		if value != nil {
+			err = json.Unmarshal(value, &spec.URLList)
+			if err != nil {
+				return err
+			}
+		}
+
 		value = b.Get(Keys.FixedPeers)
 		if value != nil {
 			err = json.Unmarshal(value, &spec.FixedPeers)
@@ -238,6 +421,63 @@ func (r *TorrentResumer) Read(torrentID string) (spec *Spec, err error) {
 			}
 		}
 
+		value = b.Get(Keys.SpeedLimitDownload)
+		if value != nil {
+			spec.SpeedLimitDownload, err = strconv.ParseInt(string(value), 10, 64)
+			if err != nil {
+				return err
+			}
+		}
+
+		value = b.Get(Keys.SpeedLimitUpload)
+		if value != nil {
+			spec.SpeedLimitUpload, err = strconv.ParseInt(string(value), 10, 64)
+			if err != nil {
+				return err
+			}
+		}
+
+		value = b.Get(Keys.Priority)
+		if value != nil {
+			spec.Priority, err = strconv.Atoi(string(value))
+			if err != nil {
+				return err
+			}
+		}
+
+		value = b.Get(Keys.SeedGoals)
+		if value != nil {
+			spec.SeedGoals = new(SeedGoals)
+			err = json.Unmarshal(value, spec.SeedGoals)
+			if err != nil {
+				return err
+			}
+		}
+
+		value = b.Get(Keys.Created)
+		if value != nil {
+			spec.Created, err = strconv.ParseBool(string(value))
+			if err != nil {
+				return err
+			}
+		}
+
+		value = b.Get(Keys.QueuePosition)
+		if value != nil {
+			spec.QueuePosition, err = strconv.Atoi(string(value))
+			if err != nil {
+				return err
+			}
+		}
+
+		value = b.Get(Keys.FilePriorities)
+		if value != nil {
+			err = json.Unmarshal(value, &spec.FilePriorities)
+			if err != nil {
+				return err
+			}
+		}
+
 		value = b.Get(Keys.DataDir)
 		if value != nil {
 			spec.DataDir = string(value)
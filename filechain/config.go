@@ -2,6 +2,8 @@ package filechain
 
 import (
 	"time"
+
+	"github.com/fichain/go-file/external/p2p"
 )
 
 // Config for Session.
@@ -9,9 +11,32 @@ type Config struct {
 	//add
 	LibP2pPort 		int
 	LibP2pBootStrap []string
+	// Peers must send the transfer handshake in this duration after opening a stream.
 	LibP2pHandShake time.Duration
+	// Newest version of the transfer protocol to speak. Older versions are also accepted.
+	// With an older peer, the newest version known by both sides is used.
+	LibP2pProtocolVersion string
 	LipP2pRandSeed 	int64
 	LibP2pUser 		string
+	// Path of a libp2p swarm key file or the key itself. If set, only the nodes having the same key can connect.
+	LibP2pPrivateNetworkKey string
+	// Prefix of the DHT protocols. Bootstrap nodes must use the same prefix.
+	LibP2pDHTProtocolPrefix string
+	// Connection manager closes connections when the number of connections exceeds LibP2pConnHighWater,
+	// until LibP2pConnLowWater connections are left. Connections younger than LibP2pConnGracePeriod are kept.
+	// Bootstrap nodes and peers that we are transferring data with are never closed.
+	LibP2pConnLowWater  int
+	LibP2pConnHighWater int
+	LibP2pConnGracePeriod time.Duration
+	// Session keeps at least LibP2pMinRoutingTablePeers peers in the DHT routing table.
+	// Connectivity is checked every LibP2pBootstrapInterval and when a connection is closed.
+	// If the routing table has less peers or all bootstrap peers are disconnected,
+	// bootstrap peers are dialed again and failed attempts are retried with an exponential backoff.
+	LibP2pMinRoutingTablePeers int
+	LibP2pBootstrapInterval    time.Duration
+	LibP2pBootstrapDialTimeout time.Duration
+	LibP2pBootstrapMinBackoff  time.Duration
+	LibP2pBootstrapMaxBackoff  time.Duration
 	Debug			bool
 
 	// Database file to save resume data.
@@ -23,6 +48,9 @@ type Config struct {
 	DataDirIncludesTorrentID bool
 	// New torrents will be listened at selected port in this range.
 	PortBegin, PortEnd uint16
+	// If true, running torrents also listen a TCP port in PortBegin..PortEnd range
+	// and exchange pieces with classic BitTorrent peers in addition to libp2p peers.
+	BitTorrentEnabled bool
 	// At start, client will set max open files limit to this number. (like "ulimit -n" command)
 	MaxOpenFiles uint64
 	// Enable peer exchange protocol.
@@ -49,6 +77,10 @@ type Config struct {
 	BlocklistEnabledForIncomingConnections bool
 	// Do not accept response larger than this size
 	BlocklistMaxResponseSize int64
+	// If not empty, only the peers with these libp2p peer IDs can connect.
+	LibP2pAllowedPeers []string
+	// Peers with these libp2p peer IDs can never connect.
+	LibP2pDeniedPeers []string
 	// Time to wait when adding torrent with AddURI().
 	TorrentAddHTTPTimeout time.Duration
 	// Maximum allowed size to be received by metadata extension.
@@ -63,8 +95,39 @@ type Config struct {
 	SpeedLimitDownload int64
 	// Global upload speed limit in KB/s.
 	SpeedLimitUpload int64
+	// Download speed limit of a single peer connection in KB/s.
+	PeerSpeedLimitDownload int64
+	// Upload speed limit of a single peer connection in KB/s.
+	PeerSpeedLimitUpload int64
+	// Global speed limits are divided between active torrents by their priorities at this interval.
+	SpeedLimitShareInterval time.Duration
 	// Start torrent automatically if it was running when previous session was closed.
 	ResumeOnStartup bool
+	// Weekly rules that change speed limits and torrent activity at certain times.
+	// Later rules override the speed limits of earlier ones when their windows overlap.
+	Schedule []ScheduleRule
+	// Schedule is checked at this interval and the settings are changed when the set of active rules changes.
+	ScheduleCheckInterval time.Duration
+	// Returns the current time for checking Schedule. If nil, time.Now is used.
+	ScheduleClock func() time.Time
+	// Seeding goals of the torrents that do not have their own goals. Zero value means seeding never ends by itself.
+	SeedGoals SeedGoals
+	// Maximum number of running torrents that are downloading, seeding or checking files.
+	// A checking torrent also takes a slot of downloading or seeding, whichever it is going to do after checking.
+	// Only torrents that verify existing files take a checking slot, others start without waiting for one.
+	// Torrents over the limits are put in Queued status and started in queue order as slots free up.
+	// Zero means no limit. Queue is disabled if all limits are zero.
+	MaxActiveDownloads int
+	MaxActiveSeeds     int
+	MaxActiveChecking  int
+	// Do not count slow torrents against MaxActiveDownloads and MaxActiveSeeds.
+	QueueSkipSlowTorrents bool
+	// A torrent is slow if it has been running for SlowTorrentTimeout and its speed is under SlowTorrentSpeed in KB/s.
+	// Download speed is used for downloading torrents, upload speed is used for seeding torrents.
+	SlowTorrentSpeed   int
+	SlowTorrentTimeout time.Duration
+	// Queue is checked at this interval, in addition to the changes of torrents.
+	QueueCheckInterval time.Duration
 
 	// Enable RPC server
 	RPCEnabled bool
@@ -75,6 +138,22 @@ type Config struct {
 	// Time to wait for ongoing requests before shutting down RPC HTTP server.
 	RPCShutdownTimeout time.Duration
 
+	// Enable HTTP gateway that serves the files of torrents at GET /<infohash>/<file path>.
+	GatewayEnabled bool
+	// Host to listen for HTTP gateway
+	GatewayHost string
+	// Listen port for HTTP gateway. A random port is picked if zero.
+	GatewayPort int
+	// If true, torrents that are not in session are added with a magnet link of the info hash on first access.
+	GatewayAddTorrents bool
+	// Time to wait for the metadata of a torrent before responding with an error.
+	GatewayMetadataTimeout time.Duration
+	// Stopped and queued torrents are started for a request. Time to wait for a free slot in the queue
+	// before responding with 503 Service Unavailable.
+	GatewayQueueTimeout time.Duration
+	// Time to wait for ongoing requests before shutting down HTTP gateway.
+	GatewayShutdownTimeout time.Duration
+
 	// Enable DHT node.
 	DHTEnabled bool
 	// DHT node will listen on this IP.
@@ -85,6 +164,11 @@ type Config struct {
 	DHTAnnounceInterval time.Duration
 	// Minimum announce interval when announcing to DHT.
 	DHTMinAnnounceInterval time.Duration
+	// Maximum duration of a single query when looking for peers in DHT.
+	DHTQueryTimeout time.Duration
+	// When advertising the torrent to DHT fails, it is retried with an exponential backoff between these durations.
+	DHTAdvertiseMinBackoff time.Duration
+	DHTAdvertiseMaxBackoff time.Duration
 	// Known routers to bootstrap local DHT node.
 	DHTBootstrapNodes []string
 
@@ -111,6 +195,10 @@ type Config struct {
 	UnchokedPeers int
 	// Number of optimistic unchoked peers.
 	OptimisticUnchokedPeers int
+	// Unchoked peers are selected again at this interval.
+	// While downloading, peers that upload to us fastest are unchoked. While seeding, peers that download from us fastest are unchoked.
+	// Optimistic unchoked peers are selected randomly at every 3rd interval.
+	UnchokeInterval time.Duration
 	// Max number of blocks allowed to be queued without dropping any.
 	MaxRequestsIn int
 	// Max number of blocks requested from a peer but not received yet.
@@ -122,14 +210,21 @@ type Config struct {
 	RequestTimeout time.Duration
 	// Max number of running downloads on piece in endgame mode, snubbed and choed peers don't count
 	EndgameMaxDuplicateDownloads int
+	// Pieces in this many bytes after the read position of a file reader are downloaded before other pieces.
+	ReadaheadSize int64
 	// Max number of outgoing connections to dial
 	MaxPeerDial int
 	// Max number of incoming connections to accept
 	MaxPeerAccept int
 	// Running metadata downloads, snubbed peers don't count
 	ParallelMetadataDownloads int
+	// Number of peers that are dialed at the same time for a torrent.
+	ParallelPeerDials int
 	// Time to wait for TCP connection to open.
 	PeerConnectTimeout time.Duration
+	// When dialing a peer fails, it is not dialed again for a duration that grows exponentially between these values.
+	PeerDialMinBackoff time.Duration
+	PeerDialMaxBackoff time.Duration
 	// Time to wait for BitTorrent handshake to complete.
 	PeerHandshakeTimeout time.Duration
 	// When peer has started to send piece block, if it does not send any bytes in PieceReadTimeout, the connection is closed.
@@ -138,6 +233,15 @@ type Config struct {
 	MaxPeerAddresses int
 	// Number of allowed-fast messages to send after handshake.
 	AllowedFastSet int
+	// Peers that send corrupt data are banned for this duration.
+	// Peer ID is banned for libp2p peers, IP address is banned for BitTorrent peers. Zero disables banning.
+	// An IP ban applies to all torrents and also blocks the other BitTorrent peers behind the same NAT,
+	// because BitTorrent peers can change their peer ID freely. Use a shorter duration if many peers share addresses.
+	PeerBanDuration time.Duration
+	// A peer is banned after sending this many pieces that fail the hash check.
+	// It is banned earlier if a verified copy of a failed piece shows that its blocks were corrupt.
+	// Zero means peers are banned only by comparing with verified pieces.
+	PeerBanHashFailures int
 
 	// Number of bytes to read when a piece is requested by a peer.
 	ReadCacheBlockSize int64
@@ -202,6 +306,11 @@ var DefaultConfig = Config{
 	MaxPieces:                              64 << 10,
 	DNSResolveTimeout:                      5 * time.Second,
 	ResumeOnStartup:                        true,
+	SpeedLimitShareInterval:                time.Second,
+	ScheduleCheckInterval:                  time.Minute,
+	SlowTorrentSpeed:                       2,
+	SlowTorrentTimeout:                     time.Minute,
+	QueueCheckInterval:                     5 * time.Second,
 
 	// RPC Server
 	RPCEnabled:         true,
@@ -209,6 +318,15 @@ var DefaultConfig = Config{
 	RPCPort:            7246,
 	RPCShutdownTimeout: 5 * time.Second,
 
+	// HTTP Gateway
+	GatewayEnabled:         false,
+	GatewayHost:            "127.0.0.1",
+	GatewayPort:            7247,
+	GatewayAddTorrents:     false,
+	GatewayMetadataTimeout: time.Minute,
+	GatewayQueueTimeout:    5 * time.Second,
+	GatewayShutdownTimeout: 5 * time.Second,
+
 	// Tracker
 	TrackerNumWant:              200,
 	TrackerStopTimeout:          5 * time.Second,
@@ -223,6 +341,9 @@ var DefaultConfig = Config{
 	DHTPort:                7246,
 	DHTAnnounceInterval:    30 * time.Minute,
 	DHTMinAnnounceInterval: time.Minute,
+	DHTQueryTimeout:        time.Minute,
+	DHTAdvertiseMinBackoff: 5 * time.Second,
+	DHTAdvertiseMaxBackoff: 10 * time.Minute,
 	DHTBootstrapNodes: []string{
 		"router.bittorrent.com:6881",
 		"dht.transmissionbt.com:6881",
@@ -234,19 +355,26 @@ var DefaultConfig = Config{
 	// Peer
 	UnchokedPeers:                3,
 	OptimisticUnchokedPeers:      1,
+	UnchokeInterval:              10 * time.Second,
 	MaxRequestsIn:                250,
 	MaxRequestsOut:               250,
 	DefaultRequestsOut:           50,
 	RequestTimeout:               20 * time.Second,
 	EndgameMaxDuplicateDownloads: 20,
+	ReadaheadSize:                4 << 20,
 	MaxPeerDial:                  80,
 	MaxPeerAccept:                20,
 	ParallelMetadataDownloads:    2,
+	ParallelPeerDials:            10,
 	PeerConnectTimeout:           5 * time.Second,
+	PeerDialMinBackoff:           10 * time.Second,
+	PeerDialMaxBackoff:           10 * time.Minute,
 	PeerHandshakeTimeout:         10 * time.Second,
 	PieceReadTimeout:             30 * time.Second,
 	MaxPeerAddresses:             2000,
 	AllowedFastSet:               10,
+	PeerBanDuration:              24 * time.Hour,
+	PeerBanHashFailures:          2,
 
 	// IO
 	ReadCacheBlockSize: 128 << 10,
@@ -267,6 +395,19 @@ var DefaultConfig = Config{
 	WebseedMaxDownloads:            4,
 
 
+	// libp2p
+	LibP2pHandShake:       10 * time.Second,
+	LibP2pProtocolVersion: p2p.TransferProtocolVersion,
+	LibP2pConnLowWater:    100,
+	LibP2pConnHighWater:   400,
+	LibP2pConnGracePeriod: time.Minute,
+	LibP2pMinRoutingTablePeers: 4,
+	LibP2pBootstrapInterval:    time.Minute,
+	LibP2pBootstrapDialTimeout: 30 * time.Second,
+	LibP2pBootstrapMinBackoff:  5 * time.Second,
+	LibP2pBootstrapMaxBackoff:  5 * time.Minute,
+	LibP2pDHTProtocolPrefix:    string(p2p.DefaultDHTProtocolPrefix),
+
 	//new
 	Debug: 							true,
 }
@@ -1,13 +1,18 @@
 package filechain
 
 import (
+	"context"
+	"crypto/tls"
 	"errors"
+	"fmt"
+	"net"
+	"net/http"
 	p2p "github.com/fichain/go-file/external/p2p"
 	"github.com/fichain/go-file/external/resumer/boltdbresumer"
 	"github.com/fichain/go-file/internal/piececache"
 	"github.com/fichain/go-file/internal/resourcemanager"
 	"github.com/fichain/go-file/internal/semaphore"
-	"github.com/juju/ratelimit"
+	"github.com/fichain/go-file/internal/speedlimit"
 	"os"
 	"path/filepath"
 	"sync"
@@ -15,7 +20,12 @@ import (
 
 	"github.com/fichain/go-file/internal/blocklist"
 	"github.com/fichain/go-file/internal/logger"
+	"github.com/fichain/go-file/internal/trackermanager"
+	connmgr "github.com/libp2p/go-libp2p-connmgr"
 	"github.com/libp2p/go-libp2p-core/host"
+	p2pPeer "github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/pnet"
+	"github.com/libp2p/go-libp2p-core/protocol"
 	discovery "github.com/libp2p/go-libp2p-discovery"
 	"github.com/mitchellh/go-homedir"
 	"go.etcd.io/bbolt"
@@ -33,6 +43,8 @@ var (
 type Session struct {
 	host			host.Host
 	routeDiscovery   *discovery.RoutingDiscovery	//dht
+	// Versions of the transfer protocol offered when dialing peers, newest first.
+	transferProtocols []protocol.ID
 	log            logger.Logger
 
 	config         Config
@@ -45,12 +57,54 @@ type Session struct {
 
 	sessionSpec 	*boltdbresumer.SessionSpec
 
-	//todo ratelimit
-	bucketDownload *ratelimit.Bucket
-	bucketUpload   *ratelimit.Bucket
+	// Limit the total speed of all torrents. Rates can be changed with SetSpeedLimits.
+	bucketDownload *speedlimit.Bucket
+	bucketUpload   *speedlimit.Bucket
+	// Serializes the updates of the shares of torrents from the buckets above.
+	mShare sync.Mutex
 
 	metrics        *sessionMetrics
 
+	// Ports that can be listened by torrents for BitTorrent peers.
+	mPorts         sync.Mutex
+	availablePorts map[int]struct{}
+
+	// Shares HTTP and UDP transports between trackers of torrents.
+	trackerManager *trackermanager.TrackerManager
+
+	// Downloads pieces from webseed sources of torrents.
+	webseedClient http.Client
+
+	// Serves the files of torrents over HTTP. nil if the gateway is not enabled.
+	gateway         *http.Server
+	gatewayListener net.Listener
+	gatewayCancel   context.CancelFunc
+	// Torrents that are being added by the gateway, by info hash.
+	gatewayAdds  map[string]*gatewayAdd
+	mGatewayAdds sync.Mutex
+
+	blocklist          *blocklist.Blocklist
+	mBlocklist         sync.RWMutex
+	blocklistTimestamp time.Time
+	gater              *p2p.Gater
+
+	// Peers that have sent corrupt pieces, by peer ID or IP address.
+	bannedPeers  map[string]BannedPeer
+	mBannedPeers sync.RWMutex
+
+	// Rules of Config.Schedule that are applied last and the torrents that are stopped by them.
+	mSchedule       sync.Mutex
+	scheduleApplied bool
+	scheduleRules   []int
+	scheduleStopped map[string]struct{}
+
+	// Torrents in queue order. Position of a torrent is its index.
+	queue  []*torrent
+	mQueue sync.Mutex
+	// Triggers the processing of the queue.
+	queueC chan struct{}
+	bootstrapper       *p2p.Bootstrapper
+
 	pieceCache     *piececache.Cache
 
 	semWrite       *semaphore.Semaphore
@@ -58,6 +112,8 @@ type Session struct {
 	db             *bbolt.DB
 	sessionResumer        *boltdbresumer.SessionResumer
 	resumer				  *boltdbresumer.TorrentResumer
+
+	closeC         chan struct{}
 }
 
 // NewSession creates a new Session for downloading and seeding torrents.
@@ -73,6 +129,32 @@ func NewSession(cfg Config) (*Session, error) {
 	if len(cfg.LibP2pUser) == 0 {
 		return nil, errors.New("no p2p user")
 	}
+	if cfg.BitTorrentEnabled && cfg.PortBegin >= cfg.PortEnd {
+		return nil, errors.New("invalid port range")
+	}
+	if cfg.UnchokeInterval <= 0 {
+		return nil, errors.New("invalid unchoke interval")
+	}
+	if cfg.SpeedLimitShareInterval <= 0 {
+		return nil, errors.New("invalid speed limit share interval")
+	}
+	if len(cfg.Schedule) > 0 && cfg.ScheduleCheckInterval <= 0 {
+		return nil, errors.New("invalid schedule check interval")
+	}
+	for i, r := range cfg.Schedule {
+		if err = r.validate(); err != nil {
+			return nil, fmt.Errorf("invalid schedule rule #%d: %s", i, err)
+		}
+	}
+	if err = cfg.SeedGoals.validate(); err != nil {
+		return nil, err
+	}
+	if cfg.MaxActiveDownloads < 0 || cfg.MaxActiveSeeds < 0 || cfg.MaxActiveChecking < 0 {
+		return nil, errors.New("negative max active torrents")
+	}
+	if cfg.queueEnabled() && cfg.QueueCheckInterval <= 0 {
+		return nil, errors.New("invalid queue check interval")
+	}
 
 	cfg.Database, err = homedir.Expand(cfg.Database)
 	if err != nil {
@@ -125,6 +207,10 @@ func NewSession(cfg Config) (*Session, error) {
 
 	bl := blocklist.New()
 	bl.Logger = l.Errorf
+	var blTracker *blocklist.Blocklist
+	if cfg.BlocklistEnabledForTrackers {
+		blTracker = bl
+	}
 	c := &Session{
 		//host: host,
 		//routeDiscovery: routeDiscovery,
@@ -137,11 +223,32 @@ func NewSession(cfg Config) (*Session, error) {
 		//metrics:
 		pieceCache:         piececache.New(cfg.ReadCacheSize, cfg.ReadCacheTTL, cfg.ParallelReads),
 		semWrite:           semaphore.New(int(cfg.ParallelWrites)),
+		bucketDownload:     speedlimit.New(cfg.SpeedLimitDownload * 1024),
+		bucketUpload:       speedlimit.New(cfg.SpeedLimitUpload * 1024),
 
 		db: 				db,
 		sessionResumer: 	sessionRe,
 		resumer:		 	torrentRe,
 		sessionSpec: 		sessionSpec,
+		blocklist:          bl,
+		trackerManager:     trackermanager.New(blTracker, cfg.DNSResolveTimeout, !cfg.TrackerHTTPVerifyTLS),
+		webseedClient: http.Client{
+			Transport: &http.Transport{
+				DialContext:           (&net.Dialer{Timeout: cfg.WebseedDialTimeout}).DialContext,
+				TLSHandshakeTimeout:   cfg.WebseedTLSHandshakeTimeout,
+				TLSClientConfig:       &tls.Config{InsecureSkipVerify: !cfg.WebseedVerifyTLS}, // nolint: gosec
+				ResponseHeaderTimeout: cfg.WebseedResponseHeaderTimeout,
+			},
+		},
+		scheduleStopped:    make(map[string]struct{}),
+		queueC:             make(chan struct{}, 1),
+		closeC:             make(chan struct{}),
+	}
+	if cfg.BitTorrentEnabled {
+		c.availablePorts = make(map[int]struct{}, int(cfg.PortEnd-cfg.PortBegin))
+		for p := cfg.PortBegin; p < cfg.PortEnd; p++ {
+			c.availablePorts[int(p)] = struct{}{}
+		}
 	}
 
 	//host
@@ -150,27 +257,102 @@ func NewSession(cfg Config) (*Session, error) {
 		return nil, err
 	}
 
-	host, err := p2p.NewRoutedHost(cfg.LibP2pPort, cfg.LibP2pBootStrap, priv)
+	var psk pnet.PSK
+	if cfg.LibP2pPrivateNetworkKey != "" {
+		psk, err = p2p.LoadPrivateNetworkKey(cfg.LibP2pPrivateNetworkKey)
+		if err != nil {
+			return nil, fmt.Errorf("cannot load private network key: %s", err)
+		}
+		l.Infoln("private network is enabled")
+	}
+
+	allowedPeers, err := decodePeerIDs(cfg.LibP2pAllowedPeers)
+	if err != nil {
+		return nil, fmt.Errorf("invalid allowed peer: %s", err)
+	}
+	deniedPeers, err := decodePeerIDs(cfg.LibP2pDeniedPeers)
+	if err != nil {
+		return nil, fmt.Errorf("invalid denied peer: %s", err)
+	}
+	c.transferProtocols, err = p2p.TransferProtocolIDs(cfg.LibP2pProtocolVersion)
+	if err != nil {
+		return nil, err
+	}
+	c.gater = p2p.NewGater(bl, cfg.BlocklistEnabledForIncomingConnections, cfg.BlocklistEnabledForOutgoingConnections, allowedPeers, deniedPeers)
+	err = c.loadBannedPeers()
+	if err != nil {
+		return nil, err
+	}
+	err = c.startBlocklistReloader()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			close(c.closeC)
+		}
+	}()
+
+	cm := connmgr.NewConnManager(cfg.LibP2pConnLowWater, cfg.LibP2pConnHighWater, cfg.LibP2pConnGracePeriod)
+	host, err := p2p.NewRoutedHost(cfg.LibP2pPort, cfg.LibP2pBootStrap, priv, psk, cm, c.gater)
 	if err != nil {
 		return nil, err
 	}
+	defer func() {
+		if err != nil {
+			host.Close()
+		}
+	}()
 	l.Infof("create host success!, id is: %v, addrs is: %v\n", host.ID(), host.Addrs())
-	routeDiscovery, err := p2p.NewRoutedDiscovery(host)
+	routeDiscovery, d, err := p2p.NewRoutedDiscovery(host, protocol.ID(cfg.LibP2pDHTProtocolPrefix), psk != nil)
 	if err != nil {
 		return nil, err
 	}
+	defer func() {
+		if err != nil {
+			d.Close()
+		}
+	}()
 	c.host = host
 	c.routeDiscovery = routeDiscovery
+	err = p2p.SetTransferHandler(host, cfg.LibP2pProtocolVersion, c.handleStream)
+	if err != nil {
+		return nil, err
+	}
 
-	l.Infoln("create route discovery success!")
+	// Already validated by NewRoutedHost.
+	bootstrapPeers, _ := p2p.ParseBootstrapPeers(cfg.LibP2pBootStrap)
+	c.bootstrapper = p2p.NewBootstrapper(host, d, bootstrapPeers, cfg.LibP2pMinRoutingTablePeers,
+		cfg.LibP2pBootstrapInterval, cfg.LibP2pBootstrapDialTimeout, cfg.LibP2pBootstrapMinBackoff, cfg.LibP2pBootstrapMaxBackoff)
+	go c.bootstrapper.Run()
+	defer func() {
+		if err != nil {
+			c.bootstrapper.Close()
+		}
+	}()
 
-	//todo blocklist for libp2p
+	l.Infoln("create route discovery success!")
 
 	//todo init metrics
 	c.initMetrics()
 
+	if cfg.GatewayEnabled {
+		err = c.startGateway()
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	c.loadExistingTorrents(sessionSpec.TorrentIds)
 
+	go c.bandwidthSharer()
+	if cfg.queueEnabled() {
+		go c.runQueue()
+	}
+	if len(cfg.Schedule) > 0 {
+		go c.runScheduler()
+	}
+
 	//todo update stats
 	//go c.updateStatsLoop()
 
@@ -180,21 +362,43 @@ func NewSession(cfg Config) (*Session, error) {
 // Close stops all torrents and release the resources.
 func (s *Session) Close() error {
 	s.log.Infoln("start close session")
-	var wg sync.WaitGroup
+	select {
+	case <-s.closeC:
+	default:
+		close(s.closeC)
+		p2p.RemoveTransferHandler(s.host, s.config.LibP2pProtocolVersion)
+		s.bootstrapper.Close()
+		s.stopGateway()
+	}
+	// Lock is not held while waiting for the run loops, they may be removing their torrents.
 	s.mTorrents.Lock()
-	wg.Add(len(s.torrents))
-	for _, t := range s.torrents {
+	torrents := s.torrents
+	s.torrents = nil
+	s.mTorrents.Unlock()
+	var wg sync.WaitGroup
+	wg.Add(len(torrents))
+	for _, t := range torrents {
 		go func(t *torrent) {
 			t.Close()
 			wg.Done()
 		}(t)
 	}
 	wg.Wait()
-	s.torrents = nil
-	s.mTorrents.Unlock()
 	return nil
 }
 
+func decodePeerIDs(ids []string) ([]p2pPeer.ID, error) {
+	ret := make([]p2pPeer.ID, 0, len(ids))
+	for _, s := range ids {
+		id, err := p2pPeer.Decode(s)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, id)
+	}
+	return ret, nil
+}
+
 func (s *Session) RemoveData()  {
 	s.Close()
 	s.mTorrents.Lock()
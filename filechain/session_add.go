@@ -2,6 +2,8 @@ package filechain
 
 import (
 	"encoding/hex"
+	"fmt"
+	"net/url"
 	"github.com/fichain/go-file/external/resumer/boltdbresumer"
 	"path"
 	"path/filepath"
@@ -12,6 +14,7 @@ import (
 	"github.com/fichain/go-file/internal/magnet"
 	"github.com/fichain/go-file/internal/metainfo"
 	"github.com/fichain/go-file/internal/storage/filestorage"
+	"github.com/fichain/go-file/internal/tracker"
 
 	"github.com/fichain/go-file/external/resumer"
 )
@@ -27,6 +30,17 @@ type AddTorrentOptions struct {
 	StopAfterDownload bool
 	//data dir
 	DataDir string
+	// HTTP sources to download the torrent data from, in addition to the "ws" params of the magnet link.
+	// A source is either a base URL for the files of the torrent or the URL of the single file (BEP 19).
+	Webseeds []string
+	// Share of the torrent from session bandwidth and write cache.
+	Priority Priority
+	// Seeding goals of the torrent. If nil, Config.SeedGoals is used.
+	SeedGoals *SeedGoals
+	// Priorities of the files in the order of the files in metainfo.
+	// They are applied when the metadata is downloaded, before the files are allocated, so skipped files are not created on disk.
+	// Ignored if the number of priorities does not match the number of files.
+	FilePriorities []FilePriority
 }
 
 func (s *Session) AddFileId(uri string, opt *AddTorrentOptions) (*torrent, error)  {
@@ -57,7 +71,23 @@ func (s *Session) addFileId(link string, opt *AddTorrentOptions) (*torrent, erro
 		return nil, newInputError(err)
 	}
 	ma.Peers = []string{}
-	ma.Trackers = [][]string{}
+	if !opt.Priority.valid() {
+		return nil, newInputError(errInvalidPriority)
+	}
+	if opt.SeedGoals != nil {
+		if err = opt.SeedGoals.validate(); err != nil {
+			return nil, newInputError(err)
+		}
+	}
+	for _, p := range opt.FilePriorities {
+		if !p.valid() {
+			return nil, newInputError(errInvalidFilePriority)
+		}
+	}
+	webseeds, err := s.parseWebseeds(append(ma.Webseeds, opt.Webseeds...))
+	if err != nil {
+		return nil, newInputError(err)
+	}
 
 	opt.ID = ma.InfoString()
 	if opt.DataDir == "" {
@@ -74,10 +104,11 @@ func (s *Session) addFileId(link string, opt *AddTorrentOptions) (*torrent, erro
 		time.Now(),
 		ma.InfoHash[:],
 		ma.Name,
+		ma.Trackers,
 		nil, // info
 		nil, // bitfield
 		resumer.Stats{},
-		//nil, // webseedSources
+		webseeds,
 		opt.StopAfterDownload,
 		opt.DataDir,
 		opt.ID,
@@ -85,6 +116,12 @@ func (s *Session) addFileId(link string, opt *AddTorrentOptions) (*torrent, erro
 	if err != nil {
 		return nil, err
 	}
+	t.priority = int32(opt.Priority)
+	if opt.SeedGoals != nil {
+		g := *opt.SeedGoals
+		t.seedGoals = &g
+	}
+	t.pendingFilePriorities = append([]FilePriority(nil), opt.FilePriorities...)
 	//go s.checkTorrent(t)
 	defer func() {
 		if err != nil {
@@ -94,9 +131,14 @@ func (s *Session) addFileId(link string, opt *AddTorrentOptions) (*torrent, erro
 	rspec := &boltdbresumer.Spec{
 		InfoHash:           ma.InfoHash[:],
 		Name:               ma.Name,
+		Trackers:           ma.Trackers,
+		URLList:            webseeds,
 		FixedPeers:         ma.Peers,
 		AddedAt:            t.addedAt,
 		StopAfterDownload:  opt.StopAfterDownload,
+		Priority:           int(opt.Priority),
+		SeedGoals:          t.seedGoals.spec(),
+		FilePriorities:     filePriorityValues(opt.FilePriorities),
 		DataDir: 			opt.DataDir,
 	}
 	err = s.resumer.Write(opt.ID, rspec)
@@ -128,18 +170,12 @@ func (s *Session) insertTorrent(t *torrent) *torrent {
 	t.log.Info("insert torrent")
 	s.mTorrents.Lock()
 	s.torrents[t.id] = t
-	keys := make([]string, 0, len(s.torrents))
-	for k := range s.torrents {
-		keys = append(keys, k)
-	}
+	err := s.writeTorrentIds()
 	s.mTorrents.Unlock()
-
-	s.sessionSpec.TorrentIds = keys
-	s.log.Debugln("current ids:", keys)
-	err := s.sessionResumer.WriteTorrentIds(keys)
 	if err != nil {
 		s.log.Errorln("write torrent ids error:", err)
 	}
+	s.addToQueue(t)
 	return t
 }
 
@@ -176,9 +212,11 @@ func (s *Session) CreateFile(dataDir string) (*torrent, error) {
 		time.Now(),
 		info.Hash[:],
 		info.Name,
+		nil, // trackers
 		info, // info
 		bf, // bitfield
 		resumer.Stats{},
+		nil, // webseeds
 		opt.StopAfterDownload,
 		torrentPath,
 		opt.ID,
@@ -187,6 +225,7 @@ func (s *Session) CreateFile(dataDir string) (*torrent, error) {
 	if err != nil {
 		return t, err
 	}
+	t.created = true
 
 	rspec := &boltdbresumer.Spec{
 		InfoHash:          info.Hash[:],
@@ -196,6 +235,7 @@ func (s *Session) CreateFile(dataDir string) (*torrent, error) {
 		DataDir: 		   torrentPath,
 		Bitfield:   	   bf.Bytes(),
 		Info:			   info.Bytes,
+		Created:           true,
 	}
 	err = s.resumer.Write(opt.ID, rspec)
 	if err != nil {
@@ -223,4 +263,62 @@ func (s *Session) existTorrent(id string) (*torrent, bool) {
 		return s.torrents[id], true
 	}
 	return nil, false
-}
\ No newline at end of file
+}
+// parseTrackers returns trackers for tiers of tracker URLs. Invalid URLs are skipped.
+func (s *Session) parseTrackers(tiers [][]string, private bool) []tracker.Tracker {
+	ret := make([]tracker.Tracker, 0, len(tiers))
+	for _, tier := range tiers {
+		trackers := make([]tracker.Tracker, 0, len(tier))
+		for _, u := range tier {
+			tr, err := s.getTracker(u, private)
+			if err != nil {
+				s.log.Warningln("invalid tracker:", err)
+				continue
+			}
+			trackers = append(trackers, tr)
+		}
+		switch len(trackers) {
+		case 0:
+		case 1:
+			ret = append(ret, trackers[0])
+		default:
+			ret = append(ret, tracker.NewTier(trackers))
+		}
+	}
+	return ret
+}
+
+func (s *Session) getTracker(u string, private bool) (tracker.Tracker, error) {
+	return s.trackerManager.Get(u, s.config.TrackerHTTPTimeout, s.getTrackerUserAgent(private), int64(s.config.TrackerHTTPMaxResponseSize))
+}
+
+// parseWebseeds returns unique webseed URLs, limited to WebseedMaxSources. Only HTTP sources are supported.
+func (s *Session) parseWebseeds(urls []string) ([]string, error) {
+	ret := make([]string, 0, len(urls))
+	seen := make(map[string]struct{}, len(urls))
+	for _, u := range urls {
+		if _, ok := seen[u]; ok {
+			continue
+		}
+		pu, err := url.Parse(u)
+		if err != nil {
+			return nil, err
+		}
+		if pu.Scheme != "http" && pu.Scheme != "https" {
+			return nil, fmt.Errorf("unsupported webseed: %s", u)
+		}
+		seen[u] = struct{}{}
+		ret = append(ret, u)
+	}
+	if len(ret) > s.config.WebseedMaxSources {
+		ret = ret[:s.config.WebseedMaxSources]
+	}
+	return ret, nil
+}
+
+func (s *Session) getTrackerUserAgent(private bool) string {
+	if private && s.config.TrackerHTTPPrivateUserAgent != "" {
+		return s.config.TrackerHTTPPrivateUserAgent
+	}
+	return "filechain/" + s.config.LibP2pProtocolVersion
+}
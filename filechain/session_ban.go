@@ -0,0 +1,194 @@
+package filechain
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/fichain/go-file/external/peer"
+	"go.etcd.io/bbolt"
+)
+
+var bannedPeersBucket = []byte("banned-peers")
+
+var errPeerNotBanned = errors.New("peer is not banned")
+
+// BannedPeer is a peer that is not allowed to connect because it has sent corrupt pieces.
+type BannedPeer struct {
+	// Peer ID of a libp2p peer or IP address of a BitTorrent peer.
+	ID string
+	// ID of the torrent that the corrupt piece belongs to.
+	TorrentID string
+	// Index of the corrupt piece that the ban is decided on.
+	Piece    uint32
+	BannedAt time.Time
+	// The peer is allowed to connect again after this time.
+	Until time.Time
+}
+
+// banKey returns the key that the peer is banned with.
+// BitTorrent peers can change their peer ID freely, so their IP address is banned instead.
+// This also bans the other peers behind the same NAT, see Config.PeerBanDuration.
+func banKey(pe *peer.Peer) string {
+	if pe.IsBitTorrent() {
+		return pe.TCPAddr.IP.String()
+	}
+	return pe.ID
+}
+
+func (s *Session) bannedPeersBucket(tx *bbolt.Tx) *bbolt.Bucket {
+	return tx.Bucket([]byte(s.config.LibP2pUser)).Bucket(bannedPeersBucket)
+}
+
+// loadBannedPeers reads the bans from the session db. Expired bans are deleted from the db.
+func (s *Session) loadBannedPeers() error {
+	now := time.Now()
+	bans := make(map[string]BannedPeer)
+	err := s.db.Update(func(tx *bbolt.Tx) error {
+		b, err := tx.Bucket([]byte(s.config.LibP2pUser)).CreateBucketIfNotExists(bannedPeersBucket)
+		if err != nil {
+			return err
+		}
+		var expired []string
+		err = b.ForEach(func(k, v []byte) error {
+			var bp BannedPeer
+			if err2 := json.Unmarshal(v, &bp); err2 != nil {
+				return err2
+			}
+			if !now.Before(bp.Until) {
+				expired = append(expired, string(k))
+				return nil
+			}
+			bans[bp.ID] = bp
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, k := range expired {
+			if err = b.Delete([]byte(k)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if len(bans) > 0 {
+		s.log.Infof("loaded %d banned peers from session db", len(bans))
+	}
+	s.mBannedPeers.Lock()
+	s.bannedPeers = bans
+	s.mBannedPeers.Unlock()
+	return nil
+}
+
+// banPeer bans the peer with the ban key for Config.PeerBanDuration after it has sent corrupt data of the torrent.
+// Connections of the peer are closed in all torrents of the session.
+func (s *Session) banPeer(id, torrentID string, piece uint32) {
+	if s.config.PeerBanDuration <= 0 {
+		return
+	}
+	now := time.Now()
+	bp := BannedPeer{
+		ID:        id,
+		TorrentID: torrentID,
+		Piece:     piece,
+		BannedAt:  now,
+		Until:     now.Add(s.config.PeerBanDuration),
+	}
+	s.mBannedPeers.Lock()
+	s.bannedPeers[bp.ID] = bp
+	s.mBannedPeers.Unlock()
+	s.log.Infof("banned peer %s until %s", bp.ID, bp.Until.Format(time.RFC3339))
+	s.closeBannedPeer(bp.ID)
+
+	val, err := json.Marshal(bp)
+	if err == nil {
+		err = s.db.Update(func(tx *bbolt.Tx) error {
+			return s.bannedPeersBucket(tx).Put([]byte(bp.ID), val)
+		})
+	}
+	if err != nil {
+		s.log.Errorln("cannot save banned peer:", err)
+	}
+}
+
+// closeBannedPeer tells all torrents to close their connections to the banned peer.
+// Bans are made in the run loops of torrents, so the commands are sent from another goroutine.
+func (s *Session) closeBannedPeer(id string) {
+	s.mTorrents.RLock()
+	torrents := make([]*torrent, 0, len(s.torrents))
+	for _, t := range s.torrents {
+		torrents = append(torrents, t)
+	}
+	s.mTorrents.RUnlock()
+	go func() {
+		for _, t := range torrents {
+			select {
+			case t.closeBannedPeerCommandC <- id:
+			case <-t.closeC:
+			}
+		}
+	}()
+}
+
+// peerBanned returns true if the peer ID or the IP address is banned.
+func (s *Session) peerBanned(id string) bool {
+	s.mBannedPeers.RLock()
+	bp, ok := s.bannedPeers[id]
+	s.mBannedPeers.RUnlock()
+	return ok && time.Now().Before(bp.Until)
+}
+
+// BannedPeers returns the peers that are banned currently, in the order they are banned.
+func (s *Session) BannedPeers() []BannedPeer {
+	now := time.Now()
+	s.mBannedPeers.RLock()
+	bans := make([]BannedPeer, 0, len(s.bannedPeers))
+	for _, bp := range s.bannedPeers {
+		if now.Before(bp.Until) {
+			bans = append(bans, bp)
+		}
+	}
+	s.mBannedPeers.RUnlock()
+	sort.Slice(bans, func(i, j int) bool {
+		if bans[i].BannedAt.Equal(bans[j].BannedAt) {
+			return bans[i].ID < bans[j].ID
+		}
+		return bans[i].BannedAt.Before(bans[j].BannedAt)
+	})
+	return bans
+}
+
+// UnbanPeer allows the peer with the ID or the IP address to connect again.
+func (s *Session) UnbanPeer(id string) error {
+	s.mBannedPeers.Lock()
+	_, ok := s.bannedPeers[id]
+	delete(s.bannedPeers, id)
+	s.mBannedPeers.Unlock()
+	if !ok {
+		return newInputError(errPeerNotBanned)
+	}
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		return s.bannedPeersBucket(tx).Delete([]byte(id))
+	})
+}
+
+// ClearBans removes all bans.
+func (s *Session) ClearBans() error {
+	s.mBannedPeers.Lock()
+	s.bannedPeers = make(map[string]BannedPeer)
+	s.mBannedPeers.Unlock()
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte(s.config.LibP2pUser))
+		err := b.DeleteBucket(bannedPeersBucket)
+		if err != nil {
+			return err
+		}
+		_, err = b.CreateBucket(bannedPeersBucket)
+		return err
+	})
+}
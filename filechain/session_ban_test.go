@@ -0,0 +1,173 @@
+package filechain
+
+import (
+	"crypto/rand"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fichain/go-file/external/peer"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSessionBannedPeers(t *testing.T) {
+	var database string
+	s := newTestSession(t, func(cfg *Config) {
+		cfg.PeerBanDuration = time.Hour
+		database = cfg.Database
+	})
+	s.banPeer(banKey(&peer.Peer{ID: "QmPeer"}), "torrent1", 3)
+	s.banPeer(banKey(&peer.Peer{ID: "ignored", TCPAddr: &net.TCPAddr{IP: net.IPv4(127, 0, 0, 2), Port: 6881}}), "torrent2", 5)
+	assert.True(t, s.peerBanned("QmPeer"))
+	assert.True(t, s.peerBanned("127.0.0.2"))
+	assert.False(t, s.peerBanned("ignored"))
+	assert.Equal(t, 2, s.Stats().BannedPeers)
+
+	// Bans are kept in the session db.
+	user := s.config.LibP2pUser
+	closeTestSession(s)
+	s = newTestSession(t, func(cfg *Config) {
+		cfg.Database = database
+		cfg.LibP2pUser = user
+	})
+	bans := s.BannedPeers()
+	if assert.Len(t, bans, 2) {
+		assert.Equal(t, "QmPeer", bans[0].ID)
+		assert.Equal(t, "torrent1", bans[0].TorrentID)
+		assert.Equal(t, uint32(3), bans[0].Piece)
+		assert.Equal(t, "127.0.0.2", bans[1].ID)
+		assert.WithinDuration(t, bans[1].BannedAt.Add(time.Hour), bans[1].Until, time.Second)
+	}
+
+	assert.NoError(t, s.UnbanPeer("QmPeer"))
+	assert.False(t, s.peerBanned("QmPeer"))
+	assert.Error(t, s.UnbanPeer("QmPeer"))
+	assert.NoError(t, s.ClearBans())
+	assert.Empty(t, s.BannedPeers())
+	assert.NoError(t, s.loadBannedPeers())
+	assert.Empty(t, s.BannedPeers())
+
+	// Expired bans are not loaded.
+	s.config.PeerBanDuration = time.Nanosecond
+	s.banPeer("QmExpired", "torrent1", 0)
+	time.Sleep(time.Millisecond)
+	assert.False(t, s.peerBanned("QmExpired"))
+	assert.NoError(t, s.loadBannedPeers())
+	assert.Empty(t, s.bannedPeers)
+}
+
+func TestSessionBanCorruptSeeder(t *testing.T) {
+	a := newTestSession(t, nil)
+	b := newTestSession(t, nil)
+	dir, err := ioutil.TempDir("", "filechain-data-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "random.bin")
+	data := make([]byte, 64<<10)
+	_, _ = rand.Read(data)
+	err = ioutil.WriteFile(name, data, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seeder, err := a.CreateFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Data is changed after the torrent is created, so the seeder sends pieces that fail the hash check.
+	err = ioutil.WriteFile(name, make([]byte, len(data)), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	leecher := downloadFrom(t, b, seeder, a, nil)
+	waitFor(t, 20*time.Second, func() bool { return len(b.BannedPeers()) == 1 })
+	bp := b.BannedPeers()[0]
+	assert.Equal(t, a.host.ID().String(), bp.ID)
+	assert.Equal(t, leecher.id, bp.TorrentID)
+	waitFor(t, 5*time.Second, func() bool { return leecher.Stats().Peers.Total == 0 })
+	assert.NotZero(t, leecher.Stats().Bytes.Wasted)
+
+	// Banned peer cannot connect again.
+	err = leecher.AddPeers([]string{loopbackP2PAddr(t, a)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(500 * time.Millisecond)
+	assert.Zero(t, leecher.Stats().Peers.Total)
+	assert.Zero(t, seeder.Stats().Peers.Total)
+
+	// Peer can connect again after the ban is cleared. It is banned again for the next corrupt piece.
+	assert.NoError(t, b.ClearBans())
+	assert.Empty(t, b.BannedPeers())
+	err = leecher.AddPeers([]string{loopbackP2PAddr(t, a)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, 20*time.Second, func() bool { return len(b.BannedPeers()) == 1 })
+}
+
+func TestSessionBanVerifiedCorruptBlocks(t *testing.T) {
+	a := newTestSession(t, nil)
+	b := newTestSession(t, func(cfg *Config) {
+		// Only the comparison with the verified piece can ban the peer.
+		cfg.PeerBanHashFailures = 0
+	})
+	c := newTestSession(t, nil)
+	data := make([]byte, 64<<10)
+	_, _ = rand.Read(data)
+	var seeders []*torrent
+	for _, s := range []*Session{a, c} {
+		dir, err := ioutil.TempDir("", "filechain-data-")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+		name := filepath.Join(dir, "random.bin")
+		err = ioutil.WriteFile(name, data, 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+		seeder, err := s.CreateFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		seeders = append(seeders, seeder)
+		if s == a {
+			// Seeder in a sends pieces that fail the hash check.
+			err = ioutil.WriteFile(name, make([]byte, len(data)), 0600)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if !assert.Equal(t, seeders[0].InfoHash(), seeders[1].InfoHash()) {
+		return
+	}
+	// Peer in a is also downloading another torrent from b, slowly.
+	a.SetSpeedLimits(1, 0)
+	other := createRandomTorrent(t, b, 1<<20)
+	downloadFrom(t, a, other, b, nil)
+	waitFor(t, 5*time.Second, func() bool { return other.Stats().Peers.Total == 1 })
+
+	leecher := downloadFrom(t, b, seeders[0], a, nil)
+	waitFor(t, 20*time.Second, func() bool { return leecher.Stats().Bytes.Wasted > 0 })
+	assert.Empty(t, b.BannedPeers())
+
+	// Pieces are downloaded from the other seeder and compared with the corrupt ones.
+	err := leecher.AddPeers([]string{loopbackP2PAddr(t, c)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, 20*time.Second, func() bool { return leecher.Stats().Status == Seeding })
+	bans := b.BannedPeers()
+	if assert.Len(t, bans, 1) {
+		assert.Equal(t, a.host.ID().String(), bans[0].ID)
+	}
+	// Connections of the banned peer are closed in all torrents.
+	waitFor(t, 5*time.Second, func() bool { return other.Stats().Peers.Total == 0 })
+}
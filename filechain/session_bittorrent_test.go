@@ -0,0 +1,62 @@
+package filechain
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/fichain/go-file/internal/magnet"
+	"github.com/stretchr/testify/assert"
+)
+
+// transferBitTorrent seeds the sample torrent from the session a and downloads it with the session b
+// by adding the BitTorrent address of a manually. It returns when b completes the download.
+func transferBitTorrent(t *testing.T, a, b *Session) {
+	t.Helper()
+	seeder := seedSampleTorrent(t, a)
+	waitFor(t, 5*time.Second, func() bool { return seeder.Stats().Port != 0 })
+	leecher := addMagnet(t, b, seeder, nil)
+	waitFor(t, 5*time.Second, func() bool { return leecher.Stats().Port != 0 })
+	err := leecher.AddPeers([]string{"127.0.0.1:" + strconv.Itoa(seeder.Stats().Port)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, 20*time.Second, func() bool { return leecher.Stats().Status == Seeding })
+	assert.NotZero(t, seeder.Stats().Bytes.Uploaded)
+}
+
+func enableBitTorrent(cfg *Config) {
+	cfg.BitTorrentEnabled = true
+}
+
+func TestSessionBitTorrent(t *testing.T) {
+	a := newTestSession(t, enableBitTorrent)
+	b := newTestSession(t, enableBitTorrent)
+	transferBitTorrent(t, a, b)
+}
+
+func TestSessionBitTorrentEncrypted(t *testing.T) {
+	a := newTestSession(t, func(cfg *Config) {
+		enableBitTorrent(cfg)
+		cfg.ForceIncomingEncryption = true
+	})
+	b := newTestSession(t, func(cfg *Config) {
+		enableBitTorrent(cfg)
+		cfg.ForceOutgoingEncryption = true
+	})
+	transferBitTorrent(t, a, b)
+}
+
+func TestTorrentAddPeersBitTorrentDisabled(t *testing.T) {
+	s := newTestSession(t, nil)
+	var ih [20]byte
+	copy(ih[:], "bittorrent disabled ")
+	m := magnet.Magnet{InfoHash: ih, Name: "disabled"}
+	tor, err := s.AddFileId(m.String(), &AddTorrentOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Error(t, tor.AddPeers([]string{"127.0.0.1:6881"}))
+	assert.NoError(t, tor.AddPeers([]string{"/ip4/127.0.0.1/tcp/4001/p2p/" + s.host.ID().Pretty()}))
+	assert.Zero(t, tor.Stats().Port)
+}
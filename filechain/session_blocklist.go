@@ -0,0 +1,179 @@
+package filechain
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha1"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+func (s *Session) startBlocklistReloader() error {
+	if s.config.BlocklistURL == "" {
+		return nil
+	}
+	blocklistTimestamp, urlChanged, err := s.getBlocklistTimestamp()
+	if err != nil {
+		return err
+	}
+
+	var delay time.Duration
+	switch {
+	case blocklistTimestamp.IsZero():
+		s.log.Infof("Blocklist is empty. Loading blocklist...")
+	case urlChanged:
+		s.log.Infof("Blocklist URL has changed. Loading blocklist...")
+	default:
+		s.log.Infof("Loading blocklist from session db...")
+		err = s.loadBlocklistFromDB()
+		if err != nil {
+			return err
+		}
+		s.mBlocklist.Lock()
+		s.blocklistTimestamp = blocklistTimestamp
+		s.mBlocklist.Unlock()
+		delay = time.Until(blocklistTimestamp.Add(s.config.BlocklistUpdateInterval))
+	}
+	go s.blocklistReloader(delay)
+	return nil
+}
+
+func (s *Session) blocklistBucket(tx *bbolt.Tx) *bbolt.Bucket {
+	return tx.Bucket([]byte(s.config.LibP2pUser)).Bucket(sessionBucket)
+}
+
+// getBlocklistTimestamp returns the time of the last blocklist update saved in the session db.
+// urlChanged is true if the saved blocklist is downloaded from a different URL.
+func (s *Session) getBlocklistTimestamp() (t time.Time, urlChanged bool, err error) {
+	urlHash := sha1.Sum([]byte(s.config.BlocklistURL))
+	err = s.db.View(func(tx *bbolt.Tx) error {
+		b := s.blocklistBucket(tx)
+		val := b.Get(blocklistTimestampKey)
+		if val == nil {
+			return nil
+		}
+		var err2 error
+		t, err2 = time.ParseInLocation(time.RFC3339, string(val), time.UTC)
+		if err2 != nil {
+			return err2
+		}
+		urlChanged = !bytes.Equal(b.Get(blocklistURLHashKey), urlHash[:])
+		return nil
+	})
+	return
+}
+
+func (s *Session) retryReloadBlocklist() {
+	for {
+		err := s.reloadBlocklist()
+		if err == nil {
+			return
+		}
+		s.log.Errorln("cannot load blocklist:", err.Error())
+		select {
+		case <-s.closeC:
+			return
+		case <-time.After(time.Minute):
+		}
+	}
+}
+
+func (s *Session) reloadBlocklist() error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.BlocklistUpdateTimeout)
+	defer cancel()
+	go func() {
+		select {
+		case <-s.closeC:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.config.BlocklistURL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return fmt.Errorf("invalid blocklist status code: %d", resp.StatusCode)
+	}
+
+	var r io.Reader = resp.Body
+	r = io.LimitReader(r, s.config.BlocklistMaxResponseSize)
+	if resp.Header.Get("content-type") == "application/x-gzip" {
+		gr, gerr := gzip.NewReader(r)
+		if gerr != nil {
+			return gerr
+		}
+		defer gr.Close()
+		r = gr
+	}
+
+	buf := bytes.NewBuffer(make([]byte, 0, resp.ContentLength))
+	r = io.TeeReader(r, buf)
+
+	n, err := s.blocklist.Reload(r)
+	if err != nil {
+		return err
+	}
+	s.log.Infof("Loaded %d rules from blocklist.", n)
+
+	now := time.Now()
+
+	s.mBlocklist.Lock()
+	s.blocklistTimestamp = now
+	s.mBlocklist.Unlock()
+
+	urlHash := sha1.Sum([]byte(s.config.BlocklistURL))
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		b := s.blocklistBucket(tx)
+		err2 := b.Put(blocklistKey, buf.Bytes())
+		if err2 != nil {
+			return err2
+		}
+		err2 = b.Put(blocklistURLHashKey, urlHash[:])
+		if err2 != nil {
+			return err2
+		}
+		return b.Put(blocklistTimestampKey, []byte(now.UTC().Format(time.RFC3339)))
+	})
+}
+
+func (s *Session) loadBlocklistFromDB() error {
+	return s.db.View(func(tx *bbolt.Tx) error {
+		b := s.blocklistBucket(tx)
+		val := b.Get(blocklistKey)
+		if val == nil {
+			return nil
+		}
+		n, err := s.blocklist.Reload(bytes.NewReader(val))
+		if err != nil {
+			return err
+		}
+		s.log.Infof("Loaded %d rules from blocklist.", n)
+		return nil
+	})
+}
+
+func (s *Session) blocklistReloader(d time.Duration) {
+	for {
+		select {
+		case <-time.After(d):
+		case <-s.closeC:
+			return
+		}
+		s.log.Info("Reloading blocklist...")
+		s.retryReloadBlocklist()
+		d = s.config.BlocklistUpdateInterval
+	}
+}
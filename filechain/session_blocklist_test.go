@@ -0,0 +1,101 @@
+package filechain
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p-core/peer"
+	ma "github.com/multiformats/go-multiaddr"
+	"github.com/stretchr/testify/assert"
+	"go.etcd.io/bbolt"
+)
+
+func TestBlocklistReload(t *testing.T) {
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		_, _ = io.WriteString(w, "# test list\n10.0.0.0/8\n192.168.1.0/24\n")
+	}))
+	defer srv.Close()
+
+	var database string
+	s := newTestSession(t, func(cfg *Config) {
+		cfg.BlocklistURL = srv.URL
+		database = cfg.Database
+	})
+	waitFor(t, 5*time.Second, func() bool { return s.blocklist.Len() == 2 })
+	waitFor(t, 5*time.Second, func() bool { return s.metrics.BlockListRecency.Value() >= 0 })
+	assert.Equal(t, int64(2), s.metrics.BlockListRules.Value())
+	assert.Equal(t, int32(1), atomic.LoadInt32(&requests))
+
+	blocked := ma.StringCast("/ip4/10.1.2.3/tcp/4001")
+	allowed := ma.StringCast("/ip4/11.1.2.3/tcp/4001")
+	assert.False(t, s.gater.InterceptAddrDial(peer.ID("a"), blocked))
+	assert.True(t, s.gater.InterceptAddrDial(peer.ID("a"), allowed))
+	assert.Equal(t, int64(1), s.metrics.BlockListBlocked.Value())
+
+	// The list is cached in the session db.
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		b := s.blocklistBucket(tx)
+		assert.Contains(t, string(b.Get(blocklistKey)), "10.0.0.0/8")
+		assert.NotNil(t, b.Get(blocklistTimestampKey))
+		return nil
+	})
+	assert.NoError(t, err)
+
+	// The list is loaded from the db when the session is opened again before the update interval.
+	user := s.config.LibP2pUser
+	closeTestSession(s)
+	s2 := newTestSession(t, func(cfg *Config) {
+		cfg.BlocklistURL = srv.URL
+		cfg.Database = database
+		cfg.LibP2pUser = user
+	})
+	assert.Equal(t, 2, s2.blocklist.Len())
+	assert.False(t, s2.gater.InterceptAddrDial(peer.ID("a"), blocked))
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&requests))
+}
+
+func TestBlocklistReloadPeriodically(t *testing.T) {
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) == 1 {
+			_, _ = io.WriteString(w, "10.0.0.0/8\n")
+		} else {
+			_, _ = io.WriteString(w, "10.0.0.0/8\n172.16.0.0/12\n192.168.0.0/16\n")
+		}
+	}))
+	defer srv.Close()
+
+	s := newTestSession(t, func(cfg *Config) {
+		cfg.BlocklistURL = srv.URL
+		cfg.BlocklistUpdateInterval = 100 * time.Millisecond
+	})
+	waitFor(t, 5*time.Second, func() bool { return s.blocklist.Len() == 3 })
+	assert.True(t, s.gater.InterceptAddrDial(peer.ID("a"), ma.StringCast("/ip4/8.8.8.8/tcp/4001")))
+	assert.False(t, s.gater.InterceptAddrDial(peer.ID("a"), ma.StringCast("/ip4/192.168.5.5/tcp/4001")))
+}
+
+func TestDeniedPeers(t *testing.T) {
+	s1 := newTestSession(t, nil)
+	s2 := newTestSession(t, func(cfg *Config) {
+		cfg.LibP2pDeniedPeers = []string{s1.host.ID().Pretty()}
+	})
+	s3 := newTestSession(t, nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err := s1.host.Connect(ctx, peer.AddrInfo{ID: s2.host.ID(), Addrs: s2.host.Addrs()})
+	assert.Error(t, err)
+	err = s2.host.Connect(ctx, peer.AddrInfo{ID: s1.host.ID(), Addrs: s1.host.Addrs()})
+	assert.Error(t, err)
+	err = s3.host.Connect(ctx, peer.AddrInfo{ID: s2.host.ID(), Addrs: s2.host.Addrs()})
+	assert.NoError(t, err)
+	assert.True(t, s2.gater.Blocked() > 0)
+}
@@ -0,0 +1,40 @@
+package filechain
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSessionChoking(t *testing.T) {
+	a := newTestSession(t, func(cfg *Config) {
+		cfg.UnchokedPeers = 1
+		cfg.OptimisticUnchokedPeers = 0
+		cfg.UnchokeInterval = 100 * time.Millisecond
+		cfg.SpeedLimitUpload = 64
+	})
+	b := newTestSession(t, nil)
+	c := newTestSession(t, nil)
+	seeder := createRandomTorrent(t, a, 192<<10)
+	leecher1 := downloadFrom(t, b, seeder, a, nil)
+	leecher2 := downloadFrom(t, c, seeder, a, nil)
+
+	// Only one of the interested peers is unchoked by the seeder at a time.
+	// Choked peers get their pending requests rejected and continue after they are unchoked again.
+	var sawChoked bool
+	waitFor(t, 20*time.Second, func() bool {
+		var unchoked int
+		for _, pe := range seeder.Peers() {
+			if pe.PeerInterested && !pe.ClientChoking {
+				unchoked++
+			}
+			if pe.PeerInterested && pe.ClientChoking {
+				sawChoked = true
+			}
+		}
+		assert.True(t, unchoked <= 1)
+		return leecher1.Stats().Status == Seeding && leecher2.Stats().Status == Seeding
+	})
+	assert.True(t, sawChoked)
+}
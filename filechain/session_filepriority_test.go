@@ -0,0 +1,167 @@
+package filechain
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fichain/go-file/internal/allocator"
+	"github.com/fichain/go-file/internal/bitfield"
+	"github.com/fichain/go-file/internal/metainfo"
+	"github.com/stretchr/testify/assert"
+)
+
+// createMultiFileTorrent creates a torrent of a directory with files of the given sizes.
+func createMultiFileTorrent(t *testing.T, s *Session, sizes ...int) *torrent {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "filechain-data-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	root := filepath.Join(dir, "share")
+	err = os.Mkdir(root, 0750)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, size := range sizes {
+		b := make([]byte, size)
+		_, err = rand.Read(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = ioutil.WriteFile(filepath.Join(root, string(rune('a'+i))+".bin"), b, 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	tor, err := s.CreateFile(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tor
+}
+
+func TestSessionFilePriorities(t *testing.T) {
+	var database, user string
+	a := newTestSession(t, nil)
+	a.SetSpeedLimits(0, 64)
+	configure := func(cfg *Config) {
+		cfg.PEXEnabled = false
+		if database != "" {
+			cfg.Database = database
+			cfg.LibP2pUser = user
+		}
+		database = cfg.Database
+		user = cfg.LibP2pUser
+	}
+	b := newTestSession(t, configure)
+	seeder := createMultiFileTorrent(t, a, 64<<10, 64<<10, 64<<10)
+	waitFor(t, 5*time.Second, func() bool { return seeder.Stats().Status == Seeding })
+
+	priorities := []FilePriority{FilePriorityHigh, FilePrioritySkip, FilePriorityLow}
+	_, err := b.AddFileId("magnet:?xt=urn:btih:"+seeder.id, &AddTorrentOptions{FilePriorities: []FilePriority{5}})
+	assert.Error(t, err)
+	leecher := addMagnet(t, b, seeder, &AddTorrentOptions{FilePriorities: priorities})
+	err = leecher.AddPeers([]string{loopbackP2PAddr(t, a)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Error(t, leecher.SetFilePriorities([]FilePriority{FilePriorityNormal}))
+	waitFor(t, 20*time.Second, func() bool { return leecher.Stats().Pieces.Total > 0 })
+	assert.Equal(t, priorities, leecher.FilePriorities())
+	assert.Error(t, leecher.SetFilePriorities([]FilePriority{FilePriorityNormal}))
+	assert.Error(t, leecher.SetFilePriorities([]FilePriority{FilePriorityNormal, 5, FilePriorityNormal}))
+	assert.NoError(t, leecher.SetFilePriorities(priorities))
+	assert.Equal(t, priorities, leecher.FilePriorities())
+
+	// Torrent is completed when the wanted files are downloaded.
+	waitFor(t, 20*time.Second, func() bool { return leecher.Stats().Status == Seeding })
+	st := leecher.Stats()
+	assert.Zero(t, st.Pieces.Missing)
+	assert.Zero(t, st.Bytes.Incomplete)
+	spec, err := b.resumer.Read(leecher.id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []int{1, -2, -1}, spec.FilePriorities)
+
+	// Skipped file is not created, even when the torrent is loaded again.
+	id := leecher.id
+	dir := filepath.Join(b.config.DataDir, leecher.Name())
+	_, err = os.Stat(filepath.Join(dir, "b.bin"))
+	assert.True(t, os.IsNotExist(err))
+	closeTestSession(b)
+	b = newTestSession(t, configure)
+	leecher, _ = b.existTorrent(id)
+	assert.Equal(t, priorities, leecher.FilePriorities())
+	waitFor(t, 5*time.Second, func() bool { return leecher.Stats().Status == Seeding })
+	_, err = os.Stat(filepath.Join(dir, "b.bin"))
+	assert.True(t, os.IsNotExist(err))
+
+	// Download continues when a skipped file is wanted again.
+	assert.NoError(t, leecher.SetFilePriorities([]FilePriority{FilePriorityNormal, FilePriorityNormal, FilePriorityNormal}))
+	assert.Nil(t, leecher.FilePriorities())
+	assert.Equal(t, Downloading, leecher.Stats().Status)
+	assert.NoError(t, leecher.AddPeers([]string{loopbackP2PAddr(t, a)}))
+	waitFor(t, 20*time.Second, func() bool { return leecher.Stats().Status == Seeding })
+	st = leecher.Stats()
+	assert.Equal(t, st.Pieces.Total, st.Pieces.Have)
+	for _, name := range []string{"a.bin", "b.bin", "c.bin"} {
+		want, err := ioutil.ReadFile(filepath.Join(seeder.dataDir, seeder.Name(), name))
+		assert.NoError(t, err)
+		got, err := ioutil.ReadFile(filepath.Join(dir, name))
+		assert.NoError(t, err)
+		assert.True(t, bytes.Equal(want, got), name)
+	}
+}
+
+func TestSessionSkipAllocatedFile(t *testing.T) {
+	a := newTestSession(t, nil)
+	a.SetSpeedLimits(0, 1)
+	b := newTestSession(t, nil)
+	seeder := createMultiFileTorrent(t, a, 64<<10, 64<<10)
+	waitFor(t, 5*time.Second, func() bool { return seeder.Stats().Status == Seeding })
+
+	leecher := downloadFrom(t, b, seeder, a, nil)
+	waitFor(t, 20*time.Second, func() bool { return leecher.Stats().Status == Downloading })
+	name := filepath.Join(b.config.DataDir, leecher.Name(), "b.bin")
+	_, err := os.Stat(name)
+	assert.NoError(t, err)
+
+	// File without downloaded data is removed when it is skipped after allocation.
+	assert.NoError(t, leecher.SetFilePriorities([]FilePriority{FilePriorityNormal, FilePrioritySkip}))
+	_, err = os.Stat(name)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestClearLazyPieces(t *testing.T) {
+	const pieceLength = 16 << 10
+	tor := &torrent{
+		info: &metainfo.Info{
+			PieceLength: pieceLength,
+			Length:      72 << 10,
+			NumPieces:   5,
+			Files: []metainfo.File{
+				{Path: "a", Length: 24 << 10},
+				{Path: "b", Length: 40 << 10},
+				{Path: "c", Length: 8 << 10},
+			},
+		},
+		files:    []allocator.File{{}, {Lazy: true}, {Lazy: true}},
+		bitfield: bitfield.New(5),
+	}
+	for i := uint32(0); i < 5; i++ {
+		tor.bitfield.Set(i)
+	}
+	tor.clearLazyPieces()
+
+	// Second piece is shared by the first file, so it is kept.
+	assert.Equal(t, []bool{true, true, false, false, false}, []bool{
+		tor.bitfield.Test(0), tor.bitfield.Test(1), tor.bitfield.Test(2), tor.bitfield.Test(3), tor.bitfield.Test(4),
+	})
+}
@@ -0,0 +1,329 @@
+package filechain
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"html"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fichain/go-file/internal/metainfo"
+)
+
+var (
+	errMetadataTimeout = errors.New("timeout while waiting for metadata")
+	errGatewayQueued   = errors.New("torrent is waiting in the queue")
+	errGatewayStopped  = errors.New("torrent cannot be started")
+)
+
+// gatewayAdd is a torrent being added by the gateway. Concurrent requests for the same info hash wait for it.
+type gatewayAdd struct {
+	torrent *torrent
+	err     error
+	doneC   chan struct{}
+}
+
+// startGateway starts the HTTP gateway that serves the files of torrents.
+func (s *Session) startGateway() error {
+	addr := net.JoinHostPort(s.config.GatewayHost, strconv.Itoa(s.config.GatewayPort))
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	s.gatewayListener = ln
+	s.gatewayAdds = make(map[string]*gatewayAdd)
+	// Requests are canceled when the session is closing, so pending reads do not delay the shutdown.
+	ctx, cancel := context.WithCancel(context.Background())
+	s.gatewayCancel = cancel
+	s.gateway = &http.Server{
+		Handler:     http.HandlerFunc(s.handleGateway),
+		BaseContext: func(net.Listener) context.Context { return ctx },
+	}
+	s.log.Infoln("HTTP gateway is listening on", ln.Addr().String())
+	go func() {
+		err := s.gateway.Serve(ln)
+		if err != nil && err != http.ErrServerClosed {
+			s.log.Errorln("HTTP gateway error:", err)
+		}
+	}()
+	return nil
+}
+
+func (s *Session) stopGateway() {
+	if s.gateway == nil {
+		return
+	}
+	s.gatewayCancel()
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.GatewayShutdownTimeout)
+	defer cancel()
+	err := s.gateway.Shutdown(ctx)
+	if err != nil {
+		s.log.Errorln("cannot shutdown HTTP gateway:", err)
+	}
+}
+
+// GatewayAddr returns the address that HTTP gateway is listening on. Returns empty string if the gateway is not enabled.
+func (s *Session) GatewayAddr() string {
+	if s.gatewayListener == nil {
+		return ""
+	}
+	return s.gatewayListener.Addr().String()
+}
+
+// handleGateway serves a file at /<infohash>/<file path> or lists a directory of the torrent at /<infohash>/<dir>/.
+func (s *Session) handleGateway(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/"), "/", 2)
+	id := strings.ToLower(parts[0])
+	if b, err := hex.DecodeString(id); err != nil || len(b) != 20 {
+		http.Error(w, "invalid info hash", http.StatusNotFound)
+		return
+	}
+	t, ok := s.existTorrent(id)
+	if !ok {
+		if !s.config.GatewayAddTorrents {
+			http.Error(w, "torrent not found", http.StatusNotFound)
+			return
+		}
+		var err error
+		t, err = s.addGatewayTorrent(id)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	err := s.startGatewayTorrent(r.Context(), t)
+	if err == errGatewayQueued {
+		w.Header().Set("Retry-After", strconv.Itoa(int(s.config.GatewayQueueTimeout.Seconds())+1))
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	info, err := s.waitMetadata(r.Context(), t)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusGatewayTimeout)
+		return
+	}
+
+	var name string
+	if len(parts) == 2 {
+		name = strings.TrimPrefix(path.Clean("/"+parts[1]), "/")
+	}
+	files := gatewayFiles(info)
+	for i, f := range files {
+		if f == name {
+			s.serveGatewayFile(w, r, t, info, i, name)
+			return
+		}
+	}
+	entries := gatewayDirEntries(files, name)
+	if len(entries) == 0 {
+		http.Error(w, "file not found", http.StatusNotFound)
+		return
+	}
+	if !strings.HasSuffix(r.URL.Path, "/") {
+		http.Redirect(w, r, path.Base(r.URL.Path)+"/", http.StatusMovedPermanently)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprintf(w, "<pre>\n")
+	for _, e := range entries {
+		u := url.URL{Path: e}
+		fmt.Fprintf(w, "<a href=\"%s\">%s</a>\n", u.String(), html.EscapeString(e))
+	}
+	fmt.Fprintf(w, "</pre>\n")
+}
+
+// addGatewayTorrent adds the torrent with the info hash once, even if it is requested concurrently.
+func (s *Session) addGatewayTorrent(id string) (*torrent, error) {
+	s.mGatewayAdds.Lock()
+	add, ok := s.gatewayAdds[id]
+	if !ok {
+		add = &gatewayAdd{doneC: make(chan struct{})}
+		s.gatewayAdds[id] = add
+	}
+	s.mGatewayAdds.Unlock()
+	if ok {
+		<-add.doneC
+		return add.torrent, add.err
+	}
+	add.torrent, add.err = s.AddFileId("magnet:?xt=urn:btih:"+id, nil)
+	s.mGatewayAdds.Lock()
+	delete(s.gatewayAdds, id)
+	s.mGatewayAdds.Unlock()
+	close(add.doneC)
+	return add.torrent, add.err
+}
+
+// startGatewayTorrent starts a stopped torrent for a request. A queued torrent is moved to the top of the queue,
+// so it gets the next free slot. It returns errGatewayQueued if the torrent does not get a slot in Config.GatewayQueueTimeout.
+func (s *Session) startGatewayTorrent(ctx context.Context, t *torrent) error {
+	st := t.queueState().Status
+	if st == Stopped {
+		err := t.Start()
+		if err != nil {
+			return err
+		}
+		st = t.queueState().Status
+	}
+	switch st {
+	case Stopped:
+		return errGatewayStopped
+	case Queued:
+	default:
+		return nil
+	}
+	err := t.MoveToQueueTop()
+	if err != nil {
+		return err
+	}
+	timeout := time.NewTimer(s.config.GatewayQueueTimeout)
+	defer timeout.Stop()
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		switch t.queueState().Status {
+		case Queued:
+		case Stopped:
+			return errGatewayStopped
+		default:
+			return nil
+		}
+		select {
+		case <-ticker.C:
+		case <-timeout.C:
+			return errGatewayQueued
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.closeC:
+			return errClosed
+		}
+	}
+}
+
+// waitMetadata returns the info of the torrent when its metadata is downloaded.
+func (s *Session) waitMetadata(ctx context.Context, t *torrent) (*metainfo.Info, error) {
+	timeout := time.NewTimer(s.config.GatewayMetadataTimeout)
+	defer timeout.Stop()
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		if info := t.metadata(); info != nil {
+			return info, nil
+		}
+		select {
+		case <-ticker.C:
+		case <-timeout.C:
+			return nil, errMetadataTimeout
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-t.closeC:
+			return nil, errClosed
+		}
+	}
+}
+
+func (s *Session) serveGatewayFile(w http.ResponseWriter, r *http.Request, t *torrent, info *metainfo.Info, index int, name string) {
+	rd, err := t.OpenFile(name)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rd.Close()
+	// Unblock the reader waiting for pieces when the client goes away.
+	doneC := make(chan struct{})
+	defer close(doneC)
+	go func() {
+		select {
+		case <-r.Context().Done():
+			rd.Close()
+		case <-doneC:
+		}
+	}()
+
+	ctype := mime.TypeByExtension(path.Ext(name))
+	if ctype == "" {
+		// Do not let ServeContent sniff the content, it would wait for the first piece.
+		ctype = "application/octet-stream"
+	}
+	w.Header().Set("Content-Type", ctype)
+	w.Header().Set("ETag", fileETag(info, index))
+	http.ServeContent(w, r, name, time.Time{}, rd)
+}
+
+// gatewayFiles returns the paths of the files in the URLs of the gateway.
+// Paths of the files in a multi file torrent are relative to the top directory.
+func gatewayFiles(info *metainfo.Info) []string {
+	files := make([]string, len(info.Files))
+	for i, f := range info.Files {
+		p := filepath.ToSlash(f.Path)
+		if info.MultiFile {
+			p = strings.TrimPrefix(p, filepath.ToSlash(info.Name)+"/")
+		}
+		files[i] = p
+	}
+	return files
+}
+
+// gatewayDirEntries returns the sorted names of the files and directories in dir. Names of directories end with a slash.
+func gatewayDirEntries(files []string, dir string) []string {
+	prefix := dir
+	if prefix != "" {
+		prefix += "/"
+	}
+	seen := make(map[string]struct{})
+	var entries []string
+	for _, f := range files {
+		if !strings.HasPrefix(f, prefix) {
+			continue
+		}
+		e := strings.TrimPrefix(f, prefix)
+		if i := strings.IndexByte(e, '/'); i >= 0 {
+			e = e[:i+1]
+		}
+		if _, ok := seen[e]; ok {
+			continue
+		}
+		seen[e] = struct{}{}
+		entries = append(entries, e)
+	}
+	sort.Strings(entries)
+	return entries
+}
+
+// fileETag returns an ETag calculated from the hashes of the pieces of the file.
+// The position of the file in torrent is included, because the boundary pieces may be shared with other files.
+func fileETag(info *metainfo.Info, index int) string {
+	var begin int64
+	for _, f := range info.Files[:index] {
+		begin += f.Length
+	}
+	length := info.Files[index].Length
+	h := sha1.New() // nolint: gosec
+	if length > 0 {
+		pieceLength := int64(info.PieceLength)
+		for i := begin / pieceLength; i <= (begin+length-1)/pieceLength; i++ {
+			h.Write(info.PieceHash(uint32(i)))
+		}
+	}
+	fmt.Fprintf(h, "%d:%d", begin, length)
+	return `"` + hex.EncodeToString(h.Sum(nil)) + `"`
+}
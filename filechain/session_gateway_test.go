@@ -0,0 +1,176 @@
+package filechain
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// gatewayGet sends a GET request to the gateway of the session. Redirects are not followed.
+func gatewayGet(t *testing.T, s *Session, path string, header http.Header) (*http.Response, []byte) {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, "http://"+s.GatewayAddr()+path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	client := http.Client{
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, body
+}
+
+func enableGateway(cfg *Config) {
+	cfg.GatewayEnabled = true
+	cfg.GatewayPort = 0
+}
+
+func TestSessionGateway(t *testing.T) {
+	s := newTestSession(t, enableGateway)
+	tor := createMultiFileTorrent(t, s, 64<<10, 100<<10, 10)
+	waitFor(t, 5*time.Second, func() bool { return tor.Stats().Status == Seeding })
+	data, err := ioutil.ReadFile(filepath.Join(tor.dataDir, tor.Name(), "b.bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ih := hex.EncodeToString(tor.InfoHash())
+
+	resp, _ := gatewayGet(t, s, "/"+ih, nil)
+	assert.Equal(t, http.StatusMovedPermanently, resp.StatusCode)
+	resp, body := gatewayGet(t, s, "/"+ih+"/", nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, string(body), `<a href="a.bin">a.bin</a>`)
+	assert.Contains(t, string(body), `<a href="b.bin">b.bin</a>`)
+	assert.Contains(t, string(body), `<a href="c.bin">c.bin</a>`)
+
+	resp, body = gatewayGet(t, s, "/"+ih+"/b.bin", nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "102400", resp.Header.Get("Content-Length"))
+	assert.True(t, bytes.Equal(data, body))
+	etag := resp.Header.Get("ETag")
+	assert.NotEmpty(t, etag)
+	resp, _ = gatewayGet(t, s, "/"+ih+"/c.bin", nil)
+	assert.NotEqual(t, etag, resp.Header.Get("ETag"))
+
+	resp, body = gatewayGet(t, s, "/"+ih+"/b.bin", http.Header{"Range": {"bytes=70000-70099"}})
+	assert.Equal(t, http.StatusPartialContent, resp.StatusCode)
+	assert.Equal(t, "100", resp.Header.Get("Content-Length"))
+	assert.True(t, bytes.Equal(data[70000:70100], body))
+
+	resp, _ = gatewayGet(t, s, "/"+ih+"/b.bin", http.Header{"If-None-Match": {etag}})
+	assert.Equal(t, http.StatusNotModified, resp.StatusCode)
+
+	resp, _ = gatewayGet(t, s, "/"+ih+"/missing.bin", nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	resp, _ = gatewayGet(t, s, "/0123456789012345678901234567890123456789/a.bin", nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestSessionGatewayAddTorrents(t *testing.T) {
+	a := newTestSession(t, nil)
+	b := newTestSession(t, func(cfg *Config) {
+		enableGateway(cfg)
+		cfg.GatewayAddTorrents = true
+	})
+	seeder := createRandomTorrent(t, a, 256<<10)
+	data, err := ioutil.ReadFile(filepath.Join(seeder.dataDir, seeder.Name()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ih := hex.EncodeToString(seeder.InfoHash())
+
+	// Torrent is added on first access, the seeder is added as a peer after that.
+	addr := loopbackP2PAddr(t, a)
+	go func() {
+		for i := 0; i < 500; i++ {
+			if tor, ok := b.existTorrent(ih); ok {
+				_ = tor.AddPeers([]string{addr})
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}()
+	resp, body := gatewayGet(t, b, "/"+ih+"/"+seeder.Name(), http.Header{"Range": {"bytes=200000-"}})
+	assert.Equal(t, http.StatusPartialContent, resp.StatusCode)
+	assert.True(t, bytes.Equal(data[200000:], body))
+}
+
+func TestSessionGatewayAddTorrentOnce(t *testing.T) {
+	s := newTestSession(t, func(cfg *Config) {
+		enableGateway(cfg)
+		cfg.GatewayAddTorrents = true
+		cfg.GatewayMetadataTimeout = 200 * time.Millisecond
+	})
+	const n = 5
+	codes := make(chan int, n)
+	for i := 0; i < n; i++ {
+		go func() {
+			resp, err := http.Get("http://" + s.GatewayAddr() + "/0123456789012345678901234567890123456789/a.bin")
+			if err != nil {
+				codes <- 0
+				return
+			}
+			resp.Body.Close()
+			codes <- resp.StatusCode
+		}()
+	}
+	for i := 0; i < n; i++ {
+		assert.Equal(t, http.StatusGatewayTimeout, <-codes)
+	}
+	s.mTorrents.RLock()
+	assert.Len(t, s.torrents, 1)
+	s.mTorrents.RUnlock()
+}
+
+func TestSessionGatewayQueuedTorrents(t *testing.T) {
+	s := newTestSession(t, func(cfg *Config) {
+		enableGateway(cfg)
+		cfg.MaxActiveSeeds = 1
+		cfg.QueueCheckInterval = 100 * time.Millisecond
+		cfg.GatewayQueueTimeout = 500 * time.Millisecond
+	})
+	tor1 := createMultiFileTorrent(t, s, 10)
+	waitFor(t, 5*time.Second, func() bool { return tor1.Stats().Status == Seeding })
+	tor2 := createMultiFileTorrent(t, s, 20)
+	waitFor(t, 5*time.Second, func() bool { return tor2.Stats().Status == Queued })
+	path1 := "/" + hex.EncodeToString(tor1.InfoHash()) + "/a.bin"
+	path2 := "/" + hex.EncodeToString(tor2.InfoHash()) + "/a.bin"
+
+	// Queued torrent does not get a slot while the other torrent is seeding.
+	resp, _ := gatewayGet(t, s, path2, nil)
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	assert.NotEmpty(t, resp.Header.Get("Retry-After"))
+	assert.Equal(t, 0, tor2.QueuePosition())
+
+	// Queued torrent is started when a slot is free.
+	tor1.Stop()
+	waitFor(t, 5*time.Second, func() bool { return tor1.Stats().Status == Stopped })
+	resp, body := gatewayGet(t, s, path2, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Len(t, body, 20)
+
+	// Stopped torrent is started for the request.
+	tor2.Stop()
+	waitFor(t, 5*time.Second, func() bool { return tor2.Stats().Status == Stopped })
+	resp, body = gatewayGet(t, s, path1, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Len(t, body, 10)
+	assert.Equal(t, Seeding, tor1.Stats().Status)
+}
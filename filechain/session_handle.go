@@ -1,27 +1,43 @@
 package filechain
 
 import (
-	p2p2 "github.com/fichain/go-file/external/p2p"
+	"encoding/hex"
+	"time"
+
+	"github.com/fichain/go-file/external/p2p"
 	"github.com/libp2p/go-libp2p-core/network"
 )
 
-func (s *Session)handleStream()  {
-	s.host.SetStreamHandler(p2p2.FileTransferProtocol, func(stream network.Stream) {
-		//first hand shake
-		flag := false
-		s.mTorrents.RLock()
-		for _,v := range s.torrents {
-			if stream.Protocol() != p2p2.GenerateFileTransferProtocol(v.id) {
-				continue
-			}
-			flag = true
-			v.AddIncomingStream(stream)
-			break
-		}
-		s.mTorrents.RUnlock()
-		if !flag{
-			s.log.Errorln("mistake income connection!", stream.Conn().RemotePeer().String())
-			stream.Close()
-		}
-	})
-}
\ No newline at end of file
+// handleStream is the handler of the transfer protocol for all torrents in the session.
+// The first message of the stream names the torrent. Streams of unknown torrents are rejected,
+// others are handed to the torrent without waiting for its run loop.
+func (s *Session) handleStream(stream network.Stream) {
+	if s.config.LibP2pHandShake > 0 {
+		_ = stream.SetDeadline(time.Now().Add(s.config.LibP2pHandShake))
+	}
+	ih, err := p2p.ReadTransferHandshake(stream)
+	if err != nil {
+		s.log.Debugln("cannot read transfer handshake from", stream.Conn().RemotePeer().Pretty(), err)
+		stream.Reset()
+		return
+	}
+	id := hex.EncodeToString(ih[:])
+	s.mTorrents.RLock()
+	t, ok := s.torrents[id]
+	s.mTorrents.RUnlock()
+	if !ok {
+		s.log.Debugln("rejected stream of unknown torrent", id, "from", stream.Conn().RemotePeer().Pretty())
+		rejectStream(stream, "unknown torrent")
+		return
+	}
+	err = t.addIncomingStream(stream)
+	if err != nil {
+		rejectStream(stream, err.Error())
+	}
+}
+
+// rejectStream sends the reason of rejection to the peer and closes the stream.
+func rejectStream(stream network.Stream, reason string) {
+	_ = p2p.WriteTransferResponse(stream, reason)
+	stream.Close()
+}
@@ -0,0 +1,235 @@
+package filechain
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"io"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/fichain/go-file/external/p2p"
+	"github.com/fichain/go-file/external/peerconn/peerreader"
+	"github.com/fichain/go-file/external/peerprotocol"
+	"github.com/fichain/go-file/internal/logger"
+	connmgr "github.com/libp2p/go-libp2p-connmgr"
+	"github.com/libp2p/go-libp2p-core/crypto"
+	"github.com/libp2p/go-libp2p-core/host"
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/protocol"
+	manet "github.com/multiformats/go-multiaddr/net"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestHost(t *testing.T) host.Host {
+	priv, _, err := crypto.GenerateKeyPairWithReader(crypto.Ed25519, 0, rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := p2p.NewHost([]string{"/ip4/127.0.0.1/tcp/0"}, priv, nil, connmgr.NewConnManager(100, 400, time.Minute), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { h.Close() })
+	return h
+}
+
+// loopbackAddrInfo returns the loopback addresses of h. Tests must not dial other interfaces.
+func loopbackAddrInfo(h host.Host) peer.AddrInfo {
+	pi := peer.AddrInfo{ID: h.ID()}
+	for _, addr := range h.Addrs() {
+		if manet.IsIPLoopback(addr) {
+			pi.Addrs = append(pi.Addrs, addr)
+		}
+	}
+	return pi
+}
+
+// openTransferStream opens a transfer stream from h to the session s.
+// The latest version of the transfer protocol is offered if protos is empty.
+func openTransferStream(t *testing.T, h host.Host, s *Session, protos ...protocol.ID) network.Stream {
+	if len(protos) == 0 {
+		protos = []protocol.ID{p2p.TransferProtocolID(p2p.TransferProtocolVersion)}
+	}
+	pi := loopbackAddrInfo(s.host)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err := h.Connect(ctx, pi)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream, err := h.NewStream(ctx, pi.ID, protos...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return stream
+}
+
+// openTorrentStream opens a transfer stream from h to the session s and completes the handshake for the torrent.
+// The stream is reset at the end of the test.
+func openTorrentStream(t *testing.T, h host.Host, s *Session, infoHash [20]byte, protos ...protocol.ID) network.Stream {
+	stream := openTransferStream(t, h, s, protos...)
+	t.Cleanup(func() { stream.Reset() })
+	_ = stream.SetDeadline(time.Now().Add(5 * time.Second))
+	if err := p2p.WriteTransferHandshake(stream, infoHash); err != nil {
+		t.Fatal(err)
+	}
+	if err := p2p.ReadTransferResponse(stream); err != nil {
+		t.Fatal(err)
+	}
+	return stream
+}
+
+// readPeerMessage reads peer protocol messages from stream until f returns true for a message.
+// It must be called once for a stream because the read messages are buffered.
+func readPeerMessage(t *testing.T, stream network.Stream, f func(msg interface{}) bool) interface{} {
+	t.Helper()
+	r := peerreader.New(stream, logger.New("test"), 5*time.Second, nil)
+	// The reader stops itself when the stream is reset.
+	go r.Run()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case msg := <-r.Messages():
+			if f(msg) {
+				return msg
+			}
+		case <-r.Done():
+			t.Fatal("stream closed before the message is received")
+		case <-timeout:
+			t.Fatal("message is not received")
+		}
+	}
+}
+
+// writePeerMessage writes a peer protocol message to stream.
+func writePeerMessage(t *testing.T, stream network.Stream, msg peerprotocol.Message) {
+	var buf bytes.Buffer
+	buf.Write([]byte{0, 0, 0, 0, byte(msg.ID())})
+	var err error
+	if wt, ok := msg.(io.WriterTo); ok {
+		_, err = wt.WriteTo(&buf)
+	} else {
+		_, err = buf.ReadFrom(msg)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := buf.Bytes()
+	binary.BigEndian.PutUint32(b, uint32(len(b)-4))
+	if _, err = stream.Write(b); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func requestTorrent(t *testing.T, h host.Host, s *Session, infoHash [20]byte) error {
+	stream := openTransferStream(t, h, s)
+	defer stream.Close()
+	_ = stream.SetDeadline(time.Now().Add(5 * time.Second))
+	err := p2p.WriteTransferHandshake(stream, infoHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p2p.ReadTransferResponse(stream)
+}
+
+func assertRejected(t *testing.T, err error, reason string) {
+	t.Helper()
+	if assert.IsType(t, &p2p.TransferRejectedError{}, err) {
+		assert.Equal(t, reason, err.(*p2p.TransferRejectedError).Reason)
+	}
+}
+
+func TestSessionHandleStream(t *testing.T) {
+	s := newTestSession(t, func(cfg *Config) { cfg.LibP2pHandShake = 500 * time.Millisecond })
+	tor := seedSampleTorrent(t, s)
+	var ih [20]byte
+	copy(ih[:], tor.InfoHash())
+	h := newTestHost(t)
+
+	// Unknown torrents are rejected by the session.
+	assertRejected(t, requestTorrent(t, h, s, [20]byte{1}), "unknown torrent")
+
+	// Known torrent is accepted and the peer protocol follows the handshake.
+	stream := openTransferStream(t, h, s)
+	assert.NoError(t, p2p.WriteTransferHandshake(stream, ih))
+	_ = stream.SetReadDeadline(time.Now().Add(5 * time.Second))
+	assert.NoError(t, p2p.ReadTransferResponse(stream))
+	buf := make([]byte, 4)
+	_, err := io.ReadFull(stream, buf)
+	assert.NoError(t, err)
+
+	// Second stream of the same peer is rejected.
+	assertRejected(t, requestTorrent(t, h, s, ih), "duplicate connection")
+	stream.Reset()
+
+	// Stopped torrents are rejected.
+	tor.Stop()
+	assertRejected(t, requestTorrent(t, h, s, ih), "torrent is stopped")
+
+	// Stream is closed if the handshake is not sent in time.
+	stream = openTransferStream(t, h, s)
+	defer stream.Close()
+	_ = stream.SetReadDeadline(time.Now().Add(5 * time.Second))
+	start := time.Now()
+	_, err = stream.Read(buf)
+	assert.Error(t, err)
+	assert.True(t, time.Since(start) < 3*time.Second)
+}
+
+// resetCountStream counts the resets of a stream.
+type resetCountStream struct {
+	network.Stream
+	resets *int32
+}
+
+func (s resetCountStream) Reset() error {
+	atomic.AddInt32(s.resets, 1)
+	return nil
+}
+
+func TestTorrentCloseResetsIncomingStreams(t *testing.T) {
+	s := newTestSession(t, nil)
+	tor := seedSampleTorrent(t, s)
+	assert.NoError(t, s.RemoveTorrent(tor.id, false))
+	<-tor.doneC
+
+	// Streams that are accepted but not handled by the run loop are reset.
+	var resets int32
+	tor.incomingStreamC <- resetCountStream{resets: &resets}
+	tor.incomingStreamC <- resetCountStream{resets: &resets}
+	tor.close()
+	assert.Equal(t, int32(2), atomic.LoadInt32(&resets))
+	assert.Equal(t, errClosed, tor.addIncomingStream(resetCountStream{resets: &resets}))
+}
+
+func TestTorrentCloseRacesIncomingStreams(t *testing.T) {
+	s := newTestSession(t, nil)
+	tor := seedSampleTorrent(t, s)
+	assert.NoError(t, s.RemoveTorrent(tor.id, false))
+	<-tor.doneC
+	tor.incomingStreamsClosed = false
+
+	// Every stream that is accepted while the torrent closes must be reset.
+	var resets, accepted int32
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				if tor.addIncomingStream(resetCountStream{resets: &resets}) == nil {
+					atomic.AddInt32(&accepted, 1)
+				}
+			}
+		}()
+	}
+	tor.resetIncomingStreams()
+	wg.Wait()
+	assert.Equal(t, atomic.LoadInt32(&accepted), atomic.LoadInt32(&resets))
+	assert.Len(t, tor.incomingStreamC, 0)
+}
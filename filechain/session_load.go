@@ -28,6 +28,7 @@ func (s *Session) loadExistingTorrents(ids []string) {
 		}
 	}
 	s.log.Infof("loaded %d existing torrents", loaded)
+	s.renumberQueue()
 	if s.config.ResumeOnStartup {
 		for _, t := range started {
 			t.Start()
@@ -83,6 +84,7 @@ func (s *Session) loadExistingTorrent(id string) (tt *torrent, hasStarted bool,
 		spec.AddedAt,
 		spec.InfoHash,
 		spec.Name,
+		spec.Trackers,
 		info,
 		bf,
 		resumer.Stats{
@@ -91,6 +93,7 @@ func (s *Session) loadExistingTorrent(id string) (tt *torrent, hasStarted bool,
 			BytesWasted:     spec.BytesWasted,
 			SeededFor:       int64(spec.SeededFor),
 		},
+		spec.URLList,
 		spec.StopAfterDownload,
 		spec.DataDir,
 		id,
@@ -98,6 +101,23 @@ func (s *Session) loadExistingTorrent(id string) (tt *torrent, hasStarted bool,
 	if err != nil {
 		return
 	}
+	t.downloadLimit.SetRate(spec.SpeedLimitDownload * 1024)
+	t.uploadLimit.SetRate(spec.SpeedLimitUpload * 1024)
+	if p := Priority(spec.Priority); p.valid() {
+		t.priority = int32(p)
+	}
+	t.created = spec.Created
+	if g := seedGoalsFromSpec(spec.SeedGoals); g != nil && g.validate() == nil {
+		t.seedGoals = g
+	}
+	if priorities := filePrioritiesFromSpec(spec.FilePriorities); info == nil {
+		t.pendingFilePriorities = priorities
+	} else if len(priorities) == len(info.Files) {
+		t.setFilePriorities(priorities)
+	}
+	if spec.QueuePosition >= 0 {
+		t.queuePosition = int32(spec.QueuePosition)
+	}
 	//go s.checkTorrent(t)
 
 	tt = s.insertTorrent(t)
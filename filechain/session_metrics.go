@@ -16,6 +16,9 @@ type sessionMetrics struct {
 	Uptime                metrics.Gauge
 	BlockListRules        metrics.Gauge
 	BlockListRecency      metrics.Gauge
+	BlockListBlocked      metrics.Gauge
+	RoutingTablePeers     metrics.Gauge
+	BootstrapPeers        metrics.Gauge
 	ReadCacheObjects      metrics.Gauge
 	ReadCacheSize         metrics.Gauge
 	ReadCacheUtilization  metrics.Gauge
@@ -48,15 +51,19 @@ func (s *Session) initMetrics() {
 		}),
 		Peers: metrics.NewRegisteredCounter("peers", r),
 
-		//BlockListRules: metrics.NewRegisteredFunctionalGauge("blocklist_rules", r, func() int64 { return int64(s.blocklist.Len()) }),
-		//BlockListRecency: metrics.NewRegisteredFunctionalGauge("blocklist_recency", r, func() int64 {
-		//	s.mBlocklist.RLock()
-		//	defer s.mBlocklist.RUnlock()
-		//	if s.blocklistTimestamp.IsZero() {
-		//		return -1
-		//	}
-		//	return int64(time.Since(s.blocklistTimestamp) / time.Second)
-		//}),
+		BlockListRules: metrics.NewRegisteredFunctionalGauge("blocklist_rules", r, func() int64 { return int64(s.blocklist.Len()) }),
+		BlockListRecency: metrics.NewRegisteredFunctionalGauge("blocklist_recency", r, func() int64 {
+			s.mBlocklist.RLock()
+			defer s.mBlocklist.RUnlock()
+			if s.blocklistTimestamp.IsZero() {
+				return -1
+			}
+			return int64(time.Since(s.blocklistTimestamp) / time.Second)
+		}),
+		BlockListBlocked: metrics.NewRegisteredFunctionalGauge("blocklist_blocked", r, func() int64 { return s.gater.Blocked() }),
+
+		RoutingTablePeers: metrics.NewRegisteredFunctionalGauge("routing_table_peers", r, func() int64 { return int64(s.bootstrapper.Stats().RoutingTablePeers) }),
+		BootstrapPeers:    metrics.NewRegisteredFunctionalGauge("bootstrap_peers", r, func() int64 { return int64(s.bootstrapper.Stats().ConnectedBootstrapPeers) }),
 
 		ReadCacheObjects:     metrics.NewRegisteredFunctionalGauge("read_cache_objects", r, func() int64 { return int64(s.pieceCache.Len()) }),
 		ReadCacheSize:        metrics.NewRegisteredFunctionalGauge("read_cache_size", r, func() int64 { return s.pieceCache.Size() }),
@@ -0,0 +1,103 @@
+package filechain
+
+import (
+	"testing"
+	"time"
+
+	"github.com/fichain/go-file/external/p2p"
+	"github.com/fichain/go-file/external/peerprotocol"
+	"github.com/fichain/go-file/external/peersource"
+	"github.com/fichain/go-file/external/pexlist"
+	"github.com/fichain/go-file/internal/magnet"
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/stretchr/testify/assert"
+)
+
+// pexHandshake is the extension handshake of a peer that supports only the PEX extension.
+var pexHandshake = peerprotocol.ExtensionMessage{
+	ExtendedMessageID: peerprotocol.ExtensionIDHandshake,
+	Payload: peerprotocol.ExtensionHandshakeMessage{
+		M: map[string]uint8{peerprotocol.ExtensionKeyPEX: peerprotocol.ExtensionIDPEX},
+		V: "test",
+	},
+}
+
+func TestTorrentSendPEX(t *testing.T) {
+	s := newTestSession(t, nil)
+	tor := seedSampleTorrent(t, s)
+	var ih [20]byte
+	copy(ih[:], tor.InfoHash())
+
+	a := newTestHost(t)
+	stream := openTorrentStream(t, a, s, ih)
+	writePeerMessage(t, stream, pexHandshake)
+	waitFor(t, 5*time.Second, func() bool { return len(tor.Peers()) == 1 })
+
+	// Connected peers are sent in the initial PEX message.
+	b := newTestHost(t)
+	stream = openTorrentStream(t, b, s, ih)
+	writePeerMessage(t, stream, pexHandshake)
+	msg := readPeerMessage(t, stream, func(msg interface{}) bool {
+		_, ok := msg.(peerprotocol.ExtensionPEXMessage)
+		return ok
+	}).(peerprotocol.ExtensionPEXMessage)
+	peers, err := pexlist.DecodePeers(msg.Added)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if assert.Len(t, peers, 1) {
+		assert.Equal(t, a.ID(), peers[0].ID)
+	}
+}
+
+func TestTorrentReceivePEX(t *testing.T) {
+	s := newTestSession(t, nil)
+	var ih [20]byte
+	copy(ih[:], "pex test torrent    ")
+	m := magnet.Magnet{InfoHash: ih, Name: "pex"}
+	tor, err := s.AddFileId(m.String(), &AddTorrentOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Peer that is only known by the sender of the PEX message.
+	other := newTestHost(t)
+	dialedC := make(chan [20]byte, 1)
+	other.SetStreamHandler(p2p.TransferProtocolID(p2p.TransferProtocolVersion), func(stream network.Stream) {
+		infoHash, err := p2p.ReadTransferHandshake(stream)
+		if err != nil {
+			return
+		}
+		_ = p2p.WriteTransferResponse(stream, "")
+		dialedC <- infoHash
+	})
+
+	h := newTestHost(t)
+	stream := openTorrentStream(t, h, s, ih)
+	writePeerMessage(t, stream, pexHandshake)
+	writePeerMessage(t, stream, peerprotocol.ExtensionMessage{
+		ExtendedMessageID: peerprotocol.ExtensionIDPEX,
+		Payload: peerprotocol.ExtensionPEXMessage{
+			Added: []peerprotocol.PEXPeer{
+				pexlist.NewPEXPeer(loopbackAddrInfo(other)),
+				// Own address must be ignored.
+				pexlist.NewPEXPeer(loopbackAddrInfo(s.host)),
+			},
+		},
+	})
+
+	select {
+	case infoHash := <-dialedC:
+		assert.Equal(t, ih, infoHash)
+	case <-time.After(10 * time.Second):
+		t.Fatal("peer received with pex is not dialed")
+	}
+	waitFor(t, 5*time.Second, func() bool {
+		for _, pe := range tor.Peers() {
+			if pe.ID == other.ID() {
+				return pe.Source == peersource.PEX
+			}
+		}
+		return false
+	})
+}
@@ -0,0 +1,23 @@
+package filechain
+
+import "errors"
+
+var errNoFreePort = errors.New("no free port")
+
+// getPort reserves a port for listening BitTorrent peers.
+// The port must be released with releasePort after the listener is closed.
+func (s *Session) getPort() (int, error) {
+	s.mPorts.Lock()
+	defer s.mPorts.Unlock()
+	for p := range s.availablePorts {
+		delete(s.availablePorts, p)
+		return p, nil
+	}
+	return 0, errNoFreePort
+}
+
+func (s *Session) releasePort(port int) {
+	s.mPorts.Lock()
+	defer s.mPorts.Unlock()
+	s.availablePorts[port] = struct{}{}
+}
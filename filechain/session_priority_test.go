@@ -0,0 +1,52 @@
+package filechain
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTorrentPriority(t *testing.T) {
+	a := newTestSession(t, nil)
+	b := newTestSession(t, func(cfg *Config) {
+		cfg.SpeedLimitDownload = 64
+		cfg.SpeedLimitShareInterval = 100 * time.Millisecond
+	})
+	bulkSeeder := createRandomTorrent(t, a, 192<<10)
+	urgentSeeder := createRandomTorrent(t, a, 192<<10)
+
+	bulk := downloadFrom(t, b, bulkSeeder, a, func(tor *torrent) {
+		err := tor.SetPriority(PriorityLow)
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+	urgent := downloadFrom(t, b, urgentSeeder, a, func(tor *torrent) {
+		err := tor.SetPriority(PriorityHigh)
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	// Share of the urgent torrent is 16 times the share of the bulk torrent while both are downloading.
+	waitFor(t, 10*time.Second, func() bool {
+		return urgent.Stats().SpeedLimit.Download == 60 && bulk.Stats().SpeedLimit.Download == 3
+	})
+	waitFor(t, 20*time.Second, func() bool { return urgent.Stats().Status == Seeding })
+	stats := bulk.Stats()
+	assert.Equal(t, Downloading, stats.Status)
+	assert.True(t, stats.Bytes.Completed < stats.Bytes.Total)
+
+	// Bulk torrent gets all of the bandwidth after the urgent torrent is completed.
+	waitFor(t, 10*time.Second, func() bool { return bulk.Stats().SpeedLimit.Download == 64 })
+	waitFor(t, 20*time.Second, func() bool { return bulk.Stats().Status == Seeding })
+
+	assert.Equal(t, PriorityHigh, urgent.Stats().Priority)
+	spec, err := b.resumer.Read(bulk.id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, int(PriorityLow), spec.Priority)
+	assert.Error(t, bulk.SetPriority(Priority(5)))
+}
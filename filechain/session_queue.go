@@ -0,0 +1,202 @@
+package filechain
+
+import (
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+func (c *Config) queueEnabled() bool {
+	return c.MaxActiveDownloads > 0 || c.MaxActiveSeeds > 0 || c.MaxActiveChecking > 0
+}
+
+// addToQueue puts the torrent in the queue.
+// New torrents are put at the bottom. Torrents loaded from resume data are put at their saved position.
+func (s *Session) addToQueue(t *torrent) {
+	s.mQueue.Lock()
+	defer s.mQueue.Unlock()
+	pos := atomic.LoadInt32(&t.queuePosition)
+	if pos >= 0 {
+		i := sort.Search(len(s.queue), func(i int) bool {
+			return queueLess(t, pos, s.queue[i], atomic.LoadInt32(&s.queue[i].queuePosition))
+		})
+		s.queue = append(s.queue, nil)
+		copy(s.queue[i+1:], s.queue[i:])
+		s.queue[i] = t
+		return
+	}
+	s.queue = append(s.queue, t)
+	s.writeQueuePositions()
+}
+
+// queueLess orders the torrents by saved position, then by the time they are added.
+func queueLess(t1 *torrent, pos1 int32, t2 *torrent, pos2 int32) bool {
+	if pos1 != pos2 {
+		return pos1 < pos2
+	}
+	if !t1.addedAt.Equal(t2.addedAt) {
+		return t1.addedAt.Before(t2.addedAt)
+	}
+	return t1.id < t2.id
+}
+
+// renumberQueue makes the positions of the torrents consecutive after loading them from resume data.
+func (s *Session) renumberQueue() {
+	s.mQueue.Lock()
+	defer s.mQueue.Unlock()
+	s.writeQueuePositions()
+}
+
+func (s *Session) removeFromQueue(t *torrent) {
+	s.mQueue.Lock()
+	defer s.mQueue.Unlock()
+	for i, t2 := range s.queue {
+		if t2 == t {
+			s.queue = append(s.queue[:i], s.queue[i+1:]...)
+			break
+		}
+	}
+	s.writeQueuePositions()
+}
+
+func (s *Session) moveInQueue(t *torrent, top bool) error {
+	s.mQueue.Lock()
+	defer s.mQueue.Unlock()
+	i := -1
+	for j, t2 := range s.queue {
+		if t2 == t {
+			i = j
+			break
+		}
+	}
+	if i < 0 {
+		return errClosed
+	}
+	copy(s.queue[i:], s.queue[i+1:])
+	if top {
+		copy(s.queue[1:], s.queue[:len(s.queue)-1])
+		s.queue[0] = t
+	} else {
+		s.queue[len(s.queue)-1] = t
+	}
+	err := s.writeQueuePositions()
+	s.notifyQueue()
+	return err
+}
+
+// writeQueuePositions sets the positions of the torrents to their indexes in the queue and saves the changed ones.
+// Must be called while holding mQueue.
+func (s *Session) writeQueuePositions() error {
+	changed := make(map[string]int)
+	for i, t := range s.queue {
+		if atomic.SwapInt32(&t.queuePosition, int32(i)) != int32(i) {
+			changed[t.id] = i
+		}
+	}
+	if len(changed) == 0 {
+		return nil
+	}
+	err := s.resumer.WriteQueuePositions(changed)
+	if err != nil {
+		s.log.Errorln("cannot save queue positions:", err)
+	}
+	return err
+}
+
+// notifyQueue triggers the processing of the queue. It does not block.
+func (s *Session) notifyQueue() {
+	select {
+	case s.queueC <- struct{}{}:
+	default:
+	}
+}
+
+func (s *Session) runQueue() {
+	ticker := time.NewTicker(s.config.QueueCheckInterval)
+	defer ticker.Stop()
+	for {
+		s.processQueue()
+		select {
+		case <-ticker.C:
+		case <-s.queueC:
+		case <-s.closeC:
+			return
+		}
+	}
+}
+
+// queueSlots counts the running torrents by what they do.
+type queueSlots struct {
+	downloads, seeds, checking int
+}
+
+// processQueue stops the torrents that are over the limits and starts the queued torrents if there are free slots.
+// Torrents at the top of the queue get the slots first.
+func (s *Session) processQueue() {
+	s.mQueue.Lock()
+	torrents := append([]*torrent(nil), s.queue...)
+	s.mQueue.Unlock()
+
+	cfg := &s.config
+	over := func(n, max int) bool { return max > 0 && n > max }
+	var used queueSlots
+	var queued []*torrent
+	var queuedStates []queueState
+	for _, t := range torrents {
+		st := t.queueState()
+		switch st.Status {
+		case Stopped, Stopping:
+			continue
+		case Queued:
+			queued = append(queued, t)
+			queuedStates = append(queuedStates, st)
+			continue
+		}
+		checking := st.Status == Allocating || st.Status == Verifying
+		counted := !(cfg.QueueSkipSlowTorrents && st.Slow)
+		next := used
+		if checking {
+			next.checking++
+		}
+		if counted && st.Completed {
+			next.seeds++
+		} else if counted {
+			next.downloads++
+		}
+		if over(next.checking, cfg.MaxActiveChecking) || over(next.seeds, cfg.MaxActiveSeeds) || over(next.downloads, cfg.MaxActiveDownloads) {
+			s.enqueue(t)
+			continue
+		}
+		used = next
+	}
+	for i, t := range queued {
+		next := used
+		if queuedStates[i].Check {
+			next.checking++
+		}
+		if queuedStates[i].Completed {
+			next.seeds++
+		} else {
+			next.downloads++
+		}
+		if over(next.checking, cfg.MaxActiveChecking) || over(next.seeds, cfg.MaxActiveSeeds) || over(next.downloads, cfg.MaxActiveDownloads) {
+			continue
+		}
+		s.dequeue(t)
+		used = next
+	}
+}
+
+func (s *Session) enqueue(t *torrent) {
+	select {
+	case t.enqueueCommandC <- struct{}{}:
+	case <-t.closeC:
+	}
+}
+
+func (s *Session) dequeue(t *torrent) {
+	select {
+	case t.dequeueCommandC <- struct{}{}:
+	case <-t.closeC:
+	}
+}
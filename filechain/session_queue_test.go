@@ -0,0 +1,160 @@
+package filechain
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSessionQueueDownloads(t *testing.T) {
+	a := newTestSession(t, nil)
+	a.SetSpeedLimits(0, 128)
+	b := newTestSession(t, func(cfg *Config) {
+		cfg.MaxActiveDownloads = 1
+		cfg.QueueCheckInterval = 100 * time.Millisecond
+		cfg.PEXEnabled = false
+	})
+	seeder1 := createRandomTorrent(t, a, 256<<10)
+	seeder2 := createRandomTorrent(t, a, 256<<10)
+	seeder3 := createRandomTorrent(t, a, 64<<10)
+
+	tor1 := downloadFrom(t, b, seeder1, a, nil)
+	tor2 := downloadFrom(t, b, seeder2, a, nil)
+	tor3 := downloadFrom(t, b, seeder3, a, nil)
+	assert.Equal(t, 0, tor1.QueuePosition())
+	assert.Equal(t, 1, tor2.QueuePosition())
+	assert.Equal(t, 2, tor3.QueuePosition())
+
+	waitFor(t, 5*time.Second, func() bool { return tor1.Stats().Status == Downloading })
+	assert.Equal(t, Queued, tor2.Stats().Status)
+	assert.Equal(t, Queued, tor3.Stats().Status)
+	// Addresses of queued torrents are kept until they are started.
+	assert.Equal(t, 1, tor3.Stats().Addresses.Total)
+
+	// Third torrent gets the slot of the first one.
+	assert.NoError(t, tor3.MoveToQueueTop())
+	assert.Equal(t, 0, tor3.QueuePosition())
+	assert.Equal(t, 1, tor1.QueuePosition())
+	assert.Equal(t, 2, tor2.QueuePosition())
+	spec, err := b.resumer.Read(tor3.id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 0, spec.QueuePosition)
+
+	waitFor(t, 20*time.Second, func() bool { return tor3.Stats().Status != Queued })
+	assert.Equal(t, Seeding, tor1.Stats().Status)
+	assert.Equal(t, Queued, tor2.Stats().Status)
+	waitFor(t, 20*time.Second, func() bool { return tor2.Stats().Status == Seeding })
+
+	// Stopped torrents are not started by the queue.
+	tor1.Stop()
+	waitFor(t, 5*time.Second, func() bool { return tor1.Stats().Status == Stopped })
+	time.Sleep(300 * time.Millisecond)
+	assert.Equal(t, Stopped, tor1.Stats().Status)
+}
+
+func TestSessionQueueSeeds(t *testing.T) {
+	var database, user string
+	s := newTestSession(t, func(cfg *Config) {
+		cfg.MaxActiveSeeds = 1
+		cfg.QueueCheckInterval = 100 * time.Millisecond
+		database = cfg.Database
+		user = cfg.LibP2pUser
+	})
+	tor1 := createRandomTorrent(t, s, 64<<10)
+	tor2 := createRandomTorrent(t, s, 64<<10)
+	tor3 := createRandomTorrent(t, s, 64<<10)
+	waitFor(t, 5*time.Second, func() bool { return tor1.Stats().Status == Seeding })
+	assert.Equal(t, Queued, tor2.Stats().Status)
+	assert.Equal(t, Queued, tor3.Stats().Status)
+
+	assert.NoError(t, tor2.MoveToQueueBottom())
+	tor1.Stop()
+	waitFor(t, 5*time.Second, func() bool { return tor3.Stats().Status == Seeding })
+	assert.Equal(t, Queued, tor2.Stats().Status)
+
+	// Queue order is kept in resume data.
+	id1, id2, id3 := tor1.id, tor2.id, tor3.id
+	closeTestSession(s)
+	s = newTestSession(t, func(cfg *Config) {
+		cfg.Database = database
+		cfg.LibP2pUser = user
+		cfg.MaxActiveSeeds = 1
+		cfg.QueueCheckInterval = 100 * time.Millisecond
+	})
+	tor1, _ = s.existTorrent(id1)
+	tor2, _ = s.existTorrent(id2)
+	tor3, _ = s.existTorrent(id3)
+	assert.Equal(t, 0, tor1.QueuePosition())
+	assert.Equal(t, 1, tor3.QueuePosition())
+	assert.Equal(t, 2, tor2.QueuePosition())
+	waitFor(t, 5*time.Second, func() bool { return tor1.Stats().Status == Seeding })
+	assert.Equal(t, Queued, tor3.Stats().Status)
+	assert.Equal(t, Queued, tor2.Stats().Status)
+
+	// Removed torrents free their positions and slots.
+	assert.NoError(t, s.RemoveTorrent(id1, false))
+	assert.Equal(t, 0, tor3.QueuePosition())
+	assert.Equal(t, 1, tor2.QueuePosition())
+	waitFor(t, 5*time.Second, func() bool { return tor3.Stats().Status == Seeding })
+	assert.Equal(t, Queued, tor2.Stats().Status)
+}
+
+func TestSessionQueueSkipSlowTorrents(t *testing.T) {
+	s := newTestSession(t, func(cfg *Config) {
+		cfg.MaxActiveSeeds = 1
+		cfg.QueueCheckInterval = 100 * time.Millisecond
+		cfg.QueueSkipSlowTorrents = true
+		cfg.SlowTorrentTimeout = 500 * time.Millisecond
+	})
+	tor1 := createRandomTorrent(t, s, 64<<10)
+	tor2 := createRandomTorrent(t, s, 64<<10)
+	waitFor(t, 5*time.Second, func() bool { return tor1.Stats().Status == Seeding })
+	assert.Equal(t, Queued, tor2.Stats().Status)
+
+	// Nobody downloads from the first torrent, so it does not take the slot after the timeout.
+	waitFor(t, 5*time.Second, func() bool { return tor2.Stats().Status == Seeding })
+	assert.True(t, tor1.Stats().Slow)
+	assert.Equal(t, Seeding, tor1.Stats().Status)
+}
+
+func TestSessionQueueChecking(t *testing.T) {
+	var database, user string
+	configure := func(cfg *Config) {
+		cfg.MaxActiveChecking = 1
+		cfg.QueueCheckInterval = time.Hour
+	}
+	s := newTestSession(t, func(cfg *Config) {
+		configure(cfg)
+		database = cfg.Database
+		user = cfg.LibP2pUser
+	})
+	tor1 := createRandomTorrent(t, s, 64<<10)
+	tor2 := createRandomTorrent(t, s, 64<<10)
+	tor3 := createRandomTorrent(t, s, 64<<10)
+	for _, tor := range []*torrent{tor1, tor2, tor3} {
+		tor := tor
+		waitFor(t, 5*time.Second, func() bool { return tor.Stats().Status == Seeding })
+	}
+
+	// Only the first torrent verifies its files after loading, the others have their bitfields.
+	assert.NoError(t, s.resumer.WriteBitfield(tor1.id, nil))
+	id1, id2, id3 := tor1.id, tor2.id, tor3.id
+	closeTestSession(s)
+	s = newTestSession(t, func(cfg *Config) {
+		configure(cfg)
+		cfg.Database = database
+		cfg.LibP2pUser = user
+	})
+	tor1, _ = s.existTorrent(id1)
+	tor2, _ = s.existTorrent(id2)
+	tor3, _ = s.existTorrent(id3)
+
+	// Torrents that do not verify do not wait for the checking slot.
+	for _, tor := range []*torrent{tor1, tor2, tor3} {
+		tor := tor
+		waitFor(t, 5*time.Second, func() bool { return tor.Stats().Status == Seeding })
+	}
+}
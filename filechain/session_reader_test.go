@@ -0,0 +1,160 @@
+package filechain
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fichain/go-file/internal/metainfo"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSessionOpenFile(t *testing.T) {
+	a := newTestSession(t, nil)
+	a.SetSpeedLimits(0, 64)
+	b := newTestSession(t, func(cfg *Config) { cfg.ReadaheadSize = 32 << 10 })
+	seeder := createRandomTorrent(t, a, 256<<10)
+	data, err := ioutil.ReadFile(filepath.Join(seeder.dataDir, seeder.Name()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	leecher := downloadFrom(t, b, seeder, a, func(tor *torrent) {
+		_, err := tor.OpenFile(seeder.Name())
+		assert.Error(t, err)
+	})
+	waitFor(t, 20*time.Second, func() bool { return leecher.Stats().Pieces.Total > 0 })
+	_, err = leecher.OpenFile("missing.bin")
+	assert.Error(t, err)
+
+	// Pieces at the end of the file are downloaded first when they are read.
+	r1, err := leecher.OpenFile(seeder.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	pos, err := r1.Seek(-32<<10, io.SeekEnd)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(224<<10), pos)
+	buf := make([]byte, 32<<10)
+	_, err = io.ReadFull(r1, buf)
+	assert.NoError(t, err)
+	assert.True(t, bytes.Equal(data[224<<10:], buf))
+	st := leecher.Stats()
+	assert.Less(t, st.Pieces.Have, st.Pieces.Total)
+	_, err = r1.Read(buf)
+	assert.Equal(t, io.EOF, err)
+	assert.NoError(t, r1.Close())
+	_, err = r1.Read(buf)
+	assert.Error(t, err)
+
+	// Readers are independent of each other.
+	r2, err := leecher.OpenFile(seeder.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	r3, err := leecher.OpenFile(seeder.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = r3.Seek(128<<10, io.SeekStart)
+	assert.NoError(t, err)
+	b3, err := ioutil.ReadAll(r3)
+	assert.NoError(t, err)
+	assert.True(t, bytes.Equal(data[128<<10:], b3))
+	b2, err := ioutil.ReadAll(r2)
+	assert.NoError(t, err)
+	assert.True(t, bytes.Equal(data, b2))
+	assert.NoError(t, r2.Close())
+	assert.NoError(t, r3.Close())
+	waitFor(t, 5*time.Second, func() bool { return leecher.Stats().Status == Seeding })
+}
+
+func TestSessionOpenFileClose(t *testing.T) {
+	s := newTestSession(t, nil)
+	tor := createRandomTorrent(t, s, 64<<10)
+	waitFor(t, 5*time.Second, func() bool { return tor.Stats().Status == Seeding })
+	r, err := tor.OpenFile(tor.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tor.mBitfield.Lock()
+	tor.bitfield.Clear(1)
+	tor.mBitfield.Unlock()
+
+	// Closing the reader unblocks the pending read.
+	_, err = r.Seek(32<<10, io.SeekStart)
+	assert.NoError(t, err)
+	errC := make(chan error, 1)
+	go func() {
+		_, err := r.Read(make([]byte, 1024))
+		errC <- err
+	}()
+	time.Sleep(100 * time.Millisecond)
+	assert.NoError(t, r.Close())
+	select {
+	case err = <-errC:
+		assert.Equal(t, errReaderClosed, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("read is not unblocked")
+	}
+}
+
+func TestSessionOpenFileCloseFromGateway(t *testing.T) {
+	s := newTestSession(t, enableGateway)
+	tor := createRandomTorrent(t, s, 64<<10)
+	waitFor(t, 5*time.Second, func() bool { return tor.Stats().Status == Seeding })
+	tor.mBitfield.Lock()
+	tor.bitfield.Clear(1)
+	tor.mBitfield.Unlock()
+
+	// Gateway closes the reader from another goroutine when the client goes away.
+	// Close must unblock the Read that waits for the missing piece, so the handler returns.
+	ctx, cancel := context.WithCancel(context.Background())
+	path := "/" + hex.EncodeToString(tor.InfoHash()) + "/" + tor.Name()
+	req := httptest.NewRequest(http.MethodGet, path, nil).WithContext(ctx)
+	req.Header.Set("Range", "bytes=32768-")
+	doneC := make(chan struct{})
+	go func() {
+		s.handleGateway(httptest.NewRecorder(), req)
+		close(doneC)
+	}()
+	time.Sleep(100 * time.Millisecond)
+	select {
+	case <-doneC:
+		t.Fatal("read is not blocked")
+	default:
+	}
+	cancel()
+	select {
+	case <-doneC:
+	case <-time.After(5 * time.Second):
+		t.Fatal("read is not unblocked")
+	}
+}
+
+func TestReadaheadDeadlines(t *testing.T) {
+	const pieceLength = 16 << 10
+	tor := &torrent{
+		session: &Session{config: Config{ReadaheadSize: 4 * pieceLength}},
+		info:    &metainfo.Info{PieceLength: pieceLength},
+		readers: make(map[*fileReader]*readerPosition),
+	}
+	slow := &fileReader{length: 20 * pieceLength}
+	fast := &fileReader{length: 20 * pieceLength}
+	tor.readers[slow] = &readerPosition{Offset: 0, Speed: 1 << 20}
+	tor.readers[fast] = &readerPosition{Offset: 10 * pieceLength, Speed: 4 << 20}
+
+	// Pieces ahead of the fast reader are needed sooner than the pieces at the same distance from the slow reader.
+	priorities := tor.readaheadPriorities()
+	for rank, i := range []uint32{0, 10, 11, 12, 13, 1, 2, 3} {
+		assert.Equal(t, readaheadPriority-rank, priorities[i], "piece #%d", i)
+	}
+	assert.Len(t, priorities, 8)
+}
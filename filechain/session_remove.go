@@ -0,0 +1,76 @@
+package filechain
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var errTorrentNotFound = errors.New("torrent not found")
+
+// RemoveTorrent closes the torrent and deletes it from the session and the resume db.
+// If deleteData is true, downloaded files of the torrent are deleted too. Files of torrents made with CreateFile are kept.
+func (s *Session) RemoveTorrent(id string, deleteData bool) error {
+	t, ok := s.existTorrent(id)
+	if !ok {
+		return newInputError(errTorrentNotFound)
+	}
+	t.Close()
+	return s.removeTorrent(t, deleteData)
+}
+
+// removeTorrent deletes the closed torrent from the session. The run loop of the torrent must have exited.
+func (s *Session) removeTorrent(t *torrent, deleteData bool) error {
+	s.mTorrents.Lock()
+	if s.torrents[t.id] != t {
+		s.mTorrents.Unlock()
+		return nil
+	}
+	delete(s.torrents, t.id)
+	err := s.writeTorrentIds()
+	s.mTorrents.Unlock()
+	s.removeFromQueue(t)
+	t.log.Info("removing torrent")
+	if err != nil {
+		return err
+	}
+	err = s.resumer.Delete(t.id)
+	if err != nil {
+		return err
+	}
+	s.shareBandwidth()
+	if deleteData {
+		return t.deleteData()
+	}
+	return nil
+}
+
+// writeTorrentIds saves the IDs of the torrents in the session. Must be called with mTorrents held,
+// so concurrent adds and removes cannot save a stale list.
+func (s *Session) writeTorrentIds() error {
+	keys := make([]string, 0, len(s.torrents))
+	for k := range s.torrents {
+		keys = append(keys, k)
+	}
+	s.sessionSpec.TorrentIds = keys
+	return s.sessionResumer.WriteTorrentIds(keys)
+}
+
+// deleteData deletes the file of a single file torrent or the top directory of a multi file torrent.
+// Files of torrents made with Session.CreateFile are shared from where the user keeps them, so they are left in place.
+func (t *torrent) deleteData() error {
+	if t.info == nil || len(t.info.Files) == 0 {
+		return nil
+	}
+	if t.created {
+		t.log.Infoln("not deleting data of created torrent:", t.dataDir)
+		return nil
+	}
+	name := t.info.Files[0].Path
+	if t.info.MultiFile {
+		name = strings.SplitN(name, string(filepath.Separator), 2)[0]
+	}
+	t.log.Infoln("deleting data:", name)
+	return os.RemoveAll(filepath.Join(t.dataDir, name))
+}
@@ -0,0 +1,207 @@
+package filechain
+
+import (
+	"errors"
+	"sort"
+	"time"
+)
+
+// ScheduleRule changes the speed limits and the activity of torrents in a weekly time window.
+type ScheduleRule struct {
+	// Days of the week that the window starts on. Empty means every day.
+	Days []time.Weekday
+	// Start and end of the window as the duration since midnight, between 0 and 24h.
+	// If End is before Start, the window ends on the next day. If they are equal, the window covers the whole day.
+	Start, End time.Duration
+	// Session speed limits in KB/s while the rule is active.
+	// Zero keeps the limit in Config, a negative value removes the limit.
+	SpeedLimitDownload int64
+	SpeedLimitUpload   int64
+	// Maximum number of running torrents while the rule is active. Zero means no limit.
+	// Torrents that are added last are stopped first. Queued torrents are not counted.
+	MaxActiveTorrents int
+	// IDs of torrents that are stopped while the rule is active.
+	PauseTorrents []string
+}
+
+func (r *ScheduleRule) validate() error {
+	const day = 24 * time.Hour
+	if r.Start < 0 || r.Start > day || r.End < 0 || r.End > day {
+		return errors.New("start and end must be between 0 and 24h")
+	}
+	if r.MaxActiveTorrents < 0 {
+		return errors.New("negative max active torrents")
+	}
+	for _, d := range r.Days {
+		if d < time.Sunday || d > time.Saturday {
+			return errors.New("invalid day")
+		}
+	}
+	return nil
+}
+
+func (r *ScheduleRule) hasDay(d time.Weekday) bool {
+	if len(r.Days) == 0 {
+		return true
+	}
+	for _, d2 := range r.Days {
+		if d2 == d {
+			return true
+		}
+	}
+	return false
+}
+
+// activeAt returns true if now is in the window of the rule, in the location of now.
+func (r *ScheduleRule) activeAt(now time.Time) bool {
+	y, m, d := now.Date()
+	offset := now.Sub(time.Date(y, m, d, 0, 0, 0, 0, now.Location()))
+	today := now.Weekday()
+	yesterday := (today + 6) % 7
+	switch {
+	case r.Start < r.End:
+		return r.hasDay(today) && offset >= r.Start && offset < r.End
+	case r.Start > r.End:
+		return (r.hasDay(today) && offset >= r.Start) || (r.hasDay(yesterday) && offset < r.End)
+	default:
+		return r.hasDay(today)
+	}
+}
+
+// scheduleSettings are the values set by the rules that are active at a time.
+type scheduleSettings struct {
+	rules              []int
+	speedLimitDownload int64
+	speedLimitUpload   int64
+	maxActiveTorrents  int
+	paused             map[string]struct{}
+}
+
+func (s *Session) scheduleSettingsAt(now time.Time) *scheduleSettings {
+	ss := &scheduleSettings{
+		speedLimitDownload: s.config.SpeedLimitDownload,
+		speedLimitUpload:   s.config.SpeedLimitUpload,
+		paused:             make(map[string]struct{}),
+	}
+	for i, r := range s.config.Schedule {
+		if !r.activeAt(now) {
+			continue
+		}
+		ss.rules = append(ss.rules, i)
+		if r.SpeedLimitDownload != 0 {
+			ss.speedLimitDownload = r.SpeedLimitDownload
+		}
+		if r.SpeedLimitUpload != 0 {
+			ss.speedLimitUpload = r.SpeedLimitUpload
+		}
+		if r.MaxActiveTorrents > 0 && (ss.maxActiveTorrents == 0 || r.MaxActiveTorrents < ss.maxActiveTorrents) {
+			ss.maxActiveTorrents = r.MaxActiveTorrents
+		}
+		for _, id := range r.PauseTorrents {
+			ss.paused[id] = struct{}{}
+		}
+	}
+	if ss.speedLimitDownload < 0 {
+		ss.speedLimitDownload = 0
+	}
+	if ss.speedLimitUpload < 0 {
+		ss.speedLimitUpload = 0
+	}
+	return ss
+}
+
+func (s *Session) now() time.Time {
+	if s.config.ScheduleClock != nil {
+		return s.config.ScheduleClock()
+	}
+	return time.Now()
+}
+
+func (s *Session) runScheduler() {
+	ticker := time.NewTicker(s.config.ScheduleCheckInterval)
+	defer ticker.Stop()
+	for {
+		s.applySchedule()
+		select {
+		case <-ticker.C:
+		case <-s.closeC:
+			return
+		}
+	}
+}
+
+// applySchedule changes the speed limits of the session if the set of active rules has changed since the last call.
+// Speed limits that are changed manually are kept until the next change.
+// Limits on torrents are enforced on every call, so the torrents that are added or started later are limited too.
+func (s *Session) applySchedule() {
+	s.mSchedule.Lock()
+	defer s.mSchedule.Unlock()
+	ss := s.scheduleSettingsAt(s.now())
+	if !s.scheduleApplied || !equalInts(ss.rules, s.scheduleRules) {
+		s.log.Infof("applying schedule rules: %v", ss.rules)
+		s.scheduleApplied = true
+		s.scheduleRules = ss.rules
+		s.SetSpeedLimits(ss.speedLimitDownload, ss.speedLimitUpload)
+	}
+	s.applyTorrentSchedule(ss)
+}
+
+// applyTorrentSchedule stops the paused torrents and the torrents over the limit,
+// and starts the torrents that are stopped by an earlier rule but are allowed to run now.
+// Queued torrents are not counted, the session queue starts them when they get a slot.
+func (s *Session) applyTorrentSchedule(ss *scheduleSettings) {
+	s.mTorrents.RLock()
+	torrents := make([]*torrent, 0, len(s.torrents))
+	for _, t := range s.torrents {
+		torrents = append(torrents, t)
+	}
+	s.mTorrents.RUnlock()
+	sort.Slice(torrents, func(i, j int) bool {
+		if torrents[i].addedAt.Equal(torrents[j].addedAt) {
+			return torrents[i].id < torrents[j].id
+		}
+		return torrents[i].addedAt.Before(torrents[j].addedAt)
+	})
+
+	var running int
+	for _, t := range torrents {
+		_, paused := ss.paused[t.id]
+		_, stopped := s.scheduleStopped[t.id]
+		status := t.queueState().Status
+		active := status != Stopped && status != Stopping && status != Queued
+		switch {
+		case paused || (ss.maxActiveTorrents > 0 && running >= ss.maxActiveTorrents):
+			// Paused torrents are removed from the queue too, so the queue does not start them in the window.
+			if active || (paused && status == Queued) {
+				t.log.Info("stopping torrent by schedule")
+				t.Stop()
+				s.scheduleStopped[t.id] = struct{}{}
+			}
+		case stopped:
+			t.log.Info("starting torrent by schedule")
+			delete(s.scheduleStopped, t.id)
+			_ = t.Start()
+			running++
+		case active:
+			running++
+		}
+	}
+}
+
+func (s *Session) activeScheduleRules() []int {
+	s.mSchedule.Lock()
+	defer s.mSchedule.Unlock()
+	return append([]int(nil), s.scheduleRules...)
+}
+
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,175 @@
+package filechain
+
+import (
+	"encoding/hex"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testClock is a clock for the schedule that is moved manually.
+type testClock struct {
+	m   sync.Mutex
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time {
+	c.m.Lock()
+	defer c.m.Unlock()
+	return c.now
+}
+
+func (c *testClock) Set(t time.Time) {
+	c.m.Lock()
+	c.now = t
+	c.m.Unlock()
+}
+
+func TestScheduleRuleActiveAt(t *testing.T) {
+	r := ScheduleRule{Days: []time.Weekday{time.Friday}, Start: 22 * time.Hour, End: 6 * time.Hour}
+	// 2021-03-05 is a Friday.
+	at := func(day, hour int) time.Time { return time.Date(2021, 3, day, hour, 0, 0, 0, time.UTC) }
+	assert.False(t, r.activeAt(at(5, 21)))
+	assert.True(t, r.activeAt(at(5, 22)))
+	assert.True(t, r.activeAt(at(6, 5)))
+	assert.False(t, r.activeAt(at(6, 6)))
+	assert.False(t, r.activeAt(at(6, 23)))
+	assert.False(t, r.activeAt(at(5, 3)))
+
+	r = ScheduleRule{Start: 9 * time.Hour, End: 18 * time.Hour}
+	assert.False(t, r.activeAt(at(1, 8)))
+	assert.True(t, r.activeAt(at(1, 9)))
+	assert.False(t, r.activeAt(at(1, 18)))
+
+	r = ScheduleRule{Days: []time.Weekday{time.Saturday, time.Sunday}}
+	assert.False(t, r.activeAt(at(5, 23)))
+	assert.True(t, r.activeAt(at(6, 0)))
+	assert.True(t, r.activeAt(at(7, 23)))
+	assert.False(t, r.activeAt(at(8, 0)))
+
+	r = ScheduleRule{Start: 25 * time.Hour}
+	assert.Error(t, r.validate())
+}
+
+func TestSessionSchedule(t *testing.T) {
+	info := sampleInfo(t)
+	sampleID := hex.EncodeToString(info.Hash[:])
+	// 2021-03-01 is a Monday.
+	day := func(d, hour int) time.Time { return time.Date(2021, 3, d, hour, 0, 0, 0, time.UTC) }
+	clock := &testClock{now: day(1, 8)}
+	s := newTestSession(t, func(cfg *Config) {
+		cfg.SpeedLimitDownload = 10
+		cfg.ScheduleCheckInterval = 10 * time.Millisecond
+		cfg.ScheduleClock = clock.Now
+		cfg.Schedule = []ScheduleRule{
+			{
+				Days:               []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday},
+				Start:              9 * time.Hour,
+				End:                18 * time.Hour,
+				SpeedLimitDownload: 100,
+				SpeedLimitUpload:   50,
+				PauseTorrents:      []string{sampleID},
+			},
+			{
+				Days:              []time.Weekday{time.Saturday, time.Sunday},
+				MaxActiveTorrents: 1,
+			},
+			{
+				Start:              22 * time.Hour,
+				End:                6 * time.Hour,
+				SpeedLimitDownload: -1,
+			},
+		}
+	})
+	sample := seedSampleTorrent(t, s)
+	assert.Equal(t, sampleID, sample.id)
+	other := createRandomTorrent(t, s, 16<<10)
+
+	// moveTo sets the clock and waits until the schedule is applied.
+	moveTo := func(now time.Time, rules []int) {
+		t.Helper()
+		clock.Set(now)
+		waitFor(t, 5*time.Second, func() bool { return equalInts(s.Stats().ScheduleRules, rules) })
+	}
+	isRunning := func(tor *torrent) func() bool {
+		return func() bool { return tor.Stats().Status == Seeding }
+	}
+	isStopped := func(tor *torrent) func() bool {
+		return func() bool { return tor.Stats().Status == Stopped }
+	}
+
+	stats := s.Stats()
+	assert.Empty(t, stats.ScheduleRules)
+	assert.Equal(t, int64(10), stats.SpeedLimitDownload)
+	assert.Zero(t, stats.SpeedLimitUpload)
+
+	// Working hours
+	moveTo(day(1, 10), []int{0})
+	stats = s.Stats()
+	assert.Equal(t, int64(100), stats.SpeedLimitDownload)
+	assert.Equal(t, int64(50), stats.SpeedLimitUpload)
+	waitFor(t, 5*time.Second, isStopped(sample))
+	waitFor(t, 5*time.Second, isRunning(other))
+
+	// Evening
+	moveTo(day(1, 19), []int{})
+	stats = s.Stats()
+	assert.Equal(t, int64(10), stats.SpeedLimitDownload)
+	assert.Zero(t, stats.SpeedLimitUpload)
+	waitFor(t, 5*time.Second, isRunning(sample))
+
+	// Night removes the download limit.
+	moveTo(day(1, 23), []int{2})
+	assert.Zero(t, s.Stats().SpeedLimitDownload)
+
+	// Only the torrent that is added first runs at weekends.
+	moveTo(day(6, 12), []int{1})
+	assert.Equal(t, int64(10), s.Stats().SpeedLimitDownload)
+	waitFor(t, 5*time.Second, isStopped(other))
+	waitFor(t, 5*time.Second, isRunning(sample))
+	// Torrents that are added in the window are limited too.
+	late := createRandomTorrent(t, s, 16<<10)
+	waitFor(t, 5*time.Second, isStopped(late))
+	moveTo(day(6, 23), []int{1, 2})
+	assert.Zero(t, s.Stats().SpeedLimitDownload)
+
+	// Next Monday before working hours.
+	moveTo(day(8, 7), []int{})
+	waitFor(t, 5*time.Second, isRunning(other))
+	waitFor(t, 5*time.Second, isRunning(sample))
+	waitFor(t, 5*time.Second, isRunning(late))
+
+	// Manual changes are kept until the next rule change.
+	s.SetSpeedLimits(1, 2)
+	time.Sleep(50 * time.Millisecond)
+	stats = s.Stats()
+	assert.Equal(t, int64(1), stats.SpeedLimitDownload)
+	assert.Equal(t, int64(2), stats.SpeedLimitUpload)
+}
+
+func TestSessionScheduleQueuedTorrents(t *testing.T) {
+	s := newTestSession(t, func(cfg *Config) {
+		cfg.MaxActiveSeeds = 1
+		cfg.QueueCheckInterval = 100 * time.Millisecond
+		cfg.ScheduleCheckInterval = 10 * time.Millisecond
+		cfg.Schedule = []ScheduleRule{{MaxActiveTorrents: 1}}
+	})
+	tor1 := createRandomTorrent(t, s, 16<<10)
+	tor2 := createRandomTorrent(t, s, 16<<10)
+	waitFor(t, 5*time.Second, func() bool { return tor1.Stats().Status == Seeding })
+
+	// Queued torrent does not use the slot of the schedule, so it is not stopped.
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, Queued, tor2.Stats().Status)
+	assert.Equal(t, Seeding, tor1.Stats().Status)
+}
+
+func TestSessionInvalidSchedule(t *testing.T) {
+	cfg := DefaultConfig
+	cfg.LibP2pUser = "test"
+	cfg.Schedule = []ScheduleRule{{End: -time.Hour}}
+	_, err := NewSession(cfg)
+	assert.Error(t, err)
+}
@@ -0,0 +1,121 @@
+package filechain
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSessionSeedGoalRatio(t *testing.T) {
+	a := newTestSession(t, nil)
+	b := newTestSession(t, nil)
+	seeder := createRandomTorrent(t, a, 128<<10)
+	err := seeder.SetSeedGoals(&SeedGoals{Ratio: 1, Action: SeedActionStop})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	leecher := downloadFrom(t, b, seeder, a, nil)
+	waitFor(t, 20*time.Second, func() bool { return leecher.Stats().Status == Seeding })
+
+	// Seeder has uploaded the whole torrent once.
+	waitFor(t, 5*time.Second, func() bool { return seeder.Stats().Status == Stopped })
+	stats := seeder.Stats()
+	assert.Equal(t, StopReasonRatio, stats.StopReason)
+	assert.True(t, stats.Bytes.Uploaded >= stats.Bytes.Total)
+	assert.Equal(t, StopReasonNone, leecher.Stats().StopReason)
+
+	spec, err := a.resumer.Read(seeder.id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 1.0, spec.SeedGoals.Ratio)
+
+	// Starting again clears the reason. Session has no default goals, so the torrent keeps seeding.
+	assert.NoError(t, seeder.SetSeedGoals(nil))
+	assert.NoError(t, seeder.Start())
+	waitFor(t, 5*time.Second, func() bool { return seeder.Stats().Status == Seeding })
+	assert.Equal(t, StopReasonNone, seeder.Stats().StopReason)
+	spec, err = a.resumer.Read(seeder.id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Nil(t, spec.SeedGoals)
+	assert.Error(t, seeder.SetSeedGoals(&SeedGoals{Ratio: -1}))
+}
+
+func TestSessionSeedGoalRemoveData(t *testing.T) {
+	a := newTestSession(t, nil)
+	b := newTestSession(t, func(cfg *Config) {
+		cfg.SeedGoals = SeedGoals{SeedTime: time.Second, Action: SeedActionRemoveData}
+	})
+	seeder := createRandomTorrent(t, a, 64<<10)
+
+	leecher := downloadFrom(t, b, seeder, a, nil)
+	assert.Equal(t, time.Second, leecher.Stats().SeedGoals.SeedTime)
+	waitFor(t, 20*time.Second, func() bool { return leecher.Stats().Status == Seeding })
+	name := filepath.Join(b.config.DataDir, leecher.Name())
+	_, err := os.Stat(name)
+	assert.NoError(t, err)
+
+	waitFor(t, 5*time.Second, func() bool {
+		_, ok := b.existTorrent(leecher.id)
+		return !ok
+	})
+	_, err = os.Stat(name)
+	assert.True(t, os.IsNotExist(err))
+	_, err = b.resumer.Read(leecher.id)
+	assert.Error(t, err)
+	assert.NotContains(t, b.sessionSpec.TorrentIds, leecher.id)
+	// Run loop has exited before the torrent is deleted from the session.
+	select {
+	case <-leecher.doneC:
+	default:
+		t.Fatal("run loop is running")
+	}
+}
+
+func TestSessionSeedGoalRemoveDataCreated(t *testing.T) {
+	a := newTestSession(t, func(cfg *Config) {
+		cfg.SeedGoals = SeedGoals{SeedTime: time.Second, Action: SeedActionRemoveData}
+	})
+	seeder := createRandomTorrent(t, a, 64<<10)
+	spec, err := a.resumer.Read(seeder.id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, spec.Created)
+	name := filepath.Join(seeder.dataDir, seeder.Name())
+
+	waitFor(t, 10*time.Second, func() bool {
+		_, ok := a.existTorrent(seeder.id)
+		return !ok
+	})
+	// Torrent is removed but the files it was created from are kept.
+	_, err = os.Stat(name)
+	assert.NoError(t, err)
+	_, err = a.resumer.Read(seeder.id)
+	assert.Error(t, err)
+}
+
+func TestSessionSeedGoalIdleTime(t *testing.T) {
+	s := newTestSession(t, func(cfg *Config) {
+		cfg.SeedGoals = SeedGoals{IdleTime: time.Second, Action: SeedActionStop}
+	})
+	tor := createRandomTorrent(t, s, 64<<10)
+	waitFor(t, 5*time.Second, func() bool { return tor.Stats().Status == Stopped })
+	assert.Equal(t, StopReasonIdleTime, tor.Stats().StopReason)
+
+	// Removing keeps the data.
+	name := filepath.Join(tor.dataDir, tor.Name())
+	assert.NoError(t, s.RemoveTorrent(tor.id, false))
+	_, err := os.Stat(name)
+	assert.NoError(t, err)
+	assert.Error(t, s.RemoveTorrent(tor.id, false))
+	// Commands are not handled after the torrent is removed.
+	_, err = tor.OpenFile(tor.Name())
+	assert.Equal(t, errClosed, err)
+}
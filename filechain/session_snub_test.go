@@ -0,0 +1,46 @@
+package filechain
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSessionSnubbedPeer(t *testing.T) {
+	a := newTestSession(t, nil)
+	b := newTestSession(t, nil)
+	c := newTestSession(t, func(cfg *Config) {
+		cfg.RequestTimeout = 500 * time.Millisecond
+		cfg.EndgameMaxDuplicateDownloads = 1
+		// Peers must be added manually.
+		cfg.PEXEnabled = false
+	})
+	seeder := createRandomTorrent(t, a, 256<<10)
+	slowSeeder := downloadFrom(t, b, seeder, a, nil)
+	waitFor(t, 20*time.Second, func() bool { return slowSeeder.Stats().Status == Seeding })
+	err := slowSeeder.SetSpeedLimits(0, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The slow seeder does not send the requested block in time.
+	start := time.Now()
+	leecher := downloadFrom(t, c, slowSeeder, b, nil)
+	waitFor(t, 5*time.Second, func() bool {
+		stats := leecher.Stats()
+		return stats.Downloads.Snubbed == 1 && stats.Downloads.Running == 0
+	})
+	peers := leecher.Peers()
+	assert.Len(t, peers, 1)
+	assert.True(t, peers[0].Snubbed)
+
+	// Pieces of the snubbed peer are downloaded from the other seeder.
+	// Otherwise a single block from the slow seeder would take more than 10 seconds.
+	err = leecher.AddPeers([]string{loopbackP2PAddr(t, a)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, 20*time.Second, func() bool { return leecher.Stats().Status == Seeding })
+	assert.True(t, time.Since(start) < 10*time.Second, time.Since(start).String())
+}
@@ -0,0 +1,73 @@
+package filechain
+
+import "time"
+
+// SetSpeedLimits changes the global download and upload speed limits in KB/s.
+// Zero means no limit. Limits of torrents and peers still apply.
+// New limits take effect immediately for all connected peers.
+func (s *Session) SetSpeedLimits(download, upload int64) {
+	s.bucketDownload.SetRate(download * 1024)
+	s.bucketUpload.SetRate(upload * 1024)
+	s.shareBandwidth()
+}
+
+func (s *Session) bandwidthSharer() {
+	ticker := time.NewTicker(s.config.SpeedLimitShareInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.shareBandwidth()
+		case <-s.closeC:
+			return
+		}
+	}
+}
+
+// shareBandwidth divides the global speed limits between the torrents that are transferring data,
+// in proportion to their priorities.
+// Download limit is shared between downloading torrents, upload limit is shared between torrents having peers.
+// It uses the transfer states published by the torrents, so it does not wait for their run loops.
+func (s *Session) shareBandwidth() {
+	s.mShare.Lock()
+	defer s.mShare.Unlock()
+
+	s.mTorrents.RLock()
+	torrents := make([]*torrent, 0, len(s.torrents))
+	for _, t := range s.torrents {
+		torrents = append(torrents, t)
+	}
+	s.mTorrents.RUnlock()
+
+	download, upload := s.bucketDownload.Rate(), s.bucketUpload.Rate()
+	downloading := make([]bool, len(torrents))
+	uploading := make([]bool, len(torrents))
+	var downloadWeights, uploadWeights int64
+	for i, t := range torrents {
+		w := int64(t.Priority().weight())
+		downloading[i], uploading[i] = t.transferring()
+		if downloading[i] {
+			downloadWeights += w
+		}
+		if uploading[i] {
+			uploadWeights += w
+		}
+	}
+	for i, t := range torrents {
+		w := int64(t.Priority().weight())
+		t.downloadShare.SetRate(share(download, w, downloadWeights, downloading[i]))
+		t.uploadShare.SetRate(share(upload, w, uploadWeights, uploading[i]))
+	}
+}
+
+// share returns the part of rate for weight. Zero means no limit.
+func share(rate, weight, totalWeight int64, active bool) int64 {
+	if rate == 0 || !active || totalWeight == 0 {
+		return 0
+	}
+	r := rate * weight / totalWeight
+	if r < 1 {
+		r = 1
+	}
+	return r
+}
@@ -0,0 +1,63 @@
+package filechain
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSessionSetSpeedLimits(t *testing.T) {
+	a := newTestSession(t, nil)
+	b := newTestSession(t, nil)
+	a.SetSpeedLimits(0, 32)
+	assert.Equal(t, int64(32), a.Stats().SpeedLimitUpload)
+	assert.Zero(t, a.Stats().SpeedLimitDownload)
+
+	seeder := createRandomTorrent(t, a, 96<<10)
+	assert.Equal(t, int64(32), seeder.Stats().SpeedLimit.Upload)
+
+	start := time.Now()
+	leecher := downloadFrom(t, b, seeder, a, nil)
+	waitFor(t, 20*time.Second, func() bool { return leecher.Stats().Status == Seeding })
+	// One second of burst is allowed, the rest is uploaded at 32 KB/s.
+	assert.True(t, time.Since(start) > 1500*time.Millisecond, time.Since(start).String())
+
+	// Removing the limit speeds up the next transfer.
+	a.SetSpeedLimits(0, 0)
+	assert.Zero(t, a.Stats().SpeedLimitUpload)
+	seeder = createRandomTorrent(t, a, 96<<10)
+	start = time.Now()
+	leecher = downloadFrom(t, b, seeder, a, nil)
+	waitFor(t, 20*time.Second, func() bool { return leecher.Stats().Status == Seeding })
+	assert.True(t, time.Since(start) < 1500*time.Millisecond, time.Since(start).String())
+}
+
+func TestTorrentSetSpeedLimits(t *testing.T) {
+	a := newTestSession(t, nil)
+	b := newTestSession(t, nil)
+	seeder := createRandomTorrent(t, a, 96<<10)
+
+	start := time.Now()
+	leecher := downloadFrom(t, b, seeder, a, func(tor *torrent) {
+		err := tor.SetSpeedLimits(32, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+	waitFor(t, 20*time.Second, func() bool { return leecher.Stats().Status == Seeding })
+	assert.True(t, time.Since(start) > 1500*time.Millisecond, time.Since(start).String())
+
+	// The lower of the session and torrent limits is effective.
+	b.SetSpeedLimits(16, 0)
+	assert.Equal(t, int64(16), leecher.Stats().SpeedLimit.Download)
+	b.SetSpeedLimits(64, 0)
+	assert.Equal(t, int64(32), leecher.Stats().SpeedLimit.Download)
+
+	spec, err := b.resumer.Read(leecher.id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, int64(32), spec.SpeedLimitDownload)
+	assert.Zero(t, spec.SpeedLimitUpload)
+}
@@ -0,0 +1,77 @@
+package filechain
+
+import (
+	"time"
+
+	"github.com/fichain/go-file/external/p2p"
+)
+
+// SessionStats contains statistics about Session.
+type SessionStats struct {
+	// Time elapsed after creation of the Session object.
+	Uptime time.Duration
+	// Number of torrents in Session.
+	Torrents int
+	// Number of rules in blocklist.
+	BlockListRules int
+	// Time elapsed after the last successful update of blocklist.
+	BlockListRecency time.Duration
+	// Number of connections rejected by the blocklist and peer lists.
+	BlockListBlocked int
+	// Number of peers that are banned for sending corrupt pieces.
+	BannedPeers int
+
+	// Number of objects in piece read cache.
+	// Each object is a block whose size is defined in Config.ReadCacheBlockSize.
+	ReadCacheObjects int
+	// Current size of read cache.
+	ReadCacheSize int64
+	// Hit ratio of read cache.
+	ReadCacheUtilization int
+
+	// Number of objects in piece write cache.
+	WriteCacheObjects int
+	// Current size of write cache.
+	WriteCacheSize int64
+
+	// Download and upload speed in bytes/s.
+	SpeedDownload int
+	SpeedUpload   int
+	// Session-wide speed limits in KB/s. Zero means no limit.
+	SpeedLimitDownload int64
+	SpeedLimitUpload   int64
+	// Indexes of the rules in Config.Schedule that are active.
+	ScheduleRules []int
+
+	// Connectivity of the session to the libp2p network.
+	Bootstrap p2p.BootstrapStats
+}
+
+// Stats returns current statistics about the Session.
+func (s *Session) Stats() SessionStats {
+	return SessionStats{
+		Uptime:           time.Since(s.createdAt),
+		Torrents:         int(s.metrics.Torrents.Value()),
+		BlockListRules:   int(s.metrics.BlockListRules.Value()),
+		BlockListRecency: time.Duration(s.metrics.BlockListRecency.Value()) * time.Second,
+		BlockListBlocked: int(s.metrics.BlockListBlocked.Value()),
+		BannedPeers:      len(s.BannedPeers()),
+
+		ReadCacheObjects:     int(s.metrics.ReadCacheObjects.Value()),
+		ReadCacheSize:        s.metrics.ReadCacheSize.Value(),
+		ReadCacheUtilization: int(s.metrics.ReadCacheUtilization.Value()),
+
+		WriteCacheObjects: int(s.metrics.WriteCacheObjects.Value()),
+		WriteCacheSize:    s.metrics.WriteCacheSize.Value(),
+
+		SpeedDownload: int(s.metrics.SpeedDownload.Rate1()),
+		SpeedUpload:   int(s.metrics.SpeedUpload.Rate1()),
+
+		SpeedLimitDownload: s.bucketDownload.Rate() / 1024,
+		SpeedLimitUpload:   s.bucketUpload.Rate() / 1024,
+
+		ScheduleRules: s.activeScheduleRules(),
+
+		Bootstrap: s.bootstrapper.Stats(),
+	}
+}
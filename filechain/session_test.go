@@ -0,0 +1,197 @@
+package filechain
+
+import (
+	"crypto/rand"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/fichain/go-file/internal/logger"
+	"github.com/fichain/go-file/internal/magnet"
+	"github.com/fichain/go-file/internal/metainfo"
+	manet "github.com/multiformats/go-multiaddr/net"
+	"github.com/stretchr/testify/assert"
+)
+
+var testSessionCount int32
+
+// newTestSession returns a session that keeps its data in a temporary directory.
+// configure may be nil. The session is closed when the test finishes.
+func newTestSession(t *testing.T, configure func(cfg *Config)) *Session {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "filechain-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	cfg := DefaultConfig
+	cfg.Database = filepath.Join(dir, "session.db")
+	cfg.DataDir = filepath.Join(dir, "data")
+	cfg.LibP2pPort = 0
+	cfg.LibP2pUser = fmt.Sprintf("test%d", atomic.AddInt32(&testSessionCount, 1))
+	cfg.Debug = false
+	cfg.RPCEnabled = false
+	if configure != nil {
+		configure(&cfg)
+	}
+	s, err := NewSession(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { closeTestSession(s) })
+	return s
+}
+
+// closeTestSession closes the session with its host and database so the database can be opened again.
+func closeTestSession(s *Session) {
+	s.Close()
+	s.host.Close()
+	s.db.Close()
+}
+
+// waitFor calls f until it returns true or the timeout expires.
+func waitFor(t *testing.T, timeout time.Duration, f func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for !f() {
+		if time.Now().After(deadline) {
+			t.Fatal("timeout")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// sampleInfo returns the info of the sample torrent in testdata.
+func sampleInfo(t *testing.T) *metainfo.Info {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := metainfo.NewInfoBytes("", []string{filepath.Join(wd, "../testdata/sample_torrent")}, false, 0, "", logger.New("test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := metainfo.NewInfo(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return info
+}
+
+// seedSampleTorrent creates the sample torrent in testdata with the session.
+func seedSampleTorrent(t *testing.T, s *Session) *torrent {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tor, err := s.CreateFile(filepath.Join(wd, "../testdata/sample_torrent"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tor
+}
+
+// createRandomTorrent seeds a new torrent of random data with the given size from the session.
+func createRandomTorrent(t *testing.T, s *Session, size int) *torrent {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "filechain-data-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	b := make([]byte, size)
+	_, err = rand.Read(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := filepath.Join(dir, "random.bin")
+	err = ioutil.WriteFile(name, b, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tor, err := s.CreateFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tor
+}
+
+// loopbackP2PAddr returns the libp2p address of the session on the loopback interface.
+func loopbackP2PAddr(t *testing.T, s *Session) string {
+	t.Helper()
+	for _, addr := range s.host.Addrs() {
+		if manet.IsIPLoopback(addr) {
+			return addr.String() + "/p2p/" + s.host.ID().Pretty()
+		}
+	}
+	t.Fatal("no loopback address")
+	return ""
+}
+
+// addMagnet adds the torrent of the seeder to the session with a magnet link that lists the trackers.
+// opts may be nil.
+func addMagnet(t *testing.T, s *Session, seeder *torrent, opts *AddTorrentOptions, trackers ...string) *torrent {
+	t.Helper()
+	var ih [20]byte
+	copy(ih[:], seeder.InfoHash())
+	m := magnet.Magnet{InfoHash: ih, Name: seeder.Name()}
+	if len(trackers) > 0 {
+		m.Trackers = [][]string{trackers}
+	}
+	if opts == nil {
+		opts = &AddTorrentOptions{}
+	}
+	tor, err := s.AddFileId(m.String(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tor
+}
+
+// downloadFrom adds the torrent of the seeder to the session with a magnet link.
+// configure is called before the seeder is added as a peer.
+func downloadFrom(t *testing.T, s *Session, seeder *torrent, seederSession *Session, configure func(tor *torrent)) *torrent {
+	t.Helper()
+	leecher := addMagnet(t, s, seeder, nil)
+	if configure != nil {
+		configure(leecher)
+	}
+	err := leecher.AddPeers([]string{loopbackP2PAddr(t, seederSession)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return leecher
+}
+
+func TestSessionBootstrapStats(t *testing.T) {
+	// Nodes of a private network run the DHT in server mode, so sessions can bootstrap from each other.
+	key := "/key/swarm/psk/1.0.0/\n/base16/\n" + strings.Repeat("ab", 32)
+	a := newTestSession(t, func(cfg *Config) { cfg.LibP2pPrivateNetworkKey = key })
+	var bootstrapPeers []string
+	for _, addr := range a.host.Addrs() {
+		if manet.IsIPLoopback(addr) {
+			bootstrapPeers = append(bootstrapPeers, addr.String()+"/p2p/"+a.host.ID().Pretty())
+		}
+	}
+	b := newTestSession(t, func(cfg *Config) {
+		cfg.LibP2pPrivateNetworkKey = key
+		cfg.LibP2pBootStrap = bootstrapPeers
+		cfg.LibP2pMinRoutingTablePeers = 1
+	})
+
+	waitFor(t, 10*time.Second, func() bool { return b.Stats().Bootstrap.Healthy })
+	s := b.Stats().Bootstrap
+	assert.Equal(t, 1, s.BootstrapPeers)
+	assert.Equal(t, 1, s.ConnectedBootstrapPeers)
+	assert.Equal(t, 1, s.RoutingTablePeers)
+	assert.NoError(t, s.Error)
+	assert.Equal(t, 0, a.Stats().Bootstrap.BootstrapPeers)
+}
@@ -0,0 +1,138 @@
+package filechain
+
+import (
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	fhttp "github.com/chihaya/chihaya/frontend/http"
+	"github.com/chihaya/chihaya/middleware"
+	"github.com/chihaya/chihaya/storage"
+	_ "github.com/chihaya/chihaya/storage/memory"
+	"github.com/fichain/go-file/internal/magnet"
+	"github.com/fichain/go-file/internal/tracker/trackerserver"
+	"github.com/stretchr/testify/assert"
+)
+
+// startTestTracker starts a chihaya HTTP tracker on the loopback interface and returns its announce URL.
+func startTestTracker(t *testing.T) string {
+	t.Helper()
+	ps, err := storage.NewPeerStore("memory", map[string]interface{}{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lgc := middleware.NewLogic(middleware.ResponseConfig{AnnounceInterval: time.Minute}, ps, nil, nil)
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := lis.Addr().String()
+	lis.Close()
+	fe, err := fhttp.NewFrontend(lgc, fhttp.Config{
+		Addr:         addr,
+		ReadTimeout:  time.Second,
+		WriteTimeout: time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { <-fe.Stop() })
+	return "http://" + addr + "/announce"
+}
+
+// startMultiaddrTracker starts a tracker that supports the multiaddr extension on the loopback interface
+// and returns its HTTP and UDP announce URLs.
+func startMultiaddrTracker(t *testing.T) (httpURL, udpURL string) {
+	t.Helper()
+	srv, err := trackerserver.New(trackerserver.DefaultConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(srv.Close)
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/announce", srv)
+	hs := &http.Server{Handler: mux}
+	go hs.Serve(lis)
+	t.Cleanup(func() { hs.Close() })
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.ServeUDP(conn)
+	t.Cleanup(func() { conn.Close() })
+	return "http://" + lis.Addr().String() + "/announce", "udp://" + conn.LocalAddr().String() + "/announce"
+}
+
+// transferWithTracker seeds the sample torrent from the session a and downloads it with the session b.
+// Peers find each other only via the tracker at announceURL.
+func transferWithTracker(t *testing.T, a, b *Session, announceURL string) (seeder, leecher *torrent) {
+	t.Helper()
+	seeder = seedSampleTorrent(t, a)
+	err := seeder.AddTrackers([]string{announceURL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, 5*time.Second, func() bool {
+		trackers := seeder.Trackers()
+		return len(trackers) == 1 && trackers[0].Status == Working
+	})
+	leecher = addMagnet(t, b, seeder, nil, announceURL)
+	waitFor(t, 20*time.Second, func() bool { return leecher.Stats().Status == Seeding })
+	return
+}
+
+func TestSessionTrackerBitTorrent(t *testing.T) {
+	announceURL := startTestTracker(t)
+	a := newTestSession(t, enableBitTorrent)
+	b := newTestSession(t, enableBitTorrent)
+	seeder, leecher := transferWithTracker(t, a, b, announceURL)
+
+	// Trackers are saved in resume data.
+	spec, err := a.resumer.Read(seeder.id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, [][]string{{announceURL}}, spec.Trackers)
+	spec, err = b.resumer.Read(leecher.id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, [][]string{{announceURL}}, spec.Trackers)
+
+	// Stopped event is announced before the torrent is stopped.
+	leecher.Stop()
+	waitFor(t, 5*time.Second, func() bool { return leecher.Stats().Status == Stopped })
+}
+
+func TestSessionTrackerMultiaddrPeers(t *testing.T) {
+	for _, scheme := range []string{"http", "udp"} {
+		scheme := scheme
+		t.Run(scheme, func(t *testing.T) {
+			announceURL, udpURL := startMultiaddrTracker(t)
+			if scheme == "udp" {
+				announceURL = udpURL
+			}
+			a := newTestSession(t, nil)
+			b := newTestSession(t, nil)
+			transferWithTracker(t, a, b, announceURL)
+		})
+	}
+}
+
+func TestTorrentAddInvalidTracker(t *testing.T) {
+	s := newTestSession(t, nil)
+	var ih [20]byte
+	copy(ih[:], "invalid tracker     ")
+	m := magnet.Magnet{InfoHash: ih, Name: "invalid"}
+	tor, err := s.AddFileId(m.String(), &AddTorrentOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Error(t, tor.AddTrackers([]string{"ftp://127.0.0.1/announce"}))
+	assert.Empty(t, tor.Trackers())
+}
@@ -0,0 +1,107 @@
+package filechain
+
+import (
+	"testing"
+	"time"
+
+	"github.com/fichain/go-file/external/p2p"
+	"github.com/fichain/go-file/external/peerprotocol"
+	"github.com/libp2p/go-libp2p-core/network"
+	p2pPeer "github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/protocol"
+	"github.com/stretchr/testify/assert"
+)
+
+// transferTestTorrent seeds the sample torrent from the session a and downloads it with the session b.
+// It returns when b completes the download.
+func transferTestTorrent(t *testing.T, a, b *Session) {
+	t.Helper()
+	leecher := downloadFrom(t, b, seedSampleTorrent(t, a), a, nil)
+	waitFor(t, 20*time.Second, func() bool { return leecher.Stats().Status == Seeding })
+}
+
+func TestSessionProtocolVersions(t *testing.T) {
+	// Sessions of different versions fall back to the older protocol and can still transfer torrents.
+	old := newTestSession(t, func(cfg *Config) { cfg.LibP2pProtocolVersion = "1.0.0" })
+	cur := newTestSession(t, nil)
+	transferTestTorrent(t, old, cur)
+
+	cur2 := newTestSession(t, nil)
+	transferTestTorrent(t, cur, cur2)
+}
+
+// readExtensionHandshake reads messages from stream until the extension handshake is received.
+func readExtensionHandshake(t *testing.T, stream network.Stream) peerprotocol.ExtensionHandshakeMessage {
+	t.Helper()
+	msg := readPeerMessage(t, stream, func(msg interface{}) bool {
+		_, ok := msg.(peerprotocol.ExtensionHandshakeMessage)
+		return ok
+	})
+	return msg.(peerprotocol.ExtensionHandshakeMessage)
+}
+
+func TestSessionNegotiateProtocolVersion(t *testing.T) {
+	s := newTestSession(t, nil)
+	tor := seedSampleTorrent(t, s)
+	var ih [20]byte
+	copy(ih[:], tor.InfoHash())
+
+	connect := func(protos []protocol.ID) (p2pPeer.ID, peerprotocol.ExtensionHandshakeMessage) {
+		h := newTestHost(t)
+		stream := openTorrentStream(t, h, s, ih, protos...)
+		return h.ID(), readExtensionHandshake(t, stream)
+	}
+	peerVersion := func(id p2pPeer.ID) string {
+		for _, pe := range tor.Peers() {
+			if pe.ID == id {
+				return pe.ProtocolVersion
+			}
+		}
+		return ""
+	}
+
+	// A peer that knows only the first version gets only the features of that version.
+	oldID, hs := connect([]protocol.ID{p2p.TransferProtocolID("1.0.0")})
+	assert.Equal(t, []string{p2p.FeatureFast, p2p.FeatureMetadata}, hs.Features)
+	assert.Equal(t, "filechain/"+p2p.TransferProtocolVersion, hs.V)
+	assert.Equal(t, "1.0.0", peerVersion(oldID))
+
+	// A peer that offers all versions uses the latest one and gets all features.
+	protos, err := p2p.TransferProtocolIDs(p2p.TransferProtocolVersion)
+	if err != nil {
+		t.Fatal(err)
+	}
+	curID, hs := connect(protos)
+	assert.Contains(t, hs.Features, p2p.FeaturePEX)
+	assert.Equal(t, p2p.TransferProtocolVersion, peerVersion(curID))
+}
+
+func TestSessionInvalidProtocolVersion(t *testing.T) {
+	cfg := DefaultConfig
+	cfg.LibP2pProtocolVersion = "0.9.0"
+	_, err := NewSession(cfg)
+	assert.Error(t, err)
+}
+
+func TestSessionAnnouncedFeatures(t *testing.T) {
+	s := newTestSession(t, nil)
+	tor := seedSampleTorrent(t, s)
+	var ih [20]byte
+	copy(ih[:], tor.InfoHash())
+
+	// The peer negotiates the latest version but announces that it does not support Fast extension.
+	stream := openTorrentStream(t, newTestHost(t), s, ih)
+	writePeerMessage(t, stream, peerprotocol.ExtensionMessage{
+		ExtendedMessageID: peerprotocol.ExtensionIDHandshake,
+		Payload: peerprotocol.ExtensionHandshakeMessage{
+			V:        "test",
+			Features: []string{p2p.FeatureMetadata},
+		},
+	})
+	waitFor(t, 5*time.Second, func() bool {
+		peers := tor.Peers()
+		return len(peers) == 1 && len(peers[0].Features) == 1
+	})
+	assert.Equal(t, []string{p2p.FeatureMetadata}, tor.Peers()[0].Features)
+	assert.Equal(t, p2p.TransferProtocolVersion, tor.Peers()[0].ProtocolVersion)
+}
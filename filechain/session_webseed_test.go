@@ -0,0 +1,140 @@
+package filechain
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/fichain/go-file/external/resumer/boltdbresumer"
+	"github.com/fichain/go-file/internal/magnet"
+	"github.com/stretchr/testify/assert"
+)
+
+// countingWriter counts the bytes of response bodies.
+type countingWriter struct {
+	http.ResponseWriter
+	n *int64
+}
+
+func (w countingWriter) Write(b []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(b)
+	atomic.AddInt64(w.n, int64(n))
+	return n, err
+}
+
+// startWebseedServer serves the testdata directory over HTTP.
+// It returns the webseed URL and a counter of served bytes.
+func startWebseedServer(t *testing.T) (string, *int64) {
+	var served int64
+	fs := http.FileServer(http.Dir("../testdata"))
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fs.ServeHTTP(countingWriter{ResponseWriter: w, n: &served}, r)
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL + "/", &served
+}
+
+// addSampleTorrentWithInfo adds the sample torrent to the session as if its metadata was known in advance.
+// Nobody seeds the torrent yet, so its data can only come from webseeds.
+func addSampleTorrentWithInfo(t *testing.T, s *Session, webseeds []string) *torrent {
+	t.Helper()
+	info := sampleInfo(t)
+	id := hex.EncodeToString(info.Hash[:])
+	err := s.resumer.Write(id, &boltdbresumer.Spec{
+		InfoHash: info.Hash[:],
+		Name:     info.Name,
+		Info:     info.Bytes,
+		URLList:  webseeds,
+		AddedAt:  time.Now(),
+		DataDir:  s.config.DataDir,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tor, _, err := s.loadExistingTorrent(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tor.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tor
+}
+
+func TestSessionWebseedOnly(t *testing.T) {
+	u, served := startWebseedServer(t)
+	s := newTestSession(t, nil)
+	tor := addSampleTorrentWithInfo(t, s, []string{u})
+	waitFor(t, 10*time.Second, func() bool { return tor.Stats().Status == Seeding })
+
+	assert.NotZero(t, atomic.LoadInt64(served))
+	assert.Zero(t, tor.Stats().Bytes.Wasted)
+	for _, name := range []string{"data/file1.bin", "folder/file2.txt"} {
+		want, err := ioutil.ReadFile(filepath.Join("../testdata/sample_torrent", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := ioutil.ReadFile(filepath.Join(s.config.DataDir, "sample_torrent", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.True(t, bytes.Equal(want, got), name)
+	}
+}
+
+func TestSessionWebseedError(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	defer srv.Close()
+	s := newTestSession(t, nil)
+	tor := addSampleTorrentWithInfo(t, s, []string{srv.URL + "/"})
+	waitFor(t, 5*time.Second, func() bool {
+		ws := tor.Webseeds()
+		return len(ws) == 1 && ws[0].Disabled
+	})
+	ws := tor.Webseeds()[0]
+	assert.Error(t, ws.Error)
+	assert.False(t, ws.Downloading)
+	assert.Equal(t, Downloading, tor.Stats().Status)
+}
+
+func TestSessionWebseedMagnet(t *testing.T) {
+	u, _ := startWebseedServer(t)
+	a := newTestSession(t, nil)
+	b := newTestSession(t, nil)
+	seeder := seedSampleTorrent(t, a)
+
+	var ih [20]byte
+	copy(ih[:], seeder.InfoHash())
+	m := magnet.Magnet{InfoHash: ih, Name: seeder.Name(), Webseeds: []string{u}}
+	leecher, err := b.AddFileId(m.String(), &AddTorrentOptions{Webseeds: []string{u, "http://127.0.0.1:1/"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = leecher.AddPeers([]string{loopbackP2PAddr(t, a)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, 20*time.Second, func() bool { return leecher.Stats().Status == Seeding })
+
+	// Duplicate sources are merged.
+	ws := leecher.Stats().Webseeds
+	if assert.Len(t, ws, 2) {
+		assert.Equal(t, u, ws[0].URL)
+		assert.Equal(t, "http://127.0.0.1:1/", ws[1].URL)
+	}
+	spec, err := b.resumer.Read(leecher.id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{u, "http://127.0.0.1:1/"}, spec.URLList)
+
+	_, err = b.AddFileId("magnet:?xt=urn:btih:"+hex.EncodeToString([]byte("unsupported webseed ")), &AddTorrentOptions{Webseeds: []string{"ftp://127.0.0.1/"}})
+	assert.Error(t, err)
+}
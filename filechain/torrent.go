@@ -1,57 +1,126 @@
 package filechain
 
 import (
+	"crypto/rand"
 	"errors"
 	"github.com/fichain/go-file/internal/storage/filestorage"
 	"net"
 	"sync"
 	"time"
 
+	"github.com/fichain/go-file/internal/acceptor"
+	btaddrlist "github.com/fichain/go-file/internal/addrlist"
 	"github.com/fichain/go-file/internal/allocator"
+	trackerannouncer "github.com/fichain/go-file/internal/announcer"
 	"github.com/fichain/go-file/internal/bitfield"
 	//"github.com/fichain/go-file/internal/blocklist"
 	"github.com/fichain/go-file/internal/bufferpool"
 	"github.com/fichain/go-file/internal/externalip"
+	"github.com/fichain/go-file/internal/handshaker/incominghandshaker"
+	"github.com/fichain/go-file/internal/handshaker/outgoinghandshaker"
 	"github.com/fichain/go-file/internal/infodownloader"
 	"github.com/fichain/go-file/internal/logger"
 	"github.com/fichain/go-file/internal/metainfo"
-	"github.com/fichain/go-file/internal/pexlist"
 	"github.com/fichain/go-file/internal/piece"
 	"github.com/fichain/go-file/internal/piecedownloader"
 	"github.com/fichain/go-file/internal/piecewriter"
+	"github.com/fichain/go-file/internal/speedlimit"
 	"github.com/fichain/go-file/internal/storage"
 	"github.com/fichain/go-file/internal/suspendchan"
+	"github.com/fichain/go-file/internal/tracker"
 	"github.com/fichain/go-file/internal/unchoker"
 	"github.com/fichain/go-file/internal/verifier"
+	"github.com/fichain/go-file/internal/webseedsource"
 	"github.com/rcrowley/go-metrics"
 
+	"github.com/fichain/go-file/external/advertiser"
+	"github.com/fichain/go-file/external/announcer"
+	"github.com/fichain/go-file/external/dialer"
 	"github.com/fichain/go-file/external/addrlist"
 	"github.com/fichain/go-file/external/peer"
+	"github.com/fichain/go-file/external/pexlist"
 	"github.com/fichain/go-file/external/piecepicker"
 	"github.com/fichain/go-file/external/resumer"
 	"github.com/libp2p/go-libp2p-core/network"
 	p2pPeer "github.com/libp2p/go-libp2p-core/peer"
 )
 
+// Peer ID prefix sent in BitTorrent handshakes. See BEP 20.
+const btPeerIDPrefix = "-FC0001-"
+
 // torrent connects to peers and downloads files from swarm.
 type torrent struct {
 	//todo add
 	incomingStreamC chan network.Stream
+	// Guards sending to incomingStreamC against the drain in resetIncomingStreams.
+	mIncomingStreams sync.Mutex
+	// Set when incomingStreamC is drained on close. No stream is accepted after that.
+	incomingStreamsClosed bool
 	//mconnectedPeers sync.RWMutex
+	// Connected libp2p peers by their IDs.
 	connectedPeers 	map[p2pPeer.ID]*peer.Peer
+	// IPs of connected BitTorrent peers. Only one connection is allowed from an IP.
+	connectedPeerIPs map[string]struct{}
 	// Also keep a reference to incoming and outgoing peers separately to count them quickly.
-	incomingPeers 	map[p2pPeer.ID]struct{}
-	outgoingPeers 	map[p2pPeer.ID]struct{}
-
+	incomingPeers 	map[*peer.Peer]struct{}
+	outgoingPeers 	map[*peer.Peer]struct{}
+
+	// TCP port that the torrent listens for BitTorrent peers. Zero if not listening.
+	port int
+	// Accepts BitTorrent connections on port and sends them to incomingConnC.
+	acceptor      *acceptor.Acceptor
+	incomingConnC chan net.Conn
+	// BitTorrent connections that are doing the handshake.
+	incomingHandshakers       map[*incominghandshaker.IncomingHandshaker]struct{}
+	incomingHandshakerResultC chan *incominghandshaker.IncomingHandshaker
+	outgoingHandshakers       map[*outgoinghandshaker.OutgoingHandshaker]struct{}
+	outgoingHandshakerResultC chan *outgoinghandshaker.OutgoingHandshaker
+	// Keeps a list of BitTorrent peer addresses to connect. Nil if BitTorrent is disabled.
+	btAddrList *btaddrlist.AddrList
+	// BitTorrent peers received while the torrent is queued. They are added to btAddrList when the torrent is dequeued.
+	queuedBTAddrs []queuedBTAddr
+
+	// Peers found in DHT are sent to this channel by dhtAnnouncer.
 	incoimgPeersC 	chan []p2pPeer.AddrInfo
 
 	infoDownloaderPeers       map[p2pPeer.ID]*infodownloader.InfoDownloader
 	infoDownloaderPeersSnubbed map[p2pPeer.ID]*infodownloader.InfoDownloader
 
-	mDhtNeedPeer sync.RWMutex
-	dhtNeedPeer bool
+	// Peers that are being dialed.
+	dialers map[p2pPeer.ID]*dialer.Dialer
+	// Dialers send the result to this channel when the dial is complete.
+	dialerResultC chan *dialer.Dialer
+	// Peers that could not be dialed are not dialed again until their backoff expires.
+	dialBackoff *dialer.Backoff
+
+	// Finds peers in DHT periodically while the download is not complete.
+	dhtAnnouncer *announcer.DHTAnnouncer
+
+	// Trackers of the torrent. Each item is either a single tracker or a tier of trackers.
+	trackers []tracker.Tracker
+	// Tracker URLs grouped in tiers. Saved in resume data.
+	rawTrackers [][]string
+	// Announce the torrent to trackers periodically while the torrent is running.
+	announcers []*trackerannouncer.PeriodicalAnnouncer
+	// Peers returned by trackers are sent to these channels by announcers.
+	addrsFromTrackers    chan []*net.TCPAddr
+	p2pAddrsFromTrackers chan []p2pPeer.AddrInfo
+	// Announces the stopped event to trackers while the torrent is in Stopping state.
+	stoppedEventAnnouncer *trackerannouncer.StopAnnouncer
+	announcersStoppedC    chan struct{}
+
+	// HTTP sources to download pieces from, along with peers (BEP 19).
+	webseedSources []*webseedsource.WebseedSource
+	// Webseed URLs. Saved in resume data.
+	rawWebseedSources []string
+	// Pieces downloaded from webseed sources are sent to this channel.
+	webseedPieceResultC *suspendchan.Chan
+	// Disabled webseed sources are sent to this channel after WebseedRetryInterval.
+	webseedRetryC chan *webseedsource.WebseedSource
 
 	dataDir		string
+	// True if the torrent is made from local files with Session.CreateFile. Its data belongs to the user and is never deleted.
+	created bool
 	//use
 	// Peers are sent to this channel when they are disconnected.
 	peerDisconnectedC chan *peer.Peer
@@ -110,7 +179,7 @@ type torrent struct {
 	// Protects bitfield writing from torrent loop and reading from announcer loop.
 	mBitfield sync.RWMutex
 
-	// Unique peer ID is generated per downloader.
+	// Unique peer ID is generated per downloader. Sent in BitTorrent handshakes.
 	peerID [20]byte
 
 	files  []allocator.File
@@ -119,6 +188,7 @@ type torrent struct {
 	piecePicker *piecepicker.PiecePicker
 
 	// We keep connected peers in this map after they complete handshake phase.
+	// Contains both libp2p and BitTorrent peers.
 	peers map[*peer.Peer]struct{}
 
 	// Keep recently seen peers to fill underpopulated PEX lists.
@@ -151,19 +221,31 @@ type torrent struct {
 	doneC chan struct{}
 
 	// These are the channels for sending a message to run() loop.
-	//statsCommandC        chan statsRequest        // Stats()
-	//trackersCommandC     chan trackersRequest     // Trackers()
-	//peersCommandC        chan peersRequest        // Peers()
-	//webseedsCommandC     chan webseedsRequest     // Webseeds()
+	statsCommandC        chan statsRequest        // Stats()
+	queueStateCommandC   chan queueStateRequest   // queueState()
+	trackersCommandC     chan trackersRequest     // Trackers()
+	peersCommandC        chan peersRequest        // Peers()
+	webseedsCommandC     chan webseedsRequest     // Webseeds()
 	startCommandC        chan struct{}            // Start()
 	stopCommandC         chan struct{}            // Stop()
+	closeCommandC        chan struct{}            // Close()
+	enqueueCommandC      chan struct{}            // Session.processQueue()
+	dequeueCommandC      chan struct{}            // Session.processQueue()
+	priorityCommandC     chan filePrioritiesRequest // SetFilePriorities()
+	openFileCommandC     chan openFileRequest     // OpenFile()
+	readerCommandC       chan readerRequest       // fileReader
+	infoCommandC         chan infoRequest         // metadata()
 	//announceCommandC     chan struct{}            // Announce()
 	//verifyCommandC       chan struct{}            // Verify()
 	//todo
 	notifyErrorCommandC  chan notifyErrorCommand  // NotifyError()
 	//notifyListenCommandC chan notifyListenCommand // NotifyListen()
-	//addPeersCommandC     chan []*net.TCPAddr      // AddPeers()
-	//addTrackersCommandC  chan []tracker.Tracker   // AddTrackers()
+	addPeersCommandC     chan addPeersRequest     // AddPeers()
+	addTrackersCommandC  chan []string            // AddTrackers()
+	closeBannedPeerCommandC chan string           // Session.banPeer()
+
+	// Advertises the torrent to DHT periodically while the torrent is running.
+	advertiser *advertiser.Advertiser
 
 	// Keeps a list of peer addresses to connect.
 	addrList *addrlist.AddrList
@@ -174,6 +256,22 @@ type torrent struct {
 	// A ticker that ticks periodically to keep a certain number of peers unchoked.
 	unchokeTicker *time.Ticker
 
+	// A ticker that ticks periodically to update the values of peer connections in the connection manager.
+	connTicker *time.Ticker
+
+	// Limit the speed of the torrent. Rates can be changed with SetSpeedLimits.
+	downloadLimit *speedlimit.Bucket
+	uploadLimit   *speedlimit.Bucket
+	// Share of the torrent from the session limits. Rates are set by Session.shareBandwidth.
+	downloadShare *speedlimit.Bucket
+	uploadShare   *speedlimit.Bucket
+	// Accessed atomically. Can be changed with SetPriority.
+	priority int32
+	// Non-zero if the torrent is downloading or has peers to upload to.
+	// Published by the run loop every second and read atomically by Session.shareBandwidth.
+	downloading int32
+	uploading   int32
+
 	// Metrics
 	downloadSpeed   metrics.Meter
 	uploadSpeed     metrics.Meter
@@ -183,11 +281,9 @@ type torrent struct {
 	seededFor       metrics.Counter
 
 	seedDurationUpdatedAt time.Time
+	// Ticks every second to update the seed duration and the published transfer state.
 	seedDurationTicker    *time.Ticker
 
-	// Peers that are sending corrupt data are banned.
-	bannedPeerIPs map[string]struct{}
-
 	// Piece buffers that are being downloaded are pooled to reduce load on GC.
 	piecePool *bufferpool.Pool
 
@@ -202,6 +298,48 @@ type torrent struct {
 	// If true, the torrent is stopped automatically when all pieces are downloaded.
 	stopAfterDownload bool
 
+	// Priorities of the files in the order of info.Files. nil means all files have normal priority.
+	// Changed in run loop, mutex is for reading from other goroutines.
+	filePriorities  []FilePriority
+	mFilePriorities sync.RWMutex
+	// Pieces that belong only to skipped files. nil if no piece is skipped.
+	skippedPieces *bitfield.Bitfield
+	// Priorities of the pieces calculated from the file priorities. nil if all files have normal priority.
+	piecePriorities []FilePriority
+	// Priorities given before the metadata is downloaded. Applied before the files are allocated.
+	pendingFilePriorities []FilePriority
+
+	// Blocks received in the downloads of pieces that have failed the hash check, by piece index and block index.
+	// Compared with the blocks of the piece when it passes the hash check, to find the senders of corrupt data.
+	corruptBlocks map[uint32][][]corruptBlock
+	// Number of pieces that have failed the hash check, by ban key of the sender.
+	hashFailures map[string]int
+
+	// Open file readers and their positions in torrent.
+	readers map[*fileReader]*readerPosition
+	// Priorities of the pieces in the readahead windows of readers.
+	readaheadPieces map[uint32]int
+	// Closed and replaced when a piece is downloaded. Readers wait on it.
+	pieceDoneC  chan struct{}
+	mPieceDoneC sync.Mutex
+
+	// Goals of the torrent that end seeding. nil means Config.SeedGoals is used. Can be changed with SetSeedGoals.
+	seedGoals  *SeedGoals
+	mSeedGoals sync.RWMutex
+	// Why the torrent has stopped by itself. Reset when the torrent is started.
+	stopReason StopReason
+	// Used to calculate the idle time for SeedGoals.IdleTime.
+	idleSince    time.Time
+	idleUploaded int64
+
+	// True if the torrent is waiting for a slot in the session queue.
+	queued bool
+	// Position of the torrent in the session queue. Accessed atomically, changed while holding Session.mQueue.
+	// Negative value means the torrent is not in the queue yet.
+	queuePosition int32
+	// Time of the last start. Used to find slow torrents.
+	startedAt time.Time
+
 	log logger.Logger
 }
 
@@ -210,10 +348,12 @@ func newTorrent2(
 	addedAt time.Time,
 	infoHash []byte,
 	name string, // display name
+	rawTrackers [][]string,
 	//fixedPeers []string,
 	info *metainfo.Info,
 	bf *bitfield.Bitfield,
 	stats resumer.Stats, // initial stats from previous run
+	webseedSources []string,
 	stopAfterDownload bool,
 	dataDir			  	string,
 	id 					string,
@@ -232,9 +372,25 @@ func newTorrent2(
 
 	t := &torrent{
 		connectedPeers: 			make(map[p2pPeer.ID]*peer.Peer),
+		connectedPeerIPs:			make(map[string]struct{}),
 		incoimgPeersC: 				make(chan []p2pPeer.AddrInfo),
-		incomingStreamC:			make(chan network.Stream),
-		dhtNeedPeer:				false,
+		incomingStreamC:			make(chan network.Stream, s.config.MaxPeerAccept),
+		incomingConnC:             make(chan net.Conn),
+		incomingHandshakers:       make(map[*incominghandshaker.IncomingHandshaker]struct{}),
+		incomingHandshakerResultC: make(chan *incominghandshaker.IncomingHandshaker),
+		outgoingHandshakers:       make(map[*outgoinghandshaker.OutgoingHandshaker]struct{}),
+		outgoingHandshakerResultC: make(chan *outgoinghandshaker.OutgoingHandshaker),
+		dialers:					make(map[p2pPeer.ID]*dialer.Dialer),
+		dialerResultC:				make(chan *dialer.Dialer),
+		dialBackoff:				dialer.NewBackoff(s.config.PeerDialMinBackoff, s.config.PeerDialMaxBackoff),
+		rawTrackers:               rawTrackers,
+		addrsFromTrackers:         make(chan []*net.TCPAddr),
+		p2pAddrsFromTrackers:      make(chan []p2pPeer.AddrInfo),
+		announcersStoppedC:        make(chan struct{}),
+		rawWebseedSources:         webseedSources,
+		webseedSources:            webseedsource.NewList(webseedSources),
+		webseedPieceResultC:       suspendchan.New(0),
+		webseedRetryC:             make(chan *webseedsource.WebseedSource),
 		session:                   s,
 		addedAt:                   addedAt,
 		infoHash:                  ih,
@@ -249,8 +405,8 @@ func newTorrent2(
 		messages:                  make(chan peer.Message),
 		pieceMessagesC:            suspendchan.New(0),
 		peers:                     make(map[*peer.Peer]struct{}),
-		incomingPeers:             make(map[p2pPeer.ID]struct{}),
-		outgoingPeers:             make(map[p2pPeer.ID]struct{}),
+		incomingPeers:             make(map[*peer.Peer]struct{}),
+		outgoingPeers:             make(map[*peer.Peer]struct{}),
 		pieceDownloaders:          make(map[*peer.Peer]*piecedownloader.PieceDownloader),
 		pieceDownloadersSnubbed:   make(map[*peer.Peer]*piecedownloader.PieceDownloader),
 		pieceDownloadersChoked:    make(map[*peer.Peer]*piecedownloader.PieceDownloader),
@@ -262,23 +418,39 @@ func newTorrent2(
 		closeC:                    make(chan chan struct{}),
 		startCommandC:             make(chan struct{}),
 		stopCommandC:              make(chan struct{}),
+		closeCommandC:             make(chan struct{}),
+		enqueueCommandC:           make(chan struct{}),
+		dequeueCommandC:           make(chan struct{}),
+		priorityCommandC:          make(chan filePrioritiesRequest),
+		openFileCommandC:          make(chan openFileRequest),
+		readerCommandC:            make(chan readerRequest),
+		infoCommandC:              make(chan infoRequest),
+		readers:                   make(map[*fileReader]*readerPosition),
+		pieceDoneC:                make(chan struct{}),
 		//announceCommandC:          make(chan struct{}),
 		//verifyCommandC:            make(chan struct{}),
-		//statsCommandC:             make(chan statsRequest),
-		//trackersCommandC:          make(chan trackersRequest),
-		//peersCommandC:             make(chan peersRequest),
-		//webseedsCommandC:          make(chan webseedsRequest),
+		statsCommandC:             make(chan statsRequest),
+		queueStateCommandC:        make(chan queueStateRequest),
+		trackersCommandC:          make(chan trackersRequest),
+		peersCommandC:             make(chan peersRequest),
+		webseedsCommandC:          make(chan webseedsRequest),
 		notifyErrorCommandC:       make(chan notifyErrorCommand),
 		//notifyListenCommandC:      make(chan notifyListenCommand),
-		//addPeersCommandC:          make(chan []*net.TCPAddr),
-		//addTrackersCommandC:       make(chan []tracker.Tracker),
+		addPeersCommandC:          make(chan addPeersRequest),
+		addTrackersCommandC:       make(chan []string),
+		closeBannedPeerCommandC:   make(chan string),
+		corruptBlocks:             make(map[uint32][][]corruptBlock),
+		hashFailures:              make(map[string]int),
 		infoDownloaderResultC:     make(chan *infodownloader.InfoDownloader),
 		allocatorProgressC:        make(chan allocator.Progress),
 		allocatorResultC:          make(chan *allocator.Allocator),
 		verifierProgressC:         make(chan verifier.Progress),
 		verifierResultC:           make(chan *verifier.Verifier),
-		bannedPeerIPs:             make(map[string]struct{}),
 		externalIP:                externalip.FirstExternalIP(),
+		downloadLimit:             speedlimit.New(0),
+		uploadLimit:               speedlimit.New(0),
+		downloadShare:             speedlimit.New(0),
+		uploadShare:               speedlimit.New(0),
 		downloadSpeed:             metrics.NilMeter{},
 		uploadSpeed:               metrics.NilMeter{},
 		bytesDownloaded:           metrics.NewCounter(),
@@ -288,6 +460,7 @@ func newTorrent2(
 		ramNotifyC:                make(chan interface{}),
 		doneC:                     make(chan struct{}),
 		stopAfterDownload:         stopAfterDownload,
+		queuePosition:             -1,
 
 		stopC: 						make(chan struct{}),
 	}
@@ -303,12 +476,12 @@ func newTorrent2(
 	if t.info != nil {
 		t.piecePool = bufferpool.New(int(t.info.PieceLength))
 	}
-	//n := t.copyPeerIDPrefix()
-	//_, err := rand.Read(t.peerID[n:])
-	//if err != nil {
-	//	return nil, err
-	//}
-	//todo add peer id with user name
+	t.trackers = s.parseTrackers(rawTrackers, t.info != nil && t.info.Private)
+	n := copy(t.peerID[:], btPeerIDPrefix)
+	_, err = rand.Read(t.peerID[n:])
+	if err != nil {
+		return nil, err
+	}
 
 	t.unchoker = unchoker.New(cfg.UnchokedPeers, cfg.OptimisticUnchokedPeers)
 	go t.run()
@@ -339,10 +512,29 @@ func DisableLogging() {
 	logger.Disable()
 }
 
-func (t *torrent) AddIncomingStream(stream network.Stream)  {
-	t.incomingStreamC <- stream
+var errBusy = errors.New("torrent is busy")
+
+// addIncomingStream hands an accepted stream to the run loop of the torrent. It does not block.
+func (t *torrent) addIncomingStream(stream network.Stream) error {
+	t.mIncomingStreams.Lock()
+	defer t.mIncomingStreams.Unlock()
+	if t.incomingStreamsClosed {
+		return errClosed
+	}
+	select {
+	case t.incomingStreamC <- stream:
+		return nil
+	default:
+		return errBusy
+	}
 }
 
-func (t *torrent) Close()  {
-	t.close()
+// Close stops the torrent and exits its run loop. It returns after the run loop has exited.
+// Commands that are sent after Close are not handled.
+func (t *torrent) Close() {
+	select {
+	case t.closeCommandC <- struct{}{}:
+	case <-t.closeC:
+	}
+	<-t.doneC
 }
@@ -42,9 +42,10 @@ func (t *torrent) handleAllocationDone(al *allocator.Allocator) {
 	if t.piecePicker != nil {
 		panic("piece picker exists")
 	}
-	t.piecePicker = piecepicker.New(t.pieces, t.session.config.EndgameMaxDuplicateDownloads, nil)
+	t.piecePicker = piecepicker.New(t.pieces, t.session.config.EndgameMaxDuplicateDownloads, t.webseedSources)
+	t.updatePiecePriorities()
 
-	for _, pe := range t.connectedPeers {
+	for pe := range t.peers {
 		pe.Bitfield = bitfield.New(t.info.NumPieces)
 	}
 
@@ -52,10 +53,12 @@ func (t *torrent) handleAllocationDone(al *allocator.Allocator) {
 	// If we already have bitfield from resume db, skip verification and start downloading.
 	t.log.Infof("bitfield is exist %v, has missins is %v, has exist is %v\n", t.bitfield != nil, al.HasMissing, al.HasExisting)
 	if t.bitfield != nil && !al.HasMissing {
+		t.clearLazyPieces()
 		for i := uint32(0); i < t.bitfield.Len(); i++ {
 			t.pieces[i].Done = t.bitfield.Test(i)
 		}
 		if t.checkCompletion() && t.stopAfterDownload {
+			t.stopReason = StopReasonDownloaded
 			t.stop(nil)
 			return
 		}
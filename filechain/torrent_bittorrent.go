@@ -0,0 +1,247 @@
+package filechain
+
+import (
+	"net"
+
+	"github.com/fichain/go-file/external/peer"
+	"github.com/fichain/go-file/external/peersource"
+	"github.com/fichain/go-file/internal/acceptor"
+	btaddrlist "github.com/fichain/go-file/internal/addrlist"
+	"github.com/fichain/go-file/internal/bitfield"
+	"github.com/fichain/go-file/internal/blocklist"
+	"github.com/fichain/go-file/internal/handshaker/incominghandshaker"
+	"github.com/fichain/go-file/internal/handshaker/outgoinghandshaker"
+	"github.com/fichain/go-file/internal/mse"
+	internalpeersource "github.com/fichain/go-file/internal/peersource"
+)
+
+// Number of ports tried before giving up listening for BitTorrent peers.
+const maxListenAttempts = 10
+
+// Extensions that we support in BitTorrent handshake.
+var btExtensions = func() [8]byte {
+	var ext [8]byte
+	bf, _ := bitfield.NewBytes(ext[:], 64)
+	bf.Set(61) // Fast Extension (BEP 6)
+	bf.Set(43) // Extension Protocol (BEP 10)
+	return ext
+}()
+
+// startAcceptor listens a port from the session for incoming BitTorrent connections.
+// Outgoing connections are still made if no port can be listened.
+func (t *torrent) startAcceptor() {
+	if !t.session.config.BitTorrentEnabled || t.btAddrList != nil {
+		return
+	}
+	var failedPorts []int
+	for i := 0; i < maxListenAttempts; i++ {
+		port, err := t.session.getPort()
+		if err != nil {
+			t.log.Warningln("cannot listen for bittorrent peers:", err)
+			break
+		}
+		lis, err := net.ListenTCP("tcp", &net.TCPAddr{Port: port})
+		if err != nil {
+			t.log.Warningf("cannot listen port %d: %s", port, err)
+			failedPorts = append(failedPorts, port)
+			continue
+		}
+		t.log.Info("listening bittorrent peers on tcp://" + lis.Addr().String())
+		t.port = port
+		t.portC <- port
+		t.acceptor = acceptor.New(lis, t.incomingConnC, t.log)
+		go t.acceptor.Run()
+		break
+	}
+	// Ports that are in use by other programs may be free later.
+	for _, port := range failedPorts {
+		t.session.releasePort(port)
+	}
+	var bl *blocklist.Blocklist
+	if t.session.config.BlocklistEnabledForOutgoingConnections {
+		bl = t.session.blocklist
+	}
+	t.btAddrList = btaddrlist.New(t.session.config.MaxPeerAddresses, bl, t.port, &t.externalIP)
+}
+
+func (t *torrent) stopAcceptor() {
+	t.log.Debugln("stopping acceptor")
+	if t.acceptor != nil {
+		t.acceptor.Close()
+		t.acceptor = nil
+	}
+	if t.port != 0 {
+		t.session.releasePort(t.port)
+		t.port = 0
+	}
+	t.btAddrList = nil
+}
+
+func (t *torrent) stopHandshakers() {
+	t.log.Debugln("stopping handshakers")
+	for ih := range t.incomingHandshakers {
+		ih.Close()
+		delete(t.connectedPeerIPs, ih.Conn.RemoteAddr().(*net.TCPAddr).IP.String())
+	}
+	t.incomingHandshakers = make(map[*incominghandshaker.IncomingHandshaker]struct{})
+	for oh := range t.outgoingHandshakers {
+		oh.Close()
+		delete(t.connectedPeerIPs, oh.Addr.IP.String())
+	}
+	t.outgoingHandshakers = make(map[*outgoinghandshaker.OutgoingHandshaker]struct{})
+}
+
+func (t *torrent) handleNewConnection(conn net.Conn) {
+	ip := conn.RemoteAddr().(*net.TCPAddr).IP
+	var reason string
+	switch {
+	case t.status() == Stopped || t.status() == Stopping || t.status() == Queued:
+		reason = "torrent is stopped"
+	case len(t.incomingHandshakers)+len(t.incomingPeers) >= t.session.config.MaxPeerAccept:
+		reason = "too many connections"
+	case t.session.config.BlocklistEnabledForIncomingConnections && t.session.blocklist.Blocked(ip):
+		reason = "peer is blocked"
+	case t.session.peerBanned(ip.String()):
+		reason = "peer is banned"
+	default:
+		if _, ok := t.connectedPeerIPs[ip.String()]; ok {
+			reason = "duplicate connection from same IP"
+		}
+	}
+	if reason != "" {
+		t.log.Debugf("rejected connection from %s: %s", conn.RemoteAddr(), reason)
+		conn.Close()
+		return
+	}
+	h := incominghandshaker.New(conn)
+	t.incomingHandshakers[h] = struct{}{}
+	t.connectedPeerIPs[ip.String()] = struct{}{}
+	go h.Run(t.peerID, t.getSKey, t.checkInfoHash, t.incomingHandshakerResultC, t.session.config.PeerHandshakeTimeout, btExtensions, t.session.config.ForceIncomingEncryption)
+}
+
+// getSKey returns the info hash as the shared secret of MSE handshake if the hash of it matches sKeyHash.
+func (t *torrent) getSKey(sKeyHash [20]byte) []byte {
+	if sKeyHash == mse.HashSKey(t.infoHash[:]) {
+		return t.infoHash[:]
+	}
+	return nil
+}
+
+func (t *torrent) checkInfoHash(infoHash [20]byte) bool {
+	return infoHash == t.infoHash
+}
+
+func (t *torrent) handleIncomingHandshakeDone(ih *incominghandshaker.IncomingHandshaker) {
+	delete(t.incomingHandshakers, ih)
+	ip := ih.Conn.RemoteAddr().(*net.TCPAddr).IP.String()
+	if ih.Error != nil {
+		delete(t.connectedPeerIPs, ip)
+		return
+	}
+	if ih.PeerID == t.peerID {
+		t.log.Debugln("connected to self, closing connection:", ih.Conn.RemoteAddr())
+		ih.Conn.Close()
+		delete(t.connectedPeerIPs, ip)
+		return
+	}
+	pe := t.newBitTorrentPeer(ih.Conn, peersource.Incoming, ih.PeerID, ih.Extensions, ih.Cipher)
+	t.incomingPeers[pe] = struct{}{}
+	t.startPeer(pe)
+}
+
+func (t *torrent) handleNewBTPeers(addrs []*net.TCPAddr, source peersource.Source) {
+	t.log.Debugf("received %d bittorrent peers from %s\n", len(addrs), source)
+	status := t.status()
+	if status == Stopped || status == Stopping {
+		return
+	}
+	if status == Queued {
+		// Address list is created when the torrent is started.
+		for _, addr := range addrs {
+			if t.completed || len(t.queuedBTAddrs) >= t.session.config.MaxPeerAddresses {
+				break
+			}
+			t.queuedBTAddrs = append(t.queuedBTAddrs, queuedBTAddr{Addr: addr, Source: source})
+		}
+		return
+	}
+	if t.btAddrList == nil {
+		return
+	}
+	if !t.completed {
+		t.btAddrList.Push(addrs, internalpeersource.Source(source))
+		t.dialBTAddresses()
+	}
+}
+
+// queuedBTAddr is a BitTorrent peer received while the torrent is queued.
+type queuedBTAddr struct {
+	Addr   *net.TCPAddr
+	Source peersource.Source
+}
+
+// dialQueuedBTAddresses dials the BitTorrent peers received while the torrent was queued.
+func (t *torrent) dialQueuedBTAddresses() {
+	queued := t.queuedBTAddrs
+	t.queuedBTAddrs = nil
+	for _, q := range queued {
+		t.handleNewBTPeers([]*net.TCPAddr{q.Addr}, q.Source)
+	}
+}
+
+func (t *torrent) dialBTAddresses() {
+	if t.completed || t.btAddrList == nil {
+		return
+	}
+	peersConnected := func() int {
+		return len(t.peers) + len(t.dialers) + len(t.outgoingHandshakers)
+	}
+	for peersConnected() < t.session.config.MaxPeerDial && len(t.outgoingHandshakers) < t.session.config.ParallelPeerDials {
+		addr, src := t.btAddrList.Pop()
+		if addr == nil {
+			return
+		}
+		ip := addr.IP.String()
+		if _, ok := t.connectedPeerIPs[ip]; ok {
+			continue
+		}
+		if t.session.peerBanned(ip) {
+			continue
+		}
+		h := outgoinghandshaker.New(addr, src)
+		t.outgoingHandshakers[h] = struct{}{}
+		t.connectedPeerIPs[ip] = struct{}{}
+		go h.Run(
+			t.session.config.PeerConnectTimeout,
+			t.session.config.PeerHandshakeTimeout,
+			t.peerID,
+			t.infoHash,
+			t.outgoingHandshakerResultC,
+			btExtensions,
+			t.session.config.DisableOutgoingEncryption,
+			t.session.config.ForceOutgoingEncryption,
+		)
+	}
+}
+
+func (t *torrent) handleOutgoingHandshakeDone(oh *outgoinghandshaker.OutgoingHandshaker) {
+	delete(t.outgoingHandshakers, oh)
+	if oh.Error != nil {
+		delete(t.connectedPeerIPs, oh.Addr.IP.String())
+		t.dialBTAddresses()
+		return
+	}
+	if t.completed {
+		t.log.Debugln("peer is not needed anymore, close connection:", oh.Addr)
+		oh.Conn.Close()
+		delete(t.connectedPeerIPs, oh.Addr.IP.String())
+		return
+	}
+	pe := t.newBitTorrentPeer(oh.Conn, peersource.Source(oh.Source), oh.PeerID, oh.Extensions, oh.Cipher)
+	t.outgoingPeers[pe] = struct{}{}
+	t.startPeer(pe)
+}
+
+func (t *torrent) newBitTorrentPeer(conn net.Conn, source peersource.Source, peerID [20]byte, extensions [8]byte, cipher mse.CryptoMethod) *peer.Peer {
+	return peer.NewBitTorrent(conn, source, peerID, extensions, cipher, t.session.config.PieceReadTimeout, t.session.config.RequestTimeout, t.session.config.MaxRequestsIn, t.downloadBuckets(), t.uploadBuckets())
+}
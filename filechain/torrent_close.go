@@ -12,40 +12,73 @@ import (
 
 var errClosed = errors.New("torrent is closed")
 
+// exit closes the torrent from the run loop. The run loop must return after calling it.
+// Commands are refused before the torrent is stopped, so they are not handled by a closing torrent.
+func (t *torrent) exit() {
+	close(t.closeC)
+	t.close()
+	close(t.doneC)
+}
+
 func (t *torrent) close() {
 	// Stop if running.
 	t.stop(errClosed)
 
 	// Maybe we are in "Stopping" state. Close "stopped" event announcer.
-	//if t.stoppedEventAnnouncer != nil {
-	//	t.stoppedEventAnnouncer.Close()
-	//}
+	if t.stoppedEventAnnouncer != nil {
+		t.stoppedEventAnnouncer.Close()
+	}
 
 	t.downloadSpeed.Stop()
 	t.uploadSpeed.Stop()
+
+	t.resetIncomingStreams()
+}
+
+// resetIncomingStreams resets the accepted streams that are not handled by the run loop yet.
+// Streams added after it are refused, so none of them is left in the channel.
+func (t *torrent) resetIncomingStreams() {
+	t.mIncomingStreams.Lock()
+	defer t.mIncomingStreams.Unlock()
+	t.incomingStreamsClosed = true
+	for {
+		select {
+		case stream := <-t.incomingStreamC:
+			_ = stream.Reset()
+		default:
+			return
+		}
+	}
 }
 
 func (t *torrent) closePeer(pe *peer.Peer) {
 	t.log.Debugln("close peer:", pe.ID)
 	pe.Close()
+	t.untagPeer(pe)
 	if pd, ok := t.pieceDownloaders[pe]; ok {
 		t.closePieceDownloader(pd)
 	}
 	if id, ok := t.infoDownloaders[pe]; ok {
 		t.closeInfoDownloader(id)
 	}
-	delete(t.connectedPeers, pe.P2pID)
-
-	delete(t.incomingPeers, pe.P2pID)
-	delete(t.outgoingPeers, pe.P2pID)
+	delete(t.peers, pe)
+	if pe.IsBitTorrent() {
+		delete(t.connectedPeerIPs, pe.TCPAddr.IP.String())
+	} else {
+		delete(t.connectedPeers, pe.P2pID)
+	}
+	delete(t.incomingPeers, pe)
+	delete(t.outgoingPeers, pe)
 	//delete(t.peerIDs, pe.ID)
-	//delete(t.connectedPeerIPs, pe.Conn.IP())
 	if t.piecePicker != nil {
 		t.piecePicker.HandleDisconnect(pe)
 	}
 	t.unchoker.HandleDisconnect(pe)
-	//t.pexDropPeer(pe.Addr())
+	if !pe.IsBitTorrent() {
+		t.pexDropPeer(t.pexAddrInfo(pe))
+	}
 	t.dialAddresses()
+	t.dialBTAddresses()
 	t.session.metrics.Peers.Dec(1)
 }
 
@@ -67,7 +100,7 @@ func (t *torrent) closePieceDownloader(pd *piecedownloader.PieceDownloader) {
 	}
 	pe.Downloading = false
 	if t.session.ram != nil {
-		t.session.ram.Release(int64(t.info.PieceLength))
+		t.session.ram.Release(t.id, int64(t.info.PieceLength))
 	}
 }
 
@@ -1,5 +1,17 @@
 package filechain
 
+import (
+	"errors"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/fichain/go-file/external/peersource"
+	"github.com/fichain/go-file/internal/metainfo"
+	p2pPeer "github.com/libp2p/go-libp2p-core/peer"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
 // Start downloading.
 // After all files are downloaded, seeding continues until the torrent is stopped.
 func (t *torrent) Start() error {
@@ -119,169 +131,230 @@ func (t *torrent) NotifyError() <-chan error {
 //	return trackers
 //}
 //
-//type statsRequest struct {
-//	Response chan Stats
-//}
-//
-//// Stats returns statistics about the Torrent.
-//func (t *torrent) Stats() Stats {
-//	var stats Stats
-//	req := statsRequest{Response: make(chan Stats, 1)}
-//	select {
-//	case t.statsCommandC <- req:
-//	case <-t.closeC:
-//	}
-//	select {
-//	case stats = <-req.Response:
-//	case <-t.closeC:
-//	}
-//	return stats
-//}
-//
-//func (t *torrent) AddPeers(peers []*net.TCPAddr) {
-//	select {
-//	case t.addPeersCommandC <- peers:
-//	case <-t.closeC:
-//	}
-//}
-//
-//func (t *torrent) AddTrackers(trackers []tracker.Tracker) {
-//	select {
-//	case t.addTrackersCommandC <- trackers:
-//	case <-t.closeC:
-//	}
-//}
-//
-//// TrackerStatus is status of the Tracker.
-//type TrackerStatus int
-//
-//const (
-//	// NotContactedYet indicates that no announce request has been made to the tracker.
-//	NotContactedYet TrackerStatus = iota
-//	// Contacting the tracker. Sending request or waiting response from the tracker.
-//	Contacting
-//	// Working indicates that the tracker has responded as expected.
-//	Working
-//	// NotWorking indicates that the tracker didn't respond or returned an error.
-//	NotWorking
-//)
-//
-//func trackerStatusToString(s TrackerStatus) string {
-//	m := map[TrackerStatus]string{
-//		NotContactedYet: "Not contacted yet",
-//		Contacting:      "Contacting",
-//		Working:         "Working",
-//		NotWorking:      "Not working",
-//	}
-//	return m[s]
-//}
-//
-//// Tracker is a server that tracks the peers of torrents.
-//type Tracker struct {
-//	URL          string
-//	Status       TrackerStatus
-//	Leechers     int
-//	Seeders      int
-//	Error        *AnnounceError
-//	Warning      string
-//	LastAnnounce time.Time
-//	NextAnnounce time.Time
-//}
-//
-//type trackersRequest struct {
-//	Response chan []Tracker
-//}
-//
-//func (t *torrent) Trackers() []Tracker {
-//	var trackers []Tracker
-//	req := trackersRequest{Response: make(chan []Tracker, 1)}
-//	select {
-//	case t.trackersCommandC <- req:
-//	case <-t.closeC:
-//	}
-//	select {
-//	case trackers = <-req.Response:
-//	case <-t.closeC:
-//	}
-//	return trackers
-//}
-//
-//// Peer is a remote peer that is connected and completed protocol handshake.
-//type Peer struct {
-//	ID                 [20]byte
-//	Client             string
-//	Addr               net.Addr
-//	Source             PeerSource
-//	ConnectedAt        time.Time
-//	Downloading        bool
-//	ClientInterested   bool
-//	ClientChoking      bool
-//	PeerInterested     bool
-//	PeerChoking        bool
-//	OptimisticUnchoked bool
-//	Snubbed            bool
-//	EncryptedHandshake bool
-//	EncryptedStream    bool
-//	DownloadSpeed      int
-//	UploadSpeed        int
-//}
-//
-//// PeerSource indicates that how the peer is found.
-//type PeerSource int
-//
-//const (
-//	// SourceTracker indicates that the peer is found from one of the trackers.
-//	SourceTracker PeerSource = iota
-//	// SourceDHT indicates that the peer is found from Decentralised Hash Table.
-//	SourceDHT
-//	// SourcePEX indicates that the peer is found from another peer.
-//	SourcePEX
-//	// SourceIncoming indicates that the peer found us.
-//	SourceIncoming
-//	// SourceManual indicates that the peer is added manually via AddPeer method.
-//	SourceManual
-//)
-//
-//type peersRequest struct {
-//	Response chan []Peer
-//}
-//
-//func (t *torrent) Peers() []Peer {
-//	var peers []Peer
-//	req := peersRequest{Response: make(chan []Peer, 1)}
-//	select {
-//	case t.peersCommandC <- req:
-//	case <-t.closeC:
-//	}
-//	select {
-//	case peers = <-req.Response:
-//	case <-t.closeC:
-//	}
-//	return peers
-//}
-//
-//// Webseed is a HTTP source defined in Torrent.
-//// Client can download from these sources along with peers from the swarm.
-//type Webseed struct {
-//	URL           string
-//	Error         error
-//	DownloadSpeed int
-//}
+type statsRequest struct {
+	Response chan Stats
+}
+
+// Stats returns statistics about the Torrent.
+func (t *torrent) Stats() Stats {
+	var stats Stats
+	req := statsRequest{Response: make(chan Stats, 1)}
+	select {
+	case t.statsCommandC <- req:
+	case <-t.closeC:
+	}
+	select {
+	case stats = <-req.Response:
+	case <-t.closeC:
+	}
+	return stats
+}
+
+// DataStats returns statistics about the Torrent.
 //
-//type webseedsRequest struct {
-//	Response chan []Webseed
-//}
+// Deprecated: Use Stats.
+func (t *torrent) DataStats() Stats {
+	return t.Stats()
+}
+
+type addPeersRequest struct {
+	Peers           []p2pPeer.AddrInfo
+	BitTorrentPeers []*net.TCPAddr
+}
+
+// AddPeers adds peer addresses to be dialed by the torrent.
+// Addresses of libp2p peers are multiaddrs ending with "/p2p/<peer id>".
+// Other addresses are "host:port" of BitTorrent peers, which can be added only if BitTorrent is enabled in Config.
+func (t *torrent) AddPeers(addrs []string) error {
+	var req addPeersRequest
+	for _, s := range addrs {
+		if strings.HasPrefix(s, "/") {
+			maddr, err := ma.NewMultiaddr(s)
+			if err != nil {
+				return err
+			}
+			pi, err := p2pPeer.AddrInfoFromP2pAddr(maddr)
+			if err != nil {
+				return err
+			}
+			req.Peers = append(req.Peers, *pi)
+			continue
+		}
+		if !t.session.config.BitTorrentEnabled {
+			return errors.New("bittorrent is not enabled: " + s)
+		}
+		addr, err := net.ResolveTCPAddr("tcp", s)
+		if err != nil {
+			return err
+		}
+		req.BitTorrentPeers = append(req.BitTorrentPeers, addr)
+	}
+	select {
+	case t.addPeersCommandC <- req:
+	case <-t.closeC:
+	}
+	return nil
+}
 //
-//func (t *torrent) Webseeds() []Webseed {
-//	var webseeds []Webseed
-//	req := webseedsRequest{Response: make(chan []Webseed, 1)}
-//	select {
-//	case t.webseedsCommandC <- req:
-//	case <-t.closeC:
-//	}
-//	select {
-//	case webseeds = <-req.Response:
-//	case <-t.closeC:
-//	}
-//	return webseeds
-//}
+// AddTrackers adds tracker URLs to the torrent. Each URL is added as a new tier.
+// Trackers are saved in resume data and announced while the torrent is running.
+func (t *torrent) AddTrackers(urls []string) error {
+	for _, u := range urls {
+		_, err := t.session.getTracker(u, false)
+		if err != nil {
+			return newInputError(err)
+		}
+	}
+	select {
+	case t.addTrackersCommandC <- urls:
+	case <-t.closeC:
+	}
+	return nil
+}
+
+// TrackerStatus is status of the Tracker.
+type TrackerStatus int
+
+const (
+	// NotContactedYet indicates that no announce request has been made to the tracker.
+	NotContactedYet TrackerStatus = iota
+	// Contacting the tracker. Sending request or waiting response from the tracker.
+	Contacting
+	// Working indicates that the tracker has responded as expected.
+	Working
+	// NotWorking indicates that the tracker didn't respond or returned an error.
+	NotWorking
+)
+
+func trackerStatusToString(s TrackerStatus) string {
+	m := map[TrackerStatus]string{
+		NotContactedYet: "Not contacted yet",
+		Contacting:      "Contacting",
+		Working:         "Working",
+		NotWorking:      "Not working",
+	}
+	return m[s]
+}
+
+// Tracker is a server that tracks the peers of torrents.
+type Tracker struct {
+	URL          string
+	Status       TrackerStatus
+	Leechers     int
+	Seeders      int
+	Error        *AnnounceError
+	Warning      string
+	LastAnnounce time.Time
+	NextAnnounce time.Time
+}
+
+type trackersRequest struct {
+	Response chan []Tracker
+}
+
+// Trackers returns the trackers of the torrent with their announce status.
+func (t *torrent) Trackers() []Tracker {
+	var trackers []Tracker
+	req := trackersRequest{Response: make(chan []Tracker, 1)}
+	select {
+	case t.trackersCommandC <- req:
+	case <-t.closeC:
+	}
+	select {
+	case trackers = <-req.Response:
+	case <-t.closeC:
+	}
+	return trackers
+}
+
+// Peer is a remote peer that is connected and completed protocol handshake.
+type Peer struct {
+	// Empty for BitTorrent peers.
+	ID                 p2pPeer.ID
+	Client             string
+	Addr               ma.Multiaddr
+	Source             peersource.Source
+	ProtocolVersion    string
+	Features           []string
+	ConnectedAt        time.Time
+	Downloading        bool
+	ClientInterested   bool
+	ClientChoking      bool
+	PeerInterested     bool
+	PeerChoking        bool
+	OptimisticUnchoked bool
+	Snubbed            bool
+	DownloadSpeed      int
+	UploadSpeed        int
+}
+
+type peersRequest struct {
+	Response chan []Peer
+}
+
+// Peers returns the list of connected (handshake completed) peers of the torrent.
+func (t *torrent) Peers() []Peer {
+	var peers []Peer
+	req := peersRequest{Response: make(chan []Peer, 1)}
+	select {
+	case t.peersCommandC <- req:
+	case <-t.closeC:
+	}
+	select {
+	case peers = <-req.Response:
+	case <-t.closeC:
+	}
+	return peers
+}
+
+// Webseed is a HTTP source defined in Torrent.
+// Client can download from these sources along with peers from the swarm.
+type Webseed struct {
+	URL string
+	// True while pieces are being downloaded from the source.
+	Downloading bool
+	// Sources are disabled for WebseedRetryInterval after an error.
+	Disabled bool
+	// Last error of the source.
+	Error error
+	// Downloaded bytes per second, calculated as 1-minute moving average.
+	DownloadSpeed int
+}
+
+type infoRequest struct {
+	Response chan *metainfo.Info
+}
+
+// metadata returns the info of the torrent. Returns nil if metadata is not downloaded yet.
+func (t *torrent) metadata() *metainfo.Info {
+	var info *metainfo.Info
+	req := infoRequest{Response: make(chan *metainfo.Info, 1)}
+	select {
+	case t.infoCommandC <- req:
+	case <-t.closeC:
+	}
+	select {
+	case info = <-req.Response:
+	case <-t.closeC:
+	}
+	return info
+}
+
+type webseedsRequest struct {
+	Response chan []Webseed
+}
+
+// Webseeds returns the HTTP sources of the torrent.
+func (t *torrent) Webseeds() []Webseed {
+	var webseeds []Webseed
+	req := webseedsRequest{Response: make(chan []Webseed, 1)}
+	select {
+	case t.webseedsCommandC <- req:
+	case <-t.closeC:
+	}
+	select {
+	case webseeds = <-req.Response:
+	case <-t.closeC:
+	}
+	return webseeds
+}
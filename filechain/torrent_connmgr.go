@@ -0,0 +1,54 @@
+package filechain
+
+import (
+	"github.com/fichain/go-file/external/peer"
+)
+
+// Transfer rate that adds 1 to the value of a connection in the connection manager.
+const connValueRate = 16 * 1024
+
+// Upper limit of the value of a single connection.
+const maxConnValue = 100
+
+// connTag returns the tag of the torrent in the connection manager.
+// Each torrent uses its own tag so a peer shared by many torrents stays protected until all of them release it.
+func (t *torrent) connTag() string {
+	return "filechain/" + t.id
+}
+
+// protectPeer prevents the connection manager from closing the connection while we are transferring data with the peer.
+func (t *torrent) protectPeer(pe *peer.Peer) {
+	if pe.IsBitTorrent() {
+		return
+	}
+	t.session.host.ConnManager().Protect(pe.P2pID, t.connTag())
+}
+
+// untagPeer removes the protection and the value of the peer when it is disconnected from the torrent.
+func (t *torrent) untagPeer(pe *peer.Peer) {
+	if pe.IsBitTorrent() {
+		return
+	}
+	cm := t.session.host.ConnManager()
+	cm.UntagPeer(pe.P2pID, t.connTag())
+	cm.Unprotect(pe.P2pID, t.connTag())
+}
+
+// updatePeerTags sets the value of each connection from its transfer rate.
+// Idle peers are unprotected so the connection manager can close them when there are too many connections.
+func (t *torrent) updatePeerTags() {
+	cm := t.session.host.ConnManager()
+	for _, pe := range t.connectedPeers {
+		rate := pe.DownloadSpeed() + pe.UploadSpeed()
+		value := 1 + rate/connValueRate
+		if value > maxConnValue {
+			value = maxConnValue
+		}
+		cm.TagPeer(pe.P2pID, t.connTag(), value)
+		if pe.Downloading || rate > 0 {
+			cm.Protect(pe.P2pID, t.connTag())
+		} else {
+			cm.Unprotect(pe.P2pID, t.connTag())
+		}
+	}
+}
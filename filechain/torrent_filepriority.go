@@ -0,0 +1,397 @@
+package filechain
+
+import (
+	"errors"
+
+	"github.com/fichain/go-file/external/piecepicker"
+	"github.com/fichain/go-file/internal/bitfield"
+)
+
+// FilePriority determines whether and in which order the files of a torrent are downloaded.
+type FilePriority int
+
+const (
+	// FilePrioritySkip files are not downloaded. They are not created on disk,
+	// unless they share a piece with a file that is downloaded.
+	FilePrioritySkip FilePriority = -2
+	// FilePriorityLow files are downloaded after the files with higher priorities.
+	FilePriorityLow FilePriority = -1
+	// FilePriorityNormal is the priority of files by default.
+	FilePriorityNormal FilePriority = 0
+	// FilePriorityHigh files are downloaded before the files with lower priorities.
+	FilePriorityHigh FilePriority = 1
+)
+
+var (
+	errInvalidFilePriority = errors.New("invalid file priority")
+	errFileCount           = errors.New("number of priorities does not match the number of files")
+	errNoMetadata          = errors.New("metadata is not downloaded yet")
+)
+
+func (p FilePriority) valid() bool {
+	return p >= FilePrioritySkip && p <= FilePriorityHigh
+}
+
+// filePriorityValues returns the priorities to save in resume data.
+func filePriorityValues(priorities []FilePriority) []int {
+	if priorities == nil {
+		return nil
+	}
+	values := make([]int, len(priorities))
+	for i, p := range priorities {
+		values[i] = int(p)
+	}
+	return values
+}
+
+// filePrioritiesFromSpec returns the priorities saved in resume data. Invalid values are replaced with the normal priority.
+func filePrioritiesFromSpec(values []int) []FilePriority {
+	if values == nil {
+		return nil
+	}
+	priorities := make([]FilePriority, len(values))
+	for i, v := range values {
+		priorities[i] = FilePriority(v)
+		if !priorities[i].valid() {
+			priorities[i] = FilePriorityNormal
+		}
+	}
+	return priorities
+}
+
+// String returns the name of the priority.
+func (p FilePriority) String() string {
+	switch p {
+	case FilePrioritySkip:
+		return "skip"
+	case FilePriorityLow:
+		return "low"
+	case FilePriorityNormal:
+		return "normal"
+	case FilePriorityHigh:
+		return "high"
+	default:
+		return "unknown"
+	}
+}
+
+type filePrioritiesRequest struct {
+	Priorities []FilePriority
+	Response   chan error
+}
+
+// FilePriorities returns the priorities of the files in the order of the files in metainfo.
+// nil value means all files have normal priority.
+func (t *torrent) FilePriorities() []FilePriority {
+	t.mFilePriorities.RLock()
+	defer t.mFilePriorities.RUnlock()
+	return append([]FilePriority(nil), t.filePriorities...)
+}
+
+// SetFilePriorities changes the priorities of the files in the order of the files in metainfo.
+// Metadata of the torrent must be downloaded before setting the priorities. Priorities are saved in resume data.
+// The torrent is completed when all files that are not skipped are downloaded.
+func (t *torrent) SetFilePriorities(priorities []FilePriority) error {
+	for _, p := range priorities {
+		if !p.valid() {
+			return newInputError(errInvalidFilePriority)
+		}
+	}
+	req := filePrioritiesRequest{
+		Priorities: append([]FilePriority(nil), priorities...),
+		Response:   make(chan error, 1),
+	}
+	select {
+	case t.priorityCommandC <- req:
+	case <-t.closeC:
+		return errClosed
+	}
+	select {
+	case err := <-req.Response:
+		return err
+	case <-t.closeC:
+		return errClosed
+	}
+}
+
+func (t *torrent) handleSetFilePriorities(req filePrioritiesRequest) {
+	if t.info == nil {
+		req.Response <- newInputError(errNoMetadata)
+		return
+	}
+	if len(req.Priorities) != len(t.info.Files) {
+		req.Response <- newInputError(errFileCount)
+		return
+	}
+	t.setFilePriorities(req.Priorities)
+	t.releaseSkippedFiles()
+	err := t.session.resumer.WriteFilePriorities(t.id, filePriorityValues(req.Priorities))
+	if err != nil {
+		req.Response <- err
+		return
+	}
+	req.Response <- nil
+	t.handleWantedPiecesChanged()
+}
+
+// handleWantedPiecesChanged continues or completes the download after the set of wanted pieces is changed.
+func (t *torrent) handleWantedPiecesChanged() {
+	for pe := range t.peers {
+		t.updateInterestedState(pe)
+	}
+	switch {
+	case t.completed && !t.wantedComplete():
+		if t.status() == Seeding {
+			t.resumeDownload()
+		} else {
+			// Completion is checked again after allocation.
+			t.completed = false
+			t.completeC = make(chan struct{})
+		}
+	case t.status() == Downloading && t.checkCompletion():
+		t.log.Info("download of wanted files completed")
+		_ = t.writeBitfield()
+		t.session.notifyQueue()
+		if t.stopAfterDownload {
+			t.stopReason = StopReasonDownloaded
+			t.stop(nil)
+		}
+	default:
+		t.startPieceDownloaders()
+		t.startWebseedDownloaders()
+	}
+}
+
+// applyPendingFilePriorities sets the priorities given before the metadata is downloaded.
+func (t *torrent) applyPendingFilePriorities() {
+	priorities := t.pendingFilePriorities
+	t.pendingFilePriorities = nil
+	if priorities == nil {
+		return
+	}
+	if len(priorities) != len(t.info.Files) {
+		t.log.Warningln("file priorities are ignored:", errFileCount)
+		return
+	}
+	t.setFilePriorities(priorities)
+}
+
+// setFilePriorities sets the priorities and updates the piece priorities. Must be called after metadata is known.
+func (t *torrent) setFilePriorities(priorities []FilePriority) {
+	allNormal := true
+	for _, p := range priorities {
+		if p != FilePriorityNormal {
+			allNormal = false
+			break
+		}
+	}
+	if allNormal {
+		priorities = nil
+	}
+	t.mFilePriorities.Lock()
+	t.filePriorities = priorities
+	t.mFilePriorities.Unlock()
+	t.updatePiecePriorities()
+}
+
+// updatePiecePriorities calculates the priority of each piece from the files that the piece belongs to.
+// A piece gets the highest priority of its files. A piece is skipped only if all of its files are skipped.
+// Pieces in the readahead windows of file readers get the priorities of the readers instead.
+func (t *torrent) updatePiecePriorities() {
+	t.skippedPieces = nil
+	t.piecePriorities = nil
+	t.readaheadPieces = nil
+	if t.info == nil {
+		return
+	}
+	t.readaheadPieces = t.readaheadPriorities()
+	if t.filePriorities != nil {
+		t.piecePriorities = make([]FilePriority, t.info.NumPieces)
+		t.calculatePiecePriorities(t.piecePriorities)
+	}
+	for i, p := range t.piecePriorities {
+		if p == FilePrioritySkip {
+			if t.skippedPieces == nil {
+				t.skippedPieces = bitfield.New(t.info.NumPieces)
+			}
+			t.skippedPieces.Set(uint32(i))
+		}
+	}
+	if t.piecePicker != nil {
+		for i := uint32(0); i < t.info.NumPieces; i++ {
+			t.setPiecePriority(i)
+		}
+	}
+}
+
+// setPiecePriority sets the priority of the piece in the piece picker from the file priorities and the readahead windows.
+// Returns true if the piece belongs only to skipped files.
+func (t *torrent) setPiecePriority(i uint32) (skipped bool) {
+	p := FilePriorityNormal
+	if t.piecePriorities != nil {
+		p = t.piecePriorities[i]
+	}
+	if t.piecePicker != nil {
+		priority, boosted := t.readaheadPieces[i]
+		if !boosted {
+			priority = int(p)
+		}
+		t.piecePicker.SetPriority(i, priority, p == FilePrioritySkip && !boosted)
+	}
+	return p == FilePrioritySkip
+}
+
+// calculatePiecePriorities sets the highest priority of the files that each piece belongs to.
+func (t *torrent) calculatePiecePriorities(priorities []FilePriority) {
+	for i := range priorities {
+		priorities[i] = FilePrioritySkip
+	}
+	var offset int64
+	for i, f := range t.info.Files {
+		begin, end := offset, offset+f.Length
+		offset = end
+		if f.Length == 0 {
+			continue
+		}
+		p := t.filePriorities[i]
+		for j := uint32(begin / int64(t.info.PieceLength)); j <= uint32((end-1)/int64(t.info.PieceLength)); j++ {
+			if p > priorities[j] {
+				priorities[j] = p
+			}
+		}
+	}
+}
+
+// skippedFiles returns the files that do not need to be created by the allocator.
+func (t *torrent) skippedFiles() []bool {
+	if t.filePriorities == nil {
+		return nil
+	}
+	skip := make([]bool, len(t.filePriorities))
+	for i, p := range t.filePriorities {
+		skip[i] = p == FilePrioritySkip
+	}
+	return skip
+}
+
+// releaseSkippedFiles removes the skipped files that are created by the allocator from the disk, if they do not have any downloaded data.
+// Files sharing a downloaded piece with a wanted file are kept.
+func (t *torrent) releaseSkippedFiles() {
+	if t.files == nil || t.filePriorities == nil || t.verifier != nil {
+		return
+	}
+	var offset int64
+	for i, p := range t.filePriorities {
+		begin, end := offset, offset+t.info.Files[i].Length
+		offset = end
+		if p != FilePrioritySkip || t.files[i].Lazy || begin == end || t.hasPieceData(begin, end) {
+			continue
+		}
+		err := t.files[i].Release()
+		if err != nil {
+			t.log.Errorln("cannot remove skipped file:", err)
+		}
+	}
+}
+
+// hasPieceData returns true if a piece between the offsets is downloaded or being written.
+func (t *torrent) hasPieceData(begin, end int64) bool {
+	for i := uint32(begin / int64(t.info.PieceLength)); i <= uint32((end-1)/int64(t.info.PieceLength)); i++ {
+		if (t.bitfield != nil && t.bitfield.Test(i)) || t.pieces[i].Writing {
+			return true
+		}
+	}
+	return false
+}
+
+// clearLazyPieces removes the pieces of skipped files that do not exist on disk from the bitfield loaded from resume data.
+// Those pieces must be downloaded again if the file is wanted later.
+// Pieces at the boundaries are shared with the neighbour files and writing them creates the file again, so they are kept.
+func (t *torrent) clearLazyPieces() {
+	pieceLength := int64(t.info.PieceLength)
+	var offset int64
+	for i, f := range t.files {
+		begin, end := offset, offset+t.info.Files[i].Length
+		offset = end
+		if !f.Lazy || begin == end {
+			continue
+		}
+		// Only the pieces that lie entirely inside the file.
+		first := (begin + pieceLength - 1) / pieceLength
+		last := end / pieceLength
+		if end == t.info.Length {
+			last = int64(t.info.NumPieces)
+		}
+		t.mBitfield.Lock()
+		for j := first; j < last; j++ {
+			t.bitfield.Clear(uint32(j))
+		}
+		t.mBitfield.Unlock()
+	}
+}
+
+// pieceWanted returns true if the piece belongs to a file that is not skipped or a file reader needs it.
+func (t *torrent) pieceWanted(i uint32) bool {
+	if t.skippedPieces == nil || !t.skippedPieces.Test(i) {
+		return true
+	}
+	_, ok := t.readaheadPieces[i]
+	return ok
+}
+
+// wantedComplete returns true if all wanted pieces are downloaded.
+func (t *torrent) wantedComplete() bool {
+	if t.bitfield == nil {
+		return false
+	}
+	if t.skippedPieces == nil {
+		return t.bitfield.All()
+	}
+	for i := uint32(0); i < t.bitfield.Len(); i++ {
+		if !t.bitfield.Test(i) && t.pieceWanted(i) {
+			return false
+		}
+	}
+	return true
+}
+
+// wantedIncomplete returns the number of pieces and bytes that are wanted and not downloaded yet.
+func (t *torrent) wantedIncomplete() (pieces uint32, bytes int64) {
+	for i := uint32(0); i < t.info.NumPieces; i++ {
+		if (t.bitfield != nil && t.bitfield.Test(i)) || !t.pieceWanted(i) {
+			continue
+		}
+		pieces++
+		if i == t.info.NumPieces-1 {
+			bytes += t.info.Length - int64(i)*int64(t.info.PieceLength)
+		} else {
+			bytes += int64(t.info.PieceLength)
+		}
+	}
+	return
+}
+
+// resumeDownload starts downloading again after the torrent is completed,
+// because some pieces of the files that were skipped are wanted now by the user or a file reader.
+func (t *torrent) resumeDownload() {
+	t.log.Info("resuming download of wanted files")
+	t.completed = false
+	t.completeC = make(chan struct{})
+	t.piecePicker = piecepicker.New(t.pieces, t.session.config.EndgameMaxDuplicateDownloads, t.webseedSources)
+	t.updatePiecePriorities()
+	for pe := range t.peers {
+		if pe.Bitfield != nil {
+			for i := uint32(0); i < pe.Bitfield.Len(); i++ {
+				if pe.Bitfield.Test(i) {
+					t.piecePicker.HandleHave(pe, i)
+				}
+			}
+		}
+		t.updateInterestedState(pe)
+	}
+	t.startAnnouncers()
+	t.setNeedMorePeers()
+	t.startPieceDownloaders()
+	t.startWebseedDownloaders()
+	t.session.notifyQueue()
+}
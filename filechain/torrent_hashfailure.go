@@ -0,0 +1,95 @@
+package filechain
+
+import (
+	"crypto/sha1"
+
+	"github.com/fichain/go-file/external/peer"
+	"github.com/fichain/go-file/internal/piece"
+)
+
+// corruptBlock is a block received in a piece download that has failed the hash check.
+type corruptBlock struct {
+	// Ban key of the peer that has sent the block.
+	Sender string
+	Hash   [sha1.Size]byte
+}
+
+// handleCorruptPiece records the blocks of a piece from the peer that has failed the hash check.
+// A single failure does not prove that the peer has sent bad data on purpose, so the peer is not banned right away.
+// The piece is downloaded again from a single peer, preferably another one.
+// The peer is banned when a verified copy of the piece has different blocks or after Config.PeerBanHashFailures corrupt pieces.
+func (t *torrent) handleCorruptPiece(pe *peer.Peer, pi *piece.Piece, data []byte) {
+	key := banKey(pe)
+	blocks, ok := t.corruptBlocks[pi.Index]
+	if !ok {
+		blocks = make([][]corruptBlock, pi.NumBlocks())
+		t.corruptBlocks[pi.Index] = blocks
+	}
+	for i := range blocks {
+		b, _ := pi.GetBlock(i)
+		cb := corruptBlock{Sender: key, Hash: sha1.Sum(data[b.Begin : b.Begin+b.Length])} // nolint: gosec
+		if !containsBlock(blocks[i], cb) {
+			blocks[i] = append(blocks[i], cb)
+		}
+	}
+	if _, ok := t.peers[pe]; ok && t.piecePicker != nil {
+		t.piecePicker.HandleHashFailed(pe, pi.Index)
+	}
+	t.hashFailures[key]++
+	if n := t.session.config.PeerBanHashFailures; n > 0 && t.hashFailures[key] >= n {
+		t.banPeer(key, pi.Index)
+	}
+}
+
+// handleVerifiedPiece bans the peers that have sent blocks of the piece different from the data that has passed the hash check.
+func (t *torrent) handleVerifiedPiece(pi *piece.Piece, data []byte) {
+	blocks, ok := t.corruptBlocks[pi.Index]
+	if !ok {
+		return
+	}
+	delete(t.corruptBlocks, pi.Index)
+	banned := make(map[string]struct{})
+	for i, received := range blocks {
+		b, _ := pi.GetBlock(i)
+		hash := sha1.Sum(data[b.Begin : b.Begin+b.Length]) // nolint: gosec
+		for _, cb := range received {
+			if _, ok := banned[cb.Sender]; ok || cb.Hash == hash {
+				continue
+			}
+			t.log.Infof("peer %s has sent corrupt block #%d of piece #%d", cb.Sender, i, pi.Index)
+			banned[cb.Sender] = struct{}{}
+			t.banPeer(cb.Sender, pi.Index)
+		}
+	}
+}
+
+// banPeer bans the peer with the ban key in the session and closes its connections.
+func (t *torrent) banPeer(key string, index uint32) {
+	delete(t.hashFailures, key)
+	t.session.banPeer(key, t.id, index)
+	t.closeBannedPeer(key)
+}
+
+// closeBannedPeer closes the connections of the peer with the ban key.
+func (t *torrent) closeBannedPeer(key string) {
+	var closed bool
+	for pe := range t.peers {
+		if banKey(pe) == key {
+			t.closePeer(pe)
+			closed = true
+		}
+	}
+	if closed {
+		// Pieces requested from the banned peer can be downloaded from other peers now.
+		t.startPieceDownloaders()
+	}
+}
+
+func containsBlock(blocks []corruptBlock, cb corruptBlock) bool {
+	for _, b := range blocks {
+		if b == cb {
+			return true
+		}
+	}
+	return false
+}
@@ -6,7 +6,7 @@ import (
 )
 
 func (t *torrent) nextInfoDownload() *infodownloader.InfoDownloader {
-	for _, pe := range t.connectedPeers {
+	for pe := range t.peers {
 		if _, ok := t.infoDownloaders[pe]; ok {
 			continue
 		}
@@ -76,6 +76,7 @@ func (t *torrent) handlePieceMessage(pm peer.PieceMessage) {
 			pe.Logger().Debugln("received not requested block:", block.Index)
 		}
 	case nil:
+		t.handlePeerUnsnubbed(pe)
 	default:
 		pe.Logger().Error(err)
 		t.closePeer(pe)
@@ -91,7 +92,7 @@ func (t *torrent) handlePieceMessage(pm peer.PieceMessage) {
 		}
 		return
 	}
-	t.log.Debugf("piece #%d downloaded from %s", msg.Index, pe.Stream.Conn().RemotePeer().Pretty())
+	t.log.Debugf("piece #%d downloaded from %s", msg.Index, pe.String())
 	t.closePieceDownloader(pd)
 	pe.StopSnubTimer()
 
@@ -305,15 +306,14 @@ func (t *torrent) handlePeerMessage(pm peer.Message) {
 				Length: msg.Length,
 			}})
 		}
-	//case peerprotocol.PortMessage:
-	//	if t.session.dht != nil {
-	//		t.session.dht.AddNode(fmt.Sprintf("%s:%d", pe.IP(), msg.Port))
-	//	}
+	case peerprotocol.PortMessage:
+		// BitTorrent peers announce their mainline DHT node. We find peers in libp2p DHT only.
 	case peerwriter.BlockUploaded:
 		l := int64(msg.Length)
 		t.uploadSpeed.Mark(l)
 		t.bytesUploaded.Inc(l)
 		t.session.metrics.SpeedUpload.Mark(l)
+		t.protectPeer(pe)
 	case peerprotocol.ExtensionHandshakeMessage:
 		pe.Logger().Debugln("extension handshake received:", msg)
 		if pe.ExtensionHandshake != nil {
@@ -321,6 +321,7 @@ func (t *torrent) handlePeerMessage(pm peer.Message) {
 			break
 		}
 		pe.ExtensionHandshake = &msg
+		pe.SetFeatures(msg.Features)
 
 		if len(msg.YourIP) == 4 {
 			t.externalIP = net.IP(msg.YourIP)
@@ -328,32 +329,13 @@ func (t *torrent) handlePeerMessage(pm peer.Message) {
 		if _, ok := msg.M[peerprotocol.ExtensionKeyMetadata]; ok {
 			t.startInfoDownloaders()
 		}
-		//if t.session.config.PEXEnabled {
-		//	if _, ok := msg.M[peerprotocol.ExtensionKeyPEX]; ok {
-		//		if t.info != nil && !t.info.Private {
-		//			pe.StartPEX(t.peers, &t.recentlySeen)
-		//		}
-		//	}
-		//}
+		if t.pexEnabled(pe) {
+			t.startPEX(pe)
+		}
 	case peerprotocol.ExtensionMetadataMessage:
 		t.handleMetadataMessage(pe, msg)
 	case peerprotocol.ExtensionPEXMessage:
-		if !t.session.config.PEXEnabled {
-			break
-		}
-		//todo change peers
-		//addrs, err := tracker.DecodePeersCompact([]byte(msg.Added))
-		//if err != nil {
-		//	t.log.Error(err)
-		//	break
-		//}
-		//t.handleNewPeers(addrs, peersource.PEX)
-		//addrs, err = tracker.DecodePeersCompact([]byte(msg.Dropped))
-		//if err != nil {
-		//	t.log.Error(err)
-		//	break
-		//}
-		//t.handleNewPeers(addrs, peersource.PEX)
+		t.handlePEXMessage(pe, msg)
 	default:
 		panic(fmt.Sprintf("unhandled peer message type: %T", msg))
 	}
@@ -368,7 +350,7 @@ func (t *torrent) updateInterestedState(pe *peer.Peer) {
 		for i := uint32(0); i < t.bitfield.Len(); i++ {
 			weHave := t.bitfield.Test(i)
 			peerHave := pe.Bitfield.Test(i)
-			if !weHave && peerHave {
+			if !weHave && peerHave && t.pieceWanted(i) {
 				interested = true
 				break
 			}
@@ -65,6 +65,7 @@ func (t *torrent) handleMetadataMessage(pe *peer.Peer, msg peerprotocol.Extensio
 			t.startInfoDownloaders()
 			break
 		}
+		t.handlePeerUnsnubbed(pe)
 		if !id.Done() {
 			id.RequestBlocks(t.maxAllowedRequests(pe))
 			pe.ResetSnubTimer()
@@ -98,6 +99,7 @@ func (t *torrent) handleMetadataMessage(pe *peer.Peer, msg peerprotocol.Extensio
 			t.stop(fmt.Errorf("cannot write resume info: %s", err))
 			break
 		}
+		t.applyPendingFilePriorities()
 		t.startAllocator()
 	case peerprotocol.ExtensionMetadataMessageTypeReject:
 		id, ok := t.infoDownloaders[pe]
@@ -1,7 +1,10 @@
 package filechain
 
 import (
-	"context"
+	"sort"
+	"time"
+
+	"github.com/fichain/go-file/external/dialer"
 	"github.com/fichain/go-file/external/p2p"
 	"github.com/fichain/go-file/external/peer"
 	"github.com/fichain/go-file/external/peerprotocol"
@@ -13,38 +16,81 @@ import (
 	"github.com/libp2p/go-libp2p-core/network"
 )
 
-func (t *torrent) setNeedMorePeers(val bool) {
-	//t.mDhtNeedPeer.Lock()
-	//t.dhtNeedPeer = val
-	//t.mDhtNeedPeer.Unlock()
+// peersNeeded returns the number of peers that we still need to reach MaxPeerDial connections.
+// Addresses waiting to be dialed are counted as peers.
+func (t *torrent) peersNeeded() int {
+	if t.completed {
+		return 0
+	}
+	n := t.session.config.MaxPeerDial - len(t.peers) - t.addrList.Len()
+	if n < 0 {
+		return 0
+	}
+	return n
 }
 
-func (t *torrent)handleNewIncomingStream(stream network.Stream)  {
+// setNeedMorePeers tells the announcers how many peers we need so they can adjust their query frequency.
+func (t *torrent) setNeedMorePeers() {
+	n := t.peersNeeded()
+	if t.dhtAnnouncer != nil {
+		t.dhtAnnouncer.NeedMorePeers(n)
+	}
+	for _, an := range t.announcers {
+		an.NeedMorePeers(n > 0)
+	}
+}
+
+func (t *torrent) handleNewIncomingStream(stream network.Stream) {
 	id := stream.Conn().RemotePeer()
-	if _, ok := t.connectedPeers[id]; ok {
-		t.log.Infof("duplicate peer, id: %s, close stream!", stream.Conn().RemotePeer().Pretty())
-		stream.Close()
+	var reason string
+	switch {
+	case t.status() == Stopped || t.status() == Stopping || t.status() == Queued:
+		reason = "torrent is stopped"
+	case len(t.incomingPeers) >= t.session.config.MaxPeerAccept:
+		reason = "too many connections"
+	case t.session.peerBanned(id.String()):
+		reason = "peer is banned"
+	default:
+		if _, ok := t.connectedPeers[id]; ok {
+			reason = "duplicate connection"
+		}
+	}
+	if reason != "" {
+		t.log.Debugf("rejected stream of peer %s: %s", id.Pretty(), reason)
+		// Do not block the run loop on a slow peer.
+		go rejectStream(stream, reason)
+		return
+	}
+	err := p2p.WriteTransferResponse(stream, "")
+	if err == nil {
+		err = stream.SetDeadline(time.Time{})
+	}
+	if err != nil {
+		t.log.Debugf("cannot accept stream of peer %s: %s", id.Pretty(), err)
+		stream.Reset()
 		return
 	}
 
-	pe := peer.New(t.session.host, stream, peersource.Incoming, t.infoHash, t.session.config.PieceReadTimeout, t.session.config.RequestTimeout, t.session.config.MaxRequestsIn, t.session.bucketDownload, t.session.bucketUpload)
-	t.connectedPeers[stream.Conn().RemotePeer()] = pe
-	//	go pe.Run(t.messages, t.pieceMessagesC.SendC(), t.peerSnubbedC, t.peerDisconnectedC)
+	pe := peer.New(t.session.host, stream, peersource.Incoming, t.infoHash, t.session.config.PieceReadTimeout, t.session.config.RequestTimeout, t.session.config.MaxRequestsIn, t.downloadBuckets(), t.uploadBuckets())
+	t.connectedPeers[id] = pe
+	t.incomingPeers[pe] = struct{}{}
 	t.startPeer(pe)
-	//go pe.Run(t.messages, t.pieceMessagesC.SendC(), t.peerSnubbedC, t.peerDisconnectedC)
 }
 
 func (t *torrent) handleNewPeers(addrs []p2pPeer.AddrInfo, source peersource.Source) {
 	t.log.Debugf("received %d peers from %s\n", len(addrs), source)
-	//t.setNeedMorePeers(false)
-	if status := t.status(); status == Stopped || status == Stopping {
+	defer t.setNeedMorePeers()
+	status := t.status()
+	if status == Stopped || status == Stopping {
 		return
 	}
 	if !t.completed {
-		//addrs = t.filterBannedIPs(addrs)
 		t.log.Debugln("not complete push addr to list")
 		t.addrList.Push(t.addrList.ToAddrs(addrs), source)
-		t.dialAddresses()
+		// Addresses of a queued torrent are dialed when it is dequeued.
+		if status != Queued {
+			t.dialAddresses()
+		}
 	}
 }
 
@@ -54,13 +100,14 @@ func (t *torrent) dialAddresses() {
 	}
 
 	peersConnected := func() int {
-		return len(t.connectedPeers)
+		return len(t.peers) + len(t.dialers) + len(t.outgoingHandshakers)
 	}
 
-	for peersConnected() < t.session.config.MaxPeerDial {
+	now := time.Now()
+	for peersConnected() < t.session.config.MaxPeerDial && len(t.dialers) < t.session.config.ParallelPeerDials {
 		addr, src := t.addrList.Pop()
 		if addr == nil {
-			//t.setNeedMorePeers(true)
+			t.setNeedMorePeers()
 			return
 		}
 		t.log.Debugln("pop addr:", addr.String(), t.addrList.Len())
@@ -68,31 +115,64 @@ func (t *torrent) dialAddresses() {
 		if _, ok := t.connectedPeers[addr.ID]; ok {
 			continue
 		}
-
-		s, err := t.session.host.NewStream(context.Background(), addr.ID, p2p.GenerateFileTransferProtocol(t.id))
-		if err != nil {
-			t.log.Errorln("create new stream error:", err)
+		if _, ok := t.dialers[addr.ID]; ok {
 			continue
 		}
-		t.log.Debugln("create new stream success!", s.Conn().RemotePeer().Pretty())
-		pe := peer.New(t.session.host, s, src, t.infoHash, t.session.config.PieceReadTimeout, t.session.config.RequestTimeout, t.session.config.MaxRequestsIn, t.session.bucketDownload, t.session.bucketUpload)
-		t.connectedPeers[addr.ID] = pe
-		t.startPeer(pe)
+		if t.session.peerBanned(addr.ID.String()) {
+			continue
+		}
+		// The address will be found again by the next discovery round.
+		if !t.dialBackoff.Allowed(addr.ID, now) {
+			continue
+		}
+
+		d := dialer.New(addr, src)
+		t.dialers[addr.ID] = d
+		go d.Run(t.session.host, t.session.transferProtocols, t.infoHash, t.session.config.PeerConnectTimeout, t.session.config.PeerHandshakeTimeout, t.dialerResultC)
 	}
 }
 
+func (t *torrent) handleDialDone(d *dialer.Dialer) {
+	id := d.Addr.ID
+	delete(t.dialers, id)
+	if d.Error != nil {
+		retryAt := t.dialBackoff.Failed(id, time.Now())
+		t.log.Debugf("cannot dial peer %s, retry after %s: %s", id.Pretty(), retryAt.Format(time.RFC3339), p2p.ConnectError(t.session.host, d.Error))
+		t.dialAddresses()
+		return
+	}
+	t.dialBackoff.Succeeded(id)
+	if _, ok := t.connectedPeers[id]; ok || t.completed {
+		t.log.Debugln("peer is not needed anymore, close stream:", id.Pretty())
+		d.Stream.Close()
+		t.dialAddresses()
+		return
+	}
+	t.log.Debugln("create new stream success!", id.Pretty())
+	pe := peer.New(t.session.host, d.Stream, d.Source, t.infoHash, t.session.config.PieceReadTimeout, t.session.config.RequestTimeout, t.session.config.MaxRequestsIn, t.downloadBuckets(), t.uploadBuckets())
+	t.connectedPeers[id] = pe
+	t.outgoingPeers[pe] = struct{}{}
+	t.startPeer(pe)
+}
+
 func (t *torrent)startPeer(pe *peer.Peer)  {
-	t.log.Debugln("start peer!", pe.Stream.Conn().RemotePeer().Pretty())
+	t.log.Debugln("start peer!", pe.String())
+	t.peers[pe] = struct{}{}
+	t.setPeerSpeedLimits(pe)
 	if t.info != nil {
 		pe.Bitfield = bitfield.New(t.info.NumPieces)
 	}
-	t.log.Debugln("run peer!", pe.Stream.Conn().RemotePeer().Pretty())
+	t.log.Debugln("run peer!", pe.String())
 	go pe.Run(t.messages, t.pieceMessagesC.SendC(), t.peerSnubbedC, t.peerDisconnectedC)
 	//todo metrcis
 	//t.session.metrics.Peers.Inc(1)
-	t.log.Debugln("send first message", pe.Stream.Conn().RemotePeer().Pretty())
+	t.log.Debugln("send first message", pe.String())
 	t.sendFirstMessage(pe)
-	//t.recentlySeen.Add(pe.Addr())
+	if !pe.IsBitTorrent() {
+		pi := t.pexAddrInfo(pe)
+		t.pexAddPeer(pi)
+		t.recentlySeen.Add(pi)
+	}
 }
 
 func (t *torrent) sendFirstMessage(p *peer.Peer) {
@@ -111,6 +191,9 @@ func (t *torrent) sendFirstMessage(p *peer.Peer) {
 		msg := peerprotocol.BitfieldMessage{Data: bitfieldData}
 		p.SendMessage(&msg)
 	}
+	if !p.ExtensionsEnabled {
+		return
+	}
 
 	var metadataSize uint32
 	if t.info != nil {
@@ -118,7 +201,12 @@ func (t *torrent) sendFirstMessage(p *peer.Peer) {
 	}
 
 	//send
-	extHandshakeMsg := peerprotocol.NewExtensionHandshake(metadataSize, "1.0", t.externalIP, t.session.config.MaxRequestsIn)
+	features := make([]string, 0, len(p.Features))
+	for f := range p.Features {
+		features = append(features, f)
+	}
+	sort.Strings(features)
+	extHandshakeMsg := peerprotocol.NewExtensionHandshake(metadataSize, "filechain/"+t.session.config.LibP2pProtocolVersion, t.externalIP, t.session.config.MaxRequestsIn, features)
 	msg := peerprotocol.ExtensionMessage{
 		ExtendedMessageID: peerprotocol.ExtensionIDHandshake,
 		Payload:           extHandshakeMsg,
@@ -129,7 +217,7 @@ func (t *torrent) sendFirstMessage(p *peer.Peer) {
 
 // Process messages received while we don't have metadata yet.
 func (t *torrent) processQueuedMessages() {
-	for _, pe := range t.connectedPeers {
+	for pe := range t.peers {
 		for _, msg := range pe.Messages {
 			pm := peer.Message{Peer: pe, Message: msg}
 			t.handlePeerMessage(pm)
@@ -0,0 +1,95 @@
+package filechain
+
+import (
+	"time"
+
+	"github.com/fichain/go-file/external/p2p"
+	"github.com/fichain/go-file/external/peer"
+	"github.com/fichain/go-file/external/peerprotocol"
+	"github.com/fichain/go-file/external/peersource"
+	"github.com/fichain/go-file/external/pexlist"
+	p2pPeer "github.com/libp2p/go-libp2p-core/peer"
+)
+
+// pexEnabled returns true if peers can be exchanged with pe.
+func (t *torrent) pexEnabled(pe *peer.Peer) bool {
+	if !t.session.config.PEXEnabled || !pe.HasFeature(p2p.FeaturePEX) {
+		return false
+	}
+	// Private torrents cannot be added with a magnet, so the torrent is not private if info is not downloaded yet.
+	return t.info == nil || !t.info.Private
+}
+
+// pexAddrInfo returns the addresses of pe to be sent to other peers.
+// Listen addresses learned by the host are preferred over the address of the connection,
+// because the remote port of an incoming connection cannot be dialed.
+func (t *torrent) pexAddrInfo(pe *peer.Peer) p2pPeer.AddrInfo {
+	pi := t.session.host.Peerstore().PeerInfo(pe.P2pID)
+	if len(pi.Addrs) == 0 {
+		pi.Addrs = append(pi.Addrs, pe.RemoteAddr())
+	}
+	return pi
+}
+
+func (t *torrent) startPEX(pe *peer.Peer) {
+	if _, ok := pe.ExtensionHandshake.M[peerprotocol.ExtensionKeyPEX]; !ok {
+		return
+	}
+	peers := make([]p2pPeer.AddrInfo, 0, len(t.connectedPeers))
+	for id, p := range t.connectedPeers {
+		if id != pe.P2pID {
+			peers = append(peers, t.pexAddrInfo(p))
+		}
+	}
+	pe.StartPEX(peers, &t.recentlySeen)
+}
+
+func (t *torrent) pexAddPeer(pi p2pPeer.AddrInfo) {
+	if !t.session.config.PEXEnabled {
+		return
+	}
+	for id, pe := range t.connectedPeers {
+		if pe.PEX != nil && id != pi.ID {
+			pe.PEX.Add(pi)
+		}
+	}
+}
+
+func (t *torrent) pexDropPeer(pi p2pPeer.AddrInfo) {
+	if !t.session.config.PEXEnabled {
+		return
+	}
+	for _, pe := range t.connectedPeers {
+		if pe.PEX != nil {
+			pe.PEX.Drop(pi)
+		}
+	}
+}
+
+func (t *torrent) handlePEXMessage(pe *peer.Peer, msg peerprotocol.ExtensionPEXMessage) {
+	if !t.pexEnabled(pe) {
+		return
+	}
+	if !pe.PEXReceived(time.Now()) {
+		pe.Logger().Debugln("pex message received too early, ignoring")
+		return
+	}
+	// Dropped peers may be still reachable, so they are tried like the added ones.
+	peers := make([]peerprotocol.PEXPeer, 0, len(msg.Added)+len(msg.Dropped))
+	peers = append(peers, msg.Added...)
+	peers = append(peers, msg.Dropped...)
+	addrs, err := pexlist.DecodePeers(peers)
+	if err != nil {
+		pe.Logger().Errorln("invalid pex message:", err)
+		return
+	}
+	filtered := addrs[:0]
+	for _, pi := range addrs {
+		if pi.ID != pe.P2pID && pi.ID != t.session.host.ID() {
+			filtered = append(filtered, pi)
+		}
+	}
+	if len(filtered) > 0 {
+		t.handleNewPeers(filtered, peersource.PEX)
+	}
+}
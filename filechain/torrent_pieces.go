@@ -17,18 +17,23 @@ func (t *torrent) checkCompletion() bool {
 	if t.completed {
 		return true
 	}
-	if !t.bitfield.All() {
+	if !t.wantedComplete() {
 		return false
 	}
 	t.completed = true
 	close(t.completeC)
 	//todo
-	for _, pe := range t.connectedPeers{
+	for pe := range t.peers {
 		if !pe.PeerInterested {
 			t.closePeer(pe)
 		}
 	}
 	t.addrList.Reset()
+	if t.btAddrList != nil {
+		t.btAddrList.Reset()
+	}
+	t.stopDHTAnnouncer()
+	t.stopWebseedDownloads()
 	for _, pd := range t.pieceDownloaders {
 		t.closePieceDownloader(pd)
 		pd.CancelPending()
@@ -0,0 +1,67 @@
+package filechain
+
+import (
+	"errors"
+	"sync/atomic"
+)
+
+// Priority of a torrent determines its share of session bandwidth and write cache
+// when it competes with other torrents.
+type Priority int
+
+const (
+	// PriorityLow torrents get a quarter of the share of a normal torrent.
+	PriorityLow Priority = -1
+	// PriorityNormal is the priority of new torrents.
+	PriorityNormal Priority = 0
+	// PriorityHigh torrents get four times the share of a normal torrent.
+	PriorityHigh Priority = 1
+)
+
+var errInvalidPriority = errors.New("invalid priority")
+
+func (p Priority) valid() bool {
+	return p >= PriorityLow && p <= PriorityHigh
+}
+
+// weight is the relative share of the priority.
+func (p Priority) weight() int {
+	switch p {
+	case PriorityLow:
+		return 1
+	case PriorityHigh:
+		return 16
+	default:
+		return 4
+	}
+}
+
+// String returns the name of the priority.
+func (p Priority) String() string {
+	switch p {
+	case PriorityLow:
+		return "low"
+	case PriorityNormal:
+		return "normal"
+	case PriorityHigh:
+		return "high"
+	default:
+		return "unknown"
+	}
+}
+
+// Priority returns the current priority of the torrent.
+func (t *torrent) Priority() Priority {
+	return Priority(atomic.LoadInt32(&t.priority))
+}
+
+// SetPriority changes the share of the torrent from session bandwidth and write cache.
+// Priority is saved in resume data.
+func (t *torrent) SetPriority(p Priority) error {
+	if !p.valid() {
+		return newInputError(errInvalidPriority)
+	}
+	atomic.StoreInt32(&t.priority, int32(p))
+	t.session.shareBandwidth()
+	return t.session.resumer.WritePriority(t.id, int(p))
+}
@@ -0,0 +1,132 @@
+package filechain
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// QueuePosition returns the position of the torrent in the session queue, starting from zero.
+func (t *torrent) QueuePosition() int {
+	return int(atomic.LoadInt32(&t.queuePosition))
+}
+
+// MoveToQueueTop moves the torrent to the top of the session queue, so it is the first torrent started when a slot frees up.
+// Queue position is saved in resume data.
+func (t *torrent) MoveToQueueTop() error {
+	return t.session.moveInQueue(t, true)
+}
+
+// MoveToQueueBottom moves the torrent to the bottom of the session queue.
+// Queue position is saved in resume data.
+func (t *torrent) MoveToQueueBottom() error {
+	return t.session.moveInQueue(t, false)
+}
+
+// handleStartCommand puts a stopped torrent in the queue if the queue is enabled, starts it otherwise.
+func (t *torrent) handleStartCommand() {
+	if t.session.config.queueEnabled() && t.errC == nil {
+		t.log.Info("torrent is queued")
+		t.queued = true
+		// Queued torrents are queued again when the session is resumed.
+		t.session.resumer.WriteStarted(t.id, true)
+		t.session.notifyQueue()
+		return
+	}
+	t.start()
+}
+
+// handleEnqueue stops the running torrent and puts it back in the queue.
+func (t *torrent) handleEnqueue() {
+	s := t.status()
+	if s == Stopping || s == Stopped || s == Queued {
+		return
+	}
+	t.log.Info("torrent is over the queue limits")
+	t.stop(nil)
+	t.queued = true
+}
+
+// handleDequeue starts the torrent when a slot in the queue is given to it.
+func (t *torrent) handleDequeue() {
+	if !t.queued || t.errC != nil {
+		return
+	}
+	t.log.Info("starting queued torrent")
+	t.start()
+	t.dialAddresses()
+	t.dialQueuedBTAddresses()
+}
+
+// queueState is the part of the torrent stats that is needed for processing the session queue.
+type queueState struct {
+	Status Status
+	// True if the torrent has all of its wanted pieces.
+	Completed bool
+	// True if the torrent does not transfer much data for a while.
+	Slow bool
+	// True if the queued torrent verifies the files that exist on disk when it is started.
+	Check bool
+}
+
+type queueStateRequest struct {
+	Response chan queueState
+}
+
+// queueState returns the state of the torrent for the session queue. It is much cheaper than Stats.
+func (t *torrent) queueState() queueState {
+	var st queueState
+	req := queueStateRequest{Response: make(chan queueState, 1)}
+	select {
+	case t.queueStateCommandC <- req:
+	case <-t.closeC:
+		return queueState{Status: Stopped}
+	}
+	select {
+	case st = <-req.Response:
+	case <-t.closeC:
+		st.Status = Stopped
+	}
+	return st
+}
+
+func (t *torrent) handleQueueState(req queueStateRequest) {
+	status := t.status()
+	req.Response <- queueState{
+		Status:    status,
+		Completed: status == Seeding || (t.info != nil && t.wantedComplete()),
+		Slow:      t.slow(status, int(t.downloadSpeed.Rate1()), int(t.uploadSpeed.Rate1())),
+		Check:     status == Queued && t.needsCheck(),
+	}
+}
+
+// needsCheck returns true if starting the torrent verifies its pieces.
+// Pieces are verified only if there is no bitfield yet and some of the files exist on disk.
+func (t *torrent) needsCheck() bool {
+	if t.info == nil || t.bitfield != nil {
+		return false
+	}
+	for _, f := range t.info.Files {
+		ok, err := t.storage.Exists(f.Path)
+		if err != nil || ok {
+			return true
+		}
+	}
+	return false
+}
+
+// slow returns true if the running torrent does not transfer much data for a while.
+func (t *torrent) slow(status Status, downloadSpeed, uploadSpeed int) bool {
+	var speed int
+	switch status {
+	case Downloading, DownloadingMetadata:
+		speed = downloadSpeed
+	case Seeding:
+		speed = uploadSpeed
+	default:
+		return false
+	}
+	if time.Since(t.startedAt) < t.session.config.SlowTorrentTimeout {
+		return false
+	}
+	return speed < t.session.config.SlowTorrentSpeed*1024
+}
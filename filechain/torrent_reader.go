@@ -0,0 +1,389 @@
+package filechain
+
+import (
+	"errors"
+	"io"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/fichain/go-file/internal/storage"
+)
+
+// readaheadPriority is the priority of the piece that is read soonest by the file readers.
+// Other pieces in the readahead windows get lower priorities in the order of their deadlines.
+// It is higher than the priorities of the files, so reading is not delayed by other downloads.
+const readaheadPriority = 1 << 20
+
+// defaultReadSpeed is used to calculate the deadlines of pieces until the read speed of a reader is measured, in bytes per second.
+const defaultReadSpeed = 1 << 20
+
+var (
+	errFileNotFound   = errors.New("file not found in torrent")
+	errReaderClosed   = errors.New("reader is closed")
+	errInvalidWhence  = errors.New("invalid whence")
+	errNegativeOffset = errors.New("negative offset")
+)
+
+type openFileRequest struct {
+	Path     string
+	Response chan openFileResponse
+}
+
+type openFileResponse struct {
+	Reader *fileReader
+	Error  error
+}
+
+// readerPosition is the read position of a file reader in torrent.
+type readerPosition struct {
+	Offset int64
+	// Read speed in bytes per second, measured when the position moves forward in the readahead window. Zero if not measured yet.
+	Speed     float64
+	UpdatedAt time.Time
+}
+
+// readerRequest is sent by a reader when its read position moves to another piece or when it is closed.
+type readerRequest struct {
+	Reader *fileReader
+	// Position of the reader in torrent. Negative value means the reader is closed.
+	Offset int64
+}
+
+// OpenFile returns a reader for the file at path. The path is relative to the top directory of a multi file torrent.
+// Metadata of the torrent must be downloaded before opening a file.
+// Read blocks until the pieces at the read position are downloaded and verified.
+// The pieces in the readahead window of the read position are downloaded before other pieces, even if the file is skipped.
+// Multiple readers can be open at the same time, but a reader must not be used by multiple goroutines concurrently.
+// The only exception is Close, which may be called while Read runs in another goroutine.
+// Closing the reader drops its priority boost and unblocks pending reads.
+func (t *torrent) OpenFile(path string) (io.ReadSeekCloser, error) {
+	req := openFileRequest{Path: path, Response: make(chan openFileResponse, 1)}
+	select {
+	case t.openFileCommandC <- req:
+	case <-t.closeC:
+		return nil, errClosed
+	}
+	select {
+	case resp := <-req.Response:
+		if resp.Error != nil {
+			return nil, resp.Error
+		}
+		return resp.Reader, nil
+	case <-t.closeC:
+		return nil, errClosed
+	}
+}
+
+func (t *torrent) handleOpenFile(req openFileRequest) {
+	if t.info == nil {
+		req.Response <- openFileResponse{Error: newInputError(errNoMetadata)}
+		return
+	}
+	name := filepath.Clean(filepath.FromSlash(req.Path))
+	if t.info.MultiFile {
+		name = filepath.Join(t.info.Name, name)
+	}
+	var offset int64
+	for _, f := range t.info.Files {
+		if f.Path == name {
+			r := &fileReader{
+				t:           t,
+				name:        f.Path,
+				begin:       offset,
+				length:      f.Length,
+				pieceLength: int64(t.info.PieceLength),
+				sentPiece:   -1,
+				closeC:      make(chan struct{}),
+			}
+			t.readers[r] = &readerPosition{Offset: offset, UpdatedAt: time.Now()}
+			t.updateReadahead()
+			req.Response <- openFileResponse{Reader: r}
+			return
+		}
+		offset += f.Length
+	}
+	req.Response <- openFileResponse{Error: newInputError(errFileNotFound)}
+}
+
+func (t *torrent) handleReaderUpdate(req readerRequest) {
+	if req.Offset < 0 {
+		delete(t.readers, req.Reader)
+		t.updateReadahead()
+		return
+	}
+	pos, ok := t.readers[req.Reader]
+	if !ok {
+		// Update is received after the reader is closed.
+		return
+	}
+	now := time.Now()
+	if d := req.Offset - pos.Offset; d > 0 && d <= t.session.config.ReadaheadSize {
+		if elapsed := now.Sub(pos.UpdatedAt).Seconds(); elapsed > 0 {
+			speed := float64(d) / elapsed
+			if pos.Speed == 0 {
+				pos.Speed = speed
+			} else {
+				pos.Speed = (3*pos.Speed + speed) / 4
+			}
+		}
+	}
+	pos.Offset = req.Offset
+	pos.UpdatedAt = now
+	t.updateReadahead()
+}
+
+// updateReadahead applies the readahead windows of the readers to the piece priorities.
+// Only the pieces that are in the old or the new windows are updated.
+func (t *torrent) updateReadahead() {
+	if t.info == nil {
+		return
+	}
+	old := t.readaheadPieces
+	t.readaheadPieces = t.readaheadPriorities()
+	var wantedChanged bool
+	for i := range old {
+		if _, ok := t.readaheadPieces[i]; !ok {
+			// Piece has left the windows.
+			wantedChanged = t.setPiecePriority(i) || wantedChanged
+		}
+	}
+	for i, p := range t.readaheadPieces {
+		oldPriority, ok := old[i]
+		if ok && oldPriority == p {
+			continue
+		}
+		skipped := t.setPiecePriority(i)
+		// Skipped piece is wanted only while it is in a window.
+		wantedChanged = wantedChanged || (skipped && !ok)
+	}
+	if wantedChanged {
+		t.handleWantedPiecesChanged()
+	}
+}
+
+// readaheadPriorities returns the priorities of the pieces in the readahead windows of the readers.
+// The deadline of a piece is the time until a reader reaches it at its read speed.
+// Pieces with earlier deadlines get higher priorities, so the piece needed soonest by any reader is picked first.
+func (t *torrent) readaheadPriorities() map[uint32]int {
+	if len(t.readers) == 0 {
+		return nil
+	}
+	pieceLength := int64(t.info.PieceLength)
+	deadlines := make(map[uint32]float64)
+	for r, pos := range t.readers {
+		if r.length == 0 {
+			continue
+		}
+		offset := pos.Offset
+		end := offset + t.session.config.ReadaheadSize
+		if fileEnd := r.begin + r.length; end > fileEnd {
+			end = fileEnd
+		}
+		speed := pos.Speed
+		if speed == 0 {
+			speed = defaultReadSpeed
+		}
+		first := uint32(offset / pieceLength)
+		last := first
+		if end > offset {
+			last = uint32((end - 1) / pieceLength)
+		}
+		for i := first; i <= last; i++ {
+			var distance int64
+			if begin := int64(i) * pieceLength; begin > offset {
+				distance = begin - offset
+			}
+			deadline := float64(distance) / speed
+			if d, ok := deadlines[i]; !ok || deadline < d {
+				deadlines[i] = deadline
+			}
+		}
+	}
+	pieces := make([]uint32, 0, len(deadlines))
+	for i := range deadlines {
+		pieces = append(pieces, i)
+	}
+	sort.Slice(pieces, func(i, j int) bool {
+		di, dj := deadlines[pieces[i]], deadlines[pieces[j]]
+		if di != dj {
+			return di < dj
+		}
+		return pieces[i] < pieces[j]
+	})
+	priorities := make(map[uint32]int, len(pieces))
+	for rank, i := range pieces {
+		priorities[i] = readaheadPriority - rank
+	}
+	return priorities
+}
+
+// pieceDone returns a channel that is closed when the next piece is downloaded.
+func (t *torrent) pieceDone() chan struct{} {
+	t.mPieceDoneC.Lock()
+	defer t.mPieceDoneC.Unlock()
+	return t.pieceDoneC
+}
+
+// notifyPieceDone wakes up the readers waiting for pieces.
+func (t *torrent) notifyPieceDone() {
+	t.mPieceDoneC.Lock()
+	close(t.pieceDoneC)
+	t.pieceDoneC = make(chan struct{})
+	t.mPieceDoneC.Unlock()
+}
+
+// hasPiece returns true if the piece is downloaded and verified. Safe to call from other goroutines.
+func (t *torrent) hasPiece(i uint32) bool {
+	t.mBitfield.RLock()
+	defer t.mBitfield.RUnlock()
+	return t.bitfield != nil && t.bitfield.Test(i)
+}
+
+// fileReader reads a file of the torrent while it is being downloaded.
+// Read and Seek must be called from one goroutine at a time, pos and sentPiece are not guarded.
+// Only Close may run concurrently with Read.
+type fileReader struct {
+	t           *torrent
+	name        string
+	begin       int64 // offset of the file in torrent
+	length      int64
+	pieceLength int64
+
+	pos       int64
+	sentPiece int64 // piece of the last position sent to the torrent
+
+	// Protects f from concurrent Read and Close.
+	m sync.Mutex
+	f storage.File
+
+	closeC    chan struct{}
+	closeOnce sync.Once
+}
+
+var _ io.ReadSeekCloser = (*fileReader)(nil)
+
+// Read reads from the file. It blocks until the piece at the read position is downloaded.
+func (r *fileReader) Read(p []byte) (int, error) {
+	select {
+	case <-r.closeC:
+		return 0, errReaderClosed
+	default:
+	}
+	if r.pos >= r.length {
+		return 0, io.EOF
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	offset := r.begin + r.pos
+	index := offset / r.pieceLength
+	err := r.sendPosition(offset, index)
+	if err != nil {
+		return 0, err
+	}
+	err = r.waitPiece(uint32(index))
+	if err != nil {
+		return 0, err
+	}
+	r.m.Lock()
+	defer r.m.Unlock()
+	select {
+	case <-r.closeC:
+		// Do not open the file after it is closed.
+		return 0, errReaderClosed
+	default:
+	}
+	if r.f == nil {
+		// File is created on disk when the first piece of it is written.
+		r.f, _, err = r.t.storage.Open(r.name, r.length)
+		if err != nil {
+			return 0, err
+		}
+	}
+	// Read until the end of the piece, next piece may not be downloaded yet.
+	n := (index+1)*r.pieceLength - offset
+	if left := r.length - r.pos; n > left {
+		n = left
+	}
+	if int64(len(p)) > n {
+		p = p[:n]
+	}
+	m, err := r.f.ReadAt(p, r.pos)
+	r.pos += int64(m)
+	if err == io.EOF && m == len(p) {
+		err = nil
+	}
+	return m, err
+}
+
+// Seek sets the position for the next Read. The priorities of the pieces are updated by the next Read.
+func (r *fileReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += r.pos
+	case io.SeekEnd:
+		offset += r.length
+	default:
+		return 0, errInvalidWhence
+	}
+	if offset < 0 {
+		return 0, errNegativeOffset
+	}
+	r.pos = offset
+	return offset, nil
+}
+
+// Close drops the priority boost of the reader and unblocks the pending Read.
+// It is safe to call from another goroutine while Read is running.
+func (r *fileReader) Close() error {
+	var err error
+	r.closeOnce.Do(func() {
+		close(r.closeC)
+		select {
+		case r.t.readerCommandC <- readerRequest{Reader: r, Offset: -1}:
+		case <-r.t.closeC:
+		}
+		r.m.Lock()
+		if r.f != nil {
+			err = r.f.Close()
+			r.f = nil
+		}
+		r.m.Unlock()
+	})
+	return err
+}
+
+// sendPosition tells the torrent that the read position is moved to another piece.
+func (r *fileReader) sendPosition(offset, index int64) error {
+	if index == r.sentPiece {
+		return nil
+	}
+	select {
+	case r.t.readerCommandC <- readerRequest{Reader: r, Offset: offset}:
+		r.sentPiece = index
+		return nil
+	case <-r.closeC:
+		return errReaderClosed
+	case <-r.t.closeC:
+		return errClosed
+	}
+}
+
+func (r *fileReader) waitPiece(i uint32) error {
+	for {
+		doneC := r.t.pieceDone()
+		if r.t.hasPiece(i) {
+			return nil
+		}
+		select {
+		case <-doneC:
+		case <-r.closeC:
+			return errReaderClosed
+		case <-r.t.closeC:
+			return errClosed
+		}
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"time"
 
 	"github.com/fichain/go-file/external/peer"
+	"github.com/fichain/go-file/internal/urldownloader"
 
 	"github.com/fichain/go-file/external/peersource"
 )
@@ -13,37 +14,54 @@ func (t *torrent) run() {
 	t.seedDurationTicker = time.NewTicker(time.Second)
 	defer t.seedDurationTicker.Stop()
 
-	t.unchokeTicker = time.NewTicker(10 * time.Second)
+	t.unchokeTicker = time.NewTicker(t.session.config.UnchokeInterval)
 	defer t.unchokeTicker.Stop()
 
+	t.connTicker = time.NewTicker(10 * time.Second)
+	defer t.connTicker.Stop()
+
 	for {
 		select {
-		case <-t.closeC:
-			//t.close()
-			close(t.doneC)
+		case <-t.closeCommandC:
+			t.exit()
 			return
 		case <-t.startCommandC:
-			t.start()
+			t.handleStartCommand()
 		case <-t.stopCommandC:
+			t.queued = false
 			t.stop(nil)
+		case <-t.enqueueCommandC:
+			t.handleEnqueue()
+		case <-t.dequeueCommandC:
+			t.handleDequeue()
+		case req := <-t.priorityCommandC:
+			t.handleSetFilePriorities(req)
+		case req := <-t.openFileCommandC:
+			t.handleOpenFile(req)
+		case req := <-t.readerCommandC:
+			t.handleReaderUpdate(req)
+		case req := <-t.infoCommandC:
+			req.Response <- t.info
 		//case <-t.announceCommandC:
 		//	t.setNeedMorePeers(true)
 		//case <-t.verifyCommandC:
 		//	t.handleVerifyCommand()
-		//case <-t.announcersStoppedC:
-		//	t.handleStopped()
+		case <-t.announcersStoppedC:
+			t.handleStopped()
 		case cmd := <-t.notifyErrorCommandC:
 			cmd.errCC <- t.errC
 		//case cmd := <-t.notifyListenCommandC:
 		//	cmd.portCC <- t.portC
-		//case req := <-t.statsCommandC:
-		//	req.Response <- t.stats()
-		//case req := <-t.trackersCommandC:
-		//	req.Response <- t.getTrackers()
-		//case req := <-t.peersCommandC:
-		//	req.Response <- t.getPeers()
-		//case req := <-t.webseedsCommandC:
-		//	req.Response <- t.getWebseeds()
+		case req := <-t.statsCommandC:
+			req.Response <- t.stats()
+		case req := <-t.queueStateCommandC:
+			t.handleQueueState(req)
+		case req := <-t.trackersCommandC:
+			req.Response <- t.getTrackers()
+		case req := <-t.peersCommandC:
+			req.Response <- t.getPeers()
+		case req := <-t.webseedsCommandC:
+			req.Response <- t.getWebseeds()
 		case p := <-t.allocatorProgressC:
 			t.log.Debugln("allocator progress!", p.AllocatedSize)
 			t.bytesAllocated = p.AllocatedSize
@@ -56,32 +74,46 @@ func (t *torrent) run() {
 			t.handleVerificationDone(ve)
 		case data := <-t.ramNotifyC:
 			t.startSinglePieceDownloader(data.(*peer.Peer))
-		//case addrs := <-t.addrsFromTrackers:
-		//	t.handleNewPeers(addrs, peersource.Tracker)
-		//case addrs := <-t.addPeersCommandC:
-		//	t.handleNewPeers(addrs, peersource.Manual)
+		case addrs := <-t.addrsFromTrackers:
+			t.handleNewBTPeers(addrs, peersource.Tracker)
+		case pis := <-t.p2pAddrsFromTrackers:
+			t.handleNewPeers(pis, peersource.Tracker)
+		case req := <-t.addPeersCommandC:
+			t.handleNewPeers(req.Peers, peersource.Manual)
+			t.handleNewBTPeers(req.BitTorrentPeers, peersource.Manual)
 		//case addrs := <-t.dhtPeersC:
 		//	t.handleNewPeers(addrs, peersource.DHT)
-		//case trackers := <-t.addTrackersCommandC:
-		//	t.handleNewTrackers(trackers)
-		//case conn := <-t.incomingConnC:
-		//	t.handleNewConnection(conn)
-		//case res := <-t.webseedPieceResultC.ReceiveC():
-		//	t.handleWebseedPieceResult(res.(*urldownloader.PieceResult))
-		//case src := <-t.webseedRetryC:
-		//	t.startPieceDownloaderForWebseed(src)
+		case urls := <-t.addTrackersCommandC:
+			t.handleNewTrackers(urls)
+		case id := <-t.closeBannedPeerCommandC:
+			t.closeBannedPeer(id)
+		case conn := <-t.incomingConnC:
+			t.handleNewConnection(conn)
+		case res := <-t.webseedPieceResultC.ReceiveC():
+			t.handleWebseedPieceResult(res.(*urldownloader.PieceResult))
+		case src := <-t.webseedRetryC:
+			t.startPieceDownloaderForWebseed(src)
 		case pw := <-t.pieceWriterResultC:
 			t.handlePieceWriteDone(pw)
-		//case now := <-t.seedDurationTicker.C:
-		//	t.updateSeedDuration(now)
-		//case pe := <-t.peerSnubbedC:
-		//	t.handlePeerSnubbed(pe)
-		//case <-t.unchokeTicker.C:
-		//	t.unchoker.TickUnchoke(t.getPeersForUnchoker(), t.completed)
-		//case ih := <-t.incomingHandshakerResultC:
-		//	t.handleIncomingHandshakeDone(ih)
-		//case oh := <-t.outgoingHandshakerResultC:
-		//	t.handleOutgoingHandshakeDone(oh)
+		case now := <-t.seedDurationTicker.C:
+			t.updateSeedDuration(now)
+			t.publishTransferState()
+			if t.checkSeedGoals(now) {
+				// Torrent is removed from the session.
+				return
+			}
+		case pe := <-t.peerSnubbedC:
+			t.handlePeerSnubbed(pe)
+		case <-t.unchokeTicker.C:
+			t.unchoker.TickUnchoke(t.getPeersForUnchoker(), t.completed)
+		case ih := <-t.incomingHandshakerResultC:
+			t.handleIncomingHandshakeDone(ih)
+		case oh := <-t.outgoingHandshakerResultC:
+			t.handleOutgoingHandshakeDone(oh)
+		case d := <-t.dialerResultC:
+			t.handleDialDone(d)
+		case <-t.connTicker.C:
+			t.updatePeerTags()
 		case pe := <-t.peerDisconnectedC:
 			t.closePeer(pe)
 		case pm := <-t.pieceMessagesC.ReceiveC():
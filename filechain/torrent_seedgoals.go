@@ -0,0 +1,187 @@
+package filechain
+
+import (
+	"errors"
+	"time"
+
+	"github.com/fichain/go-file/external/resumer/boltdbresumer"
+)
+
+// SeedAction is what is done to a torrent when one of its seeding goals is reached.
+type SeedAction int
+
+const (
+	// SeedActionStop stops the torrent.
+	SeedActionStop SeedAction = iota
+	// SeedActionRemove removes the torrent from the session. Downloaded files are kept.
+	SeedActionRemove
+	// SeedActionRemoveData removes the torrent from the session and deletes its downloaded files.
+	// Torrents made with Session.CreateFile are only removed, the files they share are kept.
+	SeedActionRemoveData
+)
+
+// String returns the name of the action.
+func (a SeedAction) String() string {
+	switch a {
+	case SeedActionStop:
+		return "stop"
+	case SeedActionRemove:
+		return "remove"
+	case SeedActionRemoveData:
+		return "remove with data"
+	default:
+		return "unknown"
+	}
+}
+
+// SeedGoals are the limits that end seeding of a torrent. Zero value of a limit means no limit.
+type SeedGoals struct {
+	// Ratio of uploaded bytes to downloaded bytes.
+	// If nothing is downloaded, for example the torrent is created in this session, the size of the torrent is used instead.
+	Ratio float64
+	// Maximum duration in Seeding status. See Stats.SeededFor.
+	SeedTime time.Duration
+	// Maximum duration in Seeding status without uploading any bytes.
+	IdleTime time.Duration
+	// Action to do when any of the goals is reached.
+	Action SeedAction
+}
+
+var errInvalidSeedGoals = errors.New("invalid seeding goals")
+
+func (g SeedGoals) validate() error {
+	if g.Ratio < 0 || g.SeedTime < 0 || g.IdleTime < 0 || g.Action < SeedActionStop || g.Action > SeedActionRemoveData {
+		return errInvalidSeedGoals
+	}
+	return nil
+}
+
+func (g *SeedGoals) spec() *boltdbresumer.SeedGoals {
+	if g == nil {
+		return nil
+	}
+	return &boltdbresumer.SeedGoals{Ratio: g.Ratio, SeedTime: g.SeedTime, IdleTime: g.IdleTime, Action: int(g.Action)}
+}
+
+func seedGoalsFromSpec(g *boltdbresumer.SeedGoals) *SeedGoals {
+	if g == nil {
+		return nil
+	}
+	return &SeedGoals{Ratio: g.Ratio, SeedTime: g.SeedTime, IdleTime: g.IdleTime, Action: SeedAction(g.Action)}
+}
+
+// StopReason tells why a torrent has stopped by itself.
+type StopReason int
+
+const (
+	// StopReasonNone is the reason of torrents that are running, or stopped by Stop or an error.
+	StopReasonNone StopReason = iota
+	// StopReasonDownloaded means the download has completed and the torrent is added with StopAfterDownload option.
+	StopReasonDownloaded
+	// StopReasonRatio means SeedGoals.Ratio is reached.
+	StopReasonRatio
+	// StopReasonSeedTime means SeedGoals.SeedTime is reached.
+	StopReasonSeedTime
+	// StopReasonIdleTime means SeedGoals.IdleTime is reached.
+	StopReasonIdleTime
+)
+
+// String returns the description of the reason.
+func (r StopReason) String() string {
+	switch r {
+	case StopReasonNone:
+		return ""
+	case StopReasonDownloaded:
+		return "download completed"
+	case StopReasonRatio:
+		return "seed ratio reached"
+	case StopReasonSeedTime:
+		return "seed time reached"
+	case StopReasonIdleTime:
+		return "idle time reached"
+	default:
+		return "unknown"
+	}
+}
+
+// SeedGoals returns the seeding goals of the torrent.
+// Torrents without their own goals use Config.SeedGoals.
+func (t *torrent) SeedGoals() SeedGoals {
+	t.mSeedGoals.RLock()
+	defer t.mSeedGoals.RUnlock()
+	if t.seedGoals != nil {
+		return *t.seedGoals
+	}
+	return t.session.config.SeedGoals
+}
+
+// SetSeedGoals changes the seeding goals of the torrent. nil value makes the torrent use Config.SeedGoals.
+// Goals are saved in resume data.
+func (t *torrent) SetSeedGoals(g *SeedGoals) error {
+	if g != nil {
+		if err := g.validate(); err != nil {
+			return newInputError(err)
+		}
+		g2 := *g
+		g = &g2
+	}
+	t.mSeedGoals.Lock()
+	t.seedGoals = g
+	t.mSeedGoals.Unlock()
+	return t.session.resumer.WriteSeedGoals(t.id, g.spec())
+}
+
+// seedRatio returns the ratio of uploaded bytes to downloaded bytes.
+func (t *torrent) seedRatio() float64 {
+	downloaded := t.bytesDownloaded.Count()
+	if downloaded == 0 && t.info != nil {
+		downloaded = t.info.Length
+	}
+	if downloaded == 0 {
+		return 0
+	}
+	return float64(t.bytesUploaded.Count()) / float64(downloaded)
+}
+
+// checkSeedGoals is called periodically from the run loop.
+// It does the action of the seeding goals if any of them is reached.
+// It returns true if the torrent is removed, the run loop must return then.
+func (t *torrent) checkSeedGoals(now time.Time) bool {
+	if t.status() != Seeding {
+		t.idleSince = time.Time{}
+		return false
+	}
+	uploaded := t.bytesUploaded.Count()
+	if t.idleSince.IsZero() || uploaded != t.idleUploaded {
+		t.idleSince = now
+		t.idleUploaded = uploaded
+	}
+
+	g := t.SeedGoals()
+	var reason StopReason
+	switch {
+	case g.Ratio > 0 && t.seedRatio() >= g.Ratio:
+		reason = StopReasonRatio
+	case g.SeedTime > 0 && time.Duration(t.seededFor.Count()) >= g.SeedTime:
+		reason = StopReasonSeedTime
+	case g.IdleTime > 0 && now.Sub(t.idleSince) >= g.IdleTime:
+		reason = StopReasonIdleTime
+	default:
+		return false
+	}
+	t.log.Infof("%s, action: %s", reason, g.Action)
+	t.stopReason = reason
+	switch g.Action {
+	case SeedActionRemove, SeedActionRemoveData:
+		// Torrent is closed and stops handling commands before it is deleted from the session.
+		t.exit()
+		err := t.session.removeTorrent(t, g.Action == SeedActionRemoveData)
+		if err != nil {
+			t.log.Errorln("cannot remove torrent:", err)
+		}
+		return true
+	default:
+		t.stop(nil)
+	}
+	return false
+}
@@ -0,0 +1,47 @@
+package filechain
+
+import (
+	"github.com/fichain/go-file/external/peer"
+)
+
+// handlePeerSnubbed is called when a peer does not send any requested block in RequestTimeout.
+// The peer keeps its download but it is not counted as running anymore,
+// so the piece can be requested from other peers in the meantime.
+func (t *torrent) handlePeerSnubbed(pe *peer.Peer) {
+	if _, ok := t.peers[pe]; !ok {
+		return
+	}
+	if pd, ok := t.pieceDownloaders[pe]; ok {
+		if _, choked := t.pieceDownloadersChoked[pe]; choked {
+			// Snub timer fired before the choke message is handled.
+			return
+		}
+		pe.Logger().Debugf("peer snubbed while downloading piece #%d", pd.Piece.Index)
+		pe.Snubbed = true
+		t.pieceDownloadersSnubbed[pe] = pd
+		if t.piecePicker != nil {
+			t.piecePicker.HandleSnubbed(pe, pd.Piece.Index)
+		}
+		t.startPieceDownloaders()
+	} else if id, ok := t.infoDownloaders[pe]; ok {
+		pe.Logger().Debugln("peer snubbed while downloading metadata")
+		pe.Snubbed = true
+		t.infoDownloadersSnubbed[pe] = id
+		t.startInfoDownloaders()
+	}
+}
+
+// handlePeerUnsnubbed is called when a snubbed peer sends a block again.
+func (t *torrent) handlePeerUnsnubbed(pe *peer.Peer) {
+	if !pe.Snubbed {
+		return
+	}
+	pe.Snubbed = false
+	if pd, ok := t.pieceDownloadersSnubbed[pe]; ok {
+		delete(t.pieceDownloadersSnubbed, pe)
+		if t.piecePicker != nil {
+			t.piecePicker.HandleUnsnubbed(pe, pd.Piece.Index)
+		}
+	}
+	delete(t.infoDownloadersSnubbed, pe)
+}
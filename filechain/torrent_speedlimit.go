@@ -0,0 +1,51 @@
+package filechain
+
+import (
+	"sync/atomic"
+
+	"github.com/fichain/go-file/external/peer"
+	"github.com/fichain/go-file/internal/speedlimit"
+)
+
+// SetSpeedLimits changes the download and upload speed limits of the torrent in KB/s.
+// Zero means no limit. Global limits of the session still apply.
+// Limits are saved in resume data.
+func (t *torrent) SetSpeedLimits(download, upload int64) error {
+	t.downloadLimit.SetRate(download * 1024)
+	t.uploadLimit.SetRate(upload * 1024)
+	return t.session.resumer.WriteSpeedLimits(t.id, download, upload)
+}
+
+// downloadBuckets returns the buckets that limit the download speed of the peers of the torrent.
+func (t *torrent) downloadBuckets() speedlimit.Buckets {
+	return speedlimit.Buckets{t.session.bucketDownload, t.downloadShare, t.downloadLimit}
+}
+
+// uploadBuckets returns the buckets that limit the upload speed of the peers of the torrent.
+func (t *torrent) uploadBuckets() speedlimit.Buckets {
+	return speedlimit.Buckets{t.session.bucketUpload, t.uploadShare, t.uploadLimit}
+}
+
+// setPeerSpeedLimits applies the per-peer speed limits in Config to a new peer.
+func (t *torrent) setPeerSpeedLimits(pe *peer.Peer) {
+	pe.DownloadLimit.SetRate(t.session.config.PeerSpeedLimitDownload * 1024)
+	pe.UploadLimit.SetRate(t.session.config.PeerSpeedLimitUpload * 1024)
+}
+
+// publishTransferState makes the transfer state of the torrent available to the session without a round trip to the run loop.
+func (t *torrent) publishTransferState() {
+	var downloading, uploading int32
+	if t.status() == Downloading {
+		downloading = 1
+	}
+	if len(t.peers) > 0 {
+		uploading = 1
+	}
+	atomic.StoreInt32(&t.downloading, downloading)
+	atomic.StoreInt32(&t.uploading, uploading)
+}
+
+// transferring returns the last published transfer state of the torrent. Safe to call from other goroutines.
+func (t *torrent) transferring() (downloading, uploading bool) {
+	return atomic.LoadInt32(&t.downloading) != 0, atomic.LoadInt32(&t.uploading) != 0
+}
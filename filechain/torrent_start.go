@@ -1,16 +1,19 @@
 package filechain
 
 import (
+	"context"
+
+	"github.com/fichain/go-file/external/advertiser"
+	"github.com/fichain/go-file/external/announcer"
 	"github.com/fichain/go-file/internal/allocator"
 	"github.com/fichain/go-file/internal/piecedownloader"
 	"github.com/fichain/go-file/internal/verifier"
-	"github.com/libp2p/go-libp2p-core/network"
 	"github.com/rcrowley/go-metrics"
 	"time"
 
 	"github.com/fichain/go-file/external/p2p"
 	"github.com/fichain/go-file/external/peer"
-	"github.com/fichain/go-file/external/peersource"
+	p2pPeer "github.com/libp2p/go-libp2p-core/peer"
 )
 
 func (t *torrent) start() {
@@ -23,6 +26,9 @@ func (t *torrent) start() {
 	// Stop announcing Stopped event if in "Stopping" state.
 	t.stopping = false
 	t.stopC = make(chan struct{})
+	t.stopReason = StopReasonNone
+	t.queued = false
+	t.startedAt = time.Now()
 
 	t.session.resumer.WriteStarted(t.id, true)
 
@@ -33,7 +39,7 @@ func (t *torrent) start() {
 	t.downloadSpeed = metrics.NewMeter()
 	t.uploadSpeed = metrics.NewMeter()
 
-	t.startStream()
+	t.startAcceptor()
 	t.startAdvertise()
 	if t.info != nil {
 		if t.pieces != nil {
@@ -53,46 +59,6 @@ func (t *torrent) start() {
 		t.startAnnouncers()
 		t.startInfoDownloaders()
 	}
-	t.startPeriodDht()
-}
-
-func (t *torrent) startPeriodDht()  {
-	t.log.Debugln("start period peers")
-	go func() {
-		ticker := time.NewTicker(60 * time.Second)
-
-		for {
-			select {
-			case <-t.completeC:
-				t.log.Debugln("torrent complete, close dht find providers!")
-				return
-			case <-t.stopC:
-				t.log.Debugln("torrent stop, close dht find providers!")
-				return
-			case <-ticker.C:
-				t.log.Debugln("start Announcers")
-				id := t.id
-				peerAddrs, err := p2p.FindProviders(t.session.routeDiscovery, id, 0)
-				if err != nil {
-					t.log.Errorln("find peers error!", err)
-				} else {
-					if len(peerAddrs) != 0 {
-						t.incoimgPeersC <- peerAddrs
-					}
-				}
-			}
-		}
-
-	}()
-
-}
-
-func (t *torrent) startStream()  {
-	t.log.Debugln("startStream")
-	t.session.host.SetStreamHandler(p2p.GenerateFileTransferProtocol(t.id), func(stream network.Stream) {
-		t.incomingStreamC <- stream
-	})
-
 }
 
 func (t *torrent) startInfoDownloaders() {
@@ -141,7 +107,7 @@ func (t *torrent) startAllocator() {
 		panic("allocator exists")
 	}
 	t.allocator = allocator.New()
-	go t.allocator.Run(t.info, t.storage, t.allocatorProgressC, t.allocatorResultC)
+	go t.allocator.Run(t.info, t.storage, t.skippedFiles(), t.allocatorProgressC, t.allocatorResultC)
 }
 //
 //func (t *torrent) addFixedPeers() {
@@ -153,26 +119,37 @@ func (t *torrent) startAllocator() {
 
 func (t *torrent) startAdvertise()  {
 	t.log.Debugln("startAdvertise")
-	err := p2p.Advertise(t.session.routeDiscovery, t.id)
-	if err != nil {
-		t.log.Errorln("advertise error!", err)
-	} else {
-		t.log.Infoln("advertise success")
+	if t.advertiser != nil {
+		return
 	}
+	advertise := func(ctx context.Context) (time.Duration, error) {
+		return p2p.Advertise(ctx, t.session.routeDiscovery, t.id)
+	}
+	t.advertiser = advertiser.New(advertise, t.session.config.DHTAdvertiseMinBackoff, t.session.config.DHTAdvertiseMaxBackoff, t.log)
+	go t.advertiser.Run()
 }
 
 func (t *torrent) startAnnouncers() {
 	t.log.Debugln("startAnnouncers")
-	id := t.id
-	peerAddrs, err := p2p.FindProviders(t.session.routeDiscovery, id, 0)
-	if err != nil {
-		t.log.Errorln("find peers error!", err)
-	} else {
-		if len(peerAddrs) != 0 {
-			t.handleNewPeers(peerAddrs, peersource.DHT)
-		}
+	// Seeders announce to trackers so that leechers can find them.
+	t.startTrackerAnnouncers()
+	// Seeders do not look for peers in DHT, they wait for incoming connections.
+	if t.dhtAnnouncer != nil || t.completed {
+		return
 	}
-	//t.session.routeDiscovery.Advertise(context.Background(), hex.EncodeToString(t.infoHash[:]))
+	findPeers := func(ctx context.Context) (<-chan p2pPeer.AddrInfo, error) {
+		return p2p.FindPeers(ctx, t.session.routeDiscovery, t.id, 0)
+	}
+	t.dhtAnnouncer = announcer.NewDHTAnnouncer(t.peersNeeded())
+	go t.dhtAnnouncer.Run(
+		findPeers,
+		t.incoimgPeersC,
+		t.session.config.DHTAnnounceInterval,
+		t.session.config.DHTMinAnnounceInterval,
+		t.session.config.DHTQueryTimeout,
+		t.session.config.MaxPeerDial,
+		t.log,
+	)
 }
 
 func (t *torrent) startPieceDownloaders() {
@@ -180,11 +157,12 @@ func (t *torrent) startPieceDownloaders() {
 		return
 	}
 	//t.log.Debugln("start piece download!")
-	for _, pe := range t.connectedPeers {
+	for pe := range t.peers {
 		if !pe.Downloading {
 			t.startPieceDownloaderFor(pe)
 		}
 	}
+	t.startWebseedDownloaders()
 }
 
 func (t *torrent) startPieceDownloaderFor(pe *peer.Peer) {
@@ -196,7 +174,7 @@ func (t *torrent) startPieceDownloaderFor(pe *peer.Peer) {
 		t.startSinglePieceDownloader(pe)
 		return
 	}
-	ok := t.session.ram.Request(t.id, pe, int64(t.info.PieceLength), t.ramNotifyC, pe.Done())
+	ok := t.session.ram.Request(t.id, pe, int64(t.info.PieceLength), t.Priority().weight(), t.ramNotifyC, pe.Done())
 	if ok {
 		t.startSinglePieceDownloader(pe)
 	}
@@ -206,7 +184,7 @@ func (t *torrent) startSinglePieceDownloader(pe *peer.Peer) {
 	var started bool
 	defer func() {
 		if !started && t.session.ram != nil {
-			t.session.ram.Release(int64(t.info.PieceLength))
+			t.session.ram.Release(t.id, int64(t.info.PieceLength))
 		}
 	}()
 	if t.status() != Downloading {
@@ -222,9 +200,10 @@ func (t *torrent) startSinglePieceDownloader(pe *peer.Peer) {
 	if _, ok := t.pieceDownloaders[pe]; ok {
 		panic("peer already has a piece downloader")
 	}
-	t.log.Debugf("requesting piece #%d from peer %s", pi.Index, pe.Stream.Conn().RemotePeer().Pretty())
+	t.log.Debugf("requesting piece #%d from peer %s", pi.Index, pe.String())
 	t.pieceDownloaders[pe] = pd
 	pe.Downloading = true
+	t.protectPeer(pe)
 	pd.RequestBlocks(t.maxAllowedRequests(pe))
 	pe.ResetSnubTimer()
 	started = true
@@ -1,8 +1,11 @@
 package filechain
 
 import (
+	"sort"
 	"time"
 
+	"github.com/fichain/go-file/external/advertiser"
+	"github.com/fichain/go-file/external/peersource"
 	"github.com/fichain/go-file/internal/stringutil"
 )
 
@@ -21,6 +24,7 @@ type Stats struct {
 		Have uint32
 		// Number of pieces that need to be downloaded. Some of them may be being downloaded.
 		// Pieces that are being downloaded may counted as missing until they are downloaded and passed hash check.
+		// Pieces of skipped files are not counted.
 		Missing uint32
 		// Number of unique pieces available on swarm.
 		// If this number is less then the number of total pieces, the download may never finish.
@@ -32,8 +36,9 @@ type Stats struct {
 		// Bytes that are downloaded and passed hash check.
 		Completed int64
 		// The number of bytes that is needed to complete all missing pieces.
+		// Pieces of skipped files are not counted.
 		Incomplete int64
-		// The number of total bytes of files in torrent.  Total = Completed + Incomplete
+		// The number of total bytes of files in torrent. Total = Completed + Incomplete if no file is skipped.
 		Total int64
 		// Downloaded is the number of bytes downloaded from swarm.
 		// Because some pieces may be downloaded more than once, this number may be greater than completed bytes.
@@ -52,6 +57,10 @@ type Stats struct {
 		Incoming int
 		// Number of peers that we have connected to.
 		Outgoing int
+		// Number of outgoing connections that are being dialed.
+		Dialing int
+		// Number of BitTorrent connections that are doing the protocol handshake.
+		Handshaking int
 	}
 	Addresses struct {
 		// Total number of peer addresses that are ready to be connected.
@@ -62,6 +71,8 @@ type Stats struct {
 		DHT int
 		// Peers found via peer exchange.
 		PEX int
+		// Addresses of BitTorrent peers.
+		BitTorrent int
 	}
 	Downloads struct {
 		// Number of active piece downloads.
@@ -72,6 +83,8 @@ type Stats struct {
 		Snubbed int
 		// Number of piece downloads in choked state.
 		Choked int
+		// Number of webseed sources that are being downloaded from. Not counted in Total.
+		Webseed int
 	}
 	MetadataDownloads struct {
 		// Number of active metadata downloads.
@@ -94,11 +107,42 @@ type Stats struct {
 		// Uploaded bytes per second.
 		Upload int
 	}
+	// Share of the torrent from session bandwidth and write cache.
+	Priority Priority
+	// Effective seeding goals of the torrent.
+	SeedGoals SeedGoals
+	// Why the torrent has stopped by itself, if so.
+	StopReason StopReason
+	// Position of the torrent in the session queue, starting from zero.
+	QueuePosition int
+	// True if the torrent is running for Config.SlowTorrentTimeout and its speed is under Config.SlowTorrentSpeed.
+	Slow bool
+	// Effective speed limits of the torrent in KB/s, the lowest of the session, priority share and torrent limits.
+	// Zero means no limit.
+	SpeedLimit struct {
+		Download int64
+		Upload   int64
+	}
+	Advertise struct {
+		// Status of the provider record in DHT.
+		Status advertiser.Status
+		// Error of the last advertise. Advertise is retried with backoff after an error.
+		Error error
+		// Time of the last and the next advertise.
+		Last time.Time
+		Next time.Time
+		// Time when the published provider record expires. Zero if the torrent has never been advertised.
+		ExpiresAt time.Time
+	}
+	// HTTP sources of the torrent with their download speeds.
+	Webseeds []Webseed
+	// TCP port that is listened for BitTorrent peers. Zero if not listening.
+	Port int
 	// Time remaining to complete download. nil value means infinity.
 	ETA *time.Duration
 }
 
-func (t *torrent) DataStats() Stats {
+func (t *torrent) stats() Stats {
 	t.updateSeedDuration(time.Now())
 
 	var s Stats
@@ -106,9 +150,19 @@ func (t *torrent) DataStats() Stats {
 	s.Status = t.status()
 	s.Error = t.lastError
 	s.Addresses.Total = t.addrList.Len()
-	s.Peers.Total = len(t.connectedPeers)
+	s.Addresses.Tracker = t.addrList.LenSource(peersource.Tracker)
+	s.Addresses.DHT = t.addrList.LenSource(peersource.DHT)
+	s.Addresses.PEX = t.addrList.LenSource(peersource.PEX)
+	if t.btAddrList != nil {
+		s.Addresses.BitTorrent = t.btAddrList.Len()
+		s.Addresses.Total += s.Addresses.BitTorrent
+	}
+	s.Peers.Total = len(t.peers)
 	s.Peers.Incoming = len(t.incomingPeers)
 	s.Peers.Outgoing = len(t.outgoingPeers)
+	s.Peers.Dialing = len(t.dialers) + len(t.outgoingHandshakers)
+	s.Peers.Handshaking = len(t.incomingHandshakers) + len(t.outgoingHandshakers)
+	s.Port = t.port
 	s.MetadataDownloads.Total = len(t.infoDownloaders)
 	s.MetadataDownloads.Snubbed = len(t.infoDownloadersSnubbed)
 	s.MetadataDownloads.Running = len(t.infoDownloaders) - len(t.infoDownloadersSnubbed)
@@ -116,6 +170,8 @@ func (t *torrent) DataStats() Stats {
 	s.Downloads.Snubbed = len(t.pieceDownloadersSnubbed)
 	s.Downloads.Choked = len(t.pieceDownloadersChoked)
 	s.Downloads.Running = len(t.pieceDownloaders) - len(t.pieceDownloadersChoked) - len(t.pieceDownloadersSnubbed)
+	s.Downloads.Webseed = t.webseedDownloads()
+	s.Webseeds = t.getWebseeds()
 	s.Pieces.Available = t.avaliablePieceCount()
 	s.Bytes.Downloaded = t.bytesDownloaded.Count()
 	s.Bytes.Uploaded = t.bytesUploaded.Count()
@@ -125,11 +181,26 @@ func (t *torrent) DataStats() Stats {
 	s.Pieces.Checked = t.checkedPieces
 	s.Speed.Download = int(t.downloadSpeed.Rate1())
 	s.Speed.Upload = int(t.uploadSpeed.Rate1())
+	s.Priority = t.Priority()
+	s.SeedGoals = t.SeedGoals()
+	s.StopReason = t.stopReason
+	s.QueuePosition = t.QueuePosition()
+	s.Slow = t.slow(s.Status, s.Speed.Download, s.Speed.Upload)
+	s.SpeedLimit.Download = t.downloadBuckets().Rate() / 1024
+	s.SpeedLimit.Upload = t.uploadBuckets().Rate() / 1024
+	if t.advertiser != nil {
+		as := t.advertiser.Stats()
+		s.Advertise.Status = as.Status
+		s.Advertise.Error = as.Error
+		s.Advertise.Last = as.LastAdvertise
+		s.Advertise.Next = as.NextAdvertise
+		s.Advertise.ExpiresAt = as.ExpiresAt
+	}
 
 	if t.info != nil {
 		s.Bytes.Total = t.info.Length
 		s.Bytes.Completed = t.bytesComplete()
-		s.Bytes.Incomplete = s.Bytes.Total - s.Bytes.Completed
+		s.Pieces.Missing, s.Bytes.Incomplete = t.wantedIncomplete()
 
 		s.Name = t.info.Name
 		s.PieceLength = t.info.PieceLength
@@ -140,7 +211,6 @@ func (t *torrent) DataStats() Stats {
 	s.Name = stringutil.Printable(s.Name)
 	if t.bitfield != nil {
 		s.Pieces.Have = t.bitfield.Count()
-		s.Pieces.Missing = s.Pieces.Total - s.Pieces.Have
 	}
 	if s.Status == Downloading {
 		bps := int64(s.Speed.Download)
@@ -202,3 +272,32 @@ func (t *torrent) updateSeedDuration(now time.Time) {
 	t.seededFor.Inc(int64(now.Sub(t.seedDurationUpdatedAt)))
 	t.seedDurationUpdatedAt = now
 }
+
+func (t *torrent) getPeers() []Peer {
+	var peers []Peer
+	for pe := range t.peers {
+		p := Peer{
+			ID:                 pe.P2pID,
+			Client:             pe.Client(),
+			Addr:               pe.RemoteAddr(),
+			Source:             pe.Source,
+			ProtocolVersion:    pe.ProtocolVersion,
+			ConnectedAt:        pe.ConnectedAt,
+			Downloading:        pe.Downloading,
+			ClientInterested:   pe.ClientInterested,
+			ClientChoking:      pe.ClientChoking,
+			PeerInterested:     pe.PeerInterested,
+			PeerChoking:        pe.PeerChoking,
+			OptimisticUnchoked: pe.OptimisticUnchoked,
+			Snubbed:            pe.Snubbed,
+			DownloadSpeed:      pe.DownloadSpeed(),
+			UploadSpeed:        pe.UploadSpeed(),
+		}
+		for f := range pe.Features {
+			p.Features = append(p.Features, f)
+		}
+		sort.Strings(p.Features)
+		peers = append(peers, p)
+	}
+	return peers
+}
@@ -20,6 +20,9 @@ const (
 	Seeding
 	// Stopping the torrent. This is the status after Stop() is called. All peers are disconnected and files are closed. A stop event sent to all trackers. After trackers responded the torrent switches into Stopped state.
 	Stopping
+	// Queued indicates that the torrent is started but it is waiting for a slot in the session queue.
+	// See Config.MaxActiveDownloads.
+	Queued
 )
 
 func (s Status) String() string {
@@ -31,12 +34,15 @@ func (s Status) String() string {
 		Downloading:         "Downloading",
 		Seeding:             "Seeding",
 		Stopping:            "Stopping",
+		Queued:              "Queued",
 	}
 	return m[s]
 }
 
 func (t *torrent) status() Status {
 	switch {
+	case t.errC == nil && t.queued:
+		return Queued
 	case t.errC == nil:
 		return Stopped
 	case t.stopping:
@@ -1,14 +1,14 @@
 package filechain
 
 import (
-	//"github.com/fichain/go-file/internal/handshaker/incominghandshaker"
-	//"github.com/fichain/go-file/internal/handshaker/outgoinghandshaker"
-	//"github.com/fichain/go-file/internal/tracker"
+	trackerannouncer "github.com/fichain/go-file/internal/announcer"
+	"github.com/fichain/go-file/external/dialer"
+	p2pPeer "github.com/libp2p/go-libp2p-core/peer"
 	"github.com/rcrowley/go-metrics"
 )
 
 func (t *torrent) handleStopped() {
-	//t.stoppedEventAnnouncer = nil
+	t.stoppedEventAnnouncer = nil
 	t.errC <- t.lastError
 	t.errC = nil
 	t.portC = nil
@@ -18,11 +18,12 @@ func (t *torrent) handleStopped() {
 	} else {
 		t.log.Info("torrent has stopped")
 	}
+	t.session.notifyQueue()
 }
 
 func (t *torrent) stop(err error) {
 	s := t.status()
-	if s == Stopping || s == Stopped {
+	if s == Stopping || s == Stopped || s == Queued {
 		return
 	}
 
@@ -32,8 +33,17 @@ func (t *torrent) stop(err error) {
 		t.log.Error(err)
 	}
 
+	t.stopAdvertiser()
+	t.stopDHTAnnouncer()
+	announcedTrackers := t.stopTrackerAnnouncers()
+	// Fields must be read before the port is released and the data is closed.
+	announcerFields := t.announcerFields()
+	t.stopDialers()
+	t.stopAcceptor()
+	t.stopHandshakers()
 	t.stopPeers()
 	t.stopPiecedownloaders()
+	t.stopWebseedDownloads()
 	t.stopInfoDownloaders()
 
 	if t.bitfield != nil {
@@ -52,9 +62,26 @@ func (t *torrent) stop(err error) {
 	t.stopping = true
 	close(t.stopC)
 
-	t.handleStopped()
-
 	t.addrList.Reset()
+
+	// The torrent stays in Stopping state until the stopped event is announced to trackers.
+	// There is no need to announce if the torrent is being closed.
+	if len(announcedTrackers) == 0 || err == errClosed {
+		t.handleStopped()
+		return
+	}
+	t.stoppedEventAnnouncer = trackerannouncer.NewStopAnnouncer(announcedTrackers, announcerFields, t.session.config.TrackerStopTimeout, t.announcersStoppedC, t.log)
+	go t.stoppedEventAnnouncer.Run()
+}
+
+// stopAdvertiser stops refreshing the provider record of the torrent.
+// DHT has no way to delete a provider record. Streams of peers that find the remaining record are rejected.
+func (t *torrent) stopAdvertiser() {
+	t.log.Debugln("stopping advertiser")
+	if t.advertiser != nil {
+		t.advertiser.Close()
+		t.advertiser = nil
+	}
 }
 
 func (t *torrent) stopAllocator() {
@@ -74,9 +101,13 @@ func (t *torrent) stopVerifier() {
 }
 
 func (t *torrent) stopWebseedDownloads() {
-	//for _, src := range t.webseedSources {
-	//	t.closeWebseedDownloader(src)
-	//}
+	t.log.Debugln("stopping webseed downloads")
+	if t.piecePicker == nil {
+		return
+	}
+	for _, src := range t.webseedSources {
+		t.closeWebseedDownloader(src)
+	}
 }
 
 func (t *torrent) resetSpeeds() {
@@ -101,20 +132,26 @@ func (t *torrent) closeData() {
 	t.checkedPieces = 0
 }
 
-//func (t *torrent) stopPeriodicalAnnouncers() {
-//	t.log.Debugln("stopping announcers")
-//	for _, an := range t.announcers {
-//		an.Close()
-//	}
-//	if t.dhtAnnouncer != nil {
-//		t.dhtAnnouncer.Close()
-//		t.dhtAnnouncer = nil
-//	}
-//}
+func (t *torrent) stopDHTAnnouncer() {
+	t.log.Debugln("stopping dht announcer")
+	if t.dhtAnnouncer != nil {
+		t.dhtAnnouncer.Close()
+		t.dhtAnnouncer = nil
+	}
+}
+
+func (t *torrent) stopDialers() {
+	t.log.Debugln("stopping dialers")
+	for _, d := range t.dialers {
+		d.Close()
+	}
+	t.dialers = make(map[p2pPeer.ID]*dialer.Dialer)
+	t.dialBackoff.Reset()
+}
 
 func (t *torrent) stopPeers() {
 	t.log.Debugln("closing peer connections")
-	for _, p := range t.connectedPeers {
+	for p := range t.peers {
 		t.closePeer(p)
 	}
 }
@@ -0,0 +1,153 @@
+package filechain
+
+import (
+	"math"
+	"strconv"
+
+	trackerannouncer "github.com/fichain/go-file/internal/announcer"
+	"github.com/fichain/go-file/internal/tracker"
+	p2pPeer "github.com/libp2p/go-libp2p-core/peer"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// announcerFields returns the values sent to trackers in announce requests.
+// It is called from announcer goroutines.
+func (t *torrent) announcerFields() tracker.Torrent {
+	tr := tracker.Torrent{
+		InfoHash:        t.infoHash,
+		PeerID:          t.peerID,
+		Port:            t.port,
+		BytesDownloaded: t.bytesDownloaded.Count(),
+		BytesUploaded:   t.bytesUploaded.Count(),
+	}
+	h := t.session.host
+	tr.Multiaddrs, _ = p2pPeer.AddrInfoToP2pAddrs(&p2pPeer.AddrInfo{ID: h.ID(), Addrs: h.Addrs()})
+	if tr.Port == 0 {
+		// Trackers reject announces with port 0. Without BitTorrent the libp2p TCP port is sent,
+		// other peers reach us with the multiaddrs.
+		tr.Port = tcpPort(h.Addrs())
+	}
+	t.mBitfield.RLock()
+	if t.bitfield == nil {
+		tr.BytesLeft = math.MaxUint32
+	} else {
+		tr.BytesLeft = t.info.Length - t.bytesComplete()
+	}
+	t.mBitfield.RUnlock()
+	return tr
+}
+
+// tcpPort returns the first TCP port in addrs, 0 if there is none.
+func tcpPort(addrs []ma.Multiaddr) int {
+	for _, addr := range addrs {
+		s, err := addr.ValueForProtocol(ma.P_TCP)
+		if err != nil {
+			continue
+		}
+		port, err := strconv.Atoi(s)
+		if err == nil {
+			return port
+		}
+	}
+	return 0
+}
+
+func (t *torrent) startTrackerAnnouncers() {
+	if len(t.announcers) > 0 {
+		return
+	}
+	for _, tr := range t.trackers {
+		t.startNewAnnouncer(tr)
+	}
+}
+
+func (t *torrent) startNewAnnouncer(tr tracker.Tracker) {
+	an := trackerannouncer.NewPeriodicalAnnouncer(
+		tr,
+		t.session.config.TrackerNumWant,
+		t.session.config.TrackerMinAnnounceInterval,
+		t.announcerFields,
+		t.completeC,
+		t.addrsFromTrackers,
+		t.p2pAddrsFromTrackers,
+		t.log,
+	)
+	t.announcers = append(t.announcers, an)
+	go an.Run()
+}
+
+// handleNewTrackers adds each URL as a new tier. URLs that are already in the torrent are skipped.
+func (t *torrent) handleNewTrackers(urls []string) {
+	existing := make(map[string]struct{})
+	for _, tier := range t.rawTrackers {
+		for _, u := range tier {
+			existing[u] = struct{}{}
+		}
+	}
+	private := t.info != nil && t.info.Private
+	running := len(t.announcers) > 0
+	var added bool
+	for _, u := range urls {
+		if _, ok := existing[u]; ok {
+			continue
+		}
+		tr, err := t.session.getTracker(u, private)
+		if err != nil {
+			t.log.Warningln("invalid tracker:", err)
+			continue
+		}
+		existing[u] = struct{}{}
+		t.trackers = append(t.trackers, tr)
+		t.rawTrackers = append(t.rawTrackers, []string{u})
+		added = true
+		if running {
+			t.startNewAnnouncer(tr)
+		}
+	}
+	if !added {
+		return
+	}
+	err := t.session.resumer.WriteTrackers(t.id, t.rawTrackers)
+	if err != nil {
+		t.log.Errorln("cannot write trackers:", err)
+	}
+	if !running {
+		if status := t.status(); status != Stopped && status != Stopping && status != Queued {
+			t.startTrackerAnnouncers()
+		}
+	}
+}
+
+// stopTrackerAnnouncers stops periodical announces and returns the trackers that have been announced to.
+func (t *torrent) stopTrackerAnnouncers() []tracker.Tracker {
+	trackers := make([]tracker.Tracker, 0, len(t.announcers))
+	for _, an := range t.announcers {
+		an.Close()
+		if an.HasAnnounced {
+			trackers = append(trackers, an.Tracker)
+		}
+	}
+	t.announcers = nil
+	return trackers
+}
+
+func (t *torrent) getTrackers() []Tracker {
+	trackers := make([]Tracker, 0, len(t.trackers))
+	for i, tr := range t.trackers {
+		tt := Tracker{URL: tr.URL()}
+		if i < len(t.announcers) {
+			st := t.announcers[i].Stats()
+			tt.Status = TrackerStatus(st.Status)
+			tt.Seeders = st.Seeders
+			tt.Leechers = st.Leechers
+			tt.Warning = st.Warning
+			tt.LastAnnounce = st.LastAnnounce
+			tt.NextAnnounce = st.NextAnnounce
+			if st.Error != nil {
+				tt.Error = &AnnounceError{err: st.Error}
+			}
+		}
+		trackers = append(trackers, tt)
+	}
+	return trackers
+}
@@ -11,7 +11,7 @@ import (
 func (t *torrent) handleVerifyCommand() {
 	t.log.Info("verifying")
 	t.doVerify = true
-	if t.status() == Stopped {
+	if s := t.status(); s == Stopped || s == Queued {
 		t.bitfield = nil
 		t.start()
 	} else {
@@ -34,6 +34,7 @@ func (t *torrent) handleVerificationDone(ve *verifier.Verifier) {
 	t.mBitfield.Lock()
 	t.bitfield = ve.Bitfield
 	t.mBitfield.Unlock()
+	t.notifyPieceDone()
 
 	// Save the bitfield to resume db.
 	//err := t.writeBitfield()
@@ -55,7 +56,7 @@ func (t *torrent) handleVerificationDone(ve *verifier.Verifier) {
 	}
 
 	// We may detect missing pieces after verification. Then, status must be set from Seeding to Downloading.
-	if !t.bitfield.All() {
+	if !t.wantedComplete() {
 		t.completed = false
 		t.completeC = make(chan struct{})
 	}
@@ -68,7 +69,7 @@ func (t *torrent) handleVerificationDone(ve *verifier.Verifier) {
 	}
 
 	//Tell connected peers that pieces we have.
-	for _, pe := range t.connectedPeers {
+	for pe := range t.peers {
 		for _, msg := range haveMessages {
 			pe.SendMessage(msg)
 		}
@@ -78,6 +79,7 @@ func (t *torrent) handleVerificationDone(ve *verifier.Verifier) {
 	t.log.Debugln("complete?", t.checkCompletion())
 	if t.checkCompletion() && t.stopAfterDownload {
 		t.log.Infoln("stop after download complete!")
+		t.stopReason = StopReasonDownloaded
 		t.stop(nil)
 		return
 	}
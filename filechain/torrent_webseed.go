@@ -0,0 +1,145 @@
+package filechain
+
+import (
+	"errors"
+	"time"
+
+	"github.com/fichain/go-file/internal/piecewriter"
+	"github.com/fichain/go-file/internal/urldownloader"
+	"github.com/fichain/go-file/internal/webseedsource"
+	"github.com/rcrowley/go-metrics"
+)
+
+var errCorruptWebseedPiece = errors.New("corrupt piece from webseed")
+
+// startWebseedDownloaders starts a download for each idle webseed source, up to WebseedMaxDownloads.
+func (t *torrent) startWebseedDownloaders() {
+	for _, src := range t.webseedSources {
+		t.startPieceDownloaderForWebseed(src)
+	}
+}
+
+func (t *torrent) startPieceDownloaderForWebseed(src *webseedsource.WebseedSource) {
+	if t.status() != Downloading {
+		return
+	}
+	if src.Downloading() {
+		return
+	}
+	if src.Disabled {
+		if time.Since(src.DisabledAt) < t.session.config.WebseedRetryInterval {
+			return
+		}
+		src.Disabled = false
+	}
+	if t.webseedDownloads() >= t.session.config.WebseedMaxDownloads {
+		return
+	}
+	spec := t.piecePicker.PickWebseed(src)
+	if spec == nil {
+		return
+	}
+	t.log.Debugf("downloading pieces #%d-#%d from webseed %s", spec.Begin, spec.End-1, src.URL)
+	src.Downloader = urldownloader.New(src.URL, spec.Begin, spec.End)
+	src.DownloadSpeed = metrics.NewMeter()
+	go src.Downloader.Run(
+		&t.session.webseedClient,
+		t.pieces,
+		t.info.MultiFile,
+		t.webseedPieceResultC.SendC(),
+		t.piecePool,
+		t.session.config.WebseedResponseBodyReadTimeout,
+		t.downloadBuckets(),
+	)
+}
+
+func (t *torrent) webseedDownloads() int {
+	var n int
+	for _, src := range t.webseedSources {
+		if src.Downloading() {
+			n++
+		}
+	}
+	return n
+}
+
+func (t *torrent) handleWebseedPieceResult(res *urldownloader.PieceResult) {
+	src := t.findWebseedSource(res.Downloader)
+	if src == nil {
+		// Result of a download that has been closed already.
+		if res.Error == nil {
+			res.Buffer.Release()
+		}
+		return
+	}
+	if res.Error != nil {
+		t.disableWebseed(src, res.Error)
+		t.startPieceDownloaders()
+		return
+	}
+	l := int64(len(res.Buffer.Data))
+	t.downloadSpeed.Mark(l)
+	t.bytesDownloaded.Inc(l)
+	t.session.metrics.SpeedDownload.Mark(l)
+	src.DownloadSpeed.Mark(l)
+
+	if res.Done {
+		t.closeWebseedDownloader(src)
+		defer t.startPieceDownloaderForWebseed(src)
+	}
+
+	piece := &t.pieces[res.Index]
+	if piece.Done || piece.Writing {
+		// Downloaded from a peer in the meantime.
+		t.bytesWasted.Inc(l)
+		res.Buffer.Release()
+		return
+	}
+	t.log.Debugf("piece #%d downloaded from webseed %s", res.Index, src.URL)
+	piece.Writing = true
+
+	// Prevent receiving more pieces to avoid more than 1 write per torrent.
+	t.pieceMessagesC.Suspend()
+	t.webseedPieceResultC.Suspend()
+
+	pw := piecewriter.New(piece, src, res.Buffer)
+	go pw.Run(t.pieceWriterResultC, t.doneC, t.session.metrics.WritesPerSecond, t.session.metrics.SpeedWrite, t.session.semWrite)
+}
+
+func (t *torrent) findWebseedSource(d *urldownloader.URLDownloader) *webseedsource.WebseedSource {
+	for _, src := range t.webseedSources {
+		if src.Downloader == d {
+			return src
+		}
+	}
+	return nil
+}
+
+// disableWebseed stops downloading from the source and schedules a retry after WebseedRetryInterval.
+func (t *torrent) disableWebseed(src *webseedsource.WebseedSource, err error) {
+	t.log.Warningf("webseed %s is disabled: %s", src.URL, err)
+	t.closeWebseedDownloader(src)
+	src.Disabled = true
+	src.DisabledAt = time.Now()
+	src.LastError = err
+	time.AfterFunc(t.session.config.WebseedRetryInterval, func() {
+		select {
+		case t.webseedRetryC <- src:
+		case <-t.doneC:
+		}
+	})
+}
+
+func (t *torrent) getWebseeds() []Webseed {
+	webseeds := make([]Webseed, 0, len(t.webseedSources))
+	for _, src := range t.webseedSources {
+		webseeds = append(webseeds, Webseed{
+			URL:           src.URL,
+			Downloading:   src.Downloading(),
+			Disabled:      src.Disabled,
+			Error:         src.LastError,
+			DownloadSpeed: int(src.DownloadSpeed.Rate1()),
+		})
+	}
+	return webseeds
+}
@@ -7,29 +7,33 @@ import (
 	"github.com/fichain/go-file/external/peerprotocol"
 
 	"github.com/fichain/go-file/internal/piecewriter"
+	"github.com/fichain/go-file/internal/webseedsource"
 )
 
 func (t *torrent) handlePieceWriteDone(pw *piecewriter.PieceWriter) {
 	pw.Piece.Writing = false
 
 	t.pieceMessagesC.Resume()
-
-	pw.Buffer.Release()
+	t.webseedPieceResultC.Resume()
 
 	if !pw.HashOK {
 		t.bytesWasted.Inc(int64(len(pw.Buffer.Data)))
 		switch src := pw.Source.(type) {
 		case *peer.Peer:
 			t.log.Debugln("received corrupt piece from peer", src.String())
-			t.closePeer(src)
-			//todo banned peer
-			//t.bannedPeerIPs[src.IP()] = struct{}{}
+			t.handleCorruptPiece(src, pw.Piece, pw.Buffer.Data)
+		case *webseedsource.WebseedSource:
+			t.log.Debugln("received corrupt piece from webseed", src.URL)
+			t.disableWebseed(src, errCorruptWebseedPiece)
 		default:
 			panic("unhandled piece source")
 		}
+		pw.Buffer.Release()
 		t.startPieceDownloaders()
 		return
 	}
+	t.handleVerifiedPiece(pw.Piece, pw.Buffer.Data)
+	pw.Buffer.Release()
 	if pw.Error != nil {
 		t.stop(pw.Error)
 		return
@@ -42,6 +46,7 @@ func (t *torrent) handlePieceWriteDone(pw *piecewriter.PieceWriter) {
 	t.mBitfield.Lock()
 	t.bitfield.Set(pw.Piece.Index)
 	t.mBitfield.Unlock()
+	t.notifyPieceDone()
 
 	if t.piecePicker != nil {
 		for _, pe := range t.piecePicker.RequestedPeers(pw.Piece.Index) {
@@ -64,12 +69,18 @@ func (t *torrent) handlePieceWriteDone(pw *piecewriter.PieceWriter) {
 	}
 
 	completed := t.checkCompletion()
+	if !completed {
+		// Webseed downloads may have been cut short by peers.
+		t.startWebseedDownloaders()
+	}
 	if completed {
 		t.log.Info("download completed")
+		t.session.notifyQueue()
 		err := t.writeBitfield()
 		if err != nil {
 			t.stop(err)
 		} else if t.stopAfterDownload {
+			t.stopReason = StopReasonDownloaded
 			t.stop(nil)
 		}
 	}
@@ -8,6 +8,7 @@ require (
 	github.com/cenkalti/backoff/v3 v3.2.2
 	github.com/cenkalti/boltbrowser v0.0.0-20190327195521-ebed13c76690
 	github.com/cenkalti/log v1.0.0
+	github.com/coreos/go-semver v0.3.0
 	github.com/chihaya/chihaya v1.0.1-0.20191017040149-0a420fe05344
 	github.com/cpuguy83/go-md2man/v2 v2.0.0 // indirect
 	github.com/fatih/color v1.10.0 // indirect
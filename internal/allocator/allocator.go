@@ -21,6 +21,24 @@ type Allocator struct {
 type File struct {
 	Storage storage.File
 	Name    string
+	// Skipped file that does not exist on the disk. It is created when some data is written into it.
+	Lazy bool
+}
+
+// Release removes the file from the disk, e.g. when it is skipped after allocation.
+// The file is created again when some data is written into it.
+// It does nothing for files that are not created by the allocator.
+func (f *File) Release() error {
+	lf, ok := f.Storage.(*lazyFile)
+	if !ok {
+		return nil
+	}
+	err := lf.release()
+	if err != nil {
+		return err
+	}
+	f.Lazy = true
+	return nil
 }
 
 // Progress about the allocation.
@@ -43,7 +61,9 @@ func (a *Allocator) Close() {
 }
 
 // Run the Allocator.
-func (a *Allocator) Run(info *metainfo.Info, sto storage.Storage, progressC chan Progress, resultC chan *Allocator) {
+// Files with true value in skip are not created if they do not exist on disk.
+// They are created later when some data is written into them, e.g. a piece that is shared with a wanted file.
+func (a *Allocator) Run(info *metainfo.Info, sto storage.Storage, skip []bool, progressC chan Progress, resultC chan *Allocator) {
 	defer close(a.doneC)
 
 	defer func() {
@@ -65,11 +85,23 @@ func (a *Allocator) Run(info *metainfo.Info, sto storage.Storage, progressC chan
 	for i, f := range info.Files {
 		var sf storage.File
 		var exists bool
+		if i < len(skip) && skip[i] {
+			exists, a.Error = sto.Exists(f.Path)
+			if a.Error != nil {
+				return
+			}
+			if !exists {
+				a.Files[i] = File{Storage: newLazyFile(sto, f.Path, f.Length), Name: f.Path, Lazy: true}
+				allocatedSize += f.Length
+				a.sendProgress(progressC, allocatedSize)
+				continue
+			}
+		}
 		sf, exists, a.Error = sto.Open(f.Path, f.Length)
 		if a.Error != nil {
 			return
 		}
-		a.Files[i] = File{Storage: sf, Name: f.Path}
+		a.Files[i] = File{Storage: newCreatedFile(sto, f.Path, f.Length, sf), Name: f.Path}
 		if exists {
 			a.HasExisting = true
 		} else {
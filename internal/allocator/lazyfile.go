@@ -0,0 +1,86 @@
+package allocator
+
+import (
+	"sync"
+
+	"github.com/fichain/go-file/internal/storage"
+)
+
+// lazyFile is a file that is not created until some data is written into it.
+// Reads return zeros until then. A created file can be released to remove it from the storage again.
+type lazyFile struct {
+	sto  storage.Storage
+	name string
+	size int64
+
+	m sync.Mutex
+	f storage.File
+}
+
+var _ storage.File = (*lazyFile)(nil)
+
+func newLazyFile(sto storage.Storage, name string, size int64) *lazyFile {
+	return &lazyFile{sto: sto, name: name, size: size}
+}
+
+// newCreatedFile returns a lazyFile for a file that is already opened.
+func newCreatedFile(sto storage.Storage, name string, size int64, f storage.File) *lazyFile {
+	return &lazyFile{sto: sto, name: name, size: size, f: f}
+}
+
+func (l *lazyFile) file() storage.File {
+	l.m.Lock()
+	defer l.m.Unlock()
+	return l.f
+}
+
+// ReadAt reads from the file if it is created, otherwise it fills p with zeros.
+func (l *lazyFile) ReadAt(p []byte, off int64) (int, error) {
+	if f := l.file(); f != nil {
+		return f.ReadAt(p, off)
+	}
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
+
+// WriteAt creates the file on first call and writes p into it.
+func (l *lazyFile) WriteAt(p []byte, off int64) (int, error) {
+	l.m.Lock()
+	if l.f == nil {
+		f, _, err := l.sto.Open(l.name, l.size)
+		if err != nil {
+			l.m.Unlock()
+			return 0, err
+		}
+		l.f = f
+	}
+	f := l.f
+	l.m.Unlock()
+	return f.WriteAt(p, off)
+}
+
+// Close closes the file if it is created.
+func (l *lazyFile) Close() error {
+	if f := l.file(); f != nil {
+		return f.Close()
+	}
+	return nil
+}
+
+// release closes the file and removes it from the storage if it is created.
+// It must not be called while data is written into the file.
+func (l *lazyFile) release() error {
+	l.m.Lock()
+	defer l.m.Unlock()
+	if l.f == nil {
+		return nil
+	}
+	err := l.f.Close()
+	l.f = nil
+	if err != nil {
+		return err
+	}
+	return l.sto.Remove(l.name)
+}
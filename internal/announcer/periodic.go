@@ -16,6 +16,7 @@ import (
 	"github.com/fichain/go-file/internal/resolver"
 	"github.com/fichain/go-file/internal/tracker"
 	"github.com/fichain/go-file/internal/tracker/httptracker"
+	"github.com/libp2p/go-libp2p-core/peer"
 )
 
 // Status of the announcer.
@@ -47,6 +48,7 @@ type PeriodicalAnnouncer struct {
 	log           logger.Logger
 	completedC    chan struct{}
 	newPeers      chan []*net.TCPAddr
+	newP2PPeers   chan []peer.AddrInfo
 	backoff       backoff.BackOff
 	getTorrent    func() tracker.Torrent
 	lastAnnounce  time.Time
@@ -63,7 +65,8 @@ type PeriodicalAnnouncer struct {
 }
 
 // NewPeriodicalAnnouncer returns a new PeriodicalAnnouncer.
-func NewPeriodicalAnnouncer(trk tracker.Tracker, numWant int, minInterval time.Duration, getTorrent func() tracker.Torrent, completedC chan struct{}, newPeers chan []*net.TCPAddr, l logger.Logger) *PeriodicalAnnouncer {
+// Peers in announce responses are sent to newPeers and libp2p peers are sent to newP2PPeers.
+func NewPeriodicalAnnouncer(trk tracker.Tracker, numWant int, minInterval time.Duration, getTorrent func() tracker.Torrent, completedC chan struct{}, newPeers chan []*net.TCPAddr, newP2PPeers chan []peer.AddrInfo, l logger.Logger) *PeriodicalAnnouncer {
 	return &PeriodicalAnnouncer{
 		Tracker:        trk,
 		status:         NotContactedYet,
@@ -73,6 +76,7 @@ func NewPeriodicalAnnouncer(trk tracker.Tracker, numWant int, minInterval time.D
 		log:            l,
 		completedC:     completedC,
 		newPeers:       newPeers,
+		newP2PPeers:    newP2PPeers,
 		getTorrent:     getTorrent,
 		needMorePeersC: make(chan struct{}, 1),
 		responseC:      make(chan *tracker.AnnounceResponse),
@@ -179,9 +183,18 @@ func (a *PeriodicalAnnouncer) Run() {
 			interval := a.getNextInterval()
 			resetTimer(interval)
 			go func() {
-				select {
-				case a.newPeers <- resp.Peers:
-				case <-a.closeC:
+				if len(resp.Peers) > 0 {
+					select {
+					case a.newPeers <- resp.Peers:
+					case <-a.closeC:
+						return
+					}
+				}
+				if len(resp.P2PPeers) > 0 {
+					select {
+					case a.newP2PPeers <- resp.P2PPeers:
+					case <-a.closeC:
+					}
 				}
 			}()
 		case err := <-a.errC:
@@ -40,7 +40,7 @@ func (a *StopAnnouncer) Close() {
 
 // Run the announcer.
 func (a *StopAnnouncer) Run() {
-	//defer close(a.doneC)
+	defer close(a.doneC)
 
 	ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(a.timeout))
 	go func() {
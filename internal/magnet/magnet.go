@@ -19,6 +19,8 @@ type Magnet struct {
 	Name     string
 	Trackers [][]string
 	Peers    []string
+	// HTTP sources of the torrent data (BEP 19).
+	Webseeds []string
 }
 
 // New parses the string and returns new Magnet.
@@ -76,6 +78,7 @@ func New(s string) (*Magnet, error) {
 	}
 
 	magnet.Peers = params["x.pe"]
+	magnet.Webseeds = params["ws"]
 
 	return &magnet, nil
 }
@@ -106,6 +109,10 @@ func (m *Magnet) String() string {
 		b.WriteString("&x.pe=")
 		b.WriteString(p)
 	}
+	for _, ws := range m.Webseeds {
+		b.WriteString("&ws=")
+		b.WriteString(url.QueryEscape(ws))
+	}
 	return b.String()
 }
 
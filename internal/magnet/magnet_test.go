@@ -31,3 +31,19 @@ func TestParse(t *testing.T) {
 		t.FailNow()
 	}
 }
+
+func TestParseWebseeds(t *testing.T) {
+	u := "magnet:?xt=urn:btih:f60cc95e3566af84c1ab223fd4ce80fa88e6438a&ws=http%3A%2F%2Forigin.example.com%2Ffiles%2F"
+	m, err := New(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Webseeds) != 1 || m.Webseeds[0] != "http://origin.example.com/files/" {
+		t.Fatal("invalid webseeds")
+	}
+	if s := m.String(); s != u {
+		t.Log(u)
+		t.Log(s)
+		t.FailNow()
+	}
+}
@@ -33,7 +33,9 @@ type Info struct {
 	Bytes       []byte
 	Private     bool
 	Files       []File
-	pieces      []byte
+	// True if files are listed in "files" key. Paths of the files start with the torrent name.
+	MultiFile bool
+	pieces    []byte
 }
 
 // File represents a file inside a Torrent.
@@ -86,6 +88,7 @@ func NewInfo(b []byte) (*Info, error) {
 		Private:     parsePrivateField(ib.Private),
 	}
 	multiFile := len(ib.Files) > 0
+	i.MultiFile = multiFile
 	if multiFile {
 		for _, f := range ib.Files {
 			i.Length += f.Length
@@ -1,15 +1,15 @@
 package resourcemanager
 
-import "math/rand"
-
 // ResourceManager is a fair manager for distributing limited amount of resources to requesters.
+// When requests are waiting, the resource is given to the key that holds the least amount relative to its weight.
 type ResourceManager struct {
 	limit     int64
 	available int64
 	objects   int
+	allocated map[string]int64
 	requests  map[string][]request
 	requestC  chan request
-	releaseC  chan int64
+	releaseC  chan release
 	statsC    chan chan Stats
 	closeC    chan struct{}
 	doneC     chan struct{}
@@ -19,11 +19,17 @@ type request struct {
 	key     string
 	data    interface{}
 	n       int64
+	weight  int
 	notifyC chan interface{}
 	cancelC chan struct{}
 	doneC   chan bool
 }
 
+type release struct {
+	key string
+	n   int64
+}
+
 // Stats about ResourceManager
 type Stats struct {
 	AllocatedSize    int64
@@ -36,9 +42,10 @@ func New(limit int64) *ResourceManager {
 	m := &ResourceManager{
 		limit:     limit,
 		available: limit,
+		allocated: make(map[string]int64),
 		requests:  make(map[string][]request),
 		requestC:  make(chan request),
-		releaseC:  make(chan int64),
+		releaseC:  make(chan release),
 		statsC:    make(chan chan Stats),
 		closeC:    make(chan struct{}),
 		doneC:     make(chan struct{}),
@@ -69,15 +76,20 @@ func (m *ResourceManager) Stats() Stats {
 }
 
 // Request `n` resource from the manager for key `key`.
+// Keys with higher `weight` get a larger share of the resource while requests are waiting.
 // Release must be called after done with the resource.
-func (m *ResourceManager) Request(key string, data interface{}, n int64, notifyC chan interface{}, cancelC chan struct{}) (acquired bool) {
+func (m *ResourceManager) Request(key string, data interface{}, n int64, weight int, notifyC chan interface{}, cancelC chan struct{}) (acquired bool) {
 	if n < 0 {
 		return
 	}
+	if weight < 1 {
+		weight = 1
+	}
 	r := request{
 		key:     key,
 		data:    data,
 		n:       n,
+		weight:  weight,
 		notifyC: notifyC,
 		cancelC: cancelC,
 		doneC:   make(chan bool),
@@ -93,29 +105,34 @@ func (m *ResourceManager) Request(key string, data interface{}, n int64, notifyC
 	return
 }
 
-// Release `n` resource to the manager.
-func (m *ResourceManager) Release(n int64) {
+// Release `n` resource of key `key` to the manager.
+func (m *ResourceManager) Release(key string, n int64) {
 	select {
-	case m.releaseC <- n:
+	case m.releaseC <- release{key: key, n: n}:
 	case <-m.closeC:
 	}
 }
 
 func (m *ResourceManager) run() {
 	for {
-		req, i := m.randomRequest()
+		req, i := m.nextRequest()
 		select {
 		case r := <-m.requestC:
 			m.handleRequest(r)
-		case n := <-m.releaseC:
-			m.available += n
+		case r := <-m.releaseC:
+			m.available += r.n
 			m.objects--
 			if m.available > m.limit {
 				panic("invalid release call")
 			}
+			m.allocated[r.key] -= r.n
+			if m.allocated[r.key] <= 0 {
+				delete(m.allocated, r.key)
+			}
 		case req.notifyC <- req.data:
 			m.available -= req.n
 			m.objects++
+			m.allocated[req.key] += req.n
 			if m.available < 0 {
 				panic("invalid request call 1")
 			}
@@ -141,8 +158,7 @@ func (m *ResourceManager) run() {
 
 func (m *ResourceManager) deleteRequest(key string, i int) {
 	rs := m.requests[key]
-	rs[i] = rs[len(rs)-1]
-	rs = rs[:len(rs)-1]
+	rs = append(rs[:i], rs[i+1:]...)
 	if len(rs) > 0 {
 		m.requests[key] = rs
 	} else {
@@ -150,16 +166,24 @@ func (m *ResourceManager) deleteRequest(key string, i int) {
 	}
 }
 
-func (m *ResourceManager) randomRequest() (request, int) {
-	for _, rs := range m.requests {
-		i := rand.Intn(len(rs)) // nolint: gosec
-		r := rs[i]
-		if r.n > m.available {
-			break
+// nextRequest returns the oldest request of the key that holds the least amount of resource relative to its weight.
+// If that request does not fit into the available resource, no request is returned,
+// so large requests are not starved by smaller ones.
+func (m *ResourceManager) nextRequest() (request, int) {
+	var next request
+	var found bool
+	var nextShare float64
+	for key, rs := range m.requests {
+		r := rs[0]
+		share := float64(m.allocated[key]) / float64(r.weight)
+		if !found || share < nextShare || (share == nextShare && key < next.key) {
+			next, nextShare, found = r, share, true
 		}
-		return r, i
 	}
-	return request{}, -1
+	if !found || next.n > m.available {
+		return request{}, -1
+	}
+	return next, 0
 }
 
 func (m *ResourceManager) handleRequest(r request) {
@@ -169,6 +193,7 @@ func (m *ResourceManager) handleRequest(r request) {
 		if acquired {
 			m.available -= r.n
 			m.objects++
+			m.allocated[r.key] += r.n
 			if m.available < 0 {
 				panic("invalid request call 2")
 			}
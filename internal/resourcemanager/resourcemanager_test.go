@@ -9,14 +9,14 @@ func TestResourceManager(t *testing.T) {
 	if m.Stats().AllocatedObjects != 0 {
 		t.FailNow()
 	}
-	ok := m.Request("foo", nil, 1, nil, nil)
+	ok := m.Request("foo", nil, 1, 1, nil, nil)
 	if !ok {
 		t.FailNow()
 	}
 	if m.Stats().AllocatedObjects != 1 {
 		t.FailNow()
 	}
-	ok = m.Request("foo", nil, 1, nil, nil)
+	ok = m.Request("foo", nil, 1, 1, nil, nil)
 	if !ok {
 		t.FailNow()
 	}
@@ -24,14 +24,14 @@ func TestResourceManager(t *testing.T) {
 		t.FailNow()
 	}
 	notifyC := make(chan interface{})
-	ok = m.Request("foo", "bar", 1, notifyC, nil)
+	ok = m.Request("foo", "bar", 1, 1, notifyC, nil)
 	if ok {
 		t.FailNow()
 	}
 	if m.Stats().AllocatedObjects != 2 {
 		t.FailNow()
 	}
-	m.Release(1)
+	m.Release("foo", 1)
 	if m.Stats().AllocatedObjects != 1 {
 		t.FailNow()
 	}
@@ -48,3 +48,38 @@ func TestResourceManager(t *testing.T) {
 		t.FailNow()
 	}
 }
+
+func TestResourceManagerWeight(t *testing.T) {
+	m := New(5)
+	for i := 0; i < 5; i++ {
+		if !m.Request("other", nil, 1, 1, nil, nil) {
+			t.FailNow()
+		}
+	}
+	highC := make(chan interface{})
+	lowC := make(chan interface{})
+	for i := 0; i < 10; i++ {
+		if m.Request("high", i, 1, 4, highC, nil) {
+			t.FailNow()
+		}
+		if m.Request("low", i, 1, 1, lowC, nil) {
+			t.FailNow()
+		}
+	}
+	var high, low int
+	for i := 0; i < 5; i++ {
+		m.Release("other", 1)
+		select {
+		case data := <-highC:
+			if data.(int) != high {
+				t.Fatal("requests of a key must be served in order")
+			}
+			high++
+		case <-lowC:
+			low++
+		}
+	}
+	if high != 4 || low != 1 {
+		t.Fatalf("high: %d, low: %d", high, low)
+	}
+}
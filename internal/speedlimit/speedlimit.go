@@ -0,0 +1,91 @@
+// Package speedlimit provides token buckets whose rate can be changed while they are in use.
+package speedlimit
+
+import (
+	"sync"
+	"time"
+
+	"github.com/juju/ratelimit"
+)
+
+// Bucket limits the number of bytes transferred per second.
+// A Bucket with zero rate does not limit the transfer.
+type Bucket struct {
+	m      sync.RWMutex
+	rate   int64
+	bucket *ratelimit.Bucket
+}
+
+// New returns a new Bucket that allows rate bytes per second.
+func New(rate int64) *Bucket {
+	b := new(Bucket)
+	b.SetRate(rate)
+	return b
+}
+
+// SetRate changes the rate of the Bucket. Zero rate removes the limit.
+// Transfers that are already waiting for the bucket are not affected.
+// Setting the same rate again does nothing.
+func (b *Bucket) SetRate(rate int64) {
+	if rate < 0 {
+		rate = 0
+	}
+	if rate == b.Rate() {
+		// Keep the tokens of the current bucket.
+		return
+	}
+	var tb *ratelimit.Bucket
+	if rate > 0 {
+		// Allow a burst of one second.
+		tb = ratelimit.NewBucketWithRate(float64(rate), rate)
+	}
+	b.m.Lock()
+	b.rate = rate
+	b.bucket = tb
+	b.m.Unlock()
+}
+
+// Rate returns the number of bytes allowed per second. Zero means no limit.
+func (b *Bucket) Rate() int64 {
+	b.m.RLock()
+	defer b.m.RUnlock()
+	return b.rate
+}
+
+// Take takes count bytes from the bucket and returns the time to wait before transferring them.
+func (b *Bucket) Take(count int64) time.Duration {
+	b.m.RLock()
+	tb := b.bucket
+	b.m.RUnlock()
+	if tb == nil {
+		return 0
+	}
+	return tb.Take(count)
+}
+
+// Buckets are a chain of buckets that all limit the same transfer,
+// for example, the session, torrent and peer buckets of a peer connection.
+type Buckets []*Bucket
+
+// Take takes count bytes from all buckets and returns the longest wait.
+func (bs Buckets) Take(count int64) time.Duration {
+	var d time.Duration
+	for _, b := range bs {
+		if d2 := b.Take(count); d2 > d {
+			d = d2
+		}
+	}
+	return d
+}
+
+// Rate returns the effective rate of the chain, that is the smallest non-zero rate. Zero means no limit.
+func (bs Buckets) Rate() int64 {
+	var rate int64
+	for _, b := range bs {
+		r := b.Rate()
+		if r > 0 && (rate == 0 || r < rate) {
+			rate = r
+		}
+	}
+	return rate
+}
@@ -0,0 +1,34 @@
+package speedlimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBucketSetRate(t *testing.T) {
+	b := New(0)
+	assert.Zero(t, b.Take(1<<20))
+	b.SetRate(1000)
+	assert.Equal(t, int64(1000), b.Rate())
+	// Burst of one second is allowed.
+	assert.Zero(t, b.Take(1000))
+	d := b.Take(1000)
+	assert.True(t, d > 900*time.Millisecond && d <= time.Second, d)
+	// Same rate does not refill the bucket.
+	b.SetRate(1000)
+	assert.True(t, b.Take(1000) > time.Second)
+	b.SetRate(0)
+	assert.Zero(t, b.Take(1<<20))
+}
+
+func TestBuckets(t *testing.T) {
+	bs := Buckets{New(0), New(2000), New(1000)}
+	assert.Equal(t, int64(1000), bs.Rate())
+	assert.Zero(t, bs.Take(1000))
+	d := bs.Take(1000)
+	assert.True(t, d > 900*time.Millisecond && d <= time.Second, d)
+	assert.Zero(t, Buckets{New(0)}.Rate())
+	assert.Zero(t, Buckets(nil).Take(1000))
+}
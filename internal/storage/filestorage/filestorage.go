@@ -25,6 +25,24 @@ func New(dest string) (*FileStorage, error) {
 
 var _ storage.Storage = (*FileStorage)(nil)
 
+// Exists returns true if the file exists on disk.
+func (s *FileStorage) Exists(name string) (bool, error) {
+	_, err := os.Stat(filepath.Join(s.dest, filepath.Clean(name)))
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Remove deletes the file from disk. It is not an error if the file does not exist.
+func (s *FileStorage) Remove(name string) error {
+	err := os.Remove(filepath.Join(s.dest, filepath.Clean(name)))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
 // Open a file.
 func (s *FileStorage) Open(name string, size int64) (f storage.File, exists bool, err error) {
 	name = filepath.Clean(name)
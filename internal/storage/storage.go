@@ -6,6 +6,10 @@ import "io"
 // Storage is an interface for reading/writing torrent files.
 type Storage interface {
 	Open(name string, size int64) (f File, exists bool, err error)
+	// Exists returns true if the file is present in the storage. It does not create the file.
+	Exists(name string) (bool, error)
+	// Remove deletes the file from the storage. The file must be closed before.
+	Remove(name string) error
 }
 
 // File interface for reading/writing torrent data.
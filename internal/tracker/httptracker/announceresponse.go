@@ -15,4 +15,6 @@ type announceResponse struct {
 	Incomplete     int32              `bencode:"incomplete"`
 	Peers          bencode.RawMessage `bencode:"peers"`
 	ExternalIP     []byte             `bencode:"external ip"`
+	// Key is tracker.PeersMultiaddrKey.
+	PeersMultiaddr []byte `bencode:"peers_ma"`
 }
@@ -16,6 +16,7 @@ import (
 
 	"github.com/fichain/go-file/internal/logger"
 	"github.com/fichain/go-file/internal/tracker"
+	"github.com/libp2p/go-libp2p-core/peer"
 	"github.com/zeebo/bencode"
 )
 
@@ -87,6 +88,10 @@ func (t *HTTPTracker) Announce(ctx context.Context, req tracker.AnnounceRequest)
 		sb.WriteString("&trackerid=")
 		sb.WriteString(t.trackerID)
 	}
+	for _, addr := range req.Torrent.Multiaddrs {
+		sb.WriteString("&" + tracker.MultiaddrParam + "=")
+		sb.WriteString(url.QueryEscape(addr.String()))
+	}
 	sb.WriteString("&key=")
 	sb.WriteString(hex.EncodeToString(req.Torrent.PeerID[16:20]))
 
@@ -180,12 +185,22 @@ func (t *HTTPTracker) Announce(ctx context.Context, req tracker.AnnounceRequest)
 		peers = peers[:filtered]
 	}
 
+	var p2pPeers []peer.AddrInfo
+	if len(response.PeersMultiaddr) > 0 {
+		p2pPeers, err = tracker.DecodePeersMultiaddr(response.PeersMultiaddr)
+		if err != nil {
+			return nil, tracker.ErrDecode
+		}
+		t.log.Debugf("got %d libp2p peers", len(p2pPeers))
+	}
+
 	return &tracker.AnnounceResponse{
 		Interval:       time.Duration(response.Interval) * time.Second,
 		MinInterval:    time.Duration(response.MinInterval) * time.Second,
 		Leechers:       response.Incomplete,
 		Seeders:        response.Complete,
 		Peers:          peers,
+		P2PPeers:       p2pPeers,
 		WarningMessage: response.WarningMessage,
 	}, nil
 }
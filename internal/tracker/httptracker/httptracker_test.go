@@ -2,17 +2,23 @@ package httptracker_test
 
 import (
 	"context"
+	"net"
 	"net/http"
 	"net/url"
 	"testing"
 	"time"
 
-	"github.com/fichain/go-file/internal/tracker"
-	"github.com/fichain/go-file/internal/tracker/httptracker"
 	fhttp "github.com/chihaya/chihaya/frontend/http"
 	"github.com/chihaya/chihaya/middleware"
 	"github.com/chihaya/chihaya/storage"
 	_ "github.com/chihaya/chihaya/storage/memory"
+	"github.com/fichain/go-file/internal/tracker"
+	"github.com/fichain/go-file/internal/tracker/httptracker"
+	"github.com/fichain/go-file/internal/tracker/trackerserver"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/test"
+	ma "github.com/multiformats/go-multiaddr"
+	"github.com/stretchr/testify/assert"
 )
 
 const timeout = 2 * time.Second
@@ -99,3 +105,70 @@ func TestHTTPTracker(t *testing.T) {
 		t.FailNow()
 	}
 }
+
+func TestHTTPTrackerMultiaddrPeers(t *testing.T) {
+	srv, err := trackerserver.New(trackerserver.DefaultConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/announce", srv)
+	hs := &http.Server{Handler: mux}
+	go hs.Serve(lis)
+	defer hs.Close()
+
+	rawURL := "http://" + lis.Addr().String() + "/announce"
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	trk := httptracker.New(rawURL, u, timeout, new(http.Transport), "Mozilla/5.0", 2*1024*1024)
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	seeder := peer.AddrInfo{
+		ID:    test.RandPeerIDFatal(t),
+		Addrs: []ma.Multiaddr{ma.StringCast("/ip4/127.0.0.1/tcp/4001")},
+	}
+	seederAddrs, err := peer.AddrInfoToP2pAddrs(&seeder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := tracker.AnnounceRequest{
+		Torrent: tracker.Torrent{
+			InfoHash:   [20]byte{7},
+			PeerID:     [20]byte{1},
+			Port:       4001,
+			Multiaddrs: seederAddrs,
+		},
+	}
+	resp, err := trk.Announce(ctx, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Empty(t, resp.P2PPeers)
+
+	leecherAddr := ma.StringCast("/ip4/127.0.0.1/tcp/4002/p2p/" + test.RandPeerIDFatal(t).Pretty())
+	req = tracker.AnnounceRequest{
+		Torrent: tracker.Torrent{
+			InfoHash:   [20]byte{7},
+			PeerID:     [20]byte{2},
+			Port:       4002,
+			BytesLeft:  1,
+			Multiaddrs: []ma.Multiaddr{leecherAddr},
+		},
+		NumWant: 10,
+	}
+	resp, err = trk.Announce(ctx, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, resp.Peers, 1)
+	assert.Equal(t, []peer.AddrInfo{seeder}, resp.P2PPeers)
+}
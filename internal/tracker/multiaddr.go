@@ -0,0 +1,71 @@
+package tracker
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+
+	"github.com/libp2p/go-libp2p-core/peer"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// Trackers that know libp2p peers may return them in this key of announce response along with the compact peer list.
+// The value is a string of concatenated items. Each item is a 2-byte big-endian length followed by a binary multiaddr
+// that ends with "/p2p/<peer id>".
+const PeersMultiaddrKey = "peers_ma"
+
+// MultiaddrParam is the announce request parameter that contains a libp2p address of the announcing peer.
+// It is repeated for each address. HTTP trackers receive it in the query string, UDP trackers receive it in the URL
+// data option of BEP 41.
+const MultiaddrParam = "ma"
+
+// MultiaddrAction is the action of UDP announce responses that contain libp2p peers.
+// UDP trackers that support the extension send it instead of the announce action of BEP 15 when the request has
+// MultiaddrParam. The response starts with the same fields as a BEP 15 announce response. Then comes a 2-byte
+// big-endian length, the libp2p peers in the encoding of PeersMultiaddrKey, and the compact peer list.
+const MultiaddrAction = 256
+
+// EncodePeersMultiaddr returns the compact multiaddr encoding of peers.
+func EncodePeersMultiaddr(peers []peer.AddrInfo) ([]byte, error) {
+	var b []byte
+	for i := range peers {
+		addrs, err := peer.AddrInfoToP2pAddrs(&peers[i])
+		if err != nil {
+			return nil, err
+		}
+		for _, addr := range addrs {
+			ab := addr.Bytes()
+			if len(ab) > math.MaxUint16 {
+				return nil, errors.New("multiaddr too long")
+			}
+			var l [2]byte
+			binary.BigEndian.PutUint16(l[:], uint16(len(ab)))
+			b = append(b, l[:]...)
+			b = append(b, ab...)
+		}
+	}
+	return b, nil
+}
+
+// DecodePeersMultiaddr parses the compact multiaddr encoding of peers.
+// Addresses of the same peer are merged into a single AddrInfo.
+func DecodePeersMultiaddr(b []byte) ([]peer.AddrInfo, error) {
+	var addrs []ma.Multiaddr
+	for len(b) > 0 {
+		if len(b) < 2 {
+			return nil, errors.New("invalid multiaddr peer list length")
+		}
+		l := int(binary.BigEndian.Uint16(b))
+		b = b[2:]
+		if len(b) < l {
+			return nil, errors.New("invalid multiaddr peer length")
+		}
+		addr, err := ma.NewMultiaddrBytes(b[:l])
+		if err != nil {
+			return nil, err
+		}
+		addrs = append(addrs, addr)
+		b = b[l:]
+	}
+	return peer.AddrInfosFromP2pAddrs(addrs...)
+}
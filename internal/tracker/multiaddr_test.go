@@ -0,0 +1,36 @@
+package tracker
+
+import (
+	"testing"
+
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/test"
+	ma "github.com/multiformats/go-multiaddr"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPeersMultiaddr(t *testing.T) {
+	a := peer.AddrInfo{
+		ID: test.RandPeerIDFatal(t),
+		Addrs: []ma.Multiaddr{
+			ma.StringCast("/ip4/127.0.0.1/tcp/4001"),
+			ma.StringCast("/ip4/127.0.0.1/udp/4001/quic"),
+		},
+	}
+	b := peer.AddrInfo{
+		ID:    test.RandPeerIDFatal(t),
+		Addrs: []ma.Multiaddr{ma.StringCast("/ip6/::1/tcp/4002")},
+	}
+	data, err := EncodePeersMultiaddr([]peer.AddrInfo{a, b})
+	if err != nil {
+		t.Fatal(err)
+	}
+	peers, err := DecodePeersMultiaddr(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.ElementsMatch(t, []peer.AddrInfo{a, b}, peers)
+
+	_, err = DecodePeersMultiaddr(data[:len(data)-1])
+	assert.Error(t, err)
+}
@@ -1,5 +1,7 @@
 package tracker
 
+import ma "github.com/multiformats/go-multiaddr"
+
 // Torrent contains fields that are sent in an announce request.
 type Torrent struct {
 	BytesUploaded   int64
@@ -8,4 +10,7 @@ type Torrent struct {
 	InfoHash        [20]byte
 	PeerID          [20]byte
 	Port            int
+	// Addresses of the libp2p host including the peer ID, sent in MultiaddrParam.
+	// Trackers that support the extension return them to other peers.
+	Multiaddrs []ma.Multiaddr
 }
@@ -6,6 +6,8 @@ import (
 	"errors"
 	"net"
 	"time"
+
+	"github.com/libp2p/go-libp2p-core/peer"
 )
 
 // Tracker tracks the IP address of peers of a Torrent swarm.
@@ -34,6 +36,8 @@ type AnnounceResponse struct {
 	Seeders        int32
 	WarningMessage string
 	Peers          []*net.TCPAddr
+	// Peers with libp2p addresses. Only returned by trackers that support the multiaddr extension.
+	P2PPeers []peer.AddrInfo
 }
 
 // ErrDecode is returned from Tracker.Announce method when there is problem with the encoding of response.
@@ -0,0 +1,88 @@
+package trackerserver
+
+import (
+	"context"
+	"math"
+	"net/http"
+
+	"github.com/chihaya/chihaya/bittorrent"
+	fhttp "github.com/chihaya/chihaya/frontend/http"
+	"github.com/chihaya/chihaya/frontend/http/bencode"
+	"github.com/fichain/go-file/internal/tracker"
+)
+
+var _ http.Handler = (*Server)(nil)
+
+// ServeHTTP answers HTTP announce requests. Mount it at the announce path of the tracker URL.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	req, err := fhttp.ParseAnnounce(r, fhttp.ParseOptions{
+		MaxNumWant:     s.config.MaxNumWant,
+		DefaultNumWant: s.config.DefaultNumWant,
+	})
+	if err != nil {
+		_ = fhttp.WriteError(w, err)
+		return
+	}
+	ctx, resp, err := s.logic.HandleAnnounce(context.Background(), req)
+	if err != nil {
+		_ = fhttp.WriteError(w, err)
+		return
+	}
+	bdict := announceDict(resp)
+	if hasMultiaddrs(req.Params) {
+		if b := s.peersMultiaddr(req, resp, math.MaxInt32); len(b) > 0 {
+			bdict[tracker.PeersMultiaddrKey] = b
+		}
+	}
+	err = bencode.NewEncoder(w).Encode(bdict)
+	if err != nil {
+		s.log.Debugln("cannot write announce response:", err)
+		return
+	}
+	s.logic.AfterAnnounce(ctx, req, resp)
+}
+
+// announceDict returns the announce response dictionary that chihaya's HTTP frontend writes.
+func announceDict(resp *bittorrent.AnnounceResponse) bencode.Dict {
+	bdict := bencode.Dict{
+		"complete":     resp.Complete,
+		"incomplete":   resp.Incomplete,
+		"interval":     resp.Interval,
+		"min interval": resp.MinInterval,
+	}
+	if !resp.Compact {
+		var peers []bencode.Dict
+		for _, ps := range [][]bittorrent.Peer{resp.IPv4Peers, resp.IPv6Peers} {
+			for _, p := range ps {
+				peers = append(peers, bencode.Dict{
+					"peer id": string(p.ID[:]),
+					"ip":      p.IP.String(),
+					"port":    p.Port,
+				})
+			}
+		}
+		bdict["peers"] = peers
+		return bdict
+	}
+	if b := compactPeers(resp.IPv4Peers); len(b) > 0 {
+		bdict["peers"] = b
+	}
+	if b := compactPeers(resp.IPv6Peers); len(b) > 0 {
+		bdict["peers6"] = b
+	}
+	return bdict
+}
+
+// compactPeers returns the addresses of peers in the compact format of BEP 23 and BEP 7.
+func compactPeers(peers []bittorrent.Peer) []byte {
+	var b []byte
+	for _, p := range peers {
+		ip := p.IP.IP
+		if p.IP.AddressFamily == bittorrent.IPv4 {
+			ip = ip.To4()
+		}
+		b = append(b, ip...)
+		b = append(b, byte(p.Port>>8), byte(p.Port))
+	}
+	return b
+}
@@ -0,0 +1,248 @@
+// Package trackerserver is a chihaya tracker that supports the multiaddr extension of the tracker package.
+// Peers that announce their libp2p addresses with tracker.MultiaddrParam are returned to other peers of the same
+// torrent, in tracker.PeersMultiaddrKey of HTTP responses and in tracker.MultiaddrAction responses of UDP.
+// Scrape requests are not supported.
+package trackerserver
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/chihaya/chihaya/bittorrent"
+	"github.com/chihaya/chihaya/middleware"
+	"github.com/chihaya/chihaya/storage"
+	"github.com/chihaya/chihaya/storage/memory"
+	"github.com/fichain/go-file/internal/logger"
+	"github.com/fichain/go-file/internal/tracker"
+	"github.com/libp2p/go-libp2p-core/peer"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// maxMultiaddrs is the number of libp2p addresses kept for a peer. Others are ignored.
+const maxMultiaddrs = 16
+
+// Config of Server.
+type Config struct {
+	// Interval sent to peers in announce responses.
+	AnnounceInterval time.Duration
+	// Peers that have not announced for this long are removed from the swarm.
+	PeerLifetime time.Duration
+	// Secret of the connection IDs given to UDP clients.
+	PrivateKey string
+	// Connection IDs of UDP clients expire after this duration.
+	MaxClockSkew time.Duration
+	// Number of peers returned when the request does not have numwant.
+	DefaultNumWant uint32
+	// Maximum number of peers returned in a response.
+	MaxNumWant uint32
+}
+
+// DefaultConfig for Server.
+var DefaultConfig = Config{
+	AnnounceInterval: 30 * time.Minute,
+	PeerLifetime:     time.Hour,
+	MaxClockSkew:     10 * time.Second,
+	DefaultNumWant:   50,
+	MaxNumWant:       100,
+}
+
+// Server is a tracker that answers HTTP and UDP announce requests.
+// The swarms are kept in memory.
+type Server struct {
+	config    Config
+	peerStore storage.PeerStore
+	logic     *middleware.Logic
+	log       logger.Logger
+
+	// Compact multiaddr encoding of the announced libp2p addresses by torrent and peer.
+	swarms map[bittorrent.InfoHash]map[peerKey]*p2pAddrs
+	m      sync.Mutex
+
+	closeC chan struct{}
+	doneC  chan struct{}
+}
+
+type peerKey struct {
+	id   bittorrent.PeerID
+	ip   string
+	port uint16
+}
+
+type p2pAddrs struct {
+	encoded   []byte
+	announced time.Time
+}
+
+func newPeerKey(p bittorrent.Peer) peerKey {
+	return peerKey{id: p.ID, ip: p.IP.String(), port: p.Port}
+}
+
+// New returns a new Server. Serve requests with ServeHTTP and ServeUDP.
+func New(cfg Config) (*Server, error) {
+	if cfg.PeerLifetime <= 0 {
+		return nil, errors.New("peer lifetime must be positive")
+	}
+	ps, err := memory.New(memory.Config{
+		GarbageCollectionInterval:   cfg.PeerLifetime,
+		PrometheusReportingInterval: time.Hour,
+		PeerLifetime:                cfg.PeerLifetime,
+		ShardCount:                  1,
+	})
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{
+		config:    cfg,
+		peerStore: ps,
+		log:       logger.New("tracker server"),
+		swarms:    make(map[bittorrent.InfoHash]map[peerKey]*p2pAddrs),
+		closeC:    make(chan struct{}),
+		doneC:     make(chan struct{}),
+	}
+	responseConfig := middleware.ResponseConfig{AnnounceInterval: cfg.AnnounceInterval}
+	s.logic = middleware.NewLogic(responseConfig, ps, []middleware.Hook{multiaddrHook{s}}, nil)
+	go s.removeExpiredPeers()
+	return s, nil
+}
+
+// Close stops the server. Requests must not be served after Close.
+func (s *Server) Close() {
+	close(s.closeC)
+	<-s.doneC
+	for _, err := range s.peerStore.Stop().Wait() {
+		s.log.Errorln("cannot stop peer store:", err)
+	}
+}
+
+func (s *Server) removeExpiredPeers() {
+	defer close(s.doneC)
+	ticker := time.NewTicker(s.config.PeerLifetime)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			s.m.Lock()
+			for ih, swarm := range s.swarms {
+				for k, addrs := range swarm {
+					if now.Sub(addrs.announced) > s.config.PeerLifetime {
+						delete(swarm, k)
+					}
+				}
+				if len(swarm) == 0 {
+					delete(s.swarms, ih)
+				}
+			}
+			s.m.Unlock()
+		case <-s.closeC:
+			return
+		}
+	}
+}
+
+// multiaddrHook saves the libp2p addresses in announce requests.
+// Addresses are removed when the peer sends a stopped event.
+type multiaddrHook struct {
+	server *Server
+}
+
+var _ middleware.Hook = multiaddrHook{}
+
+func (h multiaddrHook) HandleAnnounce(ctx context.Context, req *bittorrent.AnnounceRequest, resp *bittorrent.AnnounceResponse) (context.Context, error) {
+	s := h.server
+	key := newPeerKey(req.Peer)
+	if req.Event == bittorrent.Stopped {
+		s.m.Lock()
+		delete(s.swarms[req.InfoHash], key)
+		s.m.Unlock()
+		return ctx, nil
+	}
+	encoded, err := encodeMultiaddrs(req.Params)
+	if err != nil {
+		return ctx, bittorrent.ClientError("invalid " + tracker.MultiaddrParam + ": " + err.Error())
+	}
+	if len(encoded) == 0 {
+		return ctx, nil
+	}
+	s.m.Lock()
+	swarm, ok := s.swarms[req.InfoHash]
+	if !ok {
+		swarm = make(map[peerKey]*p2pAddrs)
+		s.swarms[req.InfoHash] = swarm
+	}
+	swarm[key] = &p2pAddrs{encoded: encoded, announced: time.Now()}
+	s.m.Unlock()
+	return ctx, nil
+}
+
+func (h multiaddrHook) HandleScrape(ctx context.Context, req *bittorrent.ScrapeRequest, resp *bittorrent.ScrapeResponse) (context.Context, error) {
+	return ctx, nil
+}
+
+// hasMultiaddrs returns true if the request contains MultiaddrParam.
+// Only these clients understand the libp2p peers in responses.
+func hasMultiaddrs(params bittorrent.Params) bool {
+	if params == nil {
+		return false
+	}
+	q, err := url.ParseQuery(params.RawQuery())
+	return err == nil && len(q[tracker.MultiaddrParam]) > 0
+}
+
+// encodeMultiaddrs returns the compact multiaddr encoding of the addresses in MultiaddrParam.
+// Params keeps only the last value of a key, so the raw query is parsed again.
+func encodeMultiaddrs(params bittorrent.Params) ([]byte, error) {
+	if params == nil {
+		return nil, nil
+	}
+	q, err := url.ParseQuery(params.RawQuery())
+	if err != nil {
+		return nil, err
+	}
+	values := q[tracker.MultiaddrParam]
+	if len(values) > maxMultiaddrs {
+		values = values[:maxMultiaddrs]
+	}
+	addrs := make([]ma.Multiaddr, 0, len(values))
+	for _, v := range values {
+		addr, err := ma.NewMultiaddr(v)
+		if err != nil {
+			return nil, err
+		}
+		addrs = append(addrs, addr)
+	}
+	pis, err := peer.AddrInfosFromP2pAddrs(addrs...)
+	if err != nil {
+		return nil, err
+	}
+	return tracker.EncodePeersMultiaddr(pis)
+}
+
+// peersMultiaddr returns the libp2p addresses of the peers in the response in compact multiaddr encoding.
+// The requesting peer is skipped. Peers are added while the result fits in limit bytes.
+func (s *Server) peersMultiaddr(req *bittorrent.AnnounceRequest, resp *bittorrent.AnnounceResponse, limit int) []byte {
+	self := newPeerKey(req.Peer)
+	var b []byte
+	s.m.Lock()
+	defer s.m.Unlock()
+	swarm := s.swarms[req.InfoHash]
+	for _, peers := range [][]bittorrent.Peer{resp.IPv4Peers, resp.IPv6Peers} {
+		for _, p := range peers {
+			key := newPeerKey(p)
+			if key == self {
+				continue
+			}
+			addrs, ok := swarm[key]
+			if !ok {
+				continue
+			}
+			if len(b)+len(addrs.encoded) > limit {
+				return b
+			}
+			b = append(b, addrs.encoded...)
+		}
+	}
+	return b
+}
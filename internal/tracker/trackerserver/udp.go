@@ -0,0 +1,133 @@
+package trackerserver
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"net"
+	"time"
+
+	"github.com/chihaya/chihaya/bittorrent"
+	"github.com/chihaya/chihaya/frontend/udp"
+	"github.com/fichain/go-file/internal/tracker"
+)
+
+// UDP tracker actions of BEP 15.
+const (
+	actionConnect  = 0
+	actionAnnounce = 1
+)
+
+// maxPacketSize is the largest payload of a UDP packet.
+const maxPacketSize = 65507
+
+var (
+	initialConnectionID = []byte{0, 0, 0x04, 0x17, 0x27, 0x10, 0x19, 0x80}
+
+	errBadConnectionID = bittorrent.ClientError("bad connection ID")
+	errUnknownAction   = bittorrent.ClientError("unknown action ID")
+)
+
+// ServeUDP answers the UDP announce requests read from conn. It returns nil after conn is closed.
+// Requests are handled one at a time.
+func (s *Server) ServeUDP(conn *net.UDPConn) error {
+	gen := udp.NewConnectionIDGenerator(s.config.PrivateKey)
+	buf := make([]byte, maxPacketSize)
+	for {
+		n, addr, err := conn.ReadFromUDP(buf)
+		if errors.Is(err, net.ErrClosed) {
+			return nil
+		}
+		if err != nil {
+			if nerr, ok := err.(net.Error); ok && nerr.Temporary() {
+				continue
+			}
+			return err
+		}
+		ip := addr.IP
+		if ip4 := ip.To4(); ip4 != nil {
+			ip = ip4
+		}
+		resp := s.handleUDP(gen, buf[:n], ip)
+		if resp == nil {
+			continue
+		}
+		_, err = conn.WriteToUDP(resp, addr)
+		if err != nil {
+			s.log.Debugln("cannot write udp response:", err)
+		}
+	}
+}
+
+// handleUDP returns the response to a UDP tracker request. It returns nil if the request must not be answered.
+func (s *Server) handleUDP(gen *udp.ConnectionIDGenerator, packet []byte, ip net.IP) []byte {
+	if len(packet) < 16 {
+		return nil
+	}
+	connID := packet[0:8]
+	action := binary.BigEndian.Uint32(packet[8:12])
+	txID := packet[12:16]
+	now := time.Now()
+
+	var b bytes.Buffer
+	if action != actionConnect && !gen.Validate(connID, ip, now, s.config.MaxClockSkew) {
+		udp.WriteError(&b, txID, errBadConnectionID)
+		return b.Bytes()
+	}
+	switch action {
+	case actionConnect:
+		if !bytes.Equal(connID, initialConnectionID) {
+			return nil
+		}
+		udp.WriteConnectionID(&b, txID, gen.Generate(ip, now))
+	case actionAnnounce:
+		req, err := udp.ParseAnnounce(udp.Request{Packet: packet, IP: ip}, false, udp.ParseOptions{
+			MaxNumWant:     s.config.MaxNumWant,
+			DefaultNumWant: s.config.DefaultNumWant,
+		})
+		if err != nil {
+			udp.WriteError(&b, txID, err)
+			break
+		}
+		ctx, resp, err := s.logic.HandleAnnounce(context.Background(), req)
+		if err != nil {
+			udp.WriteError(&b, txID, err)
+			break
+		}
+		if hasMultiaddrs(req.Params) {
+			s.writeMultiaddrAnnounce(&b, txID, req, resp)
+		} else {
+			udp.WriteAnnounce(&b, txID, resp, false, req.IP.AddressFamily == bittorrent.IPv6)
+		}
+		s.logic.AfterAnnounce(ctx, req, resp)
+	default:
+		udp.WriteError(&b, txID, errUnknownAction)
+	}
+	return b.Bytes()
+}
+
+// writeMultiaddrAnnounce writes an announce response with tracker.MultiaddrAction.
+// Libp2p peers are left out if they do not fit in a UDP packet.
+func (s *Server) writeMultiaddrAnnounce(b *bytes.Buffer, txID []byte, req *bittorrent.AnnounceRequest, resp *bittorrent.AnnounceResponse) {
+	peers := resp.IPv4Peers
+	if req.IP.AddressFamily == bittorrent.IPv6 {
+		peers = resp.IPv6Peers
+	}
+	compact := compactPeers(peers)
+	const headerSize = 20
+	limit := maxPacketSize - headerSize - 2 - len(compact)
+	if limit < 0 {
+		limit = 0
+	}
+	p2pPeers := s.peersMultiaddr(req, resp, limit)
+
+	_ = binary.Write(b, binary.BigEndian, uint32(tracker.MultiaddrAction))
+	b.Write(txID)
+	_ = binary.Write(b, binary.BigEndian, uint32(resp.Interval/time.Second))
+	_ = binary.Write(b, binary.BigEndian, resp.Incomplete)
+	_ = binary.Write(b, binary.BigEndian, resp.Complete)
+	_ = binary.Write(b, binary.BigEndian, uint16(len(p2pPeers)))
+	b.Write(p2pPeers)
+	b.Write(compact)
+}
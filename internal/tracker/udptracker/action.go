@@ -1,5 +1,7 @@
 package udptracker
 
+import "github.com/fichain/go-file/internal/tracker"
+
 type action int32
 
 // UDP tracker Actions
@@ -7,4 +9,6 @@ const (
 	actionConnect  action = 0
 	actionAnnounce action = 1
 	actionError    action = 3
+
+	actionAnnounceMultiaddr action = tracker.MultiaddrAction
 )
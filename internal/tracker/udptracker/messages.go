@@ -67,7 +67,7 @@ type announceRequest struct {
 	Key        uint32
 	NumWant    int32
 	Port       uint16
-	Extensions uint16
+	// BEP 41 options follow the port.
 }
 
 type transferAnnounceRequest struct {
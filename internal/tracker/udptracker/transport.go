@@ -137,8 +137,9 @@ func (t *Transport) Close() error {
 // sends the bytes to the transaction's response channel.
 func (t *Transport) readLoop() {
 	// Read buffer must be big enough to hold a UDP packet of maximum expected size.
-	const maxNumWant = 1000
-	bigBuf := make([]byte, 20+6*maxNumWant)
+	// Responses with libp2p peers may be as large as a UDP packet can be.
+	const maxPacketSize = 65507
+	bigBuf := make([]byte, maxPacketSize)
 	for {
 		n, err := t.conn.Read(bigBuf)
 		if err != nil {
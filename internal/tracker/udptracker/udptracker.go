@@ -10,10 +10,13 @@ import (
 	"errors"
 	"net"
 	"net/url"
+	"strings"
 	"time"
 
 	"github.com/fichain/go-file/internal/logger"
 	"github.com/fichain/go-file/internal/tracker"
+	"github.com/libp2p/go-libp2p-core/peer"
+	ma "github.com/multiformats/go-multiaddr"
 )
 
 // UDPTracker is a torrent tracker that speaks UDP.
@@ -60,7 +63,7 @@ func (t *UDPTracker) Announce(ctx context.Context, req tracker.AnnounceRequest)
 
 	request2 := &transferAnnounceRequest{
 		announceRequest: request,
-		urlData:         t.urlData,
+		urlData:         appendMultiaddrs(t.urlData, req.Torrent.Multiaddrs),
 	}
 	trx := newTransaction(request2, t.dest)
 
@@ -69,7 +72,7 @@ func (t *UDPTracker) Announce(ctx context.Context, req tracker.AnnounceRequest)
 		return nil, err
 	}
 
-	response, peers, err := t.parseAnnounceResponse(reply)
+	response, peers, p2pPeers, err := t.parseAnnounceResponse(reply)
 	if err != nil {
 		return nil, tracker.ErrDecode
 	}
@@ -80,22 +83,60 @@ func (t *UDPTracker) Announce(ctx context.Context, req tracker.AnnounceRequest)
 		Leechers: response.Leechers,
 		Seeders:  response.Seeders,
 		Peers:    peers,
+		P2PPeers: p2pPeers,
 	}, nil
 }
 
-func (t *UDPTracker) parseAnnounceResponse(data []byte) (*udpAnnounceResponse, []*net.TCPAddr, error) {
+// appendMultiaddrs adds the libp2p addresses to the URL data as MultiaddrParam.
+func appendMultiaddrs(urlData string, addrs []ma.Multiaddr) string {
+	if len(addrs) == 0 {
+		return urlData
+	}
+	var sb strings.Builder
+	sb.WriteString(urlData)
+	sep := "?"
+	if strings.ContainsRune(urlData, '?') {
+		sep = "&"
+	}
+	for _, addr := range addrs {
+		sb.WriteString(sep + tracker.MultiaddrParam + "=")
+		sb.WriteString(url.QueryEscape(addr.String()))
+		sep = "&"
+	}
+	return sb.String()
+}
+
+func (t *UDPTracker) parseAnnounceResponse(data []byte) (*udpAnnounceResponse, []*net.TCPAddr, []peer.AddrInfo, error) {
 	var response udpAnnounceResponse
 	err := binary.Read(bytes.NewReader(data), binary.BigEndian, &response)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, nil, err
 	}
 	t.log.Debugf("annouceResponse: %#v", response)
-	if response.Action != actionAnnounce {
-		return nil, nil, errors.New("invalid action")
+	rest := data[binary.Size(response):]
+	var p2pPeers []peer.AddrInfo
+	switch response.Action {
+	case actionAnnounce:
+	case actionAnnounceMultiaddr:
+		if len(rest) < 2 {
+			return nil, nil, nil, errors.New("invalid multiaddr peer list length")
+		}
+		l := int(binary.BigEndian.Uint16(rest))
+		rest = rest[2:]
+		if len(rest) < l {
+			return nil, nil, nil, errors.New("invalid multiaddr peer list length")
+		}
+		p2pPeers, err = tracker.DecodePeersMultiaddr(rest[:l])
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		rest = rest[l:]
+	default:
+		return nil, nil, nil, errors.New("invalid action")
 	}
-	peers, err := tracker.DecodePeersCompact(data[binary.Size(response):])
+	peers, err := tracker.DecodePeersCompact(rest)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, nil, err
 	}
-	return &response, peers, nil
+	return &response, peers, p2pPeers, nil
 }
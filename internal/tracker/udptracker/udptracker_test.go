@@ -2,17 +2,23 @@ package udptracker_test
 
 import (
 	"context"
+	"net"
 	"net/url"
 	"strconv"
 	"testing"
 	"time"
 
-	"github.com/fichain/go-file/internal/tracker"
-	"github.com/fichain/go-file/internal/tracker/udptracker"
 	"github.com/chihaya/chihaya/frontend/udp"
 	"github.com/chihaya/chihaya/middleware"
 	"github.com/chihaya/chihaya/storage"
 	_ "github.com/chihaya/chihaya/storage/memory"
+	"github.com/fichain/go-file/internal/tracker"
+	"github.com/fichain/go-file/internal/tracker/trackerserver"
+	"github.com/fichain/go-file/internal/tracker/udptracker"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/test"
+	ma "github.com/multiformats/go-multiaddr"
+	"github.com/stretchr/testify/assert"
 )
 
 const timeout = 2 * time.Second
@@ -94,3 +100,78 @@ func TestUDPTracker(t *testing.T) {
 		t.FailNow()
 	}
 }
+
+func TestUDPTrackerMultiaddrPeers(t *testing.T) {
+	srv, err := trackerserver.New(trackerserver.DefaultConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.ServeUDP(conn)
+	defer conn.Close()
+
+	rawURL := "udp://" + conn.LocalAddr().String() + "/announce?key=secret"
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := udptracker.NewTransport(nil, 5*time.Second)
+	defer tr.Close()
+	trk := udptracker.New(rawURL, u, tr)
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	seeder := peer.AddrInfo{
+		ID:    test.RandPeerIDFatal(t),
+		Addrs: []ma.Multiaddr{ma.StringCast("/ip4/127.0.0.1/tcp/4001")},
+	}
+	seederAddrs, err := peer.AddrInfoToP2pAddrs(&seeder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := tracker.AnnounceRequest{
+		Torrent: tracker.Torrent{
+			InfoHash:   [20]byte{7},
+			PeerID:     [20]byte{1},
+			Port:       4001,
+			Multiaddrs: seederAddrs,
+		},
+	}
+	resp, err := trk.Announce(ctx, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Empty(t, resp.P2PPeers)
+
+	leecherAddr := ma.StringCast("/ip4/127.0.0.1/tcp/4002/p2p/" + test.RandPeerIDFatal(t).Pretty())
+	req = tracker.AnnounceRequest{
+		Torrent: tracker.Torrent{
+			InfoHash:   [20]byte{7},
+			PeerID:     [20]byte{2},
+			Port:       4002,
+			BytesLeft:  1,
+			Multiaddrs: []ma.Multiaddr{leecherAddr},
+		},
+		NumWant: 10,
+	}
+	resp, err = trk.Announce(ctx, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, resp.Peers, 1)
+	assert.Equal(t, []peer.AddrInfo{seeder}, resp.P2PPeers)
+
+	// Requests without libp2p addresses get standard responses.
+	req.Torrent.Multiaddrs = nil
+	resp, err = trk.Announce(ctx, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, resp.Peers, 1)
+	assert.Empty(t, resp.P2PPeers)
+}
@@ -74,7 +74,7 @@ func (u *Unchoker) sortPeers(peers []Peer, completed bool) {
 	}
 }
 
-// TickUnchoke must be called at every 10 seconds.
+// TickUnchoke must be called periodically, normally at every 10 seconds.
 func (u *Unchoker) TickUnchoke(allPeers []Peer, torrentCompleted bool) {
 	optimistic := u.round == 0
 	peers := u.candidatesUnchoke(allPeers)
@@ -159,3 +159,86 @@ func (p *TestPeer) Optimistic() bool         { return p.optimistic }
 func (p *TestPeer) SetOptimistic(value bool) { p.optimistic = value }
 func (p *TestPeer) DownloadSpeed() int       { return p.downloadSpeed }
 func (p *TestPeer) UploadSpeed() int         { return p.uploadSpeed }
+
+// simulate runs the unchoker for a number of rounds.
+// In each round, our upload capacity is shared equally between unchoked peers,
+// limited by the download capacity of each peer.
+// Peers upload to us with their fixed upload capacity.
+// It returns the total amount uploaded to each peer.
+func simulate(u *Unchoker, peers []*TestPeer, uploadCapacity []int, downloadCapacity []int, rounds int, completed bool) []int {
+	received := make([]int, len(peers))
+	all := make([]Peer, len(peers))
+	for i, pe := range peers {
+		all[i] = pe
+	}
+	for r := 0; r < rounds; r++ {
+		u.TickUnchoke(append([]Peer(nil), all...), completed)
+		var unchoked int
+		for _, pe := range peers {
+			if !pe.choking {
+				unchoked++
+			}
+		}
+		for i, pe := range peers {
+			pe.downloadSpeed = uploadCapacity[i]
+			pe.uploadSpeed = 0
+			if pe.choking {
+				continue
+			}
+			n := 120 / unchoked
+			if n > downloadCapacity[i] {
+				n = downloadCapacity[i]
+			}
+			pe.uploadSpeed = n
+			received[i] += n
+		}
+	}
+	return received
+}
+
+func TestSimulateFreeloaders(t *testing.T) {
+	// First 4 peers upload to us, last 4 peers are freeloaders.
+	peers := make([]*TestPeer, 8)
+	for i := range peers {
+		peers[i] = &TestPeer{interested: true, choking: true}
+	}
+	uploadCapacity := []int{40, 30, 20, 10, 0, 0, 0, 0}
+	downloadCapacity := []int{100, 100, 100, 100, 100, 100, 100, 100}
+	received := simulate(New(3, 1), peers, uploadCapacity, downloadCapacity, 300, false)
+
+	var reciprocating, freeloading int
+	for i, n := range received {
+		if uploadCapacity[i] > 0 {
+			reciprocating += n
+		} else {
+			freeloading += n
+		}
+	}
+	t.Log("received:", received)
+	assert.True(t, reciprocating > 3*freeloading)
+	// Peers that upload fastest are unchoked regularly.
+	for i := 0; i < 3; i++ {
+		for j := 4; j < 8; j++ {
+			assert.True(t, received[i] > received[j])
+		}
+	}
+	// Freeloaders still get some data from optimistic unchokes.
+	assert.NotZero(t, freeloading)
+}
+
+func TestSimulateSeeding(t *testing.T) {
+	peers := make([]*TestPeer, 6)
+	for i := range peers {
+		peers[i] = &TestPeer{interested: true, choking: true}
+	}
+	// Nobody uploads to a seeder. Peers that can download faster are preferred.
+	uploadCapacity := make([]int, len(peers))
+	downloadCapacity := []int{5, 60, 10, 50, 40, 1}
+	received := simulate(New(3, 1), peers, uploadCapacity, downloadCapacity, 300, true)
+	t.Log("received:", received)
+	for _, fast := range []int{1, 3, 4} {
+		for _, slow := range []int{0, 2, 5} {
+			assert.True(t, received[fast] > received[slow])
+		}
+	}
+}
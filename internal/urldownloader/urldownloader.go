@@ -6,11 +6,14 @@ import (
 	"io"
 	"net/http"
 	"net/url"
+	"path/filepath"
+	"strings"
 	"sync/atomic"
 	"time"
 
 	"github.com/fichain/go-file/internal/bufferpool"
 	"github.com/fichain/go-file/internal/piece"
+	"github.com/fichain/go-file/internal/speedlimit"
 )
 
 // URLDownloader downloads files from a HTTP source.
@@ -71,7 +74,8 @@ func (d *URLDownloader) ReadCurrent() uint32 {
 }
 
 // Run the URLDownloader and download pieces.
-func (d *URLDownloader) Run(client *http.Client, pieces []piece.Piece, multifile bool, resultC chan interface{}, pool *bufferpool.Pool, readTimeout time.Duration) {
+// Reads from the response body are throttled by buckets.
+func (d *URLDownloader) Run(client *http.Client, pieces []piece.Piece, multifile bool, resultC chan interface{}, pool *bufferpool.Pool, readTimeout time.Duration, buckets speedlimit.Buckets) {
 	defer close(d.doneC)
 	ctx, cancel := context.WithCancel(context.Background())
 	go func() {
@@ -86,6 +90,7 @@ func (d *URLDownloader) Run(client *http.Client, pieces []piece.Piece, multifile
 
 	var n int // position in piece
 	buf := pool.Get(int(pieces[d.current].Length))
+	var finished bool // last piece is sent, buf must not be used anymore
 
 	processJob := func(job downloadJob) bool {
 		u := d.getURL(job.Filename, multifile)
@@ -119,11 +124,22 @@ func (d *URLDownloader) Run(client *http.Client, pieces []piece.Piece, multifile
 			}
 			n += o
 			m += int64(o)
+			if w := buckets.Take(int64(o)); w > 0 {
+				// Do not count the wait as read timeout.
+				timer.Stop()
+				select {
+				case <-time.After(w):
+				case <-d.closeC:
+					return false
+				}
+				timer.Reset(readTimeout)
+			}
 			if n == len(buf.Data) { // piece completed
 				index := d.current
 				done := d.current >= d.readEnd()-1
 				d.sendResult(resultC, &PieceResult{Downloader: d, Buffer: buf, Index: index, Done: done})
 				if done {
+					finished = true
 					return true
 				}
 				d.incrCurrent()
@@ -140,6 +156,10 @@ func (d *URLDownloader) Run(client *http.Client, pieces []piece.Piece, multifile
 			buf.Release()
 			break
 		}
+		// End may be moved back while downloading, so remaining jobs may not be needed.
+		if finished {
+			break
+		}
 	}
 }
 
@@ -177,7 +197,16 @@ func (d *URLDownloader) getURL(filename string, multifile bool) string {
 	if src[len(src)-1] != '/' {
 		src += "/"
 	}
-	return src + url.PathEscape(filename)
+	return src + escapePath(filename)
+}
+
+// escapePath escapes each element of the file path. Path separators are kept.
+func escapePath(name string) string {
+	parts := strings.Split(filepath.ToSlash(name), "/")
+	for i := range parts {
+		parts[i] = url.PathEscape(parts[i])
+	}
+	return strings.Join(parts, "/")
 }
 
 func (d *URLDownloader) sendResult(resultC chan interface{}, res *PieceResult) {
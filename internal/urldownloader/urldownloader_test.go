@@ -0,0 +1,16 @@
+package urldownloader
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetURL(t *testing.T) {
+	d := New("http://example.com/files", 0, 1)
+	assert.Equal(t, "http://example.com/files/name/dir%20a/file%231.bin", d.getURL(filepath.Join("name", "dir a", "file#1.bin"), true))
+	assert.Equal(t, "http://example.com/files", d.getURL("file.bin", false))
+	d = New("http://example.com/files/", 0, 1)
+	assert.Equal(t, "http://example.com/files/file%231.bin", d.getURL("file#1.bin", false))
+}